@@ -149,6 +149,9 @@ func IsValidateRole(role int) bool {
 	return role == RoleGuestUser || role == RoleCommonUser || role == RoleAdminUser || role == RoleRootUser
 }
 
+// TwoFactorRequiredRole 角色不低于该值的用户必须启用两步验证，为 0 时不强制
+var TwoFactorRequiredRole = RoleAdminUser
+
 var (
 	FileUploadPermission    = RoleGuestUser
 	FileDownloadPermission  = RoleGuestUser
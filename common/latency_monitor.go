@@ -10,13 +10,14 @@ import (
 type LatencyMetrics struct {
 	RequestStartTime    time.Time     // 请求开始时间
 	AuthCompleteTime    time.Time     // 认证完成时间
+	UpstreamStartTime   time.Time     // 开始请求上游的时间
 	UpstreamConnTime    time.Time     // 上游连接时间
 	FirstTokenTime      time.Time     // 首字响应时间
 	RequestCompleteTime time.Time     // 请求完成时间
 	
 	// 计算得出的延迟
 	AuthLatency         time.Duration // 认证延迟
-	ConnLatency         time.Duration // 连接延迟
+	ConnLatency         time.Duration // 连接延迟（请求上游到收到响应头）
 	FirstTokenLatency   time.Duration // 首字时延 (TTFT)
 	TotalLatency        time.Duration // 总延迟
 }
@@ -59,14 +60,28 @@ func RecordAuthComplete(requestID string) {
 	}
 }
 
-// RecordUpstreamConnect 记录上游连接时间
+// RecordUpstreamStart 记录开始请求上游的时间，重试时以最后一次为准
+func RecordUpstreamStart(requestID string) {
+	globalLatencyMonitor.mu.Lock()
+	defer globalLatencyMonitor.mu.Unlock()
+	
+	if metrics, exists := globalLatencyMonitor.metrics[requestID]; exists {
+		metrics.UpstreamStartTime = time.Now()
+	}
+}
+
+// RecordUpstreamConnect 记录上游连接时间（收到上游响应头）
 func RecordUpstreamConnect(requestID string) {
 	globalLatencyMonitor.mu.Lock()
 	defer globalLatencyMonitor.mu.Unlock()
 	
 	if metrics, exists := globalLatencyMonitor.metrics[requestID]; exists {
 		metrics.UpstreamConnTime = time.Now()
-		metrics.ConnLatency = metrics.UpstreamConnTime.Sub(metrics.AuthCompleteTime)
+		start := metrics.UpstreamStartTime
+		if start.IsZero() {
+			start = metrics.AuthCompleteTime
+		}
+		metrics.ConnLatency = metrics.UpstreamConnTime.Sub(start)
 	}
 }
 
@@ -0,0 +1,10 @@
+-- 累加异常行为可疑分数（集群共享）
+-- KEYS[1]: 每小时统计 hash
+-- ARGV[1]: 累加的分数
+-- ARGV[2]: 统计重置周期（秒）
+
+local score = redis.call('HINCRBY', KEYS[1], 'score', tonumber(ARGV[1]))
+if redis.call('TTL', KEYS[1]) == -1 then
+    redis.call('EXPIRE', KEYS[1], tonumber(ARGV[2]))
+end
+return score
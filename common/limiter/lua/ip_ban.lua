@@ -0,0 +1,51 @@
+-- IP 封禁（集群共享）
+-- KEYS[1]: 黑名单 hash，field 为 IP，value 为 JSON 记录
+-- ARGV[1]: IP
+-- ARGV[2]: 封禁原因
+-- ARGV[3]: 是否临时封禁 (1/0)
+-- ARGV[4]: 当前时间（秒）
+-- ARGV[5]: 临时封禁时长（秒）
+-- ARGV[6]: 永久封禁时长（秒）
+-- ARGV[7]: 转为永久封禁的违规次数
+
+local key = KEYS[1]
+local ip = ARGV[1]
+local reason = ARGV[2]
+local temporary = ARGV[3] == '1'
+local now = tonumber(ARGV[4])
+local tempDuration = tonumber(ARGV[5])
+local permanentDuration = tonumber(ARGV[6])
+local maxViolations = tonumber(ARGV[7])
+
+local expiresAt = now + permanentDuration
+if temporary then
+    expiresAt = now + tempDuration
+end
+
+local entry
+local raw = redis.call('HGET', key, ip)
+if raw then
+    -- 已存在则累加违规次数，违规过多转为永久封禁
+    entry = cjson.decode(raw)
+    entry.violation_count = (tonumber(entry.violation_count) or 0) + 1
+    entry.reason = reason
+    entry.blocked_at = now
+    entry.expires_at = expiresAt
+    if entry.violation_count >= maxViolations then
+        entry.is_temporary = false
+        entry.expires_at = now + permanentDuration
+    end
+else
+    entry = {
+        ip = ip,
+        reason = reason,
+        blocked_at = now,
+        expires_at = expiresAt,
+        violation_count = 1,
+        is_temporary = temporary
+    }
+end
+
+local encoded = cjson.encode(entry)
+redis.call('HSET', key, ip, encoded)
+return encoded
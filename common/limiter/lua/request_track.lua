@@ -0,0 +1,30 @@
+-- 异常行为检测请求统计（集群共享）
+-- KEYS[1]: 1 秒窗口内请求时间的 sorted set
+-- KEYS[2]: 每小时统计 hash (stream / large / score)，与 KEYS[1] 使用相同的 hash tag
+-- ARGV[1]: 当前时间（毫秒）
+-- ARGV[2]: 请求唯一标识
+-- ARGV[3]: 是否流式请求 (1/0)
+-- ARGV[4]: 是否超长 Prompt (1/0)
+-- ARGV[5]: 统计重置周期（秒）
+
+local now = tonumber(ARGV[1])
+
+redis.call('ZADD', KEYS[1], now, ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], 0, now - 1000)
+redis.call('PEXPIRE', KEYS[1], 2000)
+local count = redis.call('ZCARD', KEYS[1])
+
+redis.call('HINCRBY', KEYS[2], 'total', 1)
+if ARGV[3] == '1' then
+    redis.call('HINCRBY', KEYS[2], 'stream', 1)
+end
+if ARGV[4] == '1' then
+    redis.call('HINCRBY', KEYS[2], 'large', 1)
+end
+-- 统计 hash 没有过期时间时（新建或由其他命令创建）设置重置周期
+if redis.call('TTL', KEYS[2]) == -1 then
+    redis.call('EXPIRE', KEYS[2], tonumber(ARGV[5]))
+end
+
+local stats = redis.call('HMGET', KEYS[2], 'stream', 'large', 'score')
+return {count, tonumber(stats[1]) or 0, tonumber(stats[2]) or 0, tonumber(stats[3]) or 0}
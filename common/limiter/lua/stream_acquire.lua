@@ -0,0 +1,33 @@
+-- 并发流占用（集群共享）
+-- KEYS[1]: IP 的流连接 sorted set
+-- KEYS[2]: 用户的流连接 sorted set（无用户时与 KEYS[1] 相同），与 KEYS[1] 使用相同的 hash tag
+-- ARGV[1]: 当前时间（秒）
+-- ARGV[2]: 流最大持续时间（秒），超过后视为残留连接
+-- ARGV[3]: 每个 IP 最大并发流数量
+-- ARGV[4]: 每个用户最大并发流数量
+-- ARGV[5]: 连接 ID
+-- ARGV[6]: 是否有用户 (1/0)
+-- 返回 0 表示成功，1 表示超过 IP 限制，2 表示超过用户限制
+
+local now = tonumber(ARGV[1])
+local maxAge = tonumber(ARGV[2])
+local hasUser = ARGV[6] == '1'
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], 0, now - maxAge)
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+    return 1
+end
+if hasUser then
+    redis.call('ZREMRANGEBYSCORE', KEYS[2], 0, now - maxAge)
+    if redis.call('ZCARD', KEYS[2]) >= tonumber(ARGV[4]) then
+        return 2
+    end
+end
+
+redis.call('ZADD', KEYS[1], now, ARGV[5])
+redis.call('EXPIRE', KEYS[1], maxAge)
+if hasUser then
+    redis.call('ZADD', KEYS[2], now, ARGV[5])
+    redis.call('EXPIRE', KEYS[2], maxAge)
+end
+return 0
@@ -0,0 +1,29 @@
+package limiter
+
+import (
+	_ "embed"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 安全防护在集群间共享状态使用的脚本。脚本涉及多个 key 时，调用方需要为这些 key 使用相同的 hash tag，
+// 保证在 Redis Cluster 中落在同一个 slot
+
+//go:embed lua/ip_ban.lua
+var ipBanScript string
+
+//go:embed lua/request_track.lua
+var requestTrackScript string
+
+//go:embed lua/add_score.lua
+var addScoreScript string
+
+//go:embed lua/stream_acquire.lua
+var streamAcquireScript string
+
+var (
+	IPBanScript         = redis.NewScript(ipBanScript)
+	RequestTrackScript  = redis.NewScript(requestTrackScript)
+	AddScoreScript      = redis.NewScript(addScoreScript)
+	StreamAcquireScript = redis.NewScript(streamAcquireScript)
+)
@@ -0,0 +1,125 @@
+package common
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "tea"
+
+// relayMetricLabels 中继指标的公共标签
+var relayMetricLabels = []string{"channel_id", "channel_type", "model", "group"}
+
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	relayRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_requests_total",
+		Help:      "上游请求次数，每次重试单独计数",
+	}, relayMetricLabels)
+	relayErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_errors_total",
+		Help:      "上游请求失败次数",
+	}, append(relayMetricLabels, "error_code"))
+	relayRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_request_duration_seconds",
+		Help:      "上游请求总耗时，流式请求包含生成时间",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300},
+	}, relayMetricLabels)
+	relayFirstTokenDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_first_token_seconds",
+		Help:      "从收到请求到首次向客户端输出的耗时 (TTFT)",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 10, 20, 30, 60},
+	}, relayMetricLabels)
+	relayPromptTokensTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_prompt_tokens_total",
+		Help:      "计费的输入 token 数",
+	}, relayMetricLabels)
+	relayCompletionTokensTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_completion_tokens_total",
+		Help:      "计费的输出 token 数",
+	}, relayMetricLabels)
+	relayQuotaTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_quota_consumed_total",
+		Help:      "消耗的额度",
+	}, relayMetricLabels)
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		relayRequestsTotal,
+		relayErrorsTotal,
+		relayRequestDuration,
+		relayFirstTokenDuration,
+		relayPromptTokensTotal,
+		relayCompletionTokensTotal,
+		relayQuotaTotal,
+	)
+}
+
+// RegisterMetricsGauge 注册在抓取时读取当前值的仪表盘指标
+func RegisterMetricsGauge(name string, help string, value func() float64) {
+	metricsRegistry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      name,
+		Help:      help,
+	}, value))
+}
+
+// MetricsHandler 返回 Prometheus 文本格式的指标
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+func relayLabels(channelId int, channelType int, modelName string, group string) prometheus.Labels {
+	return prometheus.Labels{
+		"channel_id":   strconv.Itoa(channelId),
+		"channel_type": strconv.Itoa(channelType),
+		"model":        modelName,
+		"group":        group,
+	}
+}
+
+// RecordRelayAttemptMetrics 记录一次上游请求，errorCode 为空表示成功
+func RecordRelayAttemptMetrics(channelId int, channelType int, modelName string, group string, errorCode string, duration time.Duration) {
+	labels := relayLabels(channelId, channelType, modelName, group)
+	relayRequestsTotal.With(labels).Inc()
+	relayRequestDuration.With(labels).Observe(duration.Seconds())
+	if errorCode != "" {
+		labels["error_code"] = errorCode
+		relayErrorsTotal.With(labels).Inc()
+	}
+}
+
+// RecordFirstTokenMetrics 记录首字时延
+func RecordFirstTokenMetrics(channelId int, channelType int, modelName string, group string, latency time.Duration) {
+	relayFirstTokenDuration.With(relayLabels(channelId, channelType, modelName, group)).Observe(latency.Seconds())
+}
+
+// RecordConsumeMetrics 记录计费的 token 数与额度
+func RecordConsumeMetrics(channelId int, channelType int, modelName string, group string, promptTokens int, completionTokens int, quota int) {
+	labels := relayLabels(channelId, channelType, modelName, group)
+	if promptTokens > 0 {
+		relayPromptTokensTotal.With(labels).Add(float64(promptTokens))
+	}
+	if completionTokens > 0 {
+		relayCompletionTokensTotal.With(labels).Add(float64(completionTokens))
+	}
+	if quota > 0 {
+		relayQuotaTotal.With(labels).Add(float64(quota))
+	}
+}
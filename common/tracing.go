@@ -0,0 +1,119 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceIdKey 与 RequestIdKey 一样同时保存在 gin.Context 与 request context 中，用于日志关联
+const TraceIdKey = "trace_id"
+
+const tracerName = "tea-api"
+
+// TracingEnabled 为 false 时所有 span 均为空操作
+var TracingEnabled bool
+
+// InitTracing 初始化 OTLP 导出器，endpoint、headers、采样率等沿用 OTEL_* 标准环境变量
+func InitTracing(protocol string, serviceName string) (func(context.Context) error, error) {
+	var client otlptrace.Client
+	switch protocol {
+	case "grpc":
+		client = otlptracegrpc.NewClient()
+	case "http/protobuf", "":
+		client = otlptracehttp.NewClient()
+	default:
+		return nil, fmt.Errorf("unsupported otlp protocol: %s", protocol)
+	}
+	exporter, err := otlptrace.New(context.Background(), client)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	TracingEnabled = true
+	return provider.Shutdown, nil
+}
+
+// StartSpan 基于 ctx 中的 span 生成子 span
+func StartSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if !TracingEnabled {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// StartGinSpan 在请求上下文中生成子 span，之后的 span 都挂在它下面；
+// 返回的 end 可重复调用，结束 span 并恢复父上下文，请求被中断时标记为错误
+func StartGinSpan(c *gin.Context, name string, opts ...trace.SpanStartOption) (trace.Span, func()) {
+	if !TracingEnabled {
+		return trace.SpanFromContext(c.Request.Context()), func() {}
+	}
+	parent := c.Request.Context()
+	ctx, span := otel.Tracer(tracerName).Start(parent, name, opts...)
+	c.Request = c.Request.WithContext(ctx)
+	ended := false
+	return span, func() {
+		if ended {
+			return
+		}
+		ended = true
+		if c.IsAborted() {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(c.Writer.Status()))
+			span.SetStatus(codes.Error, http.StatusText(c.Writer.Status()))
+		}
+		span.End()
+		c.Request = c.Request.WithContext(parent)
+	}
+}
+
+// SetSpanError 记录错误并将 span 状态置为失败
+func SetSpanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// ExtractTraceContext 从请求头读取上游传入的 traceparent
+func ExtractTraceContext(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// InjectTraceHeaders 将当前 span 以 W3C traceparent 写入发往上游的请求头
+func InjectTraceHeaders(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// TraceIdFromContext 返回 ctx 中 span 的 trace id，没有有效 span 时返回空串
+func TraceIdFromContext(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
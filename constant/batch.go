@@ -0,0 +1,34 @@
+package constant
+
+const (
+	FileStorageTypeLocal = "local"
+	FileStorageTypeS3    = "s3"
+)
+
+const (
+	FilePurposeBatch       = "batch"
+	FilePurposeBatchOutput = "batch_output"
+)
+
+// 批处理任务状态，与 OpenAI Batch API 保持一致
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// BatchCompletionWindow 目前仅支持 24h
+const BatchCompletionWindow = "24h"
+
+// BatchEndpoints 批处理任务支持的接口
+var BatchEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+	"/v1/responses":        true,
+}
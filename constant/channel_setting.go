@@ -4,4 +4,12 @@ var (
 	ForceFormat                     = "force_format"        // ForceFormat 强制格式化为OpenAI格式
 	ChanelSettingProxy              = "proxy"               // Proxy 代理
 	ChannelSettingThinkingToContent = "thinking_to_content" // ThinkingToContent
+	// ChannelSettingAutoTestInterval 自动测试间隔（分钟），0 使用全局配置，小于 0 不参与自动测试
+	ChannelSettingAutoTestInterval = "auto_test_interval"
+	// ChannelSettingAutoTestLatencyThreshold 自动测试的响应时间阈值（秒），超过视为未通过，0 使用全局禁用阈值
+	ChannelSettingAutoTestLatencyThreshold = "auto_test_latency_threshold"
+	// ChannelSettingTestEndpoint 渠道测试请求的接口，例如 image、speech、rerank，为空时按渠道类型和测试模型自动选择
+	ChannelSettingTestEndpoint = "test_endpoint"
+	// ChannelSettingTestTaskId 测试 Midjourney、Suno 渠道时查询的任务 id，为空时使用渠道最近提交的任务
+	ChannelSettingTestTaskId = "test_task_id"
 )
@@ -7,4 +7,41 @@ const (
 	ContextKeyUserStatus       = "user_status"
 	ContextKeyUserEmail        = "user_email"
 	ContextKeyUserGroup        = "user_group"
+
+	ContextKeyChannelIsMultiKey    = "channel_is_multi_key"
+	ContextKeyChannelMultiKeyIndex = "channel_multi_key_index"
+
+	// 实际选中渠道所在的分组，以及请求经过的分组回退链
+	ContextKeyUsingGroup         = "using_group"
+	ContextKeyGroupFallbackChain = "group_fallback_chain"
+
+	// 发生模型回退时用户原始请求的模型
+	ContextKeyRequestedModel = "requested_model"
+
+	// 请求命中的正则过滤规则，格式为 规则组/规则名
+	ContextKeyRegexFilterRules = "regex_filter_rules"
+
+	// 批处理任务中的请求所属的批处理任务 ID
+	ContextKeyBatchId = "batch_id"
+
+	// 令牌设置了按日/周/月的额度上限，此时不能跳过预扣费
+	ContextKeyTokenWindowLimited = "token_window_limited"
+
+	// 令牌是否启用了响应缓存，以及请求是否命中响应缓存
+	ContextKeyTokenResponseCache = "token_response_cache"
+	ContextKeyResponseCacheHit   = "response_cache_hit"
+
+	// 令牌是否开启了请求/响应内容留存，以及本次请求是否被留存
+	ContextKeyTokenPayloadCapture = "token_payload_capture"
+	ContextKeyPayloadCaptured     = "payload_captured"
+
+	// 当前转发尝试的 RelayInfo，用于转发结束后读取首字时间等信息
+	ContextKeyRelayInfo = "relay_info"
+)
+
+const (
+	// HeaderServedModel 发生模型回退时返回给客户端的实际服务模型
+	HeaderServedModel = "X-Served-Model"
+	// HeaderCache 可缓存请求的响应缓存状态，HIT 或 MISS
+	HeaderCache = "X-Cache"
 )
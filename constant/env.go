@@ -18,6 +18,36 @@ var NotificationLimitDurationMinute int
 var GenerateDefaultToken bool
 var ErrorLogEnabled bool
 
+// Files 与 Batch API
+var FileStorageType string
+var FileStoragePath string
+var FileStorageS3Endpoint string
+var FileStorageS3Bucket string
+var FileStorageS3Region string
+var FileStorageS3AccessKeyId string
+var FileStorageS3SecretAccessKey string
+var FileStorageS3PathStyle bool
+var MaxFileUploadMB int
+var BatchConcurrency int
+var BatchMaxRunning int
+var BatchMaxRequests int
+var ResponsesStoreRetentionDays int
+
+// 响应缓存
+var ResponseCacheMaxEntries int
+var ResponseCacheMaxBodyKB int
+
+// Prometheus 指标
+var MetricsEnabled bool
+var MetricsToken string
+
+var OtelEnabled bool
+var OtelExporterProtocol string
+var OtelServiceName string
+
+var LatencyStatBucketSeconds int
+var LatencyStatRetentionDays int
+
 //var GeminiModelMap = map[string]string{
 //	"gemini-1.0-pro": "v1",
 //}
@@ -40,6 +70,35 @@ func InitEnv() {
 	// 是否启用错误日志
 	ErrorLogEnabled = common.GetEnvOrDefaultBool("ERROR_LOG_ENABLED", false)
 
+	// 文件存储，local 为本地磁盘，s3 为 S3 兼容的对象存储
+	FileStorageType = common.GetEnvOrDefaultString("FILE_STORAGE_TYPE", FileStorageTypeLocal)
+	FileStoragePath = common.GetEnvOrDefaultString("FILE_STORAGE_PATH", "./data/files")
+	FileStorageS3Endpoint = common.GetEnvOrDefaultString("FILE_STORAGE_S3_ENDPOINT", "")
+	FileStorageS3Bucket = common.GetEnvOrDefaultString("FILE_STORAGE_S3_BUCKET", "")
+	FileStorageS3Region = common.GetEnvOrDefaultString("FILE_STORAGE_S3_REGION", "us-east-1")
+	FileStorageS3AccessKeyId = common.GetEnvOrDefaultString("FILE_STORAGE_S3_ACCESS_KEY_ID", "")
+	FileStorageS3SecretAccessKey = common.GetEnvOrDefaultString("FILE_STORAGE_S3_SECRET_ACCESS_KEY", "")
+	FileStorageS3PathStyle = common.GetEnvOrDefaultBool("FILE_STORAGE_S3_PATH_STYLE", true)
+	MaxFileUploadMB = common.GetEnvOrDefault("MAX_FILE_UPLOAD_MB", 200)
+	// 单个批处理任务内并发执行的请求数，以及同时执行的批处理任务数
+	BatchConcurrency = common.GetEnvOrDefault("BATCH_CONCURRENCY", 4)
+	BatchMaxRunning = common.GetEnvOrDefault("BATCH_MAX_RUNNING", 2)
+	BatchMaxRequests = common.GetEnvOrDefault("BATCH_MAX_REQUESTS", 50000)
+	// 非 OpenAI 渠道 /v1/responses 保存的对话保留天数
+	ResponsesStoreRetentionDays = common.GetEnvOrDefault("RESPONSES_STORE_RETENTION_DAYS", 30)
+	// 未启用 Redis 时本地 LRU 缓存的最大条目数，以及单条缓存响应的大小上限
+	ResponseCacheMaxEntries = common.GetEnvOrDefault("RESPONSE_CACHE_MAX_ENTRIES", 1000)
+	ResponseCacheMaxBodyKB = common.GetEnvOrDefault("RESPONSE_CACHE_MAX_BODY_KB", 512)
+	// /metrics 端点，默认关闭；启用时必须设置 METRICS_TOKEN，抓取时需携带 Authorization: Bearer <token>
+	MetricsEnabled = common.GetEnvOrDefaultBool("METRICS_ENABLED", false)
+	MetricsToken = common.GetEnvOrDefaultString("METRICS_TOKEN", "")
+	// 导出地址等其余配置使用 OTEL_EXPORTER_OTLP_ENDPOINT 等标准环境变量
+	OtelEnabled = common.GetEnvOrDefaultBool("OTEL_ENABLED", false)
+	OtelExporterProtocol = common.GetEnvOrDefaultString("OTEL_EXPORTER_OTLP_PROTOCOL", "http/protobuf")
+	OtelServiceName = common.GetEnvOrDefaultString("OTEL_SERVICE_NAME", "tea-api")
+	LatencyStatBucketSeconds = common.GetEnvOrDefault("LATENCY_STAT_BUCKET_SECONDS", 300)
+	LatencyStatRetentionDays = common.GetEnvOrDefault("LATENCY_STAT_RETENTION_DAYS", 30)
+
 	//modelVersionMapStr := strings.TrimSpace(os.Getenv("GEMINI_MODEL_MAP"))
 	//if modelVersionMapStr == "" {
 	//	return
@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/dto"
+	"tea-api/model"
+	"tea-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// batchMaxMetadataPairs 与 OpenAI 保持一致，metadata 最多 16 个键值对
+const batchMaxMetadataPairs = 16
+
+func timestampPointer(timestamp int64) *int64 {
+	if timestamp == 0 {
+		return nil
+	}
+	return &timestamp
+}
+
+func stringPointer(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func batch2OpenAI(batch *model.Batch) dto.OpenAIBatch {
+	response := dto.OpenAIBatch{
+		Id:               batch.Id,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     stringPointer(batch.OutputFileId),
+		ErrorFileId:      stringPointer(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     timestampPointer(batch.InProgressAt),
+		ExpiresAt:        timestampPointer(batch.ExpiresAt),
+		FinalizingAt:     timestampPointer(batch.FinalizingAt),
+		CompletedAt:      timestampPointer(batch.CompletedAt),
+		FailedAt:         timestampPointer(batch.FailedAt),
+		ExpiredAt:        timestampPointer(batch.ExpiredAt),
+		CancellingAt:     timestampPointer(batch.CancellingAt),
+		CancelledAt:      timestampPointer(batch.CancelledAt),
+		RequestCounts: dto.BatchRequestCounts{
+			Total:     batch.RequestTotal,
+			Completed: batch.RequestCompleted,
+			Failed:    batch.RequestFailed,
+		},
+	}
+	if batch.Errors != "" {
+		var batchErrors dto.BatchErrors
+		if err := json.Unmarshal([]byte(batch.Errors), &batchErrors); err == nil {
+			response.Errors = &batchErrors
+		}
+	}
+	if batch.Metadata != "" {
+		_ = json.Unmarshal([]byte(batch.Metadata), &response.Metadata)
+	}
+	return response
+}
+
+func CreateBatch(c *gin.Context) {
+	var request dto.BatchRequest
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request", "Invalid request body: "+err.Error())
+		return
+	}
+	if !constant.BatchEndpoints[request.Endpoint] {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_endpoint", fmt.Sprintf("Unsupported endpoint '%s'.", request.Endpoint))
+		return
+	}
+	if request.CompletionWindow != constant.BatchCompletionWindow {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_completion_window", "Only the '24h' completion window is supported.")
+		return
+	}
+	if len(request.Metadata) > batchMaxMetadataPairs {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_metadata", fmt.Sprintf("Metadata can contain at most %d key-value pairs.", batchMaxMetadataPairs))
+		return
+	}
+	userId := c.GetInt("id")
+	inputFile, err := model.GetUserFileById(request.InputFileId, userId)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "file_not_found", fmt.Sprintf("No such File object: %s", request.InputFileId))
+		return
+	}
+	if inputFile.Purpose != constant.FilePurposeBatch {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_file", "The input file must be uploaded with purpose 'batch'.")
+		return
+	}
+
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		Id:               service.NewBatchId(),
+		UserId:           userId,
+		TokenId:          c.GetInt("token_id"),
+		ClientIp:         c.ClientIP(),
+		Endpoint:         request.Endpoint,
+		InputFileId:      inputFile.Id,
+		CompletionWindow: request.CompletionWindow,
+		Status:           constant.BatchStatusValidating,
+		CreatedAt:        now,
+		ExpiresAt:        now + 24*60*60,
+	}
+	if len(request.Metadata) > 0 {
+		metadata, _ := json.Marshal(request.Metadata)
+		batch.Metadata = string(metadata)
+	}
+	if err = batch.Insert(); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "batch_create_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, batch2OpenAI(batch))
+}
+
+func RetrieveBatch(c *gin.Context) {
+	batch, err := model.GetUserBatchById(c.Param("id"), c.GetInt("id"))
+	if err != nil {
+		openAIErrorResponse(c, http.StatusNotFound, "batch_not_found", fmt.Sprintf("No such Batch object: %s", c.Param("id")))
+		return
+	}
+	c.JSON(http.StatusOK, batch2OpenAI(batch))
+}
+
+func ListBatches(c *gin.Context) {
+	limit := parseListLimit(c, 20, 100)
+	batches, err := model.GetUserBatches(c.GetInt("id"), c.Query("after"), limit+1)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	data := make([]dto.OpenAIBatch, 0, len(batches))
+	for _, batch := range batches {
+		data = append(data, batch2OpenAI(batch))
+	}
+	response := dto.OpenAIList[dto.OpenAIBatch]{Object: "list", Data: data, HasMore: hasMore}
+	if len(data) > 0 {
+		response.FirstId = &data[0].Id
+		response.LastId = &data[len(data)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CancelBatch 尚未开始执行的任务直接取消，执行中的任务由后台任务停止分发剩余请求后取消
+func CancelBatch(c *gin.Context) {
+	userId := c.GetInt("id")
+	batch, err := model.GetUserBatchById(c.Param("id"), userId)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusNotFound, "batch_not_found", fmt.Sprintf("No such Batch object: %s", c.Param("id")))
+		return
+	}
+	now := common.GetTimestamp()
+	ok, err := model.UpdateBatchStatus(batch.Id, []string{constant.BatchStatusValidating}, constant.BatchStatusCancelled, map[string]interface{}{
+		"cancelling_at": now,
+		"cancelled_at":  now,
+	})
+	if err == nil && !ok {
+		ok, err = model.UpdateBatchStatus(batch.Id, []string{constant.BatchStatusInProgress}, constant.BatchStatusCancelling, map[string]interface{}{
+			"cancelling_at": now,
+		})
+	}
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "batch_cancel_failed", err.Error())
+		return
+	}
+	if !ok && batch.Status != constant.BatchStatusCancelling {
+		openAIErrorResponse(c, http.StatusConflict, "batch_not_cancellable", fmt.Sprintf("Cannot cancel a batch with status '%s'.", batch.Status))
+		return
+	}
+	batch, err = model.GetUserBatchById(batch.Id, userId)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "batch_cancel_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, batch2OpenAI(batch))
+}
@@ -0,0 +1,254 @@
+package controller
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/model"
+	"tea-api/service"
+	"tea-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// channelAutoTestState 渠道的自动测试调度状态，只保存在主节点内存中，重启后重新计数
+type channelAutoTestState struct {
+	ChannelId           int   `json:"channel_id"`
+	NextTestAt          int64 `json:"next_test_at"`
+	LastTestAt          int64 `json:"last_test_at"`
+	ConsecutivePasses   int   `json:"consecutive_passes"`
+	ConsecutiveFailures int   `json:"consecutive_failures"`
+	// 多密钥渠道各密钥的连续通过次数
+	KeyPasses map[int]int `json:"key_passes,omitempty"`
+}
+
+var channelAutoTestStates = make(map[int]*channelAutoTestState)
+var channelAutoTestStatesLock sync.Mutex
+var channelAutoTestOnce sync.Once
+
+// StartChannelAutoTest 启动内置的渠道自动测试调度，只应在主节点调用
+func StartChannelAutoTest() {
+	channelAutoTestOnce.Do(func() {
+		gopool.Go(channelAutoTestLoop)
+	})
+}
+
+func channelAutoTestLoop() {
+	ticker := time.NewTicker(time.Minute)
+	lastCleanup := time.Time{}
+	for now := range ticker.C {
+		setting := operation_setting.GetChannelAutoTestSetting()
+		if setting.HistoryRetentionDays > 0 && now.Sub(lastCleanup) > time.Hour {
+			lastCleanup = now
+			target := now.AddDate(0, 0, -setting.HistoryRetentionDays).Unix()
+			if count, err := model.DeleteOldChannelTestLogs(target); err != nil {
+				common.SysError("failed to delete old channel test logs: " + err.Error())
+			} else if count > 0 {
+				common.SysLog(fmt.Sprintf("deleted %d old channel test logs", count))
+			}
+		}
+		if !setting.Enabled {
+			continue
+		}
+		runDueChannelTests(now)
+	}
+}
+
+// channelAutoTestInterval 返回渠道的自动测试间隔，小于等于 0 表示不参与自动测试
+func channelAutoTestInterval(channel *model.Channel) time.Duration {
+	minutes := float64(operation_setting.GetChannelAutoTestSetting().IntervalMinutes)
+	if value, ok := channel.GetSetting()[constant.ChannelSettingAutoTestInterval].(float64); ok && value != 0 {
+		minutes = value
+	}
+	return time.Duration(minutes * float64(time.Minute))
+}
+
+// channelAutoTestThreshold 返回渠道自动测试的响应时间阈值（毫秒）
+func channelAutoTestThreshold(channel *model.Channel) int64 {
+	if value, ok := channel.GetSetting()[constant.ChannelSettingAutoTestLatencyThreshold].(float64); ok && value > 0 {
+		return int64(value * 1000)
+	}
+	return channelDisableThreshold()
+}
+
+func runDueChannelTests(now time.Time) {
+	channels, err := model.GetAllChannels(0, 0, true, false)
+	if err != nil {
+		common.SysError("failed to load channels for auto test: " + err.Error())
+		return
+	}
+	exists := make(map[int]bool, len(channels))
+	var due []*model.Channel
+	channelAutoTestStatesLock.Lock()
+	for _, channel := range channels {
+		interval := channelAutoTestInterval(channel)
+		if channel.Status == common.ChannelStatusManuallyDisabled || interval <= 0 {
+			continue
+		}
+		exists[channel.Id] = true
+		state, ok := channelAutoTestStates[channel.Id]
+		if !ok {
+			// 首次调度时在一个间隔内随机分散，避免所有渠道同时测试
+			state = &channelAutoTestState{
+				ChannelId:  channel.Id,
+				NextTestAt: now.Add(time.Duration(rand.Int63n(int64(interval)))).Unix(),
+			}
+			channelAutoTestStates[channel.Id] = state
+		}
+		if now.Unix() >= state.NextTestAt {
+			due = append(due, channel)
+		}
+	}
+	for channelId := range channelAutoTestStates {
+		if !exists[channelId] {
+			delete(channelAutoTestStates, channelId)
+		}
+	}
+	channelAutoTestStatesLock.Unlock()
+
+	for _, channel := range due {
+		autoTestChannel(channel)
+		time.Sleep(common.RequestInterval)
+	}
+}
+
+// autoTestChannel 测试单个渠道，按结果禁用渠道，或在连续通过足够次数后重新启用被自动禁用的渠道
+func autoTestChannel(channel *model.Channel) {
+	threshold := channelAutoTestThreshold(channel)
+	if channel.ChannelInfo.IsMultiKey {
+		// 多密钥渠道逐个密钥测试并记录，启用与禁用按密钥处理
+		passed, status := testMultiKeyChannel(channel, "", threshold, model.ChannelTestSourceAuto)
+		_, failures := updateChannelAutoTestState(channel.Id, passed)
+		scheduleNextChannelTest(channel, status, failures)
+		return
+	}
+
+	result := runChannelTest(channel, "", threshold)
+	passes, failures := updateChannelAutoTestState(channel.Id, result.err == nil)
+	status := channel.Status
+	action := ""
+	if status == common.ChannelStatusEnabled && result.shouldBan && channel.GetAutoBan() {
+		service.DisableChannel(channel.Id, channel.Name, result.err.Error())
+		action = model.ChannelTestActionDisabled
+		status = common.ChannelStatusAutoDisabled
+	} else if service.ShouldAutoEnableChannel(result.err, result.openaiErr, status, passes) {
+		service.EnableChannel(channel.Id, channel.Name)
+		action = model.ChannelTestActionEnabled
+		status = common.ChannelStatusEnabled
+	}
+	channel.UpdateResponseTime(result.milliseconds)
+
+	testLog := recordChannelTest(channel, -1, model.ChannelTestSourceAuto, result, channel.Status, status, action)
+	testLog.ConsecutivePasses = passes
+	testLog.ConsecutiveFailures = failures
+	model.RecordChannelTestLog(testLog)
+	scheduleNextChannelTest(channel, status, failures)
+}
+
+// updateChannelAutoTestState 更新连续通过/失败次数
+func updateChannelAutoTestState(channelId int, passed bool) (passes int, failures int) {
+	channelAutoTestStatesLock.Lock()
+	defer channelAutoTestStatesLock.Unlock()
+	state, ok := channelAutoTestStates[channelId]
+	if !ok {
+		state = &channelAutoTestState{ChannelId: channelId}
+		channelAutoTestStates[channelId] = state
+	}
+	if passed {
+		state.ConsecutivePasses++
+		state.ConsecutiveFailures = 0
+	} else {
+		state.ConsecutiveFailures++
+		state.ConsecutivePasses = 0
+	}
+	state.LastTestAt = time.Now().Unix()
+	return state.ConsecutivePasses, state.ConsecutiveFailures
+}
+
+// updateChannelKeyAutoTestPasses 更新多密钥渠道中单个密钥的连续通过次数
+func updateChannelKeyAutoTestPasses(channelId int, keyIndex int, passed bool) int {
+	channelAutoTestStatesLock.Lock()
+	defer channelAutoTestStatesLock.Unlock()
+	state, ok := channelAutoTestStates[channelId]
+	if !ok {
+		state = &channelAutoTestState{ChannelId: channelId}
+		channelAutoTestStates[channelId] = state
+	}
+	if state.KeyPasses == nil {
+		state.KeyPasses = make(map[int]int)
+	}
+	if passed {
+		state.KeyPasses[keyIndex]++
+	} else {
+		state.KeyPasses[keyIndex] = 0
+	}
+	return state.KeyPasses[keyIndex]
+}
+
+func scheduleNextChannelTest(channel *model.Channel, status int, failures int) {
+	delay := service.ChannelAutoTestDelay(channelAutoTestInterval(channel), status, failures)
+	channelAutoTestStatesLock.Lock()
+	defer channelAutoTestStatesLock.Unlock()
+	if state, ok := channelAutoTestStates[channel.Id]; ok {
+		state.NextTestAt = time.Now().Add(delay).Unix()
+	}
+}
+
+// GetChannelAutoTestStatus 查看自动测试的配置与各渠道的调度状态
+func GetChannelAutoTestStatus(c *gin.Context) {
+	channelAutoTestStatesLock.Lock()
+	states := make([]channelAutoTestState, 0, len(channelAutoTestStates))
+	for _, state := range channelAutoTestStates {
+		states = append(states, *state)
+	}
+	channelAutoTestStatesLock.Unlock()
+	sort.Slice(states, func(i, j int) bool { return states[i].ChannelId < states[j].ChannelId })
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"setting":  operation_setting.GetChannelAutoTestSetting(),
+			"channels": states,
+		},
+	})
+}
+
+// GetChannelTestLogs 分页查询渠道测试记录
+func GetChannelTestLogs(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	onlyFailed := c.Query("failed") == "true"
+	logs, total, err := model.GetChannelTestLogs(channelId, onlyFailed, (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": map[string]any{
+			"items":     logs,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
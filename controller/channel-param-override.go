@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+
+	"tea-api/dto"
+	"tea-api/middleware"
+	"tea-api/model"
+	"tea-api/relay"
+	"tea-api/relay/channel"
+	relaycommon "tea-api/relay/common"
+	relayconstant "tea-api/relay/constant"
+	"tea-api/relay/helper"
+
+	"github.com/gin-gonic/gin"
+)
+
+type paramOverridePreviewRequest struct {
+	// 未保存的参数覆盖配置，为空时使用渠道当前的配置
+	ParamOverride *string `json:"param_override"`
+	// 示例请求的接口路径，默认 /v1/chat/completions
+	Path    string          `json:"path"`
+	Request json.RawMessage `json:"request"`
+}
+
+type paramOverridePreview struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// paramOverridePreviewSecretHeaders 预览时隐藏的鉴权请求头
+var paramOverridePreviewSecretHeaders = []string{"Authorization", "Api-Key", "X-Api-Key", "X-Goog-Api-Key", "Mj-Api-Secret"}
+
+// PreviewChannelParamOverride 按渠道的请求转换与参数覆盖规则生成示例请求的上游地址、请求头和请求体，不会请求上游
+func PreviewChannelParamOverride(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var req paramOverridePreviewRequest
+	if err = c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if req.ParamOverride != nil {
+		if err = relaycommon.CheckParamOverride(*req.ParamOverride); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		channel.ParamOverride = req.ParamOverride
+	}
+	preview, err := buildParamOverridePreview(channel, req.Path, req.Request)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    preview,
+	})
+}
+
+func buildParamOverridePreview(channel *model.Channel, path string, body []byte) (*paramOverridePreview, error) {
+	if path == "" {
+		path = "/v1/chat/completions"
+	}
+	if len(body) == 0 {
+		return nil, errors.New("示例请求不能为空")
+	}
+	var sample struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &sample); err != nil {
+		return nil, err
+	}
+	if sample.Model == "" {
+		sample.Model = getChannelTestModel(channel)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = &http.Request{
+		Method: "POST",
+		URL:    &url.URL{Path: path},
+		Body:   io.NopCloser(bytes.NewReader(body)),
+		Header: make(http.Header),
+	}
+	c.Request.Header.Set("Content-Type", "application/json")
+	middleware.SetupContextForSelectedChannel(c, channel, sample.Model)
+
+	apiType, _ := relayconstant.ChannelType2APIType(channel.Type)
+	adaptor := relay.GetAdaptor(apiType)
+	if adaptor == nil {
+		return nil, errors.New("渠道类型不支持")
+	}
+
+	var info *relaycommon.RelayInfo
+	var convertedRequest any
+	var requestData []byte
+	var err error
+	relayMode := relayconstant.Path2RelayMode(path)
+	switch {
+	case path == "/v1/messages":
+		request := &dto.ClaudeRequest{}
+		if err = json.Unmarshal(body, request); err != nil {
+			return nil, err
+		}
+		info = relaycommon.GenRelayInfoClaude(c)
+		if err = mapParamOverridePreviewModel(c, info, adaptor, &request.Model); err != nil {
+			return nil, err
+		}
+		convertedRequest, err = adaptor.ConvertClaudeRequest(c, info, request)
+	case relayMode == relayconstant.RelayModeChatCompletions || relayMode == relayconstant.RelayModeCompletions:
+		request := &dto.GeneralOpenAIRequest{}
+		if err = json.Unmarshal(body, request); err != nil {
+			return nil, err
+		}
+		info = relaycommon.GenRelayInfo(c)
+		info.IsStream = request.Stream
+		if err = mapParamOverridePreviewModel(c, info, adaptor, &request.Model); err != nil {
+			return nil, err
+		}
+		convertedRequest, err = adaptor.ConvertOpenAIRequest(c, info, request)
+	case relayMode == relayconstant.RelayModeEmbeddings:
+		request := dto.EmbeddingRequest{}
+		if err = json.Unmarshal(body, &request); err != nil {
+			return nil, err
+		}
+		info = relaycommon.GenRelayInfo(c)
+		if err = mapParamOverridePreviewModel(c, info, adaptor, &request.Model); err != nil {
+			return nil, err
+		}
+		convertedRequest, err = adaptor.ConvertEmbeddingRequest(c, info, request)
+	case relayMode == relayconstant.RelayModeImagesGenerations:
+		request := dto.ImageRequest{}
+		if err = json.Unmarshal(body, &request); err != nil {
+			return nil, err
+		}
+		info = relaycommon.GenRelayInfo(c)
+		if err = mapParamOverridePreviewModel(c, info, adaptor, &request.Model); err != nil {
+			return nil, err
+		}
+		convertedRequest, err = adaptor.ConvertImageRequest(c, info, request)
+	case relayMode == relayconstant.RelayModeAudioSpeech:
+		request := dto.AudioRequest{}
+		if err = json.Unmarshal(body, &request); err != nil {
+			return nil, err
+		}
+		info = relaycommon.GenRelayInfo(c)
+		if err = mapParamOverridePreviewModel(c, info, adaptor, &request.Model); err != nil {
+			return nil, err
+		}
+		var reader io.Reader
+		if reader, err = adaptor.ConvertAudioRequest(c, info, request); err == nil {
+			requestData, err = io.ReadAll(reader)
+		}
+	case relayMode == relayconstant.RelayModeRerank:
+		request := &dto.RerankRequest{}
+		if err = json.Unmarshal(body, request); err != nil {
+			return nil, err
+		}
+		info = relaycommon.GenRelayInfoRerank(c, request)
+		if err = mapParamOverridePreviewModel(c, info, adaptor, &request.Model); err != nil {
+			return nil, err
+		}
+		convertedRequest, err = adaptor.ConvertRerankRequest(c, info.RelayMode, *request)
+	case relayMode == relayconstant.RelayModeResponses:
+		request := &dto.OpenAIResponsesRequest{}
+		if err = json.Unmarshal(body, request); err != nil {
+			return nil, err
+		}
+		info = relaycommon.GenRelayInfoResponses(c, request)
+		if err = mapParamOverridePreviewModel(c, info, adaptor, &request.Model); err != nil {
+			return nil, err
+		}
+		convertedRequest, err = adaptor.ConvertOpenAIResponsesRequest(c, info, *request)
+	default:
+		return nil, errors.New("不支持预览该接口: " + path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if requestData == nil {
+		if requestData, err = json.Marshal(convertedRequest); err != nil {
+			return nil, err
+		}
+	}
+	if requestData, err = info.ApplyParamOverride(requestData); err != nil {
+		return nil, err
+	}
+
+	requestURL, err := adaptor.GetRequestURL(info)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	if err = adaptor.SetupRequestHeader(c, &header, info); err != nil {
+		return nil, err
+	}
+	info.ApplyHeaderOverride(header)
+	for _, name := range paramOverridePreviewSecretHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, "***")
+		}
+	}
+	headers := make(map[string]string, len(header))
+	for name := range header {
+		headers[name] = header.Get(name)
+	}
+	return &paramOverridePreview{
+		URL:     requestURL,
+		Headers: headers,
+		Body:    requestData,
+	}, nil
+}
+
+// mapParamOverridePreviewModel 与实际转发一致地应用模型映射并初始化适配器
+func mapParamOverridePreviewModel(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, modelName *string) error {
+	if err := helper.ModelMappedHelper(c, info); err != nil {
+		return err
+	}
+	*modelName = info.UpstreamModelName
+	adaptor.Init(info)
+	return nil
+}
@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/dto"
+	"tea-api/model"
+	"tea-api/relay/channel"
+	relaycommon "tea-api/relay/common"
+	"tea-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// channelTestRequestPaths 各测试接口对应的请求路径，决定 RelayMode
+var channelTestRequestPaths = map[string]string{
+	service.ChannelTestEndpointChat:          "/v1/chat/completions",
+	service.ChannelTestEndpointEmbeddings:    "/v1/embeddings",
+	service.ChannelTestEndpointImage:         "/v1/images/generations",
+	service.ChannelTestEndpointSpeech:        "/v1/audio/speech",
+	service.ChannelTestEndpointTranscription: "/v1/audio/transcriptions",
+	service.ChannelTestEndpointRerank:        "/v1/rerank",
+	service.ChannelTestEndpointResponses:     "/v1/responses",
+}
+
+var channelTestRerankDocuments = []any{"Deep learning is a subset of machine learning.", "The weather is nice today."}
+
+// getChannelTestEndpoint 返回渠道测试请求的接口，可通过渠道设置 test_endpoint 指定
+func getChannelTestEndpoint(channel *model.Channel, testModel string) string {
+	configured, _ := channel.GetSetting()[constant.ChannelSettingTestEndpoint].(string)
+	return service.GetChannelTestEndpoint(channel.Type, testModel, configured)
+}
+
+// genChannelTestRelayInfo 按测试接口生成 RelayInfo，重排序和 Responses 接口需要额外的信息
+func genChannelTestRelayInfo(c *gin.Context, endpoint string) *relaycommon.RelayInfo {
+	switch endpoint {
+	case service.ChannelTestEndpointRerank:
+		return relaycommon.GenRelayInfoRerank(c, &dto.RerankRequest{Documents: channelTestRerankDocuments})
+	case service.ChannelTestEndpointResponses:
+		return relaycommon.GenRelayInfoResponses(c, &dto.OpenAIResponsesRequest{})
+	}
+	return relaycommon.GenRelayInfo(c)
+}
+
+// convertChannelTestRequest 构造测试请求并通过适配器转换为上游请求体
+func convertChannelTestRequest(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, endpoint string, testModel string) (io.Reader, error) {
+	var convertedRequest any
+	var err error
+	switch endpoint {
+	case service.ChannelTestEndpointImage:
+		request := dto.ImageRequest{
+			Model:  testModel,
+			Prompt: "a white cat",
+			N:      1,
+		}
+		if strings.HasPrefix(testModel, "dall-e-2") {
+			request.Size = "256x256"
+		}
+		convertedRequest, err = adaptor.ConvertImageRequest(c, info, request)
+	case service.ChannelTestEndpointSpeech:
+		return adaptor.ConvertAudioRequest(c, info, dto.AudioRequest{
+			Model: testModel,
+			Input: "hi",
+			Voice: "alloy",
+		})
+	case service.ChannelTestEndpointTranscription:
+		if err = setupChannelTestAudioForm(c, testModel); err != nil {
+			return nil, err
+		}
+		return adaptor.ConvertAudioRequest(c, info, dto.AudioRequest{
+			Model:          testModel,
+			ResponseFormat: "json",
+		})
+	case service.ChannelTestEndpointRerank:
+		convertedRequest, err = adaptor.ConvertRerankRequest(c, info.RelayMode, dto.RerankRequest{
+			Model:     testModel,
+			Query:     "What is deep learning?",
+			Documents: channelTestRerankDocuments,
+			TopN:      len(channelTestRerankDocuments),
+		})
+	case service.ChannelTestEndpointResponses:
+		input, _ := json.Marshal("hi")
+		convertedRequest, err = adaptor.ConvertOpenAIResponsesRequest(c, info, dto.OpenAIResponsesRequest{
+			Model:           testModel,
+			Input:           input,
+			MaxOutputTokens: 16,
+		})
+	default:
+		convertedRequest, err = adaptor.ConvertOpenAIRequest(c, info, buildTestRequest(testModel))
+	}
+	if err != nil {
+		return nil, err
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewBuffer(jsonData), nil
+}
+
+// setupChannelTestAudioForm 将测试音频作为 multipart 表单写入请求，供转写接口的适配器读取
+func setupChannelTestAudioForm(c *gin.Context, testModel string) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("model", testModel)
+	_ = writer.WriteField("response_format", "json")
+	part, err := writer.CreateFormFile("file", "test.wav")
+	if err != nil {
+		return err
+	}
+	if _, err = part.Write(channelTestAudioSample()); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	c.Request.Body = io.NopCloser(bytes.NewReader(body.Bytes()))
+	c.Set(common.KeyRequestBody, body.Bytes())
+	return c.Request.ParseMultipartForm(1 << 20)
+}
+
+// channelTestAudioSample 生成测试用的音频：1 秒 440Hz 正弦波，16kHz 16bit 单声道 WAV
+func channelTestAudioSample() []byte {
+	const sampleRate = 16000
+	const samples = sampleRate
+	dataSize := samples * 2
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(16))           // fmt chunk 大小
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(1))            // PCM
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(1))            // 声道数
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))   // 采样率
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*2)) // 字节率
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(2))            // 块对齐
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(16))           // 位深
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	for i := 0; i < samples; i++ {
+		value := int16(math.Sin(2*math.Pi*440*float64(i)/sampleRate) * 8000)
+		_ = binary.Write(&buf, binary.LittleEndian, value)
+	}
+	return buf.Bytes()
+}
+
+// getChannelTestTaskId 返回测试任务类渠道时查询的已知任务，优先使用渠道设置 test_task_id
+func getChannelTestTaskId(channel *model.Channel) string {
+	if taskId, ok := channel.GetSetting()[constant.ChannelSettingTestTaskId].(string); ok && taskId != "" {
+		return taskId
+	}
+	if channel.Type == common.ChannelTypeSunoAPI {
+		return model.GetLatestTaskIdByChannelId(channel.Id, constant.TaskPlatformSuno)
+	}
+	return model.GetLatestMjIdByChannelId(channel.Id)
+}
+
+// doChannelTestTaskRequest 请求任务查询接口，非 200 的响应转换为 OpenAI 格式的错误，以便判断是否需要禁用渠道
+func doChannelTestTaskRequest(channel *model.Channel, method string, requestUrl string, body any) (error, *dto.OpenAIErrorWithStatusCode) {
+	var requestBody io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return err, nil
+		}
+		requestBody = bytes.NewBuffer(jsonData)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, requestUrl, requestBody)
+	if err != nil {
+		return err, nil
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// 多密钥渠道的 Key 为全部密钥，与转发时一样选取其中一个启用的密钥
+	key := channel.GetDefaultKey()
+	if channel.Type == common.ChannelTypeSunoAPI {
+		req.Header.Set("Authorization", "Bearer "+key)
+	} else {
+		req.Header.Set("mj-api-secret", key)
+	}
+	resp, err := service.GetHttpClient().Do(req)
+	if err != nil {
+		return err, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		openaiErr := service.RelayErrorHandler(resp, true)
+		return fmt.Errorf("status code %d: %s", resp.StatusCode, openaiErr.Error.Message), openaiErr
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err, nil
+	}
+	if channel.Type == common.ChannelTypeSunoAPI {
+		var sunoResponse dto.TaskResponse[[]dto.SunoDataResponse]
+		if err = json.Unmarshal(respBody, &sunoResponse); err != nil {
+			return fmt.Errorf("invalid response: %s", string(respBody)), nil
+		}
+		if !sunoResponse.IsSuccess() {
+			return fmt.Errorf("fetch task failed: %s", sunoResponse.Message), nil
+		}
+	} else if !json.Valid(respBody) {
+		return fmt.Errorf("invalid response: %s", string(respBody)), nil
+	}
+	common.SysLog(fmt.Sprintf("testing channel #%d, response: \n%s", channel.Id, string(respBody)))
+	return nil, nil
+}
+
+// testMidjourneyChannel 通过查询任务接口测试 Midjourney 渠道：有已知任务时查询该任务，否则按空条件查询任务列表
+func testMidjourneyChannel(channel *model.Channel) (error, *dto.OpenAIErrorWithStatusCode) {
+	baseUrl := channel.GetBaseURL()
+	if taskId := getChannelTestTaskId(channel); taskId != "" {
+		return doChannelTestTaskRequest(channel, http.MethodGet, fmt.Sprintf("%s/mj/task/%s/fetch", baseUrl, taskId), nil)
+	}
+	return doChannelTestTaskRequest(channel, http.MethodPost, fmt.Sprintf("%s/mj/task/list-by-condition", baseUrl), map[string]any{
+		"ids": []string{},
+	})
+}
+
+// testSunoChannel 通过 fetch 接口测试 Suno 渠道，有已知任务时查询该任务
+func testSunoChannel(channel *model.Channel) (error, *dto.OpenAIErrorWithStatusCode) {
+	ids := []string{}
+	if taskId := getChannelTestTaskId(channel); taskId != "" {
+		ids = append(ids, taskId)
+	}
+	return doChannelTestTaskRequest(channel, http.MethodPost, fmt.Sprintf("%s/suno/fetch", channel.GetBaseURL()), map[string]any{
+		"ids": ids,
+	})
+}
@@ -1,7 +1,6 @@
 package controller
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,7 +14,6 @@ import (
 	"tea-api/middleware"
 	"tea-api/model"
 	"tea-api/relay"
-	relaycommon "tea-api/relay/common"
 	"tea-api/relay/constant"
 	"tea-api/relay/helper"
 	"tea-api/service"
@@ -31,48 +29,27 @@ import (
 
 func testChannel(channel *model.Channel, testModel string) (err error, openAIErrorWithStatusCode *dto.OpenAIErrorWithStatusCode) {
 	tik := time.Now()
-	if channel.Type == common.ChannelTypeMidjourney {
-		return errors.New("midjourney channel test is not supported"), nil
-	}
-	if channel.Type == common.ChannelTypeMidjourneyPlus {
-		return errors.New("midjourney plus channel test is not supported!!!"), nil
+	if testModel == "" {
+		testModel = getChannelTestModel(channel)
 	}
-	if channel.Type == common.ChannelTypeSunoAPI {
-		return errors.New("suno channel test is not supported"), nil
+	// 按渠道的能力选择测试接口，任务类渠道只查询任务状态
+	endpoint := getChannelTestEndpoint(channel, testModel)
+	switch endpoint {
+	case service.ChannelTestEndpointMidjourney:
+		return testMidjourneyChannel(channel)
+	case service.ChannelTestEndpointSuno:
+		return testSunoChannel(channel)
 	}
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 
-	requestPath := "/v1/chat/completions"
-
-	// 先判断是否为 Embedding 模型
-	if strings.Contains(strings.ToLower(testModel), "embedding") ||
-		strings.HasPrefix(testModel, "m3e") || // m3e 系列模型
-		strings.Contains(testModel, "bge-") || // bge 系列模型
-		strings.Contains(testModel, "embed") ||
-		channel.Type == common.ChannelTypeMokaAI { // 其他 embedding 模型
-		requestPath = "/v1/embeddings" // 修改请求路径
-	}
-
 	c.Request = &http.Request{
 		Method: "POST",
-		URL:    &url.URL{Path: requestPath}, // 使用动态路径
+		URL:    &url.URL{Path: channelTestRequestPaths[endpoint]}, // 请求路径决定 RelayMode
 		Body:   nil,
 		Header: make(http.Header),
 	}
 
-	if testModel == "" {
-		if channel.TestModel != nil && *channel.TestModel != "" {
-			testModel = *channel.TestModel
-		} else {
-			if len(channel.GetModels()) > 0 {
-				testModel = channel.GetModels()[0]
-			} else {
-				testModel = "gpt-4o-mini"
-			}
-		}
-	}
-
 	cache, err := model.GetUserCache(1)
 	if err != nil {
 		return err, nil
@@ -88,7 +65,7 @@ func testChannel(channel *model.Channel, testModel string) (err error, openAIErr
 
 	middleware.SetupContextForSelectedChannel(c, channel, testModel)
 
-	info := relaycommon.GenRelayInfo(c)
+	info := genChannelTestRelayInfo(c, endpoint)
 
 	err = helper.ModelMappedHelper(c, info)
 	if err != nil {
@@ -106,7 +83,7 @@ func testChannel(channel *model.Channel, testModel string) (err error, openAIErr
 	// 创建一个用于日志的 info 副本，移除 ApiKey
 	logInfo := *info
 	logInfo.ApiKey = ""
-	common.SysLog(fmt.Sprintf("testing channel %d with model %s , info %+v ", channel.Id, testModel, logInfo))
+	common.SysLog(fmt.Sprintf("testing channel %d with model %s on %s, info %+v ", channel.Id, testModel, endpoint, logInfo))
 
 	priceData, err := helper.ModelPriceHelper(c, info, 0, int(request.MaxTokens))
 	if err != nil {
@@ -115,16 +92,13 @@ func testChannel(channel *model.Channel, testModel string) (err error, openAIErr
 
 	adaptor.Init(info)
 
-	convertedRequest, err := adaptor.ConvertOpenAIRequest(c, info, request)
+	requestBody, err := convertChannelTestRequest(c, info, adaptor, endpoint, testModel)
 	if err != nil {
 		return err, nil
 	}
-	jsonData, err := json.Marshal(convertedRequest)
-	if err != nil {
-		return err, nil
+	if endpoint != service.ChannelTestEndpointTranscription {
+		c.Request.Body = io.NopCloser(requestBody)
 	}
-	requestBody := bytes.NewBuffer(jsonData)
-	c.Request.Body = io.NopCloser(requestBody)
 	resp, err := adaptor.DoRequest(c, info, requestBody)
 	if err != nil {
 		return err, nil
@@ -144,7 +118,10 @@ func testChannel(channel *model.Channel, testModel string) (err error, openAIErr
 	if usageA == nil {
 		return errors.New("usage is nil"), nil
 	}
-	usage := usageA.(*dto.Usage)
+	usage, ok := usageA.(*dto.Usage)
+	if !ok {
+		return fmt.Errorf("unexpected usage type %T", usageA), nil
+	}
 	result := w.Result()
 	respBody, err := io.ReadAll(result.Body)
 	if err != nil {
@@ -173,6 +150,82 @@ func testChannel(channel *model.Channel, testModel string) (err error, openAIErr
 	return nil, nil
 }
 
+// getChannelTestModel 返回渠道未指定测试模型时使用的模型
+func getChannelTestModel(channel *model.Channel) string {
+	if channel.TestModel != nil && *channel.TestModel != "" {
+		return *channel.TestModel
+	}
+	if len(channel.GetModels()) > 0 {
+		return channel.GetModels()[0]
+	}
+	return "gpt-4o-mini"
+}
+
+// channelTestResult 一次渠道测试的结果
+type channelTestResult struct {
+	modelName    string
+	milliseconds int64
+	err          error
+	openaiErr    *dto.OpenAIErrorWithStatusCode
+	shouldBan    bool
+}
+
+// runChannelTest 测试渠道并判断是否应当禁用，响应时间超过 disableThreshold（毫秒）同样视为失败
+func runChannelTest(channel *model.Channel, testModel string, disableThreshold int64) channelTestResult {
+	if testModel == "" {
+		testModel = getChannelTestModel(channel)
+	}
+	tik := time.Now()
+	err, openaiWithStatusErr := testChannel(channel, testModel)
+	result := channelTestResult{
+		modelName:    testModel,
+		milliseconds: time.Since(tik).Milliseconds(),
+		err:          err,
+		openaiErr:    openaiWithStatusErr,
+	}
+	// request error disables the channel
+	if openaiWithStatusErr != nil {
+		oaiErr := openaiWithStatusErr.Error
+		result.err = errors.New(fmt.Sprintf("type %s, httpCode %d, code %v, message %s", oaiErr.Type, openaiWithStatusErr.StatusCode, oaiErr.Code, oaiErr.Message))
+		result.shouldBan = service.ShouldDisableChannel(channel.Type, openaiWithStatusErr)
+	}
+	if result.milliseconds > disableThreshold {
+		result.err = errors.New(fmt.Sprintf("响应时间 %.2fs 超过阈值 %.2fs", float64(result.milliseconds)/1000.0, float64(disableThreshold)/1000.0))
+		result.shouldBan = true
+	}
+	return result
+}
+
+// recordChannelTest 保存测试记录，keyIndex 为 -1 表示整个渠道，statusAfter 为根据测试结果处理后的状态
+func recordChannelTest(channel *model.Channel, keyIndex int, source string, result channelTestResult, statusBefore int, statusAfter int, action string) *model.ChannelTestLog {
+	log := &model.ChannelTestLog{
+		ChannelId:    channel.Id,
+		KeyIndex:     keyIndex,
+		Source:       source,
+		ModelName:    result.modelName,
+		Success:      result.err == nil,
+		ResponseTime: result.milliseconds,
+		StatusBefore: statusBefore,
+		StatusAfter:  statusAfter,
+		Action:       action,
+	}
+	if result.err != nil {
+		log.Message = result.err.Error()
+	}
+	if result.openaiErr != nil {
+		log.StatusCode = result.openaiErr.StatusCode
+	}
+	return log
+}
+
+func channelDisableThreshold() int64 {
+	var disableThreshold = int64(common.ChannelDisableThreshold * 1000)
+	if disableThreshold == 0 {
+		disableThreshold = 10000000 // a impossible value
+	}
+	return disableThreshold
+}
+
 func buildTestRequest(model string) *dto.GeneralOpenAIRequest {
 	testRequest := &dto.GeneralOpenAIRequest{
 		Model:  "", // this will be set later
@@ -229,10 +282,19 @@ func TestChannel(c *gin.Context) {
 	}
 	testModel := c.Query("model")
 	tik := time.Now()
-	err, _ = testChannel(channel, testModel)
+	err, openaiWithStatusErr := testChannel(channel, testModel)
 	tok := time.Now()
 	milliseconds := tok.Sub(tik).Milliseconds()
 	go channel.UpdateResponseTime(milliseconds)
+	if testModel == "" {
+		testModel = getChannelTestModel(channel)
+	}
+	go model.RecordChannelTestLog(recordChannelTest(channel, -1, model.ChannelTestSourceManual, channelTestResult{
+		modelName:    testModel,
+		milliseconds: milliseconds,
+		err:          err,
+		openaiErr:    openaiWithStatusErr,
+	}, channel.Status, channel.Status, ""))
 	consumedTime := float64(milliseconds) / 1000.0
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -266,43 +328,34 @@ func testAllChannels(notify bool) error {
 	if err != nil {
 		return err
 	}
-	var disableThreshold = int64(common.ChannelDisableThreshold * 1000)
-	if disableThreshold == 0 {
-		disableThreshold = 10000000 // a impossible value
-	}
+	disableThreshold := channelDisableThreshold()
 	gopool.Go(func() {
 		for _, channel := range channels {
-			isChannelEnabled := channel.Status == common.ChannelStatusEnabled
-			tik := time.Now()
-			err, openaiWithStatusErr := testChannel(channel, "")
-			tok := time.Now()
-			milliseconds := tok.Sub(tik).Milliseconds()
-
-			shouldBanChannel := false
-
-			// request error disables the channel
-			if openaiWithStatusErr != nil {
-				oaiErr := openaiWithStatusErr.Error
-				err = errors.New(fmt.Sprintf("type %s, httpCode %d, code %v, message %s", oaiErr.Type, openaiWithStatusErr.StatusCode, oaiErr.Code, oaiErr.Message))
-				shouldBanChannel = service.ShouldDisableChannel(channel.Type, openaiWithStatusErr)
-			}
-
-			if milliseconds > disableThreshold {
-				err = errors.New(fmt.Sprintf("响应时间 %.2fs 超过阈值 %.2fs", float64(milliseconds)/1000.0, float64(disableThreshold)/1000.0))
-				shouldBanChannel = true
+			if channel.ChannelInfo.IsMultiKey {
+				testMultiKeyChannel(channel, "", disableThreshold, model.ChannelTestSourceManual)
+				continue
 			}
+			isChannelEnabled := channel.Status == common.ChannelStatusEnabled
+			result := runChannelTest(channel, "", disableThreshold)
+			action := ""
+			status := channel.Status
 
 			// disable channel
-			if isChannelEnabled && shouldBanChannel && channel.GetAutoBan() {
-				service.DisableChannel(channel.Id, channel.Name, err.Error())
+			if isChannelEnabled && result.shouldBan && channel.GetAutoBan() {
+				service.DisableChannel(channel.Id, channel.Name, result.err.Error())
+				action = model.ChannelTestActionDisabled
+				status = common.ChannelStatusAutoDisabled
 			}
 
 			// enable channel
-			if !isChannelEnabled && service.ShouldEnableChannel(err, openaiWithStatusErr, channel.Status) {
+			if !isChannelEnabled && service.ShouldEnableChannel(result.err, result.openaiErr, channel.Status) {
 				service.EnableChannel(channel.Id, channel.Name)
+				action = model.ChannelTestActionEnabled
+				status = common.ChannelStatusEnabled
 			}
 
-			channel.UpdateResponseTime(milliseconds)
+			channel.UpdateResponseTime(result.milliseconds)
+			model.RecordChannelTestLog(recordChannelTest(channel, -1, model.ChannelTestSourceManual, result, channel.Status, status, action))
 			time.Sleep(common.RequestInterval)
 		}
 		testAllChannelsLock.Lock()
@@ -315,6 +368,62 @@ func testAllChannels(notify bool) error {
 	return nil
 }
 
+// testMultiKeyChannel 逐个测试多密钥渠道中的密钥，只禁用或恢复出问题的密钥，返回是否有密钥通过测试以及测试后渠道的状态。
+// 自动测试时被自动禁用的密钥需要连续通过足够次数才会重新启用
+func testMultiKeyChannel(channel *model.Channel, testModel string, disableThreshold int64, source string) (bool, int) {
+	keyInfos := channel.GetKeyInfos()
+	var totalMilliseconds int64
+	tested := 0
+	passed := false
+	for _, keyInfo := range keyInfos {
+		if keyInfo.Status == common.ChannelStatusManuallyDisabled {
+			continue
+		}
+		single, err := channel.WithSingleKey(keyInfo.Index)
+		if err != nil {
+			continue
+		}
+		result := runChannelTest(single, testModel, disableThreshold)
+		totalMilliseconds += result.milliseconds
+		tested++
+		if result.err == nil {
+			passed = true
+		}
+
+		action := ""
+		status := keyInfo.Status
+		if keyInfo.Status == common.ChannelStatusEnabled && result.shouldBan && channel.GetAutoBan() {
+			service.DisableChannelKey(channel.Id, channel.Name, keyInfo.Index, result.err.Error())
+			action = model.ChannelTestActionDisabled
+			status = common.ChannelStatusAutoDisabled
+		}
+		shouldEnable := service.ShouldEnableChannel(result.err, result.openaiErr, keyInfo.Status)
+		if source == model.ChannelTestSourceAuto {
+			passes := updateChannelKeyAutoTestPasses(channel.Id, keyInfo.Index, result.err == nil)
+			shouldEnable = service.ShouldAutoEnableChannel(result.err, result.openaiErr, keyInfo.Status, passes)
+		}
+		if keyInfo.Status == common.ChannelStatusAutoDisabled && shouldEnable {
+			if enableErr := service.EnableChannelKey(channel.Id, channel.Name, keyInfo.Index); enableErr != nil {
+				common.SysError(fmt.Sprintf("failed to enable key #%d of channel #%d: %s", keyInfo.Index, channel.Id, enableErr.Error()))
+			} else {
+				action = model.ChannelTestActionEnabled
+				status = common.ChannelStatusEnabled
+			}
+		}
+		model.RecordChannelTestLog(recordChannelTest(channel, keyInfo.Index, source, result, keyInfo.Status, status, action))
+		time.Sleep(common.RequestInterval)
+	}
+	if tested > 0 {
+		channel.UpdateResponseTime(totalMilliseconds / int64(tested))
+	}
+	// 禁用或启用密钥时可能一并修改了渠道状态，重新读取测试后的状态
+	status := channel.Status
+	if latest, err := model.GetChannelById(channel.Id, false); err == nil {
+		status = latest.Status
+	}
+	return passed, status
+}
+
 func TestAllChannels(c *gin.Context) {
 	err := testAllChannels(true)
 	if err != nil {
@@ -330,12 +439,3 @@ func TestAllChannels(c *gin.Context) {
 	})
 	return
 }
-
-func AutomaticallyTestChannels(frequency int) {
-	for {
-		time.Sleep(time.Duration(frequency) * time.Minute)
-		common.SysLog("testing all channels")
-		_ = testAllChannels(false)
-		common.SysLog("channel test finished")
-	}
-}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"tea-api/common"
 	"tea-api/model"
+	relaycommon "tea-api/relay/common"
 	"strconv"
 	"strings"
 
@@ -65,6 +66,10 @@ func GetAllChannels(c *gin.Context) {
 			if tag != nil && *tag != "" {
 				tagChannel, err := model.GetChannelsByTag(*tag, idSort)
 				if err == nil {
+					// 与非标签模式一致，列表中不返回渠道密钥
+					for _, channel := range tagChannel {
+						channel.Key = ""
+					}
 					channelData = append(channelData, tagChannel...)
 				}
 			}
@@ -125,7 +130,7 @@ func FetchUpstreamModels(c *gin.Context) {
 	case common.ChannelTypeAli:
 		url = fmt.Sprintf("%s/compatible-mode/v1/models", baseURL)
 	}
-	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.GetDefaultKey()))
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -195,6 +200,10 @@ func SearchChannels(c *gin.Context) {
 			if tag != nil && *tag != "" {
 				tagChannel, err := model.GetChannelsByTag(*tag, idSort)
 				if err == nil {
+					// 与非标签模式一致，列表中不返回渠道密钥
+					for _, channel := range tagChannel {
+						channel.Key = ""
+					}
 					channelData = append(channelData, tagChannel...)
 				}
 			}
@@ -253,6 +262,15 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	if channel.ParamOverride != nil {
+		if err := relaycommon.CheckParamOverride(*channel.ParamOverride); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
 	channel.CreatedTime = common.GetTimestamp()
 	keys := strings.Split(channel.Key, "\n")
 	if channel.Type == common.ChannelTypeVertexAi {
@@ -277,6 +295,18 @@ func AddChannel(c *gin.Context) {
 		}
 		keys = []string{channel.Key}
 	}
+	if channel.ChannelInfo.IsMultiKey {
+		// 多密钥模式：所有密钥保存在同一个渠道中，按密钥池轮换使用
+		channel.NormalizeMultiKey()
+		if channel.ChannelInfo.MultiKeySize == 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "密钥不能为空",
+			})
+			return
+		}
+		keys = []string{channel.Key}
+	}
 	channels := make([]model.Channel, 0, len(keys))
 	for _, key := range keys {
 		if key == "" {
@@ -480,6 +510,15 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if channel.ParamOverride != nil {
+		if err := relaycommon.CheckParamOverride(*channel.ParamOverride); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
 	if channel.Type == common.ChannelTypeVertexAi {
 		if channel.Other == "" {
 			c.JSON(http.StatusOK, gin.H{
@@ -501,6 +540,29 @@ func UpdateChannel(c *gin.Context) {
 			}
 		}
 	}
+	if channel.ChannelInfo.IsMultiKey {
+		originChannel, err := model.GetChannelById(channel.Id, true)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		if channel.Key == "" {
+			channel.Key = originChannel.Key
+		}
+		if channel.Key != originChannel.Key || !originChannel.ChannelInfo.IsMultiKey {
+			// 密钥列表发生变化后下标不再对应，重置各密钥状态
+			channel.NormalizeMultiKey()
+		} else {
+			mode := channel.ChannelInfo.MultiKeyMode
+			channel.ChannelInfo = originChannel.ChannelInfo
+			if mode != "" {
+				channel.ChannelInfo.MultiKeyMode = mode
+			}
+		}
+	}
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
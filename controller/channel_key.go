@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"tea-api/common"
+	"tea-api/model"
+	"tea-api/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChannelKey 返回渠道的完整密钥，需要通过两步验证，每次查看都会记录日志
+func GetChannelKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("查看了渠道 %s（ID：%d）的密钥", channel.Name, channel.Id))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"key": channel.Key,
+		},
+	})
+}
+
+func getMultiKeyChannel(c *gin.Context) (*model.Channel, int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, 0, false
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, 0, false
+	}
+	if !channel.ChannelInfo.IsMultiKey {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该渠道未启用多密钥模式",
+		})
+		return nil, 0, false
+	}
+	index := -1
+	if c.Param("index") != "" {
+		index, err = strconv.Atoi(c.Param("index"))
+		if err != nil || index < 0 || index >= len(channel.GetKeys()) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无效的密钥下标",
+			})
+			return nil, 0, false
+		}
+	}
+	return channel, index, true
+}
+
+func GetChannelKeys(c *gin.Context) {
+	channel, _, ok := getMultiKeyChannel(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"multi_key_mode": channel.ChannelInfo.MultiKeyMode,
+			"keys":           channel.GetKeyInfos(),
+		},
+	})
+}
+
+func EnableChannelKey(c *gin.Context) {
+	channel, index, ok := getMultiKeyChannel(c)
+	if !ok {
+		return
+	}
+	err := service.EnableChannelKey(channel.Id, channel.Name, index)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func DisableChannelKey(c *gin.Context) {
+	channel, index, ok := getMultiKeyChannel(c)
+	if !ok {
+		return
+	}
+	enabled, err := model.UpdateChannelKeyStatus(channel.Id, index, common.ChannelStatusManuallyDisabled, "手动禁用")
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if enabled == 0 {
+		model.UpdateChannelStatusById(channel.Id, common.ChannelStatusManuallyDisabled, "所有密钥均已被手动禁用")
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    enabled,
+	})
+}
+
+func TestChannelKey(c *gin.Context) {
+	channel, index, ok := getMultiKeyChannel(c)
+	if !ok {
+		return
+	}
+	single, err := channel.WithSingleKey(index)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	tik := time.Now()
+	err, _ = testChannel(single, c.Query("model"))
+	consumedTime := float64(time.Since(tik).Milliseconds()) / 1000.0
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+			"time":    consumedTime,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"time":    consumedTime,
+	})
+}
@@ -1,25 +1,80 @@
 package controller
 
 import (
-    "net/http"
-    "tea-api/model"
+	"net/http"
+	"strconv"
+	"tea-api/model"
+	"tea-api/service"
+	"tea-api/setting"
 
-    "github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin"
 )
 
 func GetChannelStats(c *gin.Context) {
-    stats, err := model.GetChannelStatDetails()
-    if err != nil {
-        c.JSON(http.StatusOK, gin.H{
-            "success": false,
-            "message": err.Error(),
-        })
-        return
-    }
-    c.JSON(http.StatusOK, gin.H{
-        "success": true,
-        "message": "",
-        "data":    stats,
-    })
+	stats, err := model.GetChannelStatDetails()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    stats,
+	})
 }
 
+func GetChannelHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    service.GetChannelManager().Snapshot(),
+	})
+}
+
+// GetChannelEffectiveWeights 查看分组+模型下各渠道当前的有效权重与选中概率
+func GetChannelEffectiveWeights(c *gin.Context) {
+	group := c.Query("group")
+	modelName := c.Query("model")
+	if group == "" || modelName == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "group 和 model 不能为空",
+		})
+		return
+	}
+	weights, err := model.GetChannelEffectiveWeights(group, modelName)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"mode":     setting.GetGroupRoutingMode(group),
+			"channels": weights,
+		},
+	})
+}
+
+func ResetChannelHealth(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	service.GetChannelManager().Reset(id, c.Query("model"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"tea-api/constant"
+	"tea-api/dto"
+	"tea-api/model"
+	"tea-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// filePurposes 允许上传的文件用途，目前仅用于批处理任务
+var filePurposes = map[string]bool{
+	constant.FilePurposeBatch: true,
+}
+
+func openAIErrorResponse(c *gin.Context, statusCode int, code string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": dto.OpenAIError{
+			Message: message,
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+}
+
+// parseListLimit 解析列表接口的 limit 参数
+func parseListLimit(c *gin.Context, defaultLimit int, maxLimit int) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		return defaultLimit
+	}
+	if limit > maxLimit {
+		return maxLimit
+	}
+	return limit
+}
+
+func file2OpenAI(file *model.File) dto.OpenAIFile {
+	return dto.OpenAIFile{
+		Id:        file.Id,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    "processed",
+	}
+}
+
+func UploadFile(c *gin.Context) {
+	maxBytes := int64(constant.MaxFileUploadMB) << 20
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+1<<20)
+	purpose := c.PostForm("purpose")
+	if !filePurposes[purpose] {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_purpose", fmt.Sprintf("Invalid purpose '%s', only 'batch' is supported.", purpose))
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "missing_file", "The file parameter is required.")
+		return
+	}
+	if header.Size > maxBytes {
+		openAIErrorResponse(c, http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("The file exceeds the maximum size of %d MB.", constant.MaxFileUploadMB))
+		return
+	}
+	src, err := header.Open()
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_file", err.Error())
+		return
+	}
+	defer src.Close()
+	file, err := service.SaveUserFile(c.Request.Context(), c.GetInt("id"), header.Filename, purpose, src, header.Size)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "file_save_failed", "Failed to save the file: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, file2OpenAI(file))
+}
+
+func ListFiles(c *gin.Context) {
+	limit := parseListLimit(c, 100, 10000)
+	// 多查询一条用于判断是否还有下一页
+	files, err := model.GetUserFiles(c.GetInt("id"), c.Query("purpose"), c.Query("after"), limit+1)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	hasMore := len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	data := make([]dto.OpenAIFile, 0, len(files))
+	for _, file := range files {
+		data = append(data, file2OpenAI(file))
+	}
+	response := dto.OpenAIList[dto.OpenAIFile]{Object: "list", Data: data, HasMore: hasMore}
+	if len(data) > 0 {
+		response.FirstId = &data[0].Id
+		response.LastId = &data[len(data)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func RetrieveFile(c *gin.Context) {
+	file, err := model.GetUserFileById(c.Param("id"), c.GetInt("id"))
+	if err != nil {
+		openAIErrorResponse(c, http.StatusNotFound, "file_not_found", fmt.Sprintf("No such File object: %s", c.Param("id")))
+		return
+	}
+	c.JSON(http.StatusOK, file2OpenAI(file))
+}
+
+func RetrieveFileContent(c *gin.Context) {
+	file, err := model.GetUserFileById(c.Param("id"), c.GetInt("id"))
+	if err != nil {
+		openAIErrorResponse(c, http.StatusNotFound, "file_not_found", fmt.Sprintf("No such File object: %s", c.Param("id")))
+		return
+	}
+	storage, err := service.GetFileStorage()
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "file_storage_error", err.Error())
+		return
+	}
+	reader, err := storage.Open(c.Request.Context(), file.StorageKey)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "file_storage_error", "Failed to read the file: "+err.Error())
+		return
+	}
+	defer reader.Close()
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename))
+	c.Header("Content-Length", strconv.FormatInt(file.Bytes, 10))
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, reader)
+}
+
+func DeleteFile(c *gin.Context) {
+	file, err := model.GetUserFileById(c.Param("id"), c.GetInt("id"))
+	if err != nil {
+		openAIErrorResponse(c, http.StatusNotFound, "file_not_found", fmt.Sprintf("No such File object: %s", c.Param("id")))
+		return
+	}
+	if err = service.DeleteUserFile(c.Request.Context(), file); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "file_delete_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileDeleted{Id: file.Id, Object: "file", Deleted: true})
+}
@@ -1,25 +1,39 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/model"
+	"tea-api/service"
+	"tea-api/setting/config"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GetLatencyStats 获取延迟统计信息
+// GetLatencyStats 获取延迟统计信息，分位数统计最近两个时间桶内的请求
 func GetLatencyStats(c *gin.Context) {
-	stats := common.GetLatencyStats()
+	global, channels, models := service.GetLatencyStatsCollector().Snapshot()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    stats,
+		"data": gin.H{
+			"summary":        common.GetLatencyStats(),
+			"window_seconds": constant.LatencyStatBucketSeconds * 2,
+			"global":         global,
+			"channels":       channels,
+			"models":         models,
+		},
 	})
 }
 
-// ResetLatencyStats 重置延迟统计
+// ResetLatencyStats 重置延迟统计，不删除已持久化的历史
 func ResetLatencyStats(c *gin.Context) {
 	common.ResetLatencyStats()
+	service.GetLatencyStatsCollector().Reset()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "延迟统计已重置",
@@ -27,6 +41,40 @@ func ResetLatencyStats(c *gin.Context) {
 	})
 }
 
+// GetLatencyHistory 获取按时间桶汇总的延迟历史，指定 channel_id 或 model 时返回对应维度，否则返回全局
+func GetLatencyHistory(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	modelName := c.Query("model")
+	if channelId != 0 && modelName != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "channel_id 与 model 只能指定一个",
+		})
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	if startTimestamp == 0 {
+		startTimestamp = time.Now().Add(-24 * time.Hour).Unix()
+	}
+	stats, err := model.GetLatencyStatHistory(channelId, modelName, startTimestamp, endTimestamp)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"bucket_seconds": constant.LatencyStatBucketSeconds,
+			"items":          stats,
+		},
+	})
+}
+
 // GetLatencyOptimizationConfig 获取首字时延优化配置
 func GetLatencyOptimizationConfig(c *gin.Context) {
 	config := common.GetLatencyOptConfig()
@@ -36,3 +84,58 @@ func GetLatencyOptimizationConfig(c *gin.Context) {
 		"data":    config,
 	})
 }
+
+// UpdateLatencyOptimizationConfig 更新首字时延优化配置，只修改请求中出现的字段，时长字段单位为纳秒；
+// 配置保存为 latency_optimization.* 选项，多节点部署时随选项同步生效
+func UpdateLatencyOptimizationConfig(c *gin.Context) {
+	newConfig := *common.GetLatencyOptConfig()
+	if err := c.ShouldBindJSON(&newConfig); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的配置格式: " + err.Error(),
+		})
+		return
+	}
+	if err := validateLatencyOptimizationConfig(&newConfig); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	configMap, err := config.ConfigToMap(&newConfig)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	for key, value := range configMap {
+		if err := model.UpdateOption("latency_optimization."+key, value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    common.GetLatencyOptConfig(),
+	})
+}
+
+func validateLatencyOptimizationConfig(cfg *common.LatencyOptimizationConfig) error {
+	if cfg.StreamFlushInterval < 0 || cfg.CacheExpiration < 0 {
+		return errors.New("时长不能为负数")
+	}
+	if cfg.StreamInitialBufferSize <= 0 || cfg.StreamFirstTokenBuffer <= 0 {
+		return errors.New("流式缓冲区大小必须大于 0")
+	}
+	if cfg.StreamMaxBufferSize < cfg.StreamInitialBufferSize {
+		return errors.New("流式最大缓冲区不能小于初始缓冲区")
+	}
+	return nil
+}
@@ -91,7 +91,7 @@ func UpdateMidjourneyTaskBulk() {
 			// 使用带有超时的 context 创建新的请求
 			req = req.WithContext(ctx)
 			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("mj-api-secret", midjourneyChannel.Key)
+			req.Header.Set("mj-api-secret", midjourneyChannel.GetDefaultKey())
 			resp, err := service.GetHttpClient().Do(req)
 			if err != nil {
 				common.LogError(ctx, fmt.Sprintf("Get Task Do req error: %v", err))
@@ -159,7 +159,7 @@ func UpdateMidjourneyTaskBulk() {
 					common.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
 				} else {
 					if shouldReturnQuota {
-						err = model.IncreaseUserQuota(task.UserId, task.Quota, false)
+						err = service.RefundTaskQuota(task.UserId, task.Quota, task.SubscriptionId, task.SubscriptionQuota)
 						if err != nil {
 							common.LogError(ctx, "fail to increase user quota: "+err.Error())
 						}
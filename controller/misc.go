@@ -8,6 +8,7 @@ import (
 	"tea-api/common"
 	"tea-api/constant"
 	"tea-api/model"
+	"tea-api/service"
 	"tea-api/setting"
 	"tea-api/setting/operation_setting"
 	"tea-api/setting/system_setting"
@@ -59,6 +60,7 @@ func GetStatus(c *gin.Context) {
 			"telegram_oauth":           common.TelegramOAuthEnabled,
 			"telegram_bot_name":        common.TelegramBotName,
 			"turnstile_check":          common.TurnstileCheckEnabled,
+			"two_factor_required_role": common.TwoFactorRequiredRole,
 			"quota_per_unit":           common.QuotaPerUnit,
 			"display_in_currency":      common.DisplayInCurrencyEnabled,
 			"enable_batch_update":      common.BatchUpdateEnabled,
@@ -73,7 +75,9 @@ func GetStatus(c *gin.Context) {
 				"continuous_reward": common.ContinuousCheckinReward,
 				"max_days":          common.MaxContinuousRewardDays,
 			},
-			"enable_online_topup":         setting.PayAddress != "" && setting.EpayId != "" && setting.EpayKey != "",
+			"enable_online_topup":         service.IsOnlineTopUpEnabled(),
+			"payment_provider":            setting.PaymentProvider,
+			"stripe_currency":             setting.StripeCurrency,
 			"mj_notify_enabled":           setting.MjNotifyEnabled,
 			"chats":                       setting.Chats,
 			"demo_site_enabled":           operation_setting.DemoSiteEnabled,
@@ -6,7 +6,9 @@ import (
 	"tea-api/common"
 	"tea-api/model"
 	"tea-api/setting"
+	"tea-api/setting/operation_setting"
 	"tea-api/setting/system_setting"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -110,6 +112,121 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "BatchDiscountRatio":
+		err = operation_setting.CheckBatchDiscountRatio(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "GroupFallbackChains":
+		err = setting.CheckGroupFallbackChains(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "ResponseCacheGroups":
+		err = setting.CheckResponseCacheGroups(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "ResponseCacheHitRatio":
+		err = setting.CheckResponseCacheHitRatio(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "ResponseCacheTTLSeconds":
+		err = setting.CheckResponseCacheTTLSeconds(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "ModelFallbackChains":
+		err = setting.CheckModelFallbackChains(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "payload_capture.redact_patterns":
+		err = operation_setting.CheckPayloadCaptureRedactPatterns(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "RegexFilterRules":
+		err = setting.CheckRegexFilterRules(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "RegexFilterExemptions":
+		err = setting.CheckRegexFilterExemptions(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "TwoFactorRequiredRole":
+		role, err := strconv.Atoi(option.Value)
+		if err != nil || !common.IsValidateRole(role) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无效的角色",
+			})
+			return
+		}
+	case "PaymentProvider":
+		if option.Value != setting.PaymentProviderEpay && option.Value != setting.PaymentProviderStripe {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无效的支付渠道",
+			})
+			return
+		}
+	case "GroupFallbackBillingMode":
+		if option.Value != setting.GroupFallbackBillingOrigin && option.Value != setting.GroupFallbackBillingFallback {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无效的回退计费方式",
+			})
+			return
+		}
+	case "GroupRoutingModes":
+		err = setting.CheckGroupRoutingModes(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	case "ModelRequestRateLimitGroup":
 		err = setting.CheckModelRequestRateLimitGroup(option.Value)
 		if err != nil {
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"net/http"
+
+	"tea-api/model"
+	"tea-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPayloadCapture 管理员按请求 ID 查看留存的请求/响应内容，请求 ID 见日志的 other.request_id
+func GetPayloadCapture(c *gin.Context) {
+	capture, err := model.GetPayloadCaptureByRequestId(c.Param("request_id"), 0)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "留存内容不存在或已过期",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    capture,
+	})
+}
+
+// GetUserPayloadCapture 用户按请求 ID 查看自己请求的留存内容
+func GetUserPayloadCapture(c *gin.Context) {
+	if !operation_setting.GetPayloadCaptureSetting().UserViewEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开放查看留存内容",
+		})
+		return
+	}
+	capture, err := model.GetPayloadCaptureByRequestId(c.Param("request_id"), c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "留存内容不存在或已过期",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    capture,
+	})
+}
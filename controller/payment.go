@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"tea-api/common"
+	"tea-api/model"
+	"tea-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPaymentOrder 管理员向支付渠道查询充值订单的状态，渠道已支付但本地仍待支付时（例如回调丢失）补单入账
+func GetPaymentOrder(c *gin.Context) {
+	topUp := model.GetTopUpByTradeNo(c.Param("trade_no"))
+	if topUp == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "订单不存在",
+		})
+		return
+	}
+	provider, err := service.GetPaymentProviderByName(topUp.PaymentProvider)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	status, err := provider.QueryOrder(c.Request.Context(), topUp)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if status.Paid && topUp.Status == model.TopUpStatusPending {
+		err = completePaymentTopUp(provider.Name(), &service.PaymentEvent{
+			TradeNo:         topUp.TradeNo,
+			ProviderOrderId: status.ProviderOrderId,
+			Paid:            true,
+		})
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		topUp = model.GetTopUpByTradeNo(topUp.TradeNo)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"top_up":          topUp,
+			"provider_status": status,
+		},
+	})
+}
+
+// RefundPaymentOrder 管理员对已支付的充值订单原路退款，并扣回充值的额度。
+// 先将订单标记为退款中再调用支付渠道退款，并发请求只有一个能发起退款
+func RefundPaymentOrder(c *gin.Context) {
+	topUp := model.GetTopUpByTradeNo(c.Param("trade_no"))
+	if topUp == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "订单不存在",
+		})
+		return
+	}
+	provider, err := service.GetPaymentProviderByName(topUp.PaymentProvider)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	topUp, claimed, err := model.ClaimTopUpRefund(topUp.TradeNo)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !claimed {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "只能退款已支付的订单",
+		})
+		return
+	}
+	if err = provider.Refund(c.Request.Context(), topUp); err != nil {
+		if releaseErr := model.ReleaseTopUpRefund(topUp.Id); releaseErr != nil {
+			common.SysError(fmt.Sprintf("failed to release refund of top up %s: %s", topUp.TradeNo, releaseErr.Error()))
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	topUp, refunded, err := model.RefundTopUp(topUp.TradeNo)
+	if err != nil {
+		common.SysError(fmt.Sprintf("top up %s refunded by provider but failed to deduct quota: %s", c.Param("trade_no"), err.Error()))
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if refunded {
+		model.RecordLog(topUp.UserId, model.LogTypeManage, fmt.Sprintf("充值订单 %s 已退款，退款金额：%f，扣除额度: %v", topUp.TradeNo, topUp.Money, common.LogQuota(topUp.Quota())))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    topUp,
+	})
+}
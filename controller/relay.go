@@ -18,9 +18,12 @@ import (
 	"tea-api/relay/helper"
 	"tea-api/service"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func relayHandler(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
@@ -40,32 +43,41 @@ func relayHandler(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode
 		err = relay.EmbeddingHelper(c)
 	case relayconstant.RelayModeResponses:
 		err = relay.ResponsesHelper(c)
+	case relayconstant.RelayModeGeminiGenerateContent, relayconstant.RelayModeGeminiCountTokens, relayconstant.RelayModeGeminiEmbedContent:
+		err = relay.GeminiHelper(c)
 	default:
 		err = relay.TextHelper(c)
 	}
 
 	if constant2.ErrorLogEnabled && err != nil {
-		// 保存错误日志到mysql中
-		userId := c.GetInt("id")
-		tokenName := c.GetString("token_name")
-		modelName := c.GetString("original_model")
-		tokenId := c.GetInt("token_id")
-		userGroup := c.GetString("group")
-		channelId := c.GetInt("channel_id")
-		other := make(map[string]interface{})
-		other["error_type"] = err.Error.Type
-		other["error_code"] = err.Error.Code
-		other["status_code"] = err.StatusCode
-		other["channel_id"] = channelId
-		other["channel_name"] = c.GetString("channel_name")
-		other["channel_type"] = c.GetInt("channel_type")
-
-		model.RecordErrorLog(c, userId, channelId, modelName, tokenName, err.Error.Message, tokenId, 0, false, userGroup, other)
+		recordRelayErrorLog(c, err.Error.Message, err.Error.Type, err.Error.Code, err.StatusCode)
 	}
 
 	return err
 }
 
+// recordRelayErrorLog 保存错误日志到mysql中
+func recordRelayErrorLog(c *gin.Context, message string, errorType string, errorCode any, statusCode int) {
+	userId := c.GetInt("id")
+	tokenName := c.GetString("token_name")
+	modelName := c.GetString("original_model")
+	tokenId := c.GetInt("token_id")
+	userGroup := c.GetString("group")
+	channelId := c.GetInt("channel_id")
+	other := make(map[string]interface{})
+	other["error_type"] = errorType
+	other["error_code"] = errorCode
+	other["status_code"] = statusCode
+	other["channel_id"] = channelId
+	other["channel_name"] = c.GetString("channel_name")
+	other["channel_type"] = c.GetInt("channel_type")
+	if rules := c.GetStringSlice(constant2.ContextKeyRegexFilterRules); len(rules) > 0 {
+		other["regex_filter_rules"] = rules
+	}
+
+	model.RecordErrorLog(c, userId, channelId, modelName, tokenName, message, tokenId, 0, false, userGroup, other)
+}
+
 func Relay(c *gin.Context) {
 	relayMode := constant.Path2RelayMode(c.Request.URL.Path)
 	requestId := c.GetString(common.RequestIdKey)
@@ -73,24 +85,42 @@ func Relay(c *gin.Context) {
 	originalModel := c.GetString("original_model")
 	var openaiErr *dto.OpenAIErrorWithStatusCode
 
-	for i := 0; i <= common.RetryTimes; i++ {
-		channel, err := getChannel(c, group, originalModel, i)
-		if err != nil {
-			common.LogError(c, err.Error())
-			openaiErr = service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
-			break
-		}
-
-		openaiErr = relayRequest(c, relayMode, channel)
-
-		if openaiErr == nil {
-			return // 成功处理请求，直接返回
+	modelNames := append([]string{originalModel}, service.GetModelFallbackChain(c, group, originalModel)...)
+	for mi, modelName := range modelNames {
+		isFallback := mi > 0
+		if isFallback {
+			if !shouldFallbackModel(c, openaiErr) {
+				break
+			}
+			setupFallbackModel(c, originalModel, modelName)
 		}
-
-		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
-
-		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
-			break
+		for i := 0; i <= common.RetryTimes; i++ {
+			channel, err := getModelChannel(c, group, modelName, i, isFallback)
+			if err != nil {
+				common.LogError(c, err.Error())
+				if isFallback {
+					// 替代模型没有可用渠道，保留上一个模型的错误继续尝试下一个替代模型
+					break
+				}
+				openaiErr = service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
+				break
+			}
+
+			attemptStart := time.Now()
+			endAttemptSpan := startRelayAttemptSpan(c, channel, modelName, i)
+			openaiErr = relayRequest(c, relayMode, channel)
+			endAttemptSpan(openaiErr)
+			service.ReportRelayAttempt(c, channel.Id, modelName, openaiErr, attemptStart)
+
+			if openaiErr == nil {
+				return // 成功处理请求，直接返回
+			}
+
+			go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), c.GetBool(constant2.ContextKeyChannelIsMultiKey), c.GetInt(constant2.ContextKeyChannelMultiKeyIndex), openaiErr)
+
+			if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
+				break
+			}
 		}
 	}
 	useChannel := c.GetStringSlice("use_channel")
@@ -100,11 +130,19 @@ func Relay(c *gin.Context) {
 	}
 
 	if openaiErr != nil {
+		clearFallbackModel(c)
 		if openaiErr.StatusCode == http.StatusTooManyRequests {
 			common.LogError(c, fmt.Sprintf("origin 429 error: %s", openaiErr.Error.Message))
 			openaiErr.Error.Message = "当前分组上游负载已饱和，请稍后再试"
 		}
 		openaiErr.Error.Message = common.MessageWithRequestId(openaiErr.Error.Message, requestId)
+		if relayconstant.IsGeminiRelayMode(relayMode) {
+			// Gemini 原生接口按 Gemini 的错误格式返回
+			c.JSON(openaiErr.StatusCode, gin.H{
+				"error": service.OpenAIErrorToGeminiError(openaiErr),
+			})
+			return
+		}
 		c.JSON(openaiErr.StatusCode, gin.H{
 			"error": openaiErr.Error,
 		})
@@ -146,12 +184,14 @@ func WssRelay(c *gin.Context) {
 		}
 
 		openaiErr = wssRequest(c, ws, relayMode, channel)
+		// 实时会话的持续时间不代表渠道延迟，只记录成功与否
+		service.GetChannelManager().ReportRelayResult(channel.Id, originalModel, openaiErr, 0, 0)
 
 		if openaiErr == nil {
 			return // 成功处理请求，直接返回
 		}
 
-		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
+		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), c.GetBool(constant2.ContextKeyChannelIsMultiKey), c.GetInt(constant2.ContextKeyChannelMultiKeyIndex), openaiErr)
 
 		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
 			break
@@ -179,26 +219,49 @@ func RelayClaude(c *gin.Context) {
 	originalModel := c.GetString("original_model")
 	var claudeErr *dto.ClaudeErrorWithStatusCode
 
-	for i := 0; i <= common.RetryTimes; i++ {
-		channel, err := getChannel(c, group, originalModel, i)
-		if err != nil {
-			common.LogError(c, err.Error())
-			claudeErr = service.ClaudeErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
-			break
+	modelNames := append([]string{originalModel}, service.GetModelFallbackChain(c, group, originalModel)...)
+	var lastErr *dto.OpenAIErrorWithStatusCode
+	for mi, modelName := range modelNames {
+		isFallback := mi > 0
+		if isFallback {
+			if !shouldFallbackModel(c, lastErr) {
+				break
+			}
+			setupFallbackModel(c, originalModel, modelName)
 		}
-
-		claudeErr = claudeRequest(c, channel)
-
-		if claudeErr == nil {
-			return // 成功处理请求，直接返回
-		}
-
-		openaiErr := service.ClaudeErrorToOpenAIError(claudeErr)
-
-		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
-
-		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
-			break
+		for i := 0; i <= common.RetryTimes; i++ {
+			channel, err := getModelChannel(c, group, modelName, i, isFallback)
+			if err != nil {
+				common.LogError(c, err.Error())
+				if isFallback {
+					// 替代模型没有可用渠道，保留上一个模型的错误继续尝试下一个替代模型
+					break
+				}
+				claudeErr = service.ClaudeErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
+				lastErr = nil
+				break
+			}
+
+			attemptStart := time.Now()
+			endAttemptSpan := startRelayAttemptSpan(c, channel, modelName, i)
+			claudeErr = claudeRequest(c, channel)
+
+			if claudeErr == nil {
+				endAttemptSpan(nil)
+				service.ReportRelayAttempt(c, channel.Id, modelName, nil, attemptStart)
+				return // 成功处理请求，直接返回
+			}
+
+			openaiErr := service.ClaudeErrorToOpenAIError(claudeErr)
+			lastErr = openaiErr
+			endAttemptSpan(openaiErr)
+			service.ReportRelayAttempt(c, channel.Id, modelName, openaiErr, attemptStart)
+
+			go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), c.GetBool(constant2.ContextKeyChannelIsMultiKey), c.GetInt(constant2.ContextKeyChannelMultiKeyIndex), openaiErr)
+
+			if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
+				break
+			}
 		}
 	}
 	useChannel := c.GetStringSlice("use_channel")
@@ -208,6 +271,7 @@ func RelayClaude(c *gin.Context) {
 	}
 
 	if claudeErr != nil {
+		clearFallbackModel(c)
 		claudeErr.Error.Message = common.MessageWithRequestId(claudeErr.Error.Message, requestId)
 		c.JSON(claudeErr.StatusCode, gin.H{
 			"type":  "error",
@@ -234,7 +298,11 @@ func claudeRequest(c *gin.Context, channel *model.Channel) *dto.ClaudeErrorWithS
 	addUsedChannel(c, channel.Id)
 	requestBody, _ := common.GetRequestBody(c)
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-	return relay.ClaudeHelper(c)
+	err := relay.ClaudeHelper(c)
+	if constant2.ErrorLogEnabled && err != nil {
+		recordRelayErrorLog(c, err.Error.Message, err.Error.Type, nil, err.StatusCode)
+	}
+	return err
 }
 
 func addUsedChannel(c *gin.Context, channelId int) {
@@ -257,14 +325,62 @@ func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*m
 			AutoBan: &autoBanInt,
 		}, nil
 	}
-	channel, err := model.CacheGetRandomSatisfiedChannel(group, originalModel, retryCount)
+	return selectChannel(c, group, originalModel, retryCount)
+}
+
+// selectChannel 按分组（含回退分组）重新选择渠道并写入上下文
+func selectChannel(c *gin.Context, group, modelName string, retryCount int) (*model.Channel, error) {
+	channel, usingGroup, err := model.CacheGetRandomSatisfiedChannelWithFallback(group, modelName, retryCount)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("获取重试渠道失败: %s", err.Error()))
 	}
-	middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+	middleware.SetupContextForUsingGroup(c, usingGroup)
+	middleware.SetupContextForSelectedChannel(c, channel, modelName)
 	return channel, nil
 }
 
+// getModelChannel 替代模型没有 Distribute 预先选好的渠道，第一次尝试也需要重新选择
+func getModelChannel(c *gin.Context, group, modelName string, retryCount int, isFallback bool) (*model.Channel, error) {
+	if isFallback {
+		return selectChannel(c, group, modelName, retryCount)
+	}
+	return getChannel(c, group, modelName, retryCount)
+}
+
+// shouldFallbackModel 原模型的上游请求全部失败后才切换替代模型，本地错误和参数错误不切换
+func shouldFallbackModel(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode) bool {
+	return shouldRetry(c, openaiErr, 1)
+}
+
+func setupFallbackModel(c *gin.Context, requestedModel string, fallbackModel string) {
+	common.LogInfo(c, fmt.Sprintf("模型 %s 上游请求失败，切换到替代模型 %s", c.GetString("original_model"), fallbackModel))
+	c.Set(constant2.ContextKeyRequestedModel, requestedModel)
+	// 流式响应在转发过程中就会写出响应头，只能在尝试前设置，失败时由 clearFallbackModel 清除
+	c.Writer.Header().Set(constant2.HeaderServedModel, fallbackModel)
+}
+
+// clearFallbackModel 替代模型同样失败时清除实际服务模型的响应头，避免错误响应携带未生效的模型
+func clearFallbackModel(c *gin.Context) {
+	c.Writer.Header().Del(constant2.HeaderServedModel)
+}
+
+// startRelayAttemptSpan 为每次渠道尝试生成子 span，上游请求等阶段的 span 都挂在该尝试下
+func startRelayAttemptSpan(c *gin.Context, channel *model.Channel, modelName string, attempt int) func(*dto.OpenAIErrorWithStatusCode) {
+	span, end := common.StartGinSpan(c, "relay.attempt", trace.WithAttributes(
+		attribute.Int("channel.id", channel.Id),
+		attribute.Int("channel.type", channel.Type),
+		attribute.String("model", modelName),
+		attribute.Int("retry.attempt", attempt),
+	))
+	return func(err *dto.OpenAIErrorWithStatusCode) {
+		if err != nil {
+			span.SetAttributes(attribute.Int("http.response.status_code", err.StatusCode))
+			common.SetSpanError(span, errors.New(err.Error.Message))
+		}
+		end()
+	}
+}
+
 func shouldRetry(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode, retryTimes int) bool {
 	if openaiErr == nil {
 		return false
@@ -308,11 +424,16 @@ func shouldRetry(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode, retry
 	return true
 }
 
-func processChannelError(c *gin.Context, channelId int, channelType int, channelName string, autoBan bool, err *dto.OpenAIErrorWithStatusCode) {
+func processChannelError(c *gin.Context, channelId int, channelType int, channelName string, autoBan bool, isMultiKey bool, keyIndex int, err *dto.OpenAIErrorWithStatusCode) {
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
 	common.LogError(c, fmt.Sprintf("relay error (channel #%d, status code: %d): %s", channelId, err.StatusCode, err.Error.Message))
 	if service.ShouldDisableChannel(channelType, err) && autoBan {
+		if isMultiKey {
+			// 多密钥渠道只禁用出错的密钥，全部密钥禁用后才禁用渠道
+			service.DisableChannelKey(channelId, channelName, keyIndex, err.Error.Message)
+			return
+		}
 		service.DisableChannel(channelId, channelName, err.Error.Message)
 	}
 }
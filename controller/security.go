@@ -1,11 +1,15 @@
 package controller
 
 import (
+	"encoding/csv"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"tea-api/middleware"
+	"tea-api/model"
 	"tea-api/setting"
 )
 
@@ -236,6 +240,24 @@ func validateSecurityConfig(config *setting.SecurityConfig) error {
 	return nil
 }
 
+// parseSecurityEventFilter 解析安全事件查询条件，type 参数对应触发的规则
+func parseSecurityEventFilter(c *gin.Context) *model.SecurityEventFilter {
+	filter := &model.SecurityEventFilter{
+		IP:        c.Query("ip"),
+		Rule:      c.Query("type"),
+		Action:    c.Query("action"),
+		RequestId: c.Query("request_id"),
+	}
+	if filter.Rule == "all" {
+		filter.Rule = ""
+	}
+	filter.UserId, _ = strconv.Atoi(c.Query("user_id"))
+	filter.TokenId, _ = strconv.Atoi(c.Query("token_id"))
+	filter.StartTimestamp, _ = strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	filter.EndTimestamp, _ = strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return filter
+}
+
 // GetSecurityLogs 获取安全日志
 func GetSecurityLogs(c *gin.Context) {
 	// 获取查询参数
@@ -254,13 +276,34 @@ func GetSecurityLogs(c *gin.Context) {
 		limit = 50
 	}
 
-	// 从安全日志系统获取实际日志
-	logs, total := setting.GetSecurityLogs(page, limit, logType, ip)
+	// 未初始化日志数据库时只能返回内存中最近的日志
+	if !model.SecurityEventPersistenceEnabled() {
+		logs, total := setting.GetSecurityLogs(page, limit, logType, ip)
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data": gin.H{
+				"logs":  logs,
+				"page":  page,
+				"limit": limit,
+				"total": total,
+				"type":  logType,
+			},
+		})
+		return
+	}
 
+	events, total, err := model.GetSecurityEvents(parseSecurityEventFilter(c), (page-1)*limit, limit)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": gin.H{
-			"logs":  logs,
+			"logs":  events,
 			"page":  page,
 			"limit": limit,
 			"total": total,
@@ -268,3 +311,74 @@ func GetSecurityLogs(c *gin.Context) {
 		},
 	})
 }
+
+// maxSecurityEventExportRows 单次导出的最大行数
+const maxSecurityEventExportRows = 10000
+
+// ExportSecurityLogs 按查询条件导出安全事件为 CSV
+func ExportSecurityLogs(c *gin.Context) {
+	if !model.SecurityEventPersistenceEnabled() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "安全事件未持久化，无法导出",
+		})
+		return
+	}
+	events, _, err := model.GetSecurityEvents(parseSecurityEventFilter(c), 0, maxSecurityEventExportRows)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=security_events_%d.csv", time.Now().Unix()))
+	// 写入 BOM 以便 Excel 正确识别 UTF-8
+	_, _ = c.Writer.Write([]byte("\xEF\xBB\xBF"))
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"id", "time", "ip", "user_id", "token_id", "rule", "score", "action", "message", "request_id", "path", "details"})
+	for _, event := range events {
+		_ = writer.Write([]string{
+			strconv.Itoa(event.Id),
+			time.Unix(event.CreatedAt, 0).Format(time.RFC3339),
+			event.IP,
+			strconv.Itoa(event.UserId),
+			strconv.Itoa(event.TokenId),
+			event.Rule,
+			strconv.FormatInt(event.Score, 10),
+			event.Action,
+			event.Message,
+			event.RequestId,
+			event.Path,
+			event.Details,
+		})
+	}
+	writer.Flush()
+}
+
+// DeleteHistorySecurityLogs 删除指定时间之前的安全事件
+func DeleteHistorySecurityLogs(c *gin.Context) {
+	targetTimestamp, _ := strconv.ParseInt(c.Query("target_timestamp"), 10, 64)
+	if targetTimestamp == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "target timestamp is required",
+		})
+		return
+	}
+	count, err := model.DeleteOldSecurityEvents(c.Request.Context(), targetTimestamp, 100)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+}
@@ -0,0 +1,297 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tea-api/common"
+	"tea-api/model"
+	"tea-api/setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+func validateSubscriptionPlan(plan *model.SubscriptionPlan) error {
+	plan.Name = strings.TrimSpace(plan.Name)
+	if plan.Name == "" || len(plan.Name) > 64 {
+		return errors.New("套餐名称长度必须在1-64之间")
+	}
+	switch plan.Period {
+	case model.SubscriptionPeriodDay, model.SubscriptionPeriodWeek, model.SubscriptionPeriodMonth:
+	case "":
+		plan.Period = model.SubscriptionPeriodMonth
+	default:
+		return errors.New("无效的订阅周期")
+	}
+	if plan.Duration <= 0 {
+		return errors.New("开通的周期数必须大于0")
+	}
+	if plan.Quota < 0 || plan.Price < 0 || plan.RolloverLimit < 0 {
+		return errors.New("价格和额度不能为负数")
+	}
+	switch plan.RolloverPolicy {
+	case model.SubscriptionRolloverNone, model.SubscriptionRolloverCarryover:
+	case "":
+		plan.RolloverPolicy = model.SubscriptionRolloverNone
+	default:
+		return errors.New("无效的额度结转策略")
+	}
+	if plan.Group != "" && !setting.ContainsGroupRatio(plan.Group) {
+		return fmt.Errorf("分组 %s 不存在", plan.Group)
+	}
+	if plan.Status != model.SubscriptionPlanStatusDisabled {
+		plan.Status = model.SubscriptionPlanStatusEnabled
+	}
+	return nil
+}
+
+// GetAllSubscriptionPlans 管理员获取全部订阅套餐
+func GetAllSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetAllSubscriptionPlans(false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plans,
+	})
+}
+
+// GetUserSubscriptionPlans 用户获取可开通的订阅套餐
+func GetUserSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetAllSubscriptionPlans(true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plans,
+	})
+}
+
+func AddSubscriptionPlan(c *gin.Context) {
+	plan := model.SubscriptionPlan{}
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	plan.Id = 0
+	if err := validateSubscriptionPlan(&plan); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := plan.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plan,
+	})
+}
+
+// UpdateSubscriptionPlan 修改套餐，新的额度和结转策略从生效中订阅的下一个周期开始使用
+func UpdateSubscriptionPlan(c *gin.Context) {
+	plan := model.SubscriptionPlan{}
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if _, err := model.GetSubscriptionPlanById(plan.Id); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := validateSubscriptionPlan(&plan); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := plan.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plan,
+	})
+}
+
+func DeleteSubscriptionPlan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeleteSubscriptionPlanById(id); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetAllSubscriptions 管理员按用户和状态查询订阅
+func GetAllSubscriptions(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize < 1 {
+		pageSize = common.ItemsPerPage
+	}
+	subscriptions, total, err := model.GetSubscriptions(userId, c.Query("status"), (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"items":     subscriptions,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// GetSelfSubscription 用户获取自己生效中的订阅及对应的套餐，没有订阅时 data 为 null
+func GetSelfSubscription(c *gin.Context) {
+	subscription, err := model.GetActiveSubscription(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if subscription == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+			"data":    nil,
+		})
+		return
+	}
+	plan, err := model.GetSubscriptionPlanById(subscription.PlanId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"subscription": subscription,
+			"plan":         plan,
+		},
+	})
+}
+
+type GrantSubscriptionRequest struct {
+	UserId int `json:"user_id"`
+	PlanId int `json:"plan_id"`
+}
+
+// GrantSubscription 管理员为用户开通套餐，已订阅同一套餐时续订
+func GrantSubscription(c *gin.Context) {
+	var req GrantSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	subscription, renewed, err := model.GrantSubscription(req.UserId, req.PlanId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	action := "开通"
+	if renewed {
+		action = "续订"
+	}
+	endTime := time.Unix(subscription.EndTime, 0).Format("2006-01-02 15:04:05")
+	model.RecordLog(req.UserId, model.LogTypeManage, fmt.Sprintf("管理员%s了订阅，订阅 ID：%d，到期时间：%s", action, subscription.Id, endTime))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    subscription,
+	})
+}
+
+// CancelSubscription 管理员立即取消订阅，剩余的订阅额度作废
+func CancelSubscription(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	subscription, ended, err := model.EndSubscription(id, model.SubscriptionStatusCancelled)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !ended {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "订阅已结束",
+		})
+		return
+	}
+	model.RecordLog(subscription.UserId, model.LogTypeManage, fmt.Sprintf("管理员取消了订阅，订阅 ID：%d", subscription.Id))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    subscription,
+	})
+}
@@ -16,6 +16,7 @@ import (
 	"tea-api/dto"
 	"tea-api/model"
 	"tea-api/relay"
+	"tea-api/service"
 	"time"
 )
 
@@ -111,7 +112,7 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 	if adaptor == nil {
 		return errors.New("adaptor not found")
 	}
-	resp, err := adaptor.FetchTask(*channel.BaseURL, channel.Key, map[string]any{
+	resp, err := adaptor.FetchTask(*channel.BaseURL, channel.GetDefaultKey(), map[string]any{
 		"ids": taskIds,
 	})
 	if err != nil {
@@ -159,7 +160,7 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 			} else {
 				quota := task.Quota
 				if quota != 0 {
-					err = model.IncreaseUserQuota(task.UserId, quota, false)
+					err = service.RefundTaskQuota(task.UserId, quota, task.SubscriptionId, task.SubscriptionQuota)
 					if err != nil {
 						common.LogError(ctx, "fail to increase user quota: "+err.Error())
 					}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"encoding/json"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"tea-api/common"
@@ -98,6 +99,40 @@ func GetToken(c *gin.Context) {
 	return
 }
 
+// GetTokenUsage 返回令牌的额度与速率限制，以及当前各时间窗口的用量
+func GetTokenUsage(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	token, err := model.GetTokenByIds(id, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"limits": gin.H{
+				"daily_quota_limit":   token.DailyQuotaLimit,
+				"weekly_quota_limit":  token.WeeklyQuotaLimit,
+				"monthly_quota_limit": token.MonthlyQuotaLimit,
+				"rpm_limit":           token.RpmLimit,
+				"tpm_limit":           token.TpmLimit,
+			},
+			"usage": model.GetTokenUsage(token.Id),
+		},
+	})
+}
+
 func GetTokenStatus(c *gin.Context) {
 	tokenId := c.GetInt("token_id")
 	userId := c.GetInt("id")
@@ -139,6 +174,23 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	if token.ModelFallbacks != "" {
+		var fallbacks map[string][]string
+		if err := json.Unmarshal([]byte(token.ModelFallbacks), &fallbacks); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "替代模型配置格式错误",
+			})
+			return
+		}
+	}
+	if token.DailyQuotaLimit < 0 || token.WeeklyQuotaLimit < 0 || token.MonthlyQuotaLimit < 0 || token.RpmLimit < 0 || token.TpmLimit < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "额度与速率限制不能为负数",
+		})
+		return
+	}
 	key, err := common.GenerateKey()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -149,18 +201,26 @@ func AddToken(c *gin.Context) {
 		return
 	}
 	cleanToken := model.Token{
-		UserId:             c.GetInt("id"),
-		Name:               token.Name,
-		Key:                key,
-		CreatedTime:        common.GetTimestamp(),
-		AccessedTime:       common.GetTimestamp(),
-		ExpiredTime:        token.ExpiredTime,
-		RemainQuota:        token.RemainQuota,
-		UnlimitedQuota:     token.UnlimitedQuota,
-		ModelLimitsEnabled: token.ModelLimitsEnabled,
-		ModelLimits:        token.ModelLimits,
-		AllowIps:           token.AllowIps,
-		Group:              token.Group,
+		UserId:                c.GetInt("id"),
+		Name:                  token.Name,
+		Key:                   key,
+		CreatedTime:           common.GetTimestamp(),
+		AccessedTime:          common.GetTimestamp(),
+		ExpiredTime:           token.ExpiredTime,
+		RemainQuota:           token.RemainQuota,
+		UnlimitedQuota:        token.UnlimitedQuota,
+		ModelLimitsEnabled:    token.ModelLimitsEnabled,
+		ModelLimits:           token.ModelLimits,
+		AllowIps:              token.AllowIps,
+		Group:                 token.Group,
+		ModelFallbacks:        token.ModelFallbacks,
+		DailyQuotaLimit:       token.DailyQuotaLimit,
+		WeeklyQuotaLimit:      token.WeeklyQuotaLimit,
+		MonthlyQuotaLimit:     token.MonthlyQuotaLimit,
+		RpmLimit:              token.RpmLimit,
+		TpmLimit:              token.TpmLimit,
+		ResponseCacheEnabled:  token.ResponseCacheEnabled,
+		PayloadCaptureEnabled: token.PayloadCaptureEnabled,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -214,6 +274,23 @@ func UpdateToken(c *gin.Context) {
 		})
 		return
 	}
+	if token.ModelFallbacks != "" {
+		var fallbacks map[string][]string
+		if err := json.Unmarshal([]byte(token.ModelFallbacks), &fallbacks); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "替代模型配置格式错误",
+			})
+			return
+		}
+	}
+	if token.DailyQuotaLimit < 0 || token.WeeklyQuotaLimit < 0 || token.MonthlyQuotaLimit < 0 || token.RpmLimit < 0 || token.TpmLimit < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "额度与速率限制不能为负数",
+		})
+		return
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -250,6 +327,14 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.ModelLimits = token.ModelLimits
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
+		cleanToken.ModelFallbacks = token.ModelFallbacks
+		cleanToken.DailyQuotaLimit = token.DailyQuotaLimit
+		cleanToken.WeeklyQuotaLimit = token.WeeklyQuotaLimit
+		cleanToken.MonthlyQuotaLimit = token.MonthlyQuotaLimit
+		cleanToken.RpmLimit = token.RpmLimit
+		cleanToken.TpmLimit = token.TpmLimit
+		cleanToken.ResponseCacheEnabled = token.ResponseCacheEnabled
+		cleanToken.PayloadCaptureEnabled = token.PayloadCaptureEnabled
 	}
 	err = cleanToken.Update()
 	if err != nil {
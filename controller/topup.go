@@ -1,24 +1,23 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"net/url"
+	"net/http"
 	"tea-api/common"
 	"tea-api/model"
 	"tea-api/service"
 	"tea-api/setting"
 	"strconv"
-	"sync"
 	"time"
 
-	"github.com/Calcium-Ion/go-epay/epay"
 	"github.com/gin-gonic/gin"
-	"github.com/samber/lo"
 	"github.com/shopspring/decimal"
 )
 
-type EpayRequest struct {
+type PaymentRequest struct {
 	Amount        int64  `json:"amount"`
 	PaymentMethod string `json:"payment_method"`
 	TopUpCode     string `json:"top_up_code"`
@@ -29,20 +28,6 @@ type AmountRequest struct {
 	TopUpCode string `json:"top_up_code"`
 }
 
-func GetEpayClient() *epay.Client {
-	if setting.PayAddress == "" || setting.EpayId == "" || setting.EpayKey == "" {
-		return nil
-	}
-	withUrl, err := epay.NewClient(&epay.Config{
-		PartnerID: setting.EpayId,
-		Key:       setting.EpayKey,
-	}, setting.PayAddress)
-	if err != nil {
-		return nil
-	}
-	return withUrl
-}
-
 func getPayMoney(amount int64, group string) float64 {
 	dAmount := decimal.NewFromInt(amount)
 
@@ -57,7 +42,7 @@ func getPayMoney(amount int64, group string) float64 {
 	}
 
 	dTopupGroupRatio := decimal.NewFromFloat(topupGroupRatio)
-	dPrice := decimal.NewFromFloat(setting.Price)
+	dPrice := decimal.NewFromFloat(service.GetPaymentPrice())
 
 	payMoney := dAmount.Mul(dPrice).Mul(dTopupGroupRatio)
 
@@ -74,8 +59,9 @@ func getMinTopup() int64 {
 	return int64(minTopup)
 }
 
-func RequestEpay(c *gin.Context) {
-	var req EpayRequest
+// RequestPayment 通过当前选择的支付渠道创建充值订单
+func RequestPayment(c *gin.Context) {
+	var req PaymentRequest
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
 		c.JSON(200, gin.H{"message": "error", "data": "参数错误"})
@@ -97,34 +83,29 @@ func RequestEpay(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "error", "data": "充值金额过低"})
 		return
 	}
+	provider, err := service.GetPaymentProvider()
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "当前管理员未配置支付信息"})
+		return
+	}
 	payType := "wxpay"
 	if req.PaymentMethod == "zfb" {
 		payType = "alipay"
 	}
-	if req.PaymentMethod == "wx" {
-		req.PaymentMethod = "wxpay"
-		payType = "wxpay"
-	}
 	callBackAddress := service.GetCallbackAddress()
-	returnUrl, _ := url.Parse(setting.ServerAddress + "/log")
-	notifyUrl, _ := url.Parse(callBackAddress + "/api/user/epay/notify")
 	tradeNo := fmt.Sprintf("%s%d", common.GetRandomString(6), time.Now().Unix())
 	tradeNo = fmt.Sprintf("USR%dNO%s", id, tradeNo)
-	client := GetEpayClient()
-	if client == nil {
-		c.JSON(200, gin.H{"message": "error", "data": "当前管理员未配置支付信息"})
-		return
-	}
-	uri, params, err := client.Purchase(&epay.PurchaseArgs{
-		Type:           payType,
-		ServiceTradeNo: tradeNo,
-		Name:           fmt.Sprintf("TUC%d", req.Amount),
-		Money:          strconv.FormatFloat(payMoney, 'f', 2, 64),
-		Device:         epay.PC,
-		NotifyUrl:      notifyUrl,
-		ReturnUrl:      returnUrl,
+	checkout, err := provider.CreateCheckout(c.Request.Context(), &service.PaymentOrder{
+		TradeNo:       tradeNo,
+		Name:          fmt.Sprintf("TUC%d", req.Amount),
+		Money:         payMoney,
+		PaymentMethod: payType,
+		NotifyUrl:     callBackAddress + "/api/user/epay/notify",
+		ReturnUrl:     setting.ServerAddress + "/log",
+		CancelUrl:     setting.ServerAddress + "/topup",
 	})
 	if err != nil {
+		common.SysError(fmt.Sprintf("failed to create %s checkout: %s", provider.Name(), err.Error()))
 		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
 		return
 	}
@@ -135,109 +116,90 @@ func RequestEpay(c *gin.Context) {
 		amount = dAmount.Div(dQuotaPerUnit).IntPart()
 	}
 	topUp := &model.TopUp{
-		UserId:     id,
-		Amount:     amount,
-		Money:      payMoney,
-		TradeNo:    tradeNo,
-		CreateTime: time.Now().Unix(),
-		Status:     "pending",
+		UserId:          id,
+		Amount:          amount,
+		Money:           payMoney,
+		TradeNo:         tradeNo,
+		CreateTime:      time.Now().Unix(),
+		Status:          model.TopUpStatusPending,
+		PaymentProvider: provider.Name(),
+		ProviderOrderId: checkout.ProviderOrderId,
 	}
 	err = topUp.Insert()
 	if err != nil {
 		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
 		return
 	}
-	c.JSON(200, gin.H{"message": "success", "data": params, "url": uri})
+	c.JSON(200, gin.H{"message": "success", "data": checkout.Params, "url": checkout.URL})
 }
 
-// tradeNo lock
-var orderLocks sync.Map
-var createLock sync.Mutex
-
-// LockOrder 尝试对给定订单号加锁
-func LockOrder(tradeNo string) {
-	lock, ok := orderLocks.Load(tradeNo)
-	if !ok {
-		createLock.Lock()
-		defer createLock.Unlock()
-		lock, ok = orderLocks.Load(tradeNo)
-		if !ok {
-			lock = new(sync.Mutex)
-			orderLocks.Store(tradeNo, lock)
-		}
+// completePaymentTopUp 支付成功后为订单入账，重复的回调不会重复增加额度
+func completePaymentTopUp(providerName string, event *service.PaymentEvent) error {
+	topUp, credited, err := model.CompleteTopUp(event.TradeNo, providerName, event.ProviderOrderId)
+	if errors.Is(err, model.ErrTopUpNotFound) {
+		// 不是本系统创建的订单，确认收到即可，避免支付渠道反复重试
+		log.Printf("%s 支付回调未找到订单: %s", providerName, event.TradeNo)
+		return nil
 	}
-	lock.(*sync.Mutex).Lock()
+	if err != nil {
+		return err
+	}
+	if credited {
+		log.Printf("%s 支付回调更新用户成功 %v", providerName, topUp)
+		model.RecordLog(topUp.UserId, model.LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%f", common.LogQuota(topUp.Quota()), topUp.Money))
+	}
+	return nil
 }
 
-// UnlockOrder 释放给定订单号的锁
-func UnlockOrder(tradeNo string) {
-	lock, ok := orderLocks.Load(tradeNo)
-	if ok {
-		lock.(*sync.Mutex).Unlock()
+// handlePaymentWebhook 校验支付回调并为支付成功的订单入账，verified 表示签名校验是否通过
+func handlePaymentWebhook(c *gin.Context, providerName string) (verified bool, err error) {
+	provider, err := service.GetPaymentProviderByName(providerName)
+	if err != nil {
+		return false, err
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return false, err
+	}
+	event, err := provider.VerifyWebhook(c.Request, body)
+	if err != nil {
+		return false, err
 	}
+	if !event.Paid {
+		return true, nil
+	}
+	return true, completePaymentTopUp(providerName, event)
 }
 
 func EpayNotify(c *gin.Context) {
-	params := lo.Reduce(lo.Keys(c.Request.URL.Query()), func(r map[string]string, t string, i int) map[string]string {
-		r[t] = c.Request.URL.Query().Get(t)
-		return r
-	}, map[string]string{})
-	client := GetEpayClient()
-	if client == nil {
-		log.Println("易支付回调失败 未找到配置信息")
-		_, err := c.Writer.Write([]byte("fail"))
-		if err != nil {
-			log.Println("易支付回调写入失败")
-			return
-		}
+	verified, err := handlePaymentWebhook(c, setting.PaymentProviderEpay)
+	if err != nil {
+		log.Printf("易支付回调处理失败: %v", err)
+		_, _ = c.Writer.Write([]byte("fail"))
+		return
 	}
-	verifyInfo, err := client.Verify(params)
-	if err == nil && verifyInfo.VerifyStatus {
-		_, err := c.Writer.Write([]byte("success"))
-		if err != nil {
-			log.Println("易支付回调写入失败")
-		}
-	} else {
-		_, err := c.Writer.Write([]byte("fail"))
-		if err != nil {
-			log.Println("易支付回调写入失败")
-		}
-		log.Println("易支付回调签名验证失败")
+	if !verified {
+		_, _ = c.Writer.Write([]byte("fail"))
 		return
 	}
+	_, _ = c.Writer.Write([]byte("success"))
+}
 
-	if verifyInfo.TradeStatus == epay.StatusTradeSuccess {
-		log.Println(verifyInfo)
-		LockOrder(verifyInfo.ServiceTradeNo)
-		defer UnlockOrder(verifyInfo.ServiceTradeNo)
-		topUp := model.GetTopUpByTradeNo(verifyInfo.ServiceTradeNo)
-		if topUp == nil {
-			log.Printf("易支付回调未找到订单: %v", verifyInfo)
-			return
-		}
-		if topUp.Status == "pending" {
-			topUp.Status = "success"
-			err := topUp.Update()
-			if err != nil {
-				log.Printf("易支付回调更新订单失败: %v", topUp)
-				return
-			}
-			//user, _ := model.GetUserById(topUp.UserId, false)
-			//user.Quota += topUp.Amount * 500000
-			dAmount := decimal.NewFromInt(int64(topUp.Amount))
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd := int(dAmount.Mul(dQuotaPerUnit).IntPart())
-			err = model.IncreaseUserQuota(topUp.UserId, quotaToAdd, true)
-			if err != nil {
-				log.Printf("易支付回调更新用户失败: %v", topUp)
-				return
-			}
-			log.Printf("易支付回调更新用户成功 %v", topUp)
-			model.RecordLog(topUp.UserId, model.LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%f", common.LogQuota(quotaToAdd), topUp.Money))
-		}
-	} else {
-		log.Printf("易支付异常回调: %v", verifyInfo)
+// StripeWebhook Stripe 回调，在 Stripe 后台将 Webhook 地址配置为 回调地址/api/user/stripe/webhook
+func StripeWebhook(c *gin.Context) {
+	verified, err := handlePaymentWebhook(c, setting.PaymentProviderStripe)
+	if !verified {
+		log.Printf("Stripe 回调验证失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook"})
+		return
+	}
+	if err != nil {
+		// 返回非 2xx 让 Stripe 稍后重试
+		log.Printf("Stripe 回调处理失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
+	c.JSON(http.StatusOK, gin.H{"received": true})
 }
 
 func RequestAmount(c *gin.Context) {
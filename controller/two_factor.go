@@ -0,0 +1,394 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tea-api/common"
+	"tea-api/middleware"
+	"tea-api/model"
+	"tea-api/service"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// twoFactorLoginTimeout 完成第一步登录后，需要在该时长（秒）内输入两步验证码
+const twoFactorLoginTimeout = 5 * 60
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// resetTwoFactorSession 清除待验证的登录状态，并按本次登录是否通过两步验证设置验证时间
+func resetTwoFactorSession(session sessions.Session, verified bool) {
+	session.Delete(middleware.SessionKeyTwoFactorPendingId)
+	session.Delete(middleware.SessionKeyTwoFactorPendingTime)
+	if verified {
+		session.Set(middleware.SessionKeyTwoFactorVerifiedAt, time.Now().Unix())
+	} else {
+		session.Delete(middleware.SessionKeyTwoFactorVerifiedAt)
+	}
+}
+
+// setupTwoFactorLogin 完成第一步登录，记录待验证的用户，此时会话仍处于未登录状态
+func setupTwoFactorLogin(user *model.User, c *gin.Context) {
+	session := sessions.Default(c)
+	for _, key := range []string{"id", "username", "role", "status", "group", middleware.SessionKeyTwoFactorVerifiedAt} {
+		session.Delete(key)
+	}
+	session.Set(middleware.SessionKeyTwoFactorPendingId, user.Id)
+	session.Set(middleware.SessionKeyTwoFactorPendingTime, time.Now().Unix())
+	if err := session.Save(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "无法保存会话信息，请重试",
+			"success": false,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "",
+		"success": true,
+		"data": gin.H{
+			"require_two_factor": true,
+		},
+	})
+}
+
+// LoginTwoFactor 登录的第二步，校验动态验证码或恢复码后完成登录
+func LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "无效的参数",
+			"success": false,
+		})
+		return
+	}
+	session := sessions.Default(c)
+	userId, ok := session.Get(middleware.SessionKeyTwoFactorPendingId).(int)
+	pendingTime, _ := session.Get(middleware.SessionKeyTwoFactorPendingTime).(int64)
+	if !ok || time.Now().Unix()-pendingTime > twoFactorLoginTimeout {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "登录已过期，请重新登录",
+			"success": false,
+		})
+		return
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "用户已被封禁",
+			"success": false,
+		})
+		return
+	}
+	if err = service.VerifyUserTwoFactor(user, req.Code); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	completeLogin(user, c, true)
+}
+
+// GetTwoFactorStatus 获取当前用户的两步验证状态
+func GetTwoFactorStatus(c *gin.Context) {
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"enabled":                  user.TwoFactorEnabled,
+			"required":                 service.IsTwoFactorRequired(user.Role),
+			"recovery_codes_remaining": len(user.GetTwoFactorRecoveryCodes()),
+		},
+	})
+}
+
+// SetupTwoFactor 生成新的密钥，用户在验证器应用中添加后调用 EnableTwoFactor 确认
+func SetupTwoFactor(c *gin.Context) {
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "已启用两步验证",
+		})
+		return
+	}
+	secret, err := common.GenerateTOTPSecret()
+	if err == nil {
+		err = model.SetTwoFactorSecret(user.Id, secret)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"secret": secret,
+			"uri":    common.TOTPProvisioningURI(common.SystemName, user.Username, secret),
+		},
+	})
+}
+
+// EnableTwoFactor 使用验证器应用生成的验证码确认密钥并启用两步验证，返回只展示一次的恢复码
+func EnableTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "已启用两步验证",
+		})
+		return
+	}
+	if user.TwoFactorSecret == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "请先生成两步验证密钥",
+		})
+		return
+	}
+	counter, ok := common.ValidateTOTPCode(user.TwoFactorSecret, req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": service.ErrTwoFactorCodeInvalid.Error(),
+		})
+		return
+	}
+	codes, hashes, err := service.GenerateTwoFactorRecoveryCodes()
+	if err == nil {
+		err = model.EnableTwoFactor(user.Id, user.TwoFactorSecret, counter, hashes)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !c.GetBool("use_access_token") {
+		session := sessions.Default(c)
+		resetTwoFactorSession(session, true)
+		if err = session.Save(); err != nil {
+			common.SysError("failed to save two factor session: " + err.Error())
+		}
+	}
+	model.RecordLog(user.Id, model.LogTypeSystem, "启用了两步验证")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// verifySelfTwoFactor 读取请求中的验证码并校验当前用户的两步验证，失败时已写入响应
+func verifySelfTwoFactor(c *gin.Context) (*model.User, bool) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return nil, false
+	}
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err == nil {
+		err = service.VerifyUserTwoFactor(user, req.Code)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+	return user, true
+}
+
+// DisableTwoFactor 关闭两步验证，角色要求两步验证时不能关闭
+func DisableTwoFactor(c *gin.Context) {
+	if service.IsTwoFactorRequired(c.GetInt("role")) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "当前账户必须启用两步验证，无法关闭",
+		})
+		return
+	}
+	user, ok := verifySelfTwoFactor(c)
+	if !ok {
+		return
+	}
+	if err := model.DisableTwoFactor(user.Id); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !c.GetBool("use_access_token") {
+		session := sessions.Default(c)
+		resetTwoFactorSession(session, false)
+		if err := session.Save(); err != nil {
+			common.SysError("failed to save two factor session: " + err.Error())
+		}
+	}
+	model.RecordLog(user.Id, model.LogTypeSystem, "关闭了两步验证")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// RegenerateTwoFactorRecoveryCodes 重新生成恢复码，原有的恢复码全部失效
+func RegenerateTwoFactorRecoveryCodes(c *gin.Context) {
+	user, ok := verifySelfTwoFactor(c)
+	if !ok {
+		return
+	}
+	codes, hashes, err := service.GenerateTwoFactorRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	updated, err := model.UpdateTwoFactorRecoveryCodes(user, hashes)
+	if err == nil && !updated {
+		err = model.ErrTwoFactorStateChanged
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordLog(user.Id, model.LogTypeSystem, "重新生成了两步验证恢复码")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// VerifyTwoFactor 在当前会话中重新进行两步验证，之后的 TwoFactorVerifyWindow 内执行敏感操作无需再次输入验证码
+func VerifyTwoFactor(c *gin.Context) {
+	if _, ok := verifySelfTwoFactor(c); !ok {
+		return
+	}
+	if !c.GetBool("use_access_token") {
+		session := sessions.Default(c)
+		session.Set(middleware.SessionKeyTwoFactorVerifiedAt, time.Now().Unix())
+		if err := session.Save(); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无法保存会话信息，请重试",
+			})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"expires_in": service.TwoFactorVerifyWindow,
+		},
+	})
+}
+
+// ResetUserTwoFactor 管理员为丢失验证器的用户关闭两步验证，用户下次登录后需重新启用
+func ResetUserTwoFactor(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if c.GetInt("role") <= user.Role {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权重置同权限等级或更高权限等级用户的两步验证",
+		})
+		return
+	}
+	if !user.TwoFactorEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": service.ErrTwoFactorNotEnabled.Error(),
+		})
+		return
+	}
+	if err = model.DisableTwoFactor(user.Id); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordLog(user.Id, model.LogTypeManage, fmt.Sprintf("管理员 %s 重置了两步验证", c.GetString("username")))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -66,7 +66,17 @@ func Login(c *gin.Context) {
 
 // setup session & cookies and then return user info
 func setupLogin(user *model.User, c *gin.Context) {
+	if user.TwoFactorEnabled {
+		// 启用了两步验证的用户需要再调用 /api/user/login/2fa 完成登录
+		setupTwoFactorLogin(user, c)
+		return
+	}
+	completeLogin(user, c, false)
+}
+
+func completeLogin(user *model.User, c *gin.Context, twoFactorVerified bool) {
 	session := sessions.Default(c)
+	resetTwoFactorSession(session, twoFactorVerified)
 	session.Set("id", user.Id)
 	session.Set("username", user.Username)
 	session.Set("role", user.Role)
@@ -943,6 +953,7 @@ type UpdateUserSettingRequest struct {
 	WebhookSecret              string  `json:"webhook_secret,omitempty"`
 	NotificationEmail          string  `json:"notification_email,omitempty"`
 	AcceptUnsetModelRatioModel bool    `json:"accept_unset_model_ratio_model"`
+	PayloadCapture             bool    `json:"payload_capture"`
 }
 
 func UpdateUserSetting(c *gin.Context) {
@@ -1019,6 +1030,7 @@ func UpdateUserSetting(c *gin.Context) {
 		constant.UserSettingNotifyType:            req.QuotaWarningType,
 		constant.UserSettingQuotaWarningThreshold: req.QuotaWarningThreshold,
 		"accept_unset_model_ratio_model":          req.AcceptUnsetModelRatioModel,
+		constant.UserSettingPayloadCapture:        req.PayloadCapture,
 	}
 
 	// 如果是webhook类型,添加webhook相关设置
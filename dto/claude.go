@@ -216,3 +216,7 @@ type ClaudeUsage struct {
 	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
 	OutputTokens             int `json:"output_tokens"`
 }
+
+type ClaudeCountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
+}
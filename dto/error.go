@@ -13,6 +13,13 @@ type OpenAIErrorWithStatusCode struct {
 	LocalError bool
 }
 
+// GeminiError Gemini 原生接口的错误格式
+type GeminiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
 type GeneralErrorResponse struct {
 	Error    OpenAIError `json:"error"`
 	Message  string      `json:"message"`
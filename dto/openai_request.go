@@ -391,7 +391,7 @@ type OpenAIResponsesRequest struct {
 	ServiceTier        string               `json:"service_tier,omitempty"`
 	Store              bool                 `json:"store,omitempty"`
 	Stream             bool                 `json:"stream,omitempty"`
-	Temperature        float64              `json:"temperature,omitempty"`
+	Temperature        *float64             `json:"temperature,omitempty"`
 	Text               json.RawMessage      `json:"text,omitempty"`
 	ToolChoice         json.RawMessage      `json:"tool_choice,omitempty"`
 	Tools              []ResponsesToolsCall `json:"tools,omitempty"`
@@ -400,6 +400,45 @@ type OpenAIResponsesRequest struct {
 	User               string               `json:"user,omitempty"`
 }
 
+// ResponsesInputItem /v1/responses 请求 input 数组中的一项：消息、函数调用、函数调用结果或推理内容
+type ResponsesInputItem struct {
+	Type    string          `json:"type,omitempty"`
+	Role    string          `json:"role,omitempty"`
+	Content json.RawMessage `json:"content,omitempty"`
+	// function_call 与 function_call_output
+	CallId    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Output    json.RawMessage `json:"output,omitempty"`
+	// reasoning
+	Summary []ResponsesReasoningSummary `json:"summary,omitempty"`
+}
+
+// ResponsesInputContent 消息内容数组中的一项
+type ResponsesInputContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageUrl string `json:"image_url,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	FileId   string `json:"file_id,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Refusal  string `json:"refusal,omitempty"`
+}
+
+// ResponsesTextFormat 请求中 text.format 指定的输出格式
+type ResponsesTextFormat struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Schema      any    `json:"schema,omitempty"`
+	Strict      any    `json:"strict,omitempty"`
+}
+
+type ResponsesText struct {
+	Format *ResponsesTextFormat `json:"format,omitempty"`
+}
+
 type Reasoning struct {
 	Effort  string `json:"effort,omitempty"`
 	Summary string `json:"summary,omitempty"`
@@ -214,21 +214,28 @@ type OpenAIResponsesResponse struct {
 	Tools              []ResponsesToolsCall `json:"tools"`
 	TopP               float64              `json:"top_p"`
 	Truncation         string               `json:"truncation"`
-	Usage              *Usage               `json:"usage"`
+	Usage              *ResponsesUsage      `json:"usage"`
 	User               json.RawMessage      `json:"user"`
 	Metadata           json.RawMessage      `json:"metadata"`
 }
 
 type IncompleteDetails struct {
-	Reasoning string `json:"reasoning"`
+	Reasoning string `json:"reasoning,omitempty"`
+	Reason    string `json:"reason,omitempty"`
 }
 
 type ResponsesOutput struct {
 	Type    string                   `json:"type"`
 	ID      string                   `json:"id"`
-	Status  string                   `json:"status"`
-	Role    string                   `json:"role"`
-	Content []ResponsesOutputContent `json:"content"`
+	Status  string                   `json:"status,omitempty"`
+	Role    string                   `json:"role,omitempty"`
+	Content []ResponsesOutputContent `json:"content,omitempty"`
+	// function_call
+	CallId    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	// reasoning
+	Summary []ResponsesReasoningSummary `json:"summary,omitempty"`
 }
 
 type ResponsesOutputContent struct {
@@ -237,6 +244,28 @@ type ResponsesOutputContent struct {
 	Annotations []interface{} `json:"annotations"`
 }
 
+type ResponsesReasoningSummary struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// ResponsesUsage /v1/responses 响应中的用量
+type ResponsesUsage struct {
+	InputTokens         int                          `json:"input_tokens"`
+	OutputTokens        int                          `json:"output_tokens"`
+	TotalTokens         int                          `json:"total_tokens"`
+	InputTokensDetails  ResponsesInputTokensDetails  `json:"input_tokens_details"`
+	OutputTokensDetails ResponsesOutputTokensDetails `json:"output_tokens_details"`
+}
+
+type ResponsesInputTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type ResponsesOutputTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
 const (
 	BuildInToolWebSearchPreview = "web_search_preview"
 	BuildInToolFileSearch       = "file_search"
@@ -251,10 +280,25 @@ const (
 	ResponsesOutputTypeItemDone  = "response.output_item.done"
 )
 
+const (
+	ResponsesItemTypeMessage            = "message"
+	ResponsesItemTypeFunctionCall       = "function_call"
+	ResponsesItemTypeFunctionCallOutput = "function_call_output"
+	ResponsesItemTypeReasoning          = "reasoning"
+)
+
 // ResponsesStreamResponse 用于处理 /v1/responses 流式响应
 type ResponsesStreamResponse struct {
-	Type     string                   `json:"type"`
-	Response *OpenAIResponsesResponse `json:"response,omitempty"`
-	Delta    string                   `json:"delta,omitempty"`
-	Item     *ResponsesOutput         `json:"item,omitempty"`
+	Type           string                   `json:"type"`
+	SequenceNumber int                      `json:"sequence_number"`
+	Response       *OpenAIResponsesResponse `json:"response,omitempty"`
+	Delta          string                   `json:"delta,omitempty"`
+	Item           *ResponsesOutput         `json:"item,omitempty"`
+	ItemId         string                   `json:"item_id,omitempty"`
+	OutputIndex    *int                     `json:"output_index,omitempty"`
+	ContentIndex   *int                     `json:"content_index,omitempty"`
+	SummaryIndex   *int                     `json:"summary_index,omitempty"`
+	Part           any                      `json:"part,omitempty"`
+	Text           string                   `json:"text,omitempty"`
+	Arguments      string                   `json:"arguments,omitempty"`
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"io"
@@ -148,10 +149,22 @@ func main() {
 	operation_setting.InitRatioSettings()
 	// Initialize constants
 	constant.InitEnv()
+	common.InitLatencyOptimization()
 	// Initialize options
 	model.InitOptionMap()
 
+	if constant.OtelEnabled {
+		shutdownTracing, err := common.InitTracing(constant.OtelExporterProtocol, constant.OtelServiceName)
+		if err != nil {
+			common.FatalLog("failed to initialize tracing: " + err.Error())
+		}
+		defer shutdownTracing(context.Background())
+		common.SysLog("opentelemetry tracing enabled")
+	}
+
 	service.InitTokenEncoders()
+	service.InitChannelManager()
+	service.InitLatencyStats()
 
 	if common.RedisEnabled {
 		// for compatibility with old versions
@@ -195,7 +208,13 @@ func main() {
 		if err != nil {
 			common.FatalLog("failed to parse CHANNEL_TEST_FREQUENCY: " + err.Error())
 		}
-		go controller.AutomaticallyTestChannels(frequency)
+		// 兼容旧的环境变量，等同于开启自动测试并设置默认间隔
+		autoTestSetting := operation_setting.GetChannelAutoTestSetting()
+		autoTestSetting.Enabled = true
+		autoTestSetting.IntervalMinutes = frequency
+	}
+	if common.IsMasterNode {
+		controller.StartChannelAutoTest()
 	}
 	if common.IsMasterNode && constant.UpdateTask {
 		gopool.Go(func() {
@@ -233,6 +252,7 @@ func main() {
 	// This will cause SSE not to work!!!
 	//server.Use(gzip.Gzip(gzip.DefaultCompression))
 	server.Use(middleware.RequestId())
+	server.Use(middleware.Tracing())
 
 	// 安全中间件 - 按优先级顺序添加
 	server.Use(middleware.IPBlacklist())           // IP黑名单检查（最高优先级）
@@ -253,6 +273,20 @@ func main() {
 	server.Use(sessions.Sessions("session", store))
 
 	router.SetRouter(server, buildFS, indexPage)
+	if common.IsMasterNode {
+		gopool.Go(func() {
+			service.RunBatchWorker(router.NewBatchRelayHandler())
+		})
+		gopool.Go(func() {
+			service.CleanStoredResponses()
+		})
+		gopool.Go(func() {
+			service.CleanPayloadCaptures()
+		})
+		gopool.Go(func() {
+			service.UpdateSubscriptions()
+		})
+	}
 	var port = os.Getenv("PORT")
 	if port == "" {
 		port = strconv.Itoa(*common.Port)
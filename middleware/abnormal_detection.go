@@ -12,6 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"tea-api/common"
 	"tea-api/dto"
+	"tea-api/model"
 	"tea-api/setting"
 )
 
@@ -32,8 +33,93 @@ type requestMetrics struct {
 	requestInterval time.Duration
 }
 
+// requestStats 单个 IP 记录本次请求后的统计
+type requestStats struct {
+	count           int // 1 秒窗口内的请求数
+	streamRequests  int64
+	largePrompts    int64
+	suspiciousScore int64
+}
+
+// requestTrackerStore 异常行为统计的存储，启用 Redis 时在集群内共享
+type requestTrackerStore interface {
+	// track 记录一次请求并返回记录后的统计
+	track(identifier string, metrics requestMetrics, now time.Time) (requestStats, error)
+	// addScore 累加可疑分数并返回最新分数
+	addScore(identifier string, delta int64) (int64, error)
+}
+
 var reqMap sync.Map
 
+// memoryRequestTrackerStore 单机内存实现
+type memoryRequestTrackerStore struct{}
+
+func (s *memoryRequestTrackerStore) getTracker(identifier string) *requestTracker {
+	val, _ := reqMap.LoadOrStore(identifier, &requestTracker{
+		lastResetTime: time.Now(),
+	})
+	return val.(*requestTracker)
+}
+
+func (s *memoryRequestTrackerStore) track(identifier string, metrics requestMetrics, now time.Time) (requestStats, error) {
+	tracker := s.getTracker(identifier)
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	// 重置每小时统计
+	if now.Sub(tracker.lastResetTime) > time.Hour {
+		tracker.totalRequests = 0
+		tracker.streamRequests = 0
+		tracker.largePrompts = 0
+		tracker.suspiciousScore = 0
+		tracker.lastResetTime = now
+	}
+
+	tracker.times = append(tracker.times, now)
+	tracker.totalRequests++
+	if metrics.isStream {
+		tracker.streamRequests++
+	}
+	if metrics.promptLength > MaxPromptLength {
+		tracker.largePrompts++
+	}
+
+	// 清理旧的时间记录 (1秒窗口)
+	window := now.Add(-1 * time.Second)
+	i := 0
+	for ; i < len(tracker.times); i++ {
+		if tracker.times[i].After(window) {
+			break
+		}
+	}
+	tracker.times = tracker.times[i:]
+
+	return requestStats{
+		count:           len(tracker.times),
+		streamRequests:  tracker.streamRequests,
+		largePrompts:    tracker.largePrompts,
+		suspiciousScore: tracker.suspiciousScore,
+	}, nil
+}
+
+func (s *memoryRequestTrackerStore) addScore(identifier string, delta int64) (int64, error) {
+	tracker := s.getTracker(identifier)
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	tracker.suspiciousScore += delta
+	return tracker.suspiciousScore, nil
+}
+
+var memoryTrackerStore = &memoryRequestTrackerStore{}
+var redisTrackerStore = &redisRequestTrackerStore{}
+
+func getRequestTrackerStore() requestTrackerStore {
+	if securityRedisEnabled() {
+		return redisTrackerStore
+	}
+	return memoryTrackerStore
+}
+
 // 恶意行为检测阈值
 const (
 	MaxPromptLength        = 50000  // 最大 Prompt 长度
@@ -54,70 +140,63 @@ func AbnormalDetection() gin.HandlerFunc {
 		}
 
 		identifier := c.ClientIP()
-		val, _ := reqMap.LoadOrStore(identifier, &requestTracker{
-			lastResetTime: time.Now(),
-		})
-		tracker := val.(*requestTracker)
 		now := time.Now()
 
 		// 分析请求内容
 		metrics := analyzeRequest(c)
 
-		tracker.mu.Lock()
-		defer tracker.mu.Unlock()
-
-		// 重置每小时统计
-		if now.Sub(tracker.lastResetTime) > time.Hour {
-			tracker.totalRequests = 0
-			tracker.streamRequests = 0
-			tracker.largePrompts = 0
-			tracker.suspiciousScore = 0
-			tracker.lastResetTime = now
+		store := getRequestTrackerStore()
+		stats, err := store.track(identifier, metrics, now)
+		if err != nil {
+			// Redis 不可用时退回本机统计
+			common.SysError("failed to track request in redis: " + err.Error())
+			store = memoryTrackerStore
+			stats, _ = store.track(identifier, metrics, now)
 		}
-
-		tracker.times = append(tracker.times, now)
-		tracker.totalRequests++
-
-		// 清理旧的时间记录 (1秒窗口)
-		window := now.Add(-1 * time.Second)
-		i := 0
-		for ; i < len(tracker.times); i++ {
-			if tracker.times[i].After(window) {
-				break
-			}
-		}
-		tracker.times = tracker.times[i:]
-		count := len(tracker.times)
+		count := stats.count
 
 		// 计算可疑分数
-		suspiciousScore := calculateSuspiciousScore(metrics, tracker, count)
-		tracker.suspiciousScore += suspiciousScore
+		suspiciousScore := calculateSuspiciousScore(metrics, stats)
 
 		// 高频请求检测 - 使用新的配置结构
 		maxRequestsPerSecond := 10 // 默认阈值
 		if count > maxRequestsPerSecond {
 			common.SysLog(fmt.Sprintf("abnormal high frequency from %s: %d req/s", identifier, count))
-			tracker.suspiciousScore += 20
+			suspiciousScore += 20
 
 			// 记录安全日志
-			setting.AddSecurityLog("rate_limit", identifier,
-				fmt.Sprintf("高频请求: %d req/s", count), "rate_limited",
-				map[string]interface{}{
+			recordSecurityEvent(c, &model.SecurityEvent{
+				Rule:    "rate_limit",
+				IP:      identifier,
+				Message: fmt.Sprintf("高频请求: %d req/s", count),
+				Action:  "rate_limited",
+				Score:   suspiciousScore,
+			}, map[string]interface{}{
 					"requests_per_second": count,
 					"threshold": maxRequestsPerSecond,
 				})
 		}
+		if score, err := store.addScore(identifier, suspiciousScore); err == nil {
+			stats.suspiciousScore = score
+		} else {
+			common.SysError("failed to add suspicious score: " + err.Error())
+			stats.suspiciousScore += suspiciousScore
+		}
 
 		// 恶意行为检测
-		if detectMaliciousBehavior(metrics, tracker, identifier) {
+		if detectMaliciousBehavior(metrics, stats, identifier) {
 			// 记录安全日志
-			setting.AddSecurityLog("malicious_detection", identifier,
-				"检测到恶意行为：token浪费攻击", "blocked",
-				map[string]interface{}{
+			recordSecurityEvent(c, &model.SecurityEvent{
+				Rule:    "malicious_detection",
+				IP:      identifier,
+				Message: "检测到恶意行为：token浪费攻击",
+				Action:  "blocked",
+				Score:   suspiciousScore,
+			}, map[string]interface{}{
 					"prompt_length": metrics.promptLength,
 					"random_chars": metrics.hasRandomChars,
 					"stream": metrics.isStream,
-					"suspicious_score": tracker.suspiciousScore,
+					"suspicious_score": stats.suspiciousScore,
 				})
 
 			// 自动加入黑名单
@@ -127,10 +206,20 @@ func AbnormalDetection() gin.HandlerFunc {
 		}
 
 		// 可疑分数过高
-		if tracker.suspiciousScore > SuspiciousScoreLimit {
-			common.SysLog(fmt.Sprintf("suspicious score too high from %s: %d", identifier, tracker.suspiciousScore))
+		if stats.suspiciousScore > SuspiciousScoreLimit {
+			common.SysLog(fmt.Sprintf("suspicious score too high from %s: %d", identifier, stats.suspiciousScore))
+			recordSecurityEvent(c, &model.SecurityEvent{
+				Rule:    "suspicious_score",
+				IP:      identifier,
+				Message: fmt.Sprintf("可疑行为分数过高：%d", stats.suspiciousScore),
+				Action:  "blocked",
+				Score:   suspiciousScore,
+			}, map[string]interface{}{
+				"total_score": stats.suspiciousScore,
+				"threshold":   SuspiciousScoreLimit,
+			})
 			// 临时封禁高可疑分数的IP
-			AutoBlacklistIP(identifier, fmt.Sprintf("可疑行为分数过高：%d", tracker.suspiciousScore))
+			AutoBlacklistIP(identifier, fmt.Sprintf("可疑行为分数过高：%d", stats.suspiciousScore))
 			abortWithMessage(c, "可疑行为分数过高，请求被限制")
 			return
 		}
@@ -149,8 +238,8 @@ func analyzeRequest(c *gin.Context) requestMetrics {
 		metrics.isStream = true
 	}
 
-	// 分析请求体内容
-	if c.Request.Body != nil && c.Request.Method == "POST" {
+	// 分析请求体内容，文件上传不做分析，避免将整个文件读入内存
+	if c.Request.Body != nil && c.Request.Method == "POST" && !strings.HasPrefix(c.ContentType(), "multipart/") {
 		body, err := io.ReadAll(c.Request.Body)
 		if err == nil {
 			// 重新设置请求体供后续使用
@@ -201,13 +290,12 @@ func isRandomChar(char rune) bool {
 }
 
 // calculateSuspiciousScore 计算可疑分数
-func calculateSuspiciousScore(metrics requestMetrics, tracker *requestTracker, requestCount int) int64 {
+func calculateSuspiciousScore(metrics requestMetrics, stats requestStats) int64 {
 	score := int64(0)
 
 	// 超长 Prompt 加分
 	if metrics.promptLength > MaxPromptLength {
 		score += 30
-		tracker.largePrompts++
 	} else if metrics.promptLength > 20000 {
 		score += 15
 	}
@@ -220,16 +308,15 @@ func calculateSuspiciousScore(metrics requestMetrics, tracker *requestTracker, r
 	// 流式请求加分
 	if metrics.isStream {
 		score += 5
-		tracker.streamRequests++
 	}
 
 	// 高频请求加分
-	if requestCount > 10 {
-		score += int64(requestCount - 10) * 2
+	if stats.count > 10 {
+		score += int64(stats.count - 10) * 2
 	}
 
 	// 流式请求过多加分
-	if tracker.streamRequests > MaxConcurrentStreams {
+	if stats.streamRequests > MaxConcurrentStreams {
 		score += 20
 	}
 
@@ -237,7 +324,7 @@ func calculateSuspiciousScore(metrics requestMetrics, tracker *requestTracker, r
 }
 
 // detectMaliciousBehavior 检测恶意行为
-func detectMaliciousBehavior(metrics requestMetrics, tracker *requestTracker, identifier string) bool {
+func detectMaliciousBehavior(metrics requestMetrics, stats requestStats, identifier string) bool {
 	// 检测典型的 token 浪费攻击模式
 	if metrics.promptLength > MaxPromptLength &&
 		metrics.hasRandomChars &&
@@ -248,14 +335,14 @@ func detectMaliciousBehavior(metrics requestMetrics, tracker *requestTracker, id
 	}
 
 	// 检测过多的大 Prompt 请求
-	if tracker.largePrompts > 10 {
-		common.SysLog(fmt.Sprintf("too many large prompts from %s: %d", identifier, tracker.largePrompts))
+	if stats.largePrompts > 10 {
+		common.SysLog(fmt.Sprintf("too many large prompts from %s: %d", identifier, stats.largePrompts))
 		return true
 	}
 
 	// 检测过多的流式请求
-	if tracker.streamRequests > MaxConcurrentStreams * 2 {
-		common.SysLog(fmt.Sprintf("too many stream requests from %s: %d", identifier, tracker.streamRequests))
+	if stats.streamRequests > MaxConcurrentStreams * 2 {
+		common.SysLog(fmt.Sprintf("too many stream requests from %s: %d", identifier, stats.streamRequests))
 		return true
 	}
 
@@ -5,7 +5,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"tea-api/common"
+	"tea-api/constant"
 	"tea-api/model"
+	"tea-api/service"
 	"strconv"
 	"strings"
 )
@@ -28,6 +30,7 @@ func authHelper(c *gin.Context, minRole int) {
 	id := session.Get("id")
 	status := session.Get("status")
 	useAccessToken := false
+	twoFactorEnabled := false
 	if username == nil {
 		// Check access token
 		accessToken := c.Request.Header.Get("Authorization")
@@ -55,6 +58,7 @@ func authHelper(c *gin.Context, minRole int) {
 			id = user.Id
 			status = user.Status
 			useAccessToken = true
+			twoFactorEnabled = user.TwoFactorEnabled
 		} else {
 			c.JSON(http.StatusOK, gin.H{
 				"success": false,
@@ -116,6 +120,9 @@ func authHelper(c *gin.Context, minRole int) {
 		c.Abort()
 		return
 	}
+	if !checkRequiredTwoFactor(c, session, id.(int), role.(int), useAccessToken, twoFactorEnabled) {
+		return
+	}
 	c.Set("username", username)
 	c.Set("role", role)
 	c.Set("id", id)
@@ -159,6 +166,11 @@ func WssAuth(c *gin.Context) {
 
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		_, endSpan := common.StartGinSpan(c, "middleware.TokenAuth")
+		defer endSpan()
+		requestId := c.GetString(common.RequestIdKey)
+		common.StartLatencyTracking(requestId)
+		defer finishLatencyTracking(c, requestId)
 		// 先检测是否为ws
 		if c.Request.Header.Get("Sec-WebSocket-Protocol") != "" {
 			// Sec-WebSocket-Protocol: realtime, openai-insecure-api-key.sk-xxx, openai-beta.realtime-v1
@@ -182,6 +194,16 @@ func TokenAuth() func(c *gin.Context) {
 				c.Request.Header.Set("Authorization", "Bearer "+key)
 			}
 		}
+		// Gemini 原生接口通过 x-goog-api-key 请求头或 key 查询参数传递令牌
+		if strings.HasPrefix(c.Request.URL.Path, "/v1beta/") {
+			key := c.Request.Header.Get("x-goog-api-key")
+			if key == "" {
+				key = c.Query("key")
+			}
+			if key != "" {
+				c.Request.Header.Set("Authorization", "Bearer "+key)
+			}
+		}
 		key := c.Request.Header.Get("Authorization")
 		parts := make([]string, 0)
 		key = strings.TrimPrefix(key, "Bearer ")
@@ -236,6 +258,9 @@ func TokenAuth() func(c *gin.Context) {
 		}
 		c.Set("allow_ips", token.GetIpLimitsMap())
 		c.Set("token_group", token.Group)
+		c.Set("token_model_fallbacks", token.GetModelFallbacksMap())
+		c.Set(constant.ContextKeyTokenResponseCache, token.ResponseCacheEnabled)
+		c.Set(constant.ContextKeyTokenPayloadCapture, token.PayloadCaptureEnabled)
 		if len(parts) > 1 {
 			if model.IsAdmin(token.UserId) {
 				c.Set("specific_channel_id", parts[1])
@@ -244,6 +269,12 @@ func TokenAuth() func(c *gin.Context) {
 				return
 			}
 		}
+		if status, err := service.CheckTokenLimits(c, token); err != nil {
+			abortWithOpenAiMessage(c, status, err.Error())
+			return
+		}
+		endSpan()
+		common.RecordAuthComplete(requestId)
 		c.Next()
 	}
 }
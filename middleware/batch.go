@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"tea-api/constant"
+	"tea-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BatchRequest 将批处理任务 ID 写入上下文，供计费与日志使用，只用于批处理任务的内部路由
+func BatchRequest() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if batchId := service.GetBatchIdFromContext(c.Request.Context()); batchId != "" {
+			c.Set(constant.ContextKeyBatchId, batchId)
+		}
+		c.Next()
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ModelRequest struct {
@@ -24,6 +25,8 @@ type ModelRequest struct {
 
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		span, endSpan := common.StartGinSpan(c, "middleware.Distribute")
+		defer endSpan()
 		allowIpsMap := c.GetStringMap("allow_ips")
 		if len(allowIpsMap) != 0 {
 			clientIp := c.ClientIP()
@@ -95,7 +98,8 @@ func Distribute() func(c *gin.Context) {
 			}
 
 			if shouldSelectChannel {
-				channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, modelRequest.Model, 0)
+				var usingGroup string
+				channel, usingGroup, err = model.CacheGetRandomSatisfiedChannelWithFallback(userGroup, modelRequest.Model, 0)
 				if err != nil {
 					message := fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道", userGroup, modelRequest.Model)
 					// 如果错误，但是渠道不为空，说明是数据库一致性问题
@@ -111,14 +115,35 @@ func Distribute() func(c *gin.Context) {
 					abortWithOpenAiMessage(c, http.StatusServiceUnavailable, fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道（数据库一致性已被破坏）", userGroup, modelRequest.Model))
 					return
 				}
+				SetupContextForUsingGroup(c, usingGroup)
 			}
 		}
 		c.Set(constant.ContextKeyRequestStartTime, time.Now())
 		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+		span.SetAttributes(attribute.Int("channel.id", c.GetInt("channel_id")), attribute.String("model", modelRequest.Model))
+		endSpan()
 		c.Next()
 	}
 }
 
+// SetupContextForUsingGroup 记录实际选中渠道所在的分组，分组发生变化时追加到回退链
+func SetupContextForUsingGroup(c *gin.Context, usingGroup string) {
+	c.Set(constant.ContextKeyUsingGroup, usingGroup)
+	chain := c.GetStringSlice(constant.ContextKeyGroupFallbackChain)
+	if len(chain) == 0 {
+		if group := c.GetString("group"); group != usingGroup {
+			chain = append(chain, group)
+		}
+	}
+	if len(chain) > 0 && chain[len(chain)-1] == usingGroup {
+		return
+	}
+	if len(chain) > 0 {
+		common.LogInfo(c, fmt.Sprintf("分组 %s 无可用渠道，回退到分组 %s", chain[len(chain)-1], usingGroup))
+	}
+	c.Set(constant.ContextKeyGroupFallbackChain, append(chain, usingGroup))
+}
+
 func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 	var modelRequest ModelRequest
 	shouldSelectChannel := true
@@ -168,6 +193,10 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 	if err != nil {
 		return nil, false, errors.New("无效的请求, " + err.Error())
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+		// Gemini 原生接口的模型名在路径中
+		modelRequest.Model, _ = relayconstant.ParseGeminiModelAction(c.Request.URL.Path)
+	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
 		//wss://api.openai.com/v1/realtime?model=gpt-4o-realtime-preview-2024-10-01
 		modelRequest.Model = c.Query("model")
@@ -222,7 +251,15 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	c.Set("auto_ban", channel.GetAutoBan())
 	c.Set("model_mapping", channel.GetModelMapping())
 	c.Set("status_code_mapping", channel.GetStatusCodeMapping())
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	key, keyIndex, err := channel.GetNextEnabledKey()
+	if err != nil {
+		// 渠道仍为启用状态但密钥已全部禁用，退回默认密钥，由后续的错误处理决定是否禁用渠道
+		common.SysError(fmt.Sprintf("failed to get enabled key for channel #%d: %s", channel.Id, err.Error()))
+		key = channel.GetDefaultKey()
+	}
+	c.Set(constant.ContextKeyChannelIsMultiKey, channel.ChannelInfo.IsMultiKey)
+	c.Set(constant.ContextKeyChannelMultiKeyIndex, keyIndex)
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 	c.Set("base_url", channel.GetBaseURL())
 	// TODO: api_version统一
 	switch channel.Type {
@@ -9,7 +9,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"tea-api/common"
-	"tea-api/setting"
+	"tea-api/model"
 )
 
 // IPBlacklistEntry IP黑名单条目
@@ -44,6 +44,13 @@ const (
 
 // IPBlacklist IP黑名单中间件
 func IPBlacklist() gin.HandlerFunc {
+	// 启用 Redis 时从 Redis 恢复黑白名单，并订阅其他节点的变更
+	if securityRedisEnabled() {
+		if err := ipBlacklistManager.loadFromRedis(); err != nil {
+			common.SysError("failed to load blacklist from redis: " + err.Error())
+		}
+		ipBlacklistManager.subscribeBlacklistEvents()
+	}
 	// 启动清理协程
 	go ipBlacklistManager.cleanupRoutine()
 	
@@ -105,6 +112,41 @@ func (manager *IPBlacklistManager) isBlacklisted(ip string) *IPBlacklistEntry {
 
 // AddToBlacklist 添加IP到黑名单
 func (manager *IPBlacklistManager) AddToBlacklist(ip, reason string, temporary bool) {
+	var entry *IPBlacklistEntry
+	if securityRedisEnabled() {
+		var err error
+		entry, err = redisAddToBlacklist(ip, reason, temporary)
+		if err != nil {
+			// Redis 不可用时至少在本节点生效
+			common.SysError("failed to add IP to redis blacklist: " + err.Error())
+			entry = nil
+		} else {
+			manager.mu.Lock()
+			manager.blacklist[ip] = entry
+			manager.mu.Unlock()
+		}
+	}
+	if entry == nil {
+		entry = manager.addToLocalBlacklist(ip, reason, temporary)
+	}
+
+	common.SysLog(fmt.Sprintf("added IP %s to blacklist: %s (temporary: %v)", ip, reason, temporary))
+
+	// 记录安全日志
+	recordSecurityEvent(nil, &model.SecurityEvent{
+		Rule:    "ip_blacklist",
+		IP:      ip,
+		Message: fmt.Sprintf("IP已加入黑名单: %s", reason),
+		Action:  "blacklisted",
+	}, map[string]interface{}{
+			"reason": reason,
+			"temporary": temporary,
+			"violations": entry.ViolationCount,
+		})
+}
+
+// addToLocalBlacklist 在本地内存中添加或更新黑名单条目，返回条目副本
+func (manager *IPBlacklistManager) addToLocalBlacklist(ip, reason string, temporary bool) *IPBlacklistEntry {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 	
@@ -139,21 +181,17 @@ func (manager *IPBlacklistManager) AddToBlacklist(ip, reason string, temporary b
 			IsTemporary:    temporary,
 		}
 	}
-
-	common.SysLog(fmt.Sprintf("added IP %s to blacklist: %s (temporary: %v)", ip, reason, temporary))
-
-	// 记录安全日志
-	setting.AddSecurityLog("ip_blacklist", ip,
-		fmt.Sprintf("IP已加入黑名单: %s", reason), "blacklisted",
-		map[string]interface{}{
-			"reason": reason,
-			"temporary": temporary,
-			"violations": manager.blacklist[ip].ViolationCount,
-		})
+	entry := *manager.blacklist[ip]
+	return &entry
 }
 
 // RemoveFromBlacklist 从黑名单移除IP
 func (manager *IPBlacklistManager) RemoveFromBlacklist(ip string) {
+	if securityRedisEnabled() {
+		if err := redisRemoveFromBlacklist(ip); err != nil {
+			common.SysError("failed to remove IP from redis blacklist: " + err.Error())
+		}
+	}
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 	
@@ -165,6 +203,11 @@ func (manager *IPBlacklistManager) RemoveFromBlacklist(ip string) {
 
 // AddToWhitelist 添加IP到白名单
 func (manager *IPBlacklistManager) AddToWhitelist(ip string) {
+	if securityRedisEnabled() {
+		if err := redisAddToWhitelist(ip); err != nil {
+			common.SysError("failed to add IP to redis whitelist: " + err.Error())
+		}
+	}
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 	
@@ -174,6 +217,11 @@ func (manager *IPBlacklistManager) AddToWhitelist(ip string) {
 
 // RemoveFromWhitelist 从白名单移除IP
 func (manager *IPBlacklistManager) RemoveFromWhitelist(ip string) {
+	if securityRedisEnabled() {
+		if err := redisRemoveFromWhitelist(ip); err != nil {
+			common.SysError("failed to remove IP from redis whitelist: " + err.Error())
+		}
+	}
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 	
@@ -187,6 +235,9 @@ func (manager *IPBlacklistManager) cleanupRoutine() {
 	defer ticker.Stop()
 	
 	for range ticker.C {
+		if securityRedisEnabled() {
+			manager.cleanupRedisExpiredEntries()
+		}
 		manager.cleanupExpiredEntries()
 	}
 }
@@ -312,6 +363,13 @@ func (manager *IPBlacklistManager) GetBlacklistData() []map[string]interface{} {
 	return blacklistData
 }
 
+// Size 返回黑名单中的 IP 数量
+func (manager *IPBlacklistManager) Size() int {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return len(manager.blacklist)
+}
+
 // GetBlacklistManager 获取黑名单管理器实例
 func GetBlacklistManager() *IPBlacklistManager {
 	return ipBlacklistManager
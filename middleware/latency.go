@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"tea-api/common"
+	"tea-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// finishLatencyTracking 请求结束后汇总各阶段延迟，只统计成功选中渠道并正常返回的请求
+func finishLatencyTracking(c *gin.Context, requestId string) {
+	metrics := common.RecordRequestComplete(requestId)
+	if metrics == nil {
+		return
+	}
+	common.LogLatencyMetrics(requestId, metrics)
+	channelId := c.GetInt("channel_id")
+	if channelId == 0 || c.Writer.Status() >= http.StatusBadRequest {
+		return
+	}
+	service.GetLatencyStatsCollector().Record(channelId, c.GetString("original_model"), metrics)
+}
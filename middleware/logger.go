@@ -11,6 +11,9 @@ func SetUpLogger(server *gin.Engine) {
 		var requestID string
 		if param.Keys != nil {
 			requestID = param.Keys[common.RequestIdKey].(string)
+			if traceId, ok := param.Keys[common.TraceIdKey].(string); ok {
+				requestID += " | trace_id=" + traceId
+			}
 		}
 		return fmt.Sprintf("[GIN] %s | %s | %3d | %13v | %15s | %7s %s\n",
 			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
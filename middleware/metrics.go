@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"tea-api/common"
+	"tea-api/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	common.RegisterMetricsGauge("active_streams", "本节点当前活跃的流式连接数", func() float64 {
+		return float64(ActiveStreamCount())
+	})
+	common.RegisterMetricsGauge("ip_blacklist_size", "IP 黑名单中的条目数", func() float64 {
+		return float64(ipBlacklistManager.Size())
+	})
+}
+
+// MetricsAuth 校验抓取请求携带的 Bearer token，未设置 METRICS_TOKEN 时拒绝所有请求
+func MetricsAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if constant.MetricsToken == "" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(constant.MetricsToken)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// payloadCaptureWriter 在正常写出响应的同时保留前 limit 字节，超出部分只计数
+type payloadCaptureWriter struct {
+	gin.ResponseWriter
+	buffer    bytes.Buffer
+	limit     int
+	size      int
+	truncated bool
+}
+
+func (w *payloadCaptureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *payloadCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *payloadCaptureWriter) capture(data []byte) {
+	w.size += len(data)
+	if remain := w.limit - w.buffer.Len(); remain < len(data) {
+		w.truncated = true
+		data = data[:max(remain, 0)]
+	}
+	w.buffer.Write(data)
+}
+
+// PayloadCapture 令牌或用户开启留存后，保存请求体和响应内容，请求结束后脱敏写入日志数据库
+func PayloadCapture() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if !service.ShouldCapturePayload(c) {
+			c.Next()
+			return
+		}
+		// 表单请求在请求结束后从解析好的表单中读取字段，不读取原始请求体
+		var requestBody []byte
+		if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+			var err error
+			requestBody, err = common.GetRequestBody(c)
+			if err != nil {
+				c.Next()
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(requestBody))
+		}
+		c.Set(constant.ContextKeyPayloadCaptured, true)
+		// 流式响应的 SSE 格式有较多额外内容，原始响应多保留一些以便拼接出完整的文本
+		writer := &payloadCaptureWriter{
+			ResponseWriter: c.Writer,
+			limit:          service.PayloadCaptureLimit() * 4,
+		}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+		service.RecordPayloadCapture(c, requestBody, writer.buffer.Bytes(), writer.truncated, writer.size)
+	}
+}
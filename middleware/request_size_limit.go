@@ -33,6 +33,12 @@ func RequestSizeLimit() gin.HandlerFunc {
 			return
 		}
 
+		// Files API 上传的文件由接口自身限制大小
+		if c.Request.URL.Path == "/v1/files" {
+			c.Next()
+			return
+		}
+
 		// 检查 Content-Length
 		if c.Request.ContentLength > MaxRequestBodySize {
 			abortWithSizeError(c, fmt.Sprintf("请求体大小超过限制: %d bytes", c.Request.ContentLength))
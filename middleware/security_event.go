@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"tea-api/common"
+	"tea-api/model"
+	"tea-api/setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordSecurityEvent 记录安全事件：最近的事件保留在内存中供安全面板统计，
+// 同时持久化到 security_events 表以便审计查询。c 为空时不记录请求相关信息。
+func recordSecurityEvent(c *gin.Context, event *model.SecurityEvent, details map[string]interface{}) {
+	setting.AddSecurityLog(event.Rule, event.IP, event.Message, event.Action, details)
+
+	if c != nil {
+		if event.UserId == 0 {
+			event.UserId = c.GetInt("id")
+		}
+		if event.TokenId == 0 {
+			event.TokenId = c.GetInt("token_id")
+		}
+		event.RequestId = c.GetString(common.RequestIdKey)
+		if c.Request != nil {
+			event.Path = c.Request.URL.Path
+		}
+	}
+	if len(details) > 0 {
+		event.Details = common.MapToJsonStr(details)
+	}
+	model.RecordSecurityEvent(event)
+}
@@ -0,0 +1,289 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"tea-api/common"
+	"tea-api/common/limiter"
+)
+
+// 启用 Redis 时，IP 黑名单、异常行为统计和并发流数量在所有节点间共享，
+// 本地内存中的数据只作为缓存；未启用 Redis 时保持单机内存实现。
+
+const (
+	redisIPBlacklistKey     = "security:ip_blacklist"
+	redisIPWhitelistKey     = "security:ip_whitelist"
+	redisIPBlacklistChannel = "security:ip_blacklist:events"
+	// 同一个标识的请求时间与统计由同一个脚本读写，使用标识作为 hash tag
+	redisRequestTimesKey = "security:abnormal:{%s}:times"
+	redisRequestStatsKey = "security:abnormal:{%s}:stats"
+	// 占用并发流时同时检查 IP 与用户，两类 key 使用同一个 hash tag
+	redisStreamIPPrefix   = "security:{stream}:ip:"
+	redisStreamUserPrefix = "security:{stream}:user:"
+)
+
+// redisRequestStatsTTL 异常行为统计的重置周期
+const redisRequestStatsTTL = time.Hour
+
+const (
+	blacklistEventAdd             = "add"
+	blacklistEventRemove          = "remove"
+	blacklistEventWhitelistAdd    = "whitelist_add"
+	blacklistEventWhitelistRemove = "whitelist_remove"
+)
+
+func securityRedisEnabled() bool {
+	return common.RedisEnabled && common.RDB != nil
+}
+
+// ipBlacklistRecord 黑名单条目在 Redis 中的存储格式，时间为 Unix 秒
+type ipBlacklistRecord struct {
+	IP             string `json:"ip"`
+	Reason         string `json:"reason"`
+	BlockedAt      int64  `json:"blocked_at"`
+	ExpiresAt      int64  `json:"expires_at"`
+	ViolationCount int    `json:"violation_count"`
+	IsTemporary    bool   `json:"is_temporary"`
+}
+
+func (r *ipBlacklistRecord) toEntry() *IPBlacklistEntry {
+	return &IPBlacklistEntry{
+		IP:             r.IP,
+		Reason:         r.Reason,
+		BlockedAt:      time.Unix(r.BlockedAt, 0),
+		ExpiresAt:      time.Unix(r.ExpiresAt, 0),
+		ViolationCount: r.ViolationCount,
+		IsTemporary:    r.IsTemporary,
+	}
+}
+
+// blacklistEvent 通过 Redis 发布订阅同步到其他节点的黑白名单变更
+type blacklistEvent struct {
+	Action string             `json:"action"`
+	IP     string             `json:"ip"`
+	Record *ipBlacklistRecord `json:"record,omitempty"`
+}
+
+var blacklistSubscribeOnce sync.Once
+
+// redisAddToBlacklist 原子地写入或累加黑名单条目，并通知其他节点
+func redisAddToBlacklist(ip, reason string, temporary bool) (*IPBlacklistEntry, error) {
+	ctx := context.Background()
+	temporaryArg := "0"
+	if temporary {
+		temporaryArg = "1"
+	}
+	raw, err := limiter.IPBanScript.Run(ctx, common.RDB, []string{redisIPBlacklistKey},
+		ip, reason, temporaryArg, time.Now().Unix(),
+		int64(TempBlockDuration.Seconds()), int64(PermanentBlockDuration.Seconds()), MaxViolations).Text()
+	if err != nil {
+		return nil, err
+	}
+	record := &ipBlacklistRecord{}
+	if err := json.Unmarshal([]byte(raw), record); err != nil {
+		return nil, err
+	}
+	publishBlacklistEvent(blacklistEvent{Action: blacklistEventAdd, IP: ip, Record: record})
+	return record.toEntry(), nil
+}
+
+func redisRemoveFromBlacklist(ip string) error {
+	if err := common.RDB.HDel(context.Background(), redisIPBlacklistKey, ip).Err(); err != nil {
+		return err
+	}
+	publishBlacklistEvent(blacklistEvent{Action: blacklistEventRemove, IP: ip})
+	return nil
+}
+
+func redisAddToWhitelist(ip string) error {
+	if err := common.RDB.SAdd(context.Background(), redisIPWhitelistKey, ip).Err(); err != nil {
+		return err
+	}
+	publishBlacklistEvent(blacklistEvent{Action: blacklistEventWhitelistAdd, IP: ip})
+	return nil
+}
+
+func redisRemoveFromWhitelist(ip string) error {
+	if err := common.RDB.SRem(context.Background(), redisIPWhitelistKey, ip).Err(); err != nil {
+		return err
+	}
+	publishBlacklistEvent(blacklistEvent{Action: blacklistEventWhitelistRemove, IP: ip})
+	return nil
+}
+
+func publishBlacklistEvent(event blacklistEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if err := common.RDB.Publish(context.Background(), redisIPBlacklistChannel, data).Err(); err != nil {
+		common.SysError("failed to publish blacklist event: " + err.Error())
+	}
+}
+
+// loadFromRedis 从 Redis 加载全部黑白名单，覆盖本地缓存
+func (manager *IPBlacklistManager) loadFromRedis() error {
+	ctx := context.Background()
+	rawEntries, err := common.RDB.HGetAll(ctx, redisIPBlacklistKey).Result()
+	if err != nil {
+		return err
+	}
+	whitelist, err := common.RDB.SMembers(ctx, redisIPWhitelistKey).Result()
+	if err != nil {
+		return err
+	}
+	blacklist := make(map[string]*IPBlacklistEntry, len(rawEntries))
+	for ip, raw := range rawEntries {
+		record := &ipBlacklistRecord{}
+		if err := json.Unmarshal([]byte(raw), record); err != nil {
+			common.SysError(fmt.Sprintf("invalid blacklist record for IP %s: %s", ip, err.Error()))
+			continue
+		}
+		blacklist[ip] = record.toEntry()
+	}
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.blacklist = blacklist
+	manager.whitelist = make(map[string]bool, len(whitelist))
+	for _, ip := range whitelist {
+		manager.whitelist[ip] = true
+	}
+	return nil
+}
+
+// cleanupRedisExpiredEntries 删除 Redis 中已过期的临时封禁
+func (manager *IPBlacklistManager) cleanupRedisExpiredEntries() {
+	ctx := context.Background()
+	rawEntries, err := common.RDB.HGetAll(ctx, redisIPBlacklistKey).Result()
+	if err != nil {
+		common.SysError("failed to load redis blacklist: " + err.Error())
+		return
+	}
+	now := time.Now().Unix()
+	for ip, raw := range rawEntries {
+		record := &ipBlacklistRecord{}
+		if err := json.Unmarshal([]byte(raw), record); err != nil {
+			continue
+		}
+		if record.IsTemporary && now > record.ExpiresAt {
+			common.RDB.HDel(ctx, redisIPBlacklistKey, ip)
+		}
+	}
+}
+
+// subscribeBlacklistEvents 订阅其他节点的黑白名单变更
+func (manager *IPBlacklistManager) subscribeBlacklistEvents() {
+	blacklistSubscribeOnce.Do(func() {
+		go func() {
+			for {
+				pubsub := common.RDB.Subscribe(context.Background(), redisIPBlacklistChannel)
+				for msg := range pubsub.Channel() {
+					event := blacklistEvent{}
+					if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+						continue
+					}
+					manager.applyEvent(event)
+				}
+				_ = pubsub.Close()
+				// 连接断开后重新订阅，并全量同步一次避免遗漏
+				time.Sleep(5 * time.Second)
+				if err := manager.loadFromRedis(); err != nil {
+					common.SysError("failed to reload blacklist from redis: " + err.Error())
+				}
+			}
+		}()
+	})
+}
+
+func (manager *IPBlacklistManager) applyEvent(event blacklistEvent) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	switch event.Action {
+	case blacklistEventAdd:
+		if event.Record != nil {
+			manager.blacklist[event.IP] = event.Record.toEntry()
+		}
+	case blacklistEventRemove:
+		delete(manager.blacklist, event.IP)
+	case blacklistEventWhitelistAdd:
+		manager.whitelist[event.IP] = true
+	case blacklistEventWhitelistRemove:
+		delete(manager.whitelist, event.IP)
+	}
+}
+
+// redisRequestTrackerStore 使用 Redis 统计异常行为，所有节点共享同一份计数
+type redisRequestTrackerStore struct{}
+
+func (s *redisRequestTrackerStore) track(identifier string, metrics requestMetrics, now time.Time) (requestStats, error) {
+	stream := "0"
+	if metrics.isStream {
+		stream = "1"
+	}
+	large := "0"
+	if metrics.promptLength > MaxPromptLength {
+		large = "1"
+	}
+	member := strconv.FormatInt(now.UnixNano(), 10) + "-" + common.GetRandomString(6)
+	result, err := limiter.RequestTrackScript.Run(context.Background(), common.RDB,
+		[]string{fmt.Sprintf(redisRequestTimesKey, identifier), fmt.Sprintf(redisRequestStatsKey, identifier)},
+		now.UnixMilli(), member, stream, large, int64(redisRequestStatsTTL.Seconds())).Int64Slice()
+	if err != nil {
+		return requestStats{}, err
+	}
+	if len(result) != 4 {
+		return requestStats{}, fmt.Errorf("unexpected request track result: %v", result)
+	}
+	return requestStats{
+		count:           int(result[0]),
+		streamRequests:  result[1],
+		largePrompts:    result[2],
+		suspiciousScore: result[3],
+	}, nil
+}
+
+func (s *redisRequestTrackerStore) addScore(identifier string, delta int64) (int64, error) {
+	return limiter.AddScoreScript.Run(context.Background(), common.RDB,
+		[]string{fmt.Sprintf(redisRequestStatsKey, identifier)}, delta, int64(redisRequestStatsTTL.Seconds())).Int64()
+}
+
+// redisAcquireStream 在集群范围内检查并占用一个并发流名额
+func redisAcquireStream(connectionID, clientIP string, userID int) (bool, error) {
+	ipKey := redisStreamIPPrefix + clientIP
+	userKey := ipKey
+	hasUser := "0"
+	if userID > 0 {
+		userKey = redisStreamUserPrefix + strconv.Itoa(userID)
+		hasUser = "1"
+	}
+	result, err := limiter.StreamAcquireScript.Run(context.Background(), common.RDB, []string{ipKey, userKey},
+		time.Now().Unix(), int64(StreamMaxDuration.Seconds()), MaxStreamsPerIP, MaxStreamsPerUser,
+		connectionID, hasUser).Int()
+	if err != nil {
+		return false, err
+	}
+	switch result {
+	case 1:
+		common.SysLog(fmt.Sprintf("IP %s exceeded max streams limit in cluster", clientIP))
+		return false, nil
+	case 2:
+		common.SysLog(fmt.Sprintf("User %d exceeded max streams limit in cluster", userID))
+		return false, nil
+	}
+	return true, nil
+}
+
+// redisReleaseStream 释放集群范围内占用的并发流名额
+func redisReleaseStream(connectionID, clientIP string, userID int) {
+	ctx := context.Background()
+	common.RDB.ZRem(ctx, redisStreamIPPrefix+clientIP, connectionID)
+	if userID > 0 {
+		common.RDB.ZRem(ctx, redisStreamUserPrefix+strconv.Itoa(userID), connectionID)
+	}
+}
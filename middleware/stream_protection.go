@@ -9,6 +9,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"tea-api/common"
+	"tea-api/model"
 )
 
 // StreamConnection 流连接跟踪
@@ -62,14 +63,23 @@ func StreamProtection() gin.HandlerFunc {
 		userID := c.GetInt("id")
 		tokenID := c.GetInt("token_id")
 		
+		// 创建流连接跟踪
+		connectionID := fmt.Sprintf("%s_%d_%d_%d", clientIP, userID, tokenID, time.Now().UnixNano())
+
 		// 检查并发流限制
-		if !streamMonitor.checkStreamLimits(clientIP, userID) {
+		if !streamMonitor.acquire(connectionID, clientIP, userID) {
+			recordSecurityEvent(c, &model.SecurityEvent{
+				Rule:    "stream_limit",
+				IP:      clientIP,
+				Message: "超过最大并发流数量限制",
+				Action:  "rejected",
+			}, map[string]interface{}{
+				"max_streams_per_ip":   MaxStreamsPerIP,
+				"max_streams_per_user": MaxStreamsPerUser,
+			})
 			abortWithStreamError(c, "超过最大并发流数量限制")
 			return
 		}
-
-		// 创建流连接跟踪
-		connectionID := fmt.Sprintf("%s_%d_%d_%d", clientIP, userID, tokenID, time.Now().UnixNano())
 		ctx, cancel := context.WithTimeout(c.Request.Context(), StreamMaxDuration)
 		
 		connection := &StreamConnection{
@@ -116,6 +126,19 @@ func isStreamRequest(c *gin.Context) bool {
 		   c.Query("stream") == "true"
 }
 
+// acquire 检查并发流限制，启用 Redis 时在集群范围内计数
+func (sm *StreamMonitor) acquire(connectionID, clientIP string, userID int) bool {
+	if securityRedisEnabled() {
+		ok, err := redisAcquireStream(connectionID, clientIP, userID)
+		if err == nil {
+			return ok
+		}
+		// Redis 不可用时退回本机计数
+		common.SysError("failed to acquire stream slot in redis: " + err.Error())
+	}
+	return sm.checkStreamLimits(clientIP, userID)
+}
+
 // checkStreamLimits 检查流限制
 func (sm *StreamMonitor) checkStreamLimits(clientIP string, userID int) bool {
 	sm.mu.RLock()
@@ -167,6 +190,9 @@ func (sm *StreamMonitor) unregisterConnection(id string) {
 	if conn, exists := sm.connections[id]; exists {
 		conn.IsActive = false
 		delete(sm.connections, id)
+		if securityRedisEnabled() {
+			redisReleaseStream(id, conn.ClientIP, conn.UserID)
+		}
 		common.SysLog(fmt.Sprintf("unregistered stream connection %s", id))
 	}
 }
@@ -202,18 +228,14 @@ func (sm *StreamMonitor) cleanupStaleConnections() {
 		// 检查空闲超时
 		if now.Sub(conn.LastActivity) > StreamIdleTimeout {
 			common.SysLog(fmt.Sprintf("closing idle stream connection %s", id))
-			conn.Cancel()
-			conn.IsActive = false
-			delete(sm.connections, id)
+			sm.closeConnection(id, conn, "stream_idle", "流空闲超时，连接已关闭")
 			continue
 		}
 
 		// 检查最大持续时间
 		if now.Sub(conn.StartTime) > StreamMaxDuration {
 			common.SysLog(fmt.Sprintf("closing long-running stream connection %s", id))
-			conn.Cancel()
-			conn.IsActive = false
-			delete(sm.connections, id)
+			sm.closeConnection(id, conn, "stream_max_duration", "流持续时间过长，连接已关闭")
 			continue
 		}
 
@@ -223,14 +245,33 @@ func (sm *StreamMonitor) cleanupStaleConnections() {
 			rate := float64(conn.BytesSent) / duration
 			if rate < MinBytesPerSecond {
 				common.SysLog(fmt.Sprintf("closing slow stream connection %s (rate: %.2f bytes/s)", id, rate))
-				conn.Cancel()
-				conn.IsActive = false
-				delete(sm.connections, id)
+				sm.closeConnection(id, conn, "stream_slow_client", fmt.Sprintf("流传输速率过低（%.2f bytes/s），连接已关闭", rate))
 			}
 		}
 	}
 }
 
+// closeConnection 强制关闭连接并记录安全事件，调用方需持有写锁
+func (sm *StreamMonitor) closeConnection(id string, conn *StreamConnection, rule string, message string) {
+	conn.Cancel()
+	conn.IsActive = false
+	delete(sm.connections, id)
+	if securityRedisEnabled() {
+		redisReleaseStream(id, conn.ClientIP, conn.UserID)
+	}
+	recordSecurityEvent(nil, &model.SecurityEvent{
+		Rule:    rule,
+		IP:      conn.ClientIP,
+		UserId:  conn.UserID,
+		TokenId: conn.TokenID,
+		Message: message,
+		Action:  "closed",
+	}, map[string]interface{}{
+		"bytes_sent": conn.BytesSent,
+		"duration":   time.Since(conn.StartTime).Seconds(),
+	})
+}
+
 // streamResponseWriter 流响应写入器
 type streamResponseWriter struct {
 	gin.ResponseWriter
@@ -267,6 +308,20 @@ func abortWithStreamError(c *gin.Context, message string) {
 	c.Abort()
 }
 
+// ActiveStreamCount 返回本节点当前活跃的流式连接数
+func ActiveStreamCount() int {
+	streamMonitor.mu.RLock()
+	defer streamMonitor.mu.RUnlock()
+
+	count := 0
+	for _, conn := range streamMonitor.connections {
+		if conn.IsActive {
+			count++
+		}
+	}
+	return count
+}
+
 // GetStreamStats 获取流统计信息
 func GetStreamStats() map[string]interface{} {
 	streamMonitor.mu.RLock()
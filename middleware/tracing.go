@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"tea-api/common"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing 为每个请求生成根 span，并沿用客户端传入的 traceparent
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !common.TracingEnabled {
+			c.Next()
+			return
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		ctx := common.ExtractTraceContext(c.Request.Context(), c.Request.Header)
+		ctx, span := common.StartSpan(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.ClientAddress(c.ClientIP()),
+			))
+		defer span.End()
+
+		traceId := common.TraceIdFromContext(ctx)
+		c.Set(common.TraceIdKey, traceId)
+		ctx = context.WithValue(ctx, common.TraceIdKey, traceId)
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"tea-api/common"
+	"tea-api/model"
+	"tea-api/service"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 已通过密码或第三方登录、等待输入两步验证码的用户及其登录时间
+	SessionKeyTwoFactorPendingId   = "two_factor_pending_id"
+	SessionKeyTwoFactorPendingTime = "two_factor_pending_time"
+	// 当前会话最近一次通过两步验证的时间
+	SessionKeyTwoFactorVerifiedAt = "two_factor_verified_at"
+)
+
+// TwoFactorCodeHeader 使用 access token 调用敏感接口时，通过该请求头提供两步验证码
+const TwoFactorCodeHeader = "Two-Factor-Code"
+
+// twoFactorSetupPaths 必须启用两步验证的用户在启用或完成两步验证前仅能访问的接口
+var twoFactorSetupPaths = map[string]bool{
+	"GET /api/user/self":        true,
+	"GET /api/user/2fa/status":  true,
+	"POST /api/user/2fa/setup":  true,
+	"POST /api/user/2fa/enable": true,
+	"POST /api/user/2fa/verify": true,
+}
+
+func abortTwoFactorRequired(c *gin.Context, message string, enabled bool) {
+	c.JSON(http.StatusOK, gin.H{
+		"success":             false,
+		"message":             message,
+		"two_factor_required": true,
+		"two_factor_enabled":  enabled,
+	})
+	c.Abort()
+}
+
+// checkRequiredTwoFactor 角色要求两步验证时，会话必须已通过两步验证，access token 的用户必须已启用两步验证，
+// 否则只能访问启用两步验证所需的接口
+func checkRequiredTwoFactor(c *gin.Context, session sessions.Session, userId int, role int, useAccessToken bool, enabled bool) bool {
+	if !service.IsTwoFactorRequired(role) || twoFactorSetupPaths[c.Request.Method+" "+c.FullPath()] {
+		return true
+	}
+	if useAccessToken {
+		if enabled {
+			return true
+		}
+	} else {
+		if session.Get(SessionKeyTwoFactorVerifiedAt) != nil {
+			return true
+		}
+		user, err := model.GetUserById(userId, false)
+		if err == nil {
+			enabled = user.TwoFactorEnabled
+		}
+	}
+	if enabled {
+		abortTwoFactorRequired(c, "请先完成两步验证", true)
+	} else {
+		abortTwoFactorRequired(c, "当前账户必须启用两步验证，请先在个人设置中启用", false)
+	}
+	return false
+}
+
+// TwoFactorAuth 保护查看渠道密钥、修改系统设置等敏感操作，需在 TwoFactorVerifyWindow 内通过过两步验证，
+// 或在请求头 Two-Factor-Code 中提供验证码。未启用两步验证且角色不要求两步验证的用户直接放行。
+func TwoFactorAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user, err := model.GetUserById(c.GetInt("id"), false)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		if !user.TwoFactorEnabled {
+			if service.IsTwoFactorRequired(user.Role) {
+				abortTwoFactorRequired(c, "当前账户必须启用两步验证，请先在个人设置中启用", false)
+				return
+			}
+			c.Next()
+			return
+		}
+		useAccessToken := c.GetBool("use_access_token")
+		session := sessions.Default(c)
+		now := time.Now().Unix()
+		if !useAccessToken {
+			if verifiedAt, ok := session.Get(SessionKeyTwoFactorVerifiedAt).(int64); ok && now-verifiedAt <= service.TwoFactorVerifyWindow {
+				c.Next()
+				return
+			}
+		}
+		code := c.GetHeader(TwoFactorCodeHeader)
+		if code == "" {
+			abortTwoFactorRequired(c, "该操作需要两步验证", true)
+			return
+		}
+		if err = service.VerifyUserTwoFactor(user, code); err != nil {
+			abortTwoFactorRequired(c, err.Error(), true)
+			return
+		}
+		if !useAccessToken {
+			session.Set(SessionKeyTwoFactorVerifiedAt, now)
+			if err = session.Save(); err != nil {
+				common.SysError("failed to save two factor session: " + err.Error())
+			}
+		}
+		c.Next()
+	}
+}
@@ -108,20 +108,37 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	}
 	channel := Channel{}
 	if len(abilities) > 0 {
-		// Randomly choose one
-		weightSum := uint(0)
-		for _, ability_ := range abilities {
-			weightSum += ability_.Weight + 10
+		// 过滤熔断中的渠道，全部熔断时保留原列表
+		if channelHealthChecker != nil {
+			healthy := make([]Ability, 0, len(abilities))
+			for _, ability_ := range abilities {
+				if channelHealthChecker.Allow(ability_.ChannelId, model) {
+					healthy = append(healthy, ability_)
+				}
+			}
+			if len(healthy) > 0 {
+				abilities = healthy
+			}
 		}
-		// Randomly choose one
-		weight := common.GetRandomInt(int(weightSum))
-		for _, ability_ := range abilities {
-			weight -= int(ability_.Weight) + 10
-			//log.Printf("weight: %d, ability weight: %d", weight, *ability_.Weight)
-			if weight <= 0 {
-				channel.Id = ability_.ChannelId
+		channelIds := make([]int, len(abilities))
+		baseWeights := make([]int, len(abilities))
+		for i, ability_ := range abilities {
+			channelIds[i] = ability_.ChannelId
+			baseWeights[i] = int(ability_.Weight)
+		}
+		weights := getEffectiveWeights(group, model, channelIds, baseWeights)
+		// 半开渠道已有探测请求在途时重新选择，全部在探测时沿用首次选中的渠道
+		for len(abilities) > 0 {
+			idx := pickWeightedIndex(weights)
+			if channel.Id == 0 {
+				channel.Id = abilities[idx].ChannelId
+			}
+			if acquireChannelProbe(abilities[idx].ChannelId, model) {
+				channel.Id = abilities[idx].ChannelId
 				break
 			}
+			abilities = append(abilities[:idx:idx], abilities[idx+1:]...)
+			weights = append(weights[:idx:idx], weights[idx+1:]...)
 		}
 	} else {
 		return nil, errors.New("channel not found")
@@ -0,0 +1,140 @@
+package model
+
+import (
+	"errors"
+	"tea-api/common"
+	"tea-api/constant"
+)
+
+// Batch 批处理任务，由后台任务逐行读取输入文件并通过中转流程执行
+type Batch struct {
+	Id               string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id" gorm:"index"`
+	ClientIp         string `json:"-" gorm:"type:varchar(64)"`
+	Endpoint         string `json:"endpoint" gorm:"type:varchar(64)"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(64)"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window" gorm:"type:varchar(16)"`
+	Status           string `json:"status" gorm:"type:varchar(16);index"`
+	Errors           string `json:"errors" gorm:"type:text"`   // 校验失败时的错误列表，JSON 格式
+	Metadata         string `json:"metadata" gorm:"type:text"` // 用户自定义的元数据，JSON 格式
+	RequestTotal     int    `json:"request_total"`
+	RequestCompleted int    `json:"request_completed"`
+	RequestFailed    int    `json:"request_failed"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;index"`
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint"`
+	FinalizingAt     int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt         int64  `json:"failed_at" gorm:"bigint"`
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt     int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint"`
+}
+
+func (batch *Batch) Insert() error {
+	if batch.CreatedAt == 0 {
+		batch.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(batch).Error
+}
+
+// IsFinished 任务是否已经结束
+func (batch *Batch) IsFinished() bool {
+	switch batch.Status {
+	case constant.BatchStatusFailed, constant.BatchStatusCompleted, constant.BatchStatusExpired, constant.BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func GetBatchById(id string) (*Batch, error) {
+	var batch Batch
+	err := DB.Where("id = ?", id).First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetUserBatchById 只返回属于该用户的批处理任务
+func GetUserBatchById(id string, userId int) (*Batch, error) {
+	if id == "" {
+		return nil, errors.New("batch id 为空")
+	}
+	var batch Batch
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetUserBatches 按创建时间倒序列出用户的批处理任务，after 为上一页最后一个任务的 ID
+func GetUserBatches(userId int, after string, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	tx := DB.Where("user_id = ?", userId)
+	if after != "" {
+		cursor, err := GetUserBatchById(after, userId)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where("created_at < ? OR (created_at = ? AND id < ?)", cursor.CreatedAt, cursor.CreatedAt, cursor.Id)
+	}
+	err := tx.Order("created_at desc, id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// GetBatchesByStatus 按创建时间顺序返回指定状态的批处理任务
+func GetBatchesByStatus(status string, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status = ?", status).Order("created_at asc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// UpdateBatchStatus 仅当任务处于 from 中的某个状态时才切换到新状态，返回是否切换成功
+func UpdateBatchStatus(id string, from []string, to string, fields map[string]interface{}) (bool, error) {
+	updates := map[string]interface{}{"status": to}
+	for k, v := range fields {
+		updates[k] = v
+	}
+	result := DB.Model(&Batch{}).Where("id = ? AND status IN ?", id, from).Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UpdateBatchProgress 更新任务的请求计数
+func UpdateBatchProgress(id string, completed int, failed int) error {
+	return DB.Model(&Batch{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"request_completed": completed,
+		"request_failed":    failed,
+	}).Error
+}
+
+// GetBatchStatus 只查询任务状态，用于执行过程中检查任务是否被取消
+func GetBatchStatus(id string) (string, error) {
+	var batch Batch
+	err := DB.Select("status").Where("id = ?", id).First(&batch).Error
+	if err != nil {
+		return "", err
+	}
+	return batch.Status, nil
+}
+
+// FailInterruptedBatches 服务重启后，上次未执行完的任务无法继续，标记为失败或已取消，避免重复计费
+func FailInterruptedBatches(errorsJson string) error {
+	now := common.GetTimestamp()
+	err := DB.Model(&Batch{}).
+		Where("status IN ?", []string{constant.BatchStatusInProgress, constant.BatchStatusFinalizing}).
+		Updates(map[string]interface{}{"status": constant.BatchStatusFailed, "failed_at": now, "errors": errorsJson}).Error
+	if err != nil {
+		return err
+	}
+	return DB.Model(&Batch{}).
+		Where("status = ?", constant.BatchStatusCancelling).
+		Updates(map[string]interface{}{"status": constant.BatchStatusCancelled, "cancelled_at": now}).Error
+}
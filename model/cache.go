@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/rand"
 	"tea-api/common"
+	"tea-api/setting"
 	"sort"
 	"strings"
 	"sync"
@@ -75,7 +76,151 @@ func SyncChannelCache(frequency int) {
 	}
 }
 
+// ChannelHealthChecker 由 service.ChannelManager 实现，选择渠道时过滤熔断中的渠道并按健康度调整权重
+type ChannelHealthChecker interface {
+	Allow(channelId int, modelName string) bool
+	WeightFactor(channelId int, modelName string) float64
+	// FirstTokenLatency 返回首字时延 EWMA（毫秒），样本不足时返回 0
+	FirstTokenLatency(channelId int, modelName string) float64
+	// LatencyWeightFactor 延迟优先模式下的权重系数，fastest 为候选渠道中最低的首字时延
+	LatencyWeightFactor(channelId int, modelName string, fastest float64) float64
+	// AcquireProbe 渠道被选中时调用，半开渠道已有探测请求在途时返回 false
+	AcquireProbe(channelId int, modelName string) bool
+}
+
+var channelHealthChecker ChannelHealthChecker
+
+func SetChannelHealthChecker(checker ChannelHealthChecker) {
+	channelHealthChecker = checker
+}
+
+// filterHealthyChannels 过滤掉熔断中的渠道，若全部熔断则保留原列表，避免请求直接失败
+func filterHealthyChannels(channels []*Channel, modelName string) []*Channel {
+	if channelHealthChecker == nil {
+		return channels
+	}
+	healthy := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if channelHealthChecker.Allow(channel.Id, modelName) {
+			healthy = append(healthy, channel)
+		}
+	}
+	if len(healthy) == 0 {
+		return channels
+	}
+	return healthy
+}
+
+// getEffectiveWeights 返回同一优先级候选渠道经健康度调整后的权重（含平滑系数），
+// 分组使用延迟优先模式时按首字时延相对最快渠道的比例调整
+func getEffectiveWeights(group string, modelName string, channelIds []int, weights []int) []float64 {
+	// 平滑系数
+	smoothingFactor := 10
+	latencyMode := channelHealthChecker != nil && setting.GetGroupRoutingMode(group) == setting.GroupRoutingModeLatency
+	fastest := 0.0
+	if latencyMode {
+		for _, channelId := range channelIds {
+			latency := channelHealthChecker.FirstTokenLatency(channelId, modelName)
+			if latency > 0 && (fastest == 0 || latency < fastest) {
+				fastest = latency
+			}
+		}
+	}
+	effective := make([]float64, len(channelIds))
+	for i, channelId := range channelIds {
+		effective[i] = float64(weights[i] + smoothingFactor)
+		if channelHealthChecker == nil {
+			continue
+		}
+		if latencyMode {
+			effective[i] *= channelHealthChecker.LatencyWeightFactor(channelId, modelName, fastest)
+		} else {
+			effective[i] *= channelHealthChecker.WeightFactor(channelId, modelName)
+		}
+	}
+	return effective
+}
+
+// ChannelEffectiveWeight 渠道在某个分组+模型下的实时有效权重，用于管理接口展示
+type ChannelEffectiveWeight struct {
+	ChannelId         int     `json:"channel_id"`
+	Name              string  `json:"name"`
+	Priority          int64   `json:"priority"`
+	Weight            int     `json:"weight"`
+	FirstTokenLatency float64 `json:"first_token_latency"`
+	EffectiveWeight   float64 `json:"effective_weight"`
+	// 在同优先级渠道中被选中的概率
+	Probability float64 `json:"probability"`
+}
+
+// GetChannelEffectiveWeights 返回分组+模型下所有启用渠道的有效权重，按优先级从高到低排列
+func GetChannelEffectiveWeights(group string, modelName string) ([]*ChannelEffectiveWeight, error) {
+	var channels []*Channel
+	if common.MemoryCacheEnabled {
+		channelSyncLock.RLock()
+		channels = append(channels, group2model2channels[group][modelName]...)
+		channelSyncLock.RUnlock()
+	} else {
+		var channelIds []int
+		err := DB.Model(&Ability{}).Where(groupCol+" = ? and model = ? and enabled = ?", group, modelName, true).
+			Pluck("channel_id", &channelIds).Error
+		if err != nil {
+			return nil, err
+		}
+		if len(channelIds) > 0 {
+			if err = DB.Where("id in ?", channelIds).Find(&channels).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	byPriority := make(map[int64][]*Channel)
+	var priorities []int64
+	for _, channel := range channels {
+		priority := channel.GetPriority()
+		if _, ok := byPriority[priority]; !ok {
+			priorities = append(priorities, priority)
+		}
+		byPriority[priority] = append(byPriority[priority], channel)
+	}
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] > priorities[j] })
+
+	result := make([]*ChannelEffectiveWeight, 0, len(channels))
+	for _, priority := range priorities {
+		tier := byPriority[priority]
+		channelIds := make([]int, len(tier))
+		baseWeights := make([]int, len(tier))
+		for i, channel := range tier {
+			channelIds[i] = channel.Id
+			baseWeights[i] = channel.GetWeight()
+		}
+		weights := getEffectiveWeights(group, modelName, channelIds, baseWeights)
+		totalWeight := 0.0
+		for _, weight := range weights {
+			totalWeight += weight
+		}
+		for i, channel := range tier {
+			item := &ChannelEffectiveWeight{
+				ChannelId:       channel.Id,
+				Name:            channel.Name,
+				Priority:        priority,
+				Weight:          baseWeights[i],
+				EffectiveWeight: weights[i],
+			}
+			if channelHealthChecker != nil {
+				item.FirstTokenLatency = channelHealthChecker.FirstTokenLatency(channel.Id, modelName)
+			}
+			if totalWeight > 0 {
+				item.Probability = weights[i] / totalWeight
+			}
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
 func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
+	requestModel := model
 	if strings.HasPrefix(model, "gpt-4-gizmo") {
 		model = "gpt-4-gizmo-*"
 	}
@@ -95,6 +240,7 @@ func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Cha
 	if len(channels) == 0 {
 		return nil, errors.New("channel not found")
 	}
+	channels = filterHealthyChannels(channels, requestModel)
 
 	uniquePriorities := make(map[int]bool)
 	for _, channel := range channels {
@@ -119,27 +265,61 @@ func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Cha
 		}
 	}
 
-	// 平滑系数
-	smoothingFactor := 10
 	// Calculate the total weight of all channels up to endIdx
-	totalWeight := 0
-	for _, channel := range targetChannels {
-		totalWeight += channel.GetWeight() + smoothingFactor
+	channelIds := make([]int, len(targetChannels))
+	baseWeights := make([]int, len(targetChannels))
+	for i, channel := range targetChannels {
+		channelIds[i] = channel.Id
+		baseWeights[i] = channel.GetWeight()
 	}
-	// Generate a random value in the range [0, totalWeight)
-	randomWeight := rand.Intn(totalWeight)
-
-	// Find a channel based on its weight
-	for _, channel := range targetChannels {
-		randomWeight -= channel.GetWeight() + smoothingFactor
-		if randomWeight < 0 {
+	weights := getEffectiveWeights(group, requestModel, channelIds, baseWeights)
+	// 半开渠道已有探测请求在途时从候选中移除后重新选择，
+	// 全部候选都在探测时沿用首次选中的渠道，避免请求直接失败
+	var picked *Channel
+	for len(targetChannels) > 0 {
+		idx := pickWeightedIndex(weights)
+		channel := targetChannels[idx]
+		if acquireChannelProbe(channel.Id, requestModel) {
 			return channel, nil
 		}
+		if picked == nil {
+			picked = channel
+		}
+		targetChannels = append(targetChannels[:idx:idx], targetChannels[idx+1:]...)
+		weights = append(weights[:idx:idx], weights[idx+1:]...)
+	}
+	if picked != nil {
+		return picked, nil
 	}
 	// return null if no channel is not found
 	return nil, errors.New("channel not found")
 }
 
+// pickWeightedIndex 按权重随机选择一个下标，weights 不能为空
+func pickWeightedIndex(weights []float64) int {
+	totalWeight := 0.0
+	for _, weight := range weights {
+		totalWeight += weight
+	}
+	// Generate a random value in the range [0, totalWeight)
+	randomWeight := rand.Float64() * totalWeight
+	for i, weight := range weights {
+		randomWeight -= weight
+		if randomWeight < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
+
+// acquireChannelProbe 为选中的渠道占用半开探测名额
+func acquireChannelProbe(channelId int, modelName string) bool {
+	if channelHealthChecker == nil {
+		return true
+	}
+	return channelHealthChecker.AcquireProbe(channelId, modelName)
+}
+
 func CacheGetChannel(id int) (*Channel, error) {
 	if !common.MemoryCacheEnabled {
 		return GetChannelById(id, true)
@@ -164,3 +344,16 @@ func CacheUpdateChannelStatus(id int, status int) {
 		channel.Status = status
 	}
 }
+
+func CacheUpdateChannelInfo(id int, info ChannelInfo) {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	channelSyncLock.Lock()
+	defer channelSyncLock.Unlock()
+	if channel, ok := channelsIDM[id]; ok {
+		channelKeyLock.Lock()
+		channel.ChannelInfo = info
+		channelKeyLock.Unlock()
+	}
+}
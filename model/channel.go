@@ -1,6 +1,7 @@
 package model
 
 import (
+	"database/sql/driver"
 	"encoding/json"
 	"tea-api/common"
 	"strings"
@@ -37,6 +38,36 @@ type Channel struct {
 	Tag               *string `json:"tag" gorm:"index"`
 	Setting           *string `json:"setting" gorm:"type:text"`
 	ParamOverride     *string `json:"param_override" gorm:"type:text"`
+	ChannelInfo       ChannelInfo `json:"channel_info" gorm:"type:json"`
+}
+
+// ChannelInfo 保存渠道的多密钥（密钥池）信息
+type ChannelInfo struct {
+	IsMultiKey             bool           `json:"is_multi_key"`
+	MultiKeySize           int            `json:"multi_key_size"`
+	MultiKeyMode           string         `json:"multi_key_mode"`                      // random / polling
+	MultiKeyStatusList     map[int]int    `json:"multi_key_status_list,omitempty"`     // 未出现的下标视为启用
+	MultiKeyDisabledReason map[int]string `json:"multi_key_disabled_reason,omitempty"` // 禁用原因
+	MultiKeyDisabledTime   map[int]int64  `json:"multi_key_disabled_time,omitempty"`
+}
+
+func (info *ChannelInfo) Scan(val interface{}) error {
+	var bytesValue []byte
+	switch v := val.(type) {
+	case []byte:
+		bytesValue = v
+	case string:
+		bytesValue = []byte(v)
+	}
+	if len(bytesValue) == 0 {
+		*info = ChannelInfo{}
+		return nil
+	}
+	return json.Unmarshal(bytesValue, info)
+}
+
+func (info ChannelInfo) Value() (driver.Value, error) {
+	return json.Marshal(info)
 }
 
 func (channel *Channel) GetModels() []string {
@@ -0,0 +1,243 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"tea-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MultiKeyModeRandom  = "random"
+	MultiKeyModePolling = "polling"
+)
+
+// channelKeyLock 保护多密钥渠道的状态列表以及轮询下标
+var channelKeyLock sync.Mutex
+var channelKeyPollingIndex = make(map[int]int)
+
+// channelKeyUpdateLock 串行化 UpdateChannelKeyStatus 对 channel_info 的读改写
+var channelKeyUpdateLock sync.Mutex
+
+// ChannelKeyInfo 用于管理接口展示单个密钥的状态
+type ChannelKeyInfo struct {
+	Index          int    `json:"index"`
+	Key            string `json:"key"`
+	Status         int    `json:"status"`
+	DisabledReason string `json:"disabled_reason,omitempty"`
+	DisabledTime   int64  `json:"disabled_time,omitempty"`
+}
+
+// GetKeys 返回渠道的全部密钥，多密钥渠道按行拆分，Vertex 渠道使用 JSON 数组
+func (channel *Channel) GetKeys() []string {
+	if !channel.ChannelInfo.IsMultiKey {
+		return []string{channel.Key}
+	}
+	trimmed := strings.TrimSpace(channel.Key)
+	if channel.Type == common.ChannelTypeVertexAi && strings.HasPrefix(trimmed, "[") {
+		var rawKeys []json.RawMessage
+		if err := json.Unmarshal([]byte(trimmed), &rawKeys); err == nil {
+			keys := make([]string, 0, len(rawKeys))
+			for _, raw := range rawKeys {
+				keys = append(keys, string(raw))
+			}
+			return keys
+		}
+	}
+	keys := make([]string, 0)
+	for _, key := range strings.Split(trimmed, "\n") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (info *ChannelInfo) getKeyStatus(index int) int {
+	if info.MultiKeyStatusList == nil {
+		return common.ChannelStatusEnabled
+	}
+	status, ok := info.MultiKeyStatusList[index]
+	if !ok {
+		return common.ChannelStatusEnabled
+	}
+	return status
+}
+
+// GetNextEnabledKey 按渠道的多密钥模式选出一个可用密钥，返回密钥及其下标。
+// 非多密钥渠道直接返回 channel.Key，下标为 0。
+func (channel *Channel) GetNextEnabledKey() (string, int, error) {
+	if !channel.ChannelInfo.IsMultiKey {
+		return channel.Key, 0, nil
+	}
+	keys := channel.GetKeys()
+	if len(keys) == 0 {
+		return "", 0, errors.New("渠道没有可用的密钥")
+	}
+
+	channelKeyLock.Lock()
+	defer channelKeyLock.Unlock()
+
+	enabledIdx := make([]int, 0, len(keys))
+	for i := range keys {
+		if channel.ChannelInfo.getKeyStatus(i) == common.ChannelStatusEnabled {
+			enabledIdx = append(enabledIdx, i)
+		}
+	}
+	if len(enabledIdx) == 0 {
+		return "", 0, fmt.Errorf("渠道 #%d 的所有密钥均已禁用", channel.Id)
+	}
+
+	if channel.ChannelInfo.MultiKeyMode == MultiKeyModePolling {
+		start := channelKeyPollingIndex[channel.Id] % len(keys)
+		for offset := 0; offset < len(keys); offset++ {
+			idx := (start + offset) % len(keys)
+			if channel.ChannelInfo.getKeyStatus(idx) == common.ChannelStatusEnabled {
+				channelKeyPollingIndex[channel.Id] = idx + 1
+				return keys[idx], idx, nil
+			}
+		}
+	}
+	idx := enabledIdx[rand.Intn(len(enabledIdx))]
+	return keys[idx], idx, nil
+}
+
+// GetDefaultKey 返回一个可用密钥，用于任务查询、余额查询等不经过渠道选择的场景
+func (channel *Channel) GetDefaultKey() string {
+	key, _, err := channel.GetNextEnabledKey()
+	if err != nil {
+		if keys := channel.GetKeys(); len(keys) > 0 {
+			return keys[0]
+		}
+		return channel.Key
+	}
+	return key
+}
+
+// GetKeyByIndex 返回指定下标的密钥
+func (channel *Channel) GetKeyByIndex(index int) (string, error) {
+	keys := channel.GetKeys()
+	if index < 0 || index >= len(keys) {
+		return "", fmt.Errorf("密钥下标 %d 超出范围", index)
+	}
+	return keys[index], nil
+}
+
+// GetKeyInfos 返回多密钥渠道中每个密钥的状态，密钥内容已脱敏
+func (channel *Channel) GetKeyInfos() []ChannelKeyInfo {
+	channelKeyLock.Lock()
+	defer channelKeyLock.Unlock()
+	keys := channel.GetKeys()
+	infos := make([]ChannelKeyInfo, 0, len(keys))
+	for i, key := range keys {
+		info := ChannelKeyInfo{
+			Index:  i,
+			Key:    maskChannelKey(key),
+			Status: channel.ChannelInfo.getKeyStatus(i),
+		}
+		if channel.ChannelInfo.MultiKeyDisabledReason != nil {
+			info.DisabledReason = channel.ChannelInfo.MultiKeyDisabledReason[i]
+		}
+		if channel.ChannelInfo.MultiKeyDisabledTime != nil {
+			info.DisabledTime = channel.ChannelInfo.MultiKeyDisabledTime[i]
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// WithSingleKey 返回仅包含指定下标密钥的渠道副本，用于单独测试某个密钥
+func (channel *Channel) WithSingleKey(index int) (*Channel, error) {
+	key, err := channel.GetKeyByIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	single := *channel
+	single.Key = key
+	single.ChannelInfo = ChannelInfo{}
+	return &single, nil
+}
+
+// NormalizeMultiKey 在新增或修改密钥后重新计算密钥数量并重置各密钥状态
+func (channel *Channel) NormalizeMultiKey() {
+	if !channel.ChannelInfo.IsMultiKey {
+		return
+	}
+	if channel.ChannelInfo.MultiKeyMode != MultiKeyModePolling {
+		channel.ChannelInfo.MultiKeyMode = MultiKeyModeRandom
+	}
+	channel.ChannelInfo.MultiKeySize = len(channel.GetKeys())
+	channel.ChannelInfo.MultiKeyStatusList = nil
+	channel.ChannelInfo.MultiKeyDisabledReason = nil
+	channel.ChannelInfo.MultiKeyDisabledTime = nil
+}
+
+func maskChannelKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:4] + strings.Repeat("*", 8) + key[len(key)-4:]
+}
+
+// UpdateChannelKeyStatus 更新多密钥渠道中单个密钥的状态，
+// 返回更新后仍启用的密钥数量。
+// 渠道出错时会异步调用，读改写 channel_info 需要串行化：同一进程内由 channelKeyUpdateLock 保证，
+// 多个节点之间在事务中使用 SELECT ... FOR UPDATE 锁定渠道记录。
+func UpdateChannelKeyStatus(channelId int, index int, status int, reason string) (int, error) {
+	channelKeyUpdateLock.Lock()
+	defer channelKeyUpdateLock.Unlock()
+
+	var info ChannelInfo
+	enabled := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var channel Channel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&channel, "id = ?", channelId).Error; err != nil {
+			return err
+		}
+		if !channel.ChannelInfo.IsMultiKey {
+			return errors.New("该渠道未启用多密钥模式")
+		}
+		keys := channel.GetKeys()
+		if index < 0 || index >= len(keys) {
+			return fmt.Errorf("密钥下标 %d 超出范围", index)
+		}
+		info = channel.ChannelInfo
+		if info.MultiKeyStatusList == nil {
+			info.MultiKeyStatusList = make(map[int]int)
+		}
+		if info.MultiKeyDisabledReason == nil {
+			info.MultiKeyDisabledReason = make(map[int]string)
+		}
+		if info.MultiKeyDisabledTime == nil {
+			info.MultiKeyDisabledTime = make(map[int]int64)
+		}
+		if status == common.ChannelStatusEnabled {
+			delete(info.MultiKeyStatusList, index)
+			delete(info.MultiKeyDisabledReason, index)
+			delete(info.MultiKeyDisabledTime, index)
+		} else {
+			info.MultiKeyStatusList[index] = status
+			info.MultiKeyDisabledReason[index] = reason
+			info.MultiKeyDisabledTime[index] = common.GetTimestamp()
+		}
+		for i := range keys {
+			if info.getKeyStatus(i) == common.ChannelStatusEnabled {
+				enabled++
+			}
+		}
+		return tx.Model(&Channel{}).Where("id = ?", channelId).Update("channel_info", info).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	CacheUpdateChannelInfo(channelId, info)
+	return enabled, nil
+}
@@ -1,31 +1,53 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"fmt"
+
+	"tea-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
 
 // ChannelStat records usage statistics for a channel
 // SuccessRate is calculated as Success/Total in service layer
-// Continuous failures or successes can be extended later
+// Rows with an empty Model hold the channel-level totals, other rows are per channel+model
+// and additionally carry the health snapshot maintained by service.ChannelManager
 
 type ChannelStat struct {
-	ID        int   `json:"id" gorm:"primaryKey"`
-	ChannelID int   `json:"channel_id" gorm:"index"`
-	Total     int64 `json:"total"`
-	Success   int64 `json:"success"`
-	UpdatedAt int64 `json:"updated_at" gorm:"autoUpdateTime:milli"`
-	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime:milli"`
+	ID                   int     `json:"id" gorm:"primaryKey"`
+	ChannelID            int     `json:"channel_id" gorm:"index;uniqueIndex:idx_channel_stat_channel_model"`
+	Model                string  `json:"model" gorm:"type:varchar(255);default:'';uniqueIndex:idx_channel_stat_channel_model"`
+	Total                int64   `json:"total"`
+	Success              int64   `json:"success"`
+	RecentSuccessRate    float64 `json:"recent_success_rate" gorm:"default:1"`
+	AvgLatency           float64 `json:"avg_latency"`             // in milliseconds
+	AvgFirstTokenLatency float64 `json:"avg_first_token_latency"` // in milliseconds
+	ConsecutiveFailures  int     `json:"consecutive_failures"`
+	CircuitState         string  `json:"circuit_state" gorm:"type:varchar(16);default:'closed'"`
+	UpdatedAt            int64   `json:"updated_at" gorm:"autoUpdateTime:milli"`
+	CreatedAt            int64   `json:"created_at" gorm:"autoCreateTime:milli"`
 }
 
+// channelStatUniqueIndex 渠道+模型唯一索引，旧版本的表按渠道记录，可能存在重复行
+const channelStatUniqueIndex = "idx_channel_stat_channel_model"
+
 type ChannelStatDetail struct {
-    ChannelStat
-    Name string `json:"name"`
+	ChannelStat
+	Name string `json:"name"`
 }
 
 func GetChannelStatDetails() (stats []ChannelStatDetail, err error) {
-    err = DB.Table("channel_stats").
-        Select("channel_stats.*, channels.name").
-        Joins("left join channels on channels.id = channel_stats.channel_id").
-        Scan(&stats).Error
-    return
+	err = DB.Table("channel_stats").
+		Select("channel_stats.*, channels.name").
+		Joins("left join channels on channels.id = channel_stats.channel_id").
+		Scan(&stats).Error
+	return
+}
+
+func GetAllChannelStats() (stats []*ChannelStat, err error) {
+	err = DB.Find(&stats).Error
+	return
 }
 
 func UpdateChannelStat(tx *gorm.DB, channelID int, success bool) error {
@@ -41,5 +63,72 @@ func UpdateChannelStat(tx *gorm.DB, channelID int, success bool) error {
 	if success {
 		updates["success"] = gorm.Expr("success + ?", 1)
 	}
-	return tx.Model(&ChannelStat{}).Where("channel_id = ?", channelID).Updates(updates).Error
+	return tx.Model(&ChannelStat{}).Where("channel_id = ? and model = ?", channelID, "").Updates(updates).Error
+}
+
+// SaveChannelHealthStat 累加调用次数并覆盖健康快照，total/success 为上次保存以来的增量
+func SaveChannelHealthStat(stat *ChannelStat) error {
+	return DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "channel_id"}, {Name: "model"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"total":                   gorm.Expr("channel_stats.total + ?", stat.Total),
+			"success":                 gorm.Expr("channel_stats.success + ?", stat.Success),
+			"recent_success_rate":     stat.RecentSuccessRate,
+			"avg_latency":             stat.AvgLatency,
+			"avg_first_token_latency": stat.AvgFirstTokenLatency,
+			"consecutive_failures":    stat.ConsecutiveFailures,
+			"circuit_state":           stat.CircuitState,
+			"updated_at":              stat.UpdatedAt,
+		}),
+	}).Create(stat).Error
+}
+
+// dedupeChannelStats 在创建渠道+模型唯一索引前合并重复的统计行，
+// 保留 id 最大的一行并累加 total/success，其余行删除
+func dedupeChannelStats() error {
+	migrator := DB.Migrator()
+	if !migrator.HasTable(&ChannelStat{}) || migrator.HasIndex(&ChannelStat{}, channelStatUniqueIndex) {
+		return nil
+	}
+	// 旧版本的表没有 model 列，迁移时新增的 model 列默认为空，按渠道合并即可
+	hasModel := migrator.HasColumn(&ChannelStat{}, "model")
+	groupBy := "channel_id"
+	if hasModel {
+		groupBy = "channel_id, model"
+	}
+	var duplicates []struct {
+		ChannelID int
+		Model     string
+		Total     int64
+		Success   int64
+		MaxID     int
+	}
+	err := DB.Model(&ChannelStat{}).
+		Select(groupBy + ", SUM(total) AS total, SUM(success) AS success, MAX(id) AS max_id").
+		Group(groupBy).
+		Having("COUNT(*) > 1").
+		Scan(&duplicates).Error
+	if err != nil {
+		return err
+	}
+	for _, dup := range duplicates {
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&ChannelStat{}).Where("id = ?", dup.MaxID).
+				UpdateColumns(map[string]interface{}{"total": dup.Total, "success": dup.Success}).Error; err != nil {
+				return err
+			}
+			query := tx.Where("channel_id = ? AND id <> ?", dup.ChannelID, dup.MaxID)
+			if hasModel {
+				query = query.Where("model = ?", dup.Model)
+			}
+			return query.Delete(&ChannelStat{}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(duplicates) > 0 {
+		common.SysLog(fmt.Sprintf("merged duplicate channel stats of %d channel/model pairs", len(duplicates)))
+	}
+	return nil
 }
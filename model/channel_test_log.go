@@ -0,0 +1,62 @@
+package model
+
+import "tea-api/common"
+
+const (
+	ChannelTestSourceManual = "manual"
+	ChannelTestSourceAuto   = "auto"
+
+	// 测试后对渠道执行的动作
+	ChannelTestActionDisabled = "disabled"
+	ChannelTestActionEnabled  = "enabled"
+)
+
+// ChannelTestLog 记录每次渠道测试的结果以及据此对渠道做出的启用/禁用动作，用于排查渠道反复切换状态的原因
+type ChannelTestLog struct {
+	Id           int    `json:"id"`
+	ChannelId    int    `json:"channel_id" gorm:"index"`
+	KeyIndex     int    `json:"key_index" gorm:"default:-1"` // 多密钥渠道测试的密钥下标，-1 表示整个渠道
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index"`
+	Source       string `json:"source" gorm:"type:varchar(16)"`
+	ModelName    string `json:"model_name" gorm:"type:varchar(255);default:''"`
+	Success      bool   `json:"success"`
+	ResponseTime int64  `json:"response_time"` // in milliseconds
+	StatusCode   int    `json:"status_code"`
+	Message      string `json:"message" gorm:"type:text"`
+	StatusBefore int    `json:"status_before"`
+	StatusAfter  int    `json:"status_after"` // 按测试结果禁用或启用后的状态
+	Action       string `json:"action" gorm:"type:varchar(16);default:''"`
+	// 自动测试连续通过/失败的次数
+	ConsecutivePasses   int `json:"consecutive_passes"`
+	ConsecutiveFailures int `json:"consecutive_failures"`
+}
+
+func RecordChannelTestLog(log *ChannelTestLog) {
+	if log.CreatedAt == 0 {
+		log.CreatedAt = common.GetTimestamp()
+	}
+	if err := DB.Create(log).Error; err != nil {
+		common.SysError("failed to record channel test log: " + err.Error())
+	}
+}
+
+// GetChannelTestLogs 按时间倒序查询测试记录，channelId 为 0 时查询所有渠道
+func GetChannelTestLogs(channelId int, onlyFailed bool, startIdx int, num int) (logs []*ChannelTestLog, total int64, err error) {
+	tx := DB.Model(&ChannelTestLog{})
+	if channelId != 0 {
+		tx = tx.Where("channel_id = ?", channelId)
+	}
+	if onlyFailed {
+		tx = tx.Where("success = ?", false)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, total, err
+}
+
+func DeleteOldChannelTestLogs(targetTimestamp int64) (int64, error) {
+	result := DB.Where("created_at < ?", targetTimestamp).Delete(&ChannelTestLog{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"errors"
+	"tea-api/common"
+
+	"gorm.io/gorm"
+)
+
+// File 用户通过 Files API 上传的文件以及批处理任务生成的结果文件，文件内容保存在文件存储中
+type File struct {
+	Id         string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	Filename   string `json:"filename"`
+	Purpose    string `json:"purpose" gorm:"type:varchar(32);index"`
+	Bytes      int64  `json:"bytes"`
+	StorageKey string `json:"-"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (file *File) Insert() error {
+	if file.CreatedAt == 0 {
+		file.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(file).Error
+}
+
+// GetUserFileById 只返回属于该用户的文件
+func GetUserFileById(id string, userId int) (*File, error) {
+	if id == "" {
+		return nil, errors.New("file id 为空")
+	}
+	var file File
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetUserFiles 按创建时间倒序列出用户的文件，after 为上一页最后一个文件的 ID
+func GetUserFiles(userId int, purpose string, after string, limit int) ([]*File, error) {
+	var files []*File
+	tx := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		tx = tx.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		cursor, err := GetUserFileById(after, userId)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where("created_at < ? OR (created_at = ? AND id < ?)", cursor.CreatedAt, cursor.CreatedAt, cursor.Id)
+	}
+	err := tx.Order("created_at desc, id desc").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+func DeleteUserFileById(id string, userId int) error {
+	result := DB.Where("id = ? AND user_id = ?", id, userId).Delete(&File{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"strings"
+	"tea-api/common"
+	"tea-api/setting"
+)
+
+// CacheGetRandomSatisfiedChannelWithFallback 按分组回退链选择渠道，返回选中的渠道及其所在分组。
+// retry 先在原分组内按优先级递减，原分组的优先级用尽或全部熔断后依次进入回退分组。
+func CacheGetRandomSatisfiedChannelWithFallback(group string, model string, retry int) (*Channel, string, error) {
+	chain := setting.GetGroupFallbackChain(group)
+	if len(chain) == 1 {
+		channel, err := CacheGetRandomSatisfiedChannel(group, model, retry)
+		return channel, group, err
+	}
+
+	remaining := retry
+	lastGroup := ""
+	lastRetry := 0
+	for _, g := range chain {
+		count := countHealthyPriorities(g, model)
+		if count == 0 {
+			continue
+		}
+		if remaining < count {
+			channel, err := CacheGetRandomSatisfiedChannel(g, model, remaining)
+			return channel, g, err
+		}
+		remaining -= count
+		lastGroup = g
+		lastRetry = count - 1
+	}
+	if lastGroup != "" {
+		// 回退链已走完，停留在最后一个可用分组的最低优先级
+		channel, err := CacheGetRandomSatisfiedChannel(lastGroup, model, lastRetry)
+		return channel, lastGroup, err
+	}
+
+	// 回退链上没有健康渠道，按顺序选择第一个存在渠道的分组（全部熔断时由半开探测恢复）
+	var err error
+	for _, g := range chain {
+		var channel *Channel
+		channel, err = CacheGetRandomSatisfiedChannel(g, model, retry)
+		if err == nil && channel != nil {
+			return channel, g, nil
+		}
+	}
+	return nil, group, err
+}
+
+// countHealthyPriorities 返回分组下该模型未熔断渠道的优先级数量，为 0 表示该分组不可用
+func countHealthyPriorities(group string, model string) int {
+	requestModel := model
+	if strings.HasPrefix(model, "gpt-4-gizmo") {
+		model = "gpt-4-gizmo-*"
+	}
+	if strings.HasPrefix(model, "gpt-4o-gizmo") {
+		model = "gpt-4o-gizmo-*"
+	}
+
+	priorities := make(map[int64]bool)
+	if common.MemoryCacheEnabled {
+		channelSyncLock.RLock()
+		channels := group2model2channels[group][model]
+		channelSyncLock.RUnlock()
+		for _, channel := range channels {
+			if channelHealthChecker == nil || channelHealthChecker.Allow(channel.Id, requestModel) {
+				priorities[channel.GetPriority()] = true
+			}
+		}
+		return len(priorities)
+	}
+
+	trueVal := "1"
+	if common.UsingPostgreSQL {
+		trueVal = "true"
+	}
+	var abilities []Ability
+	err := DB.Select("channel_id, priority").Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model).Find(&abilities).Error
+	if err != nil {
+		return 0
+	}
+	healthy := false
+	for _, ability := range abilities {
+		if ability.Priority != nil {
+			priorities[*ability.Priority] = true
+		}
+		if channelHealthChecker == nil || channelHealthChecker.Allow(ability.ChannelId, requestModel) {
+			healthy = true
+		}
+	}
+	// 数据库模式下重试按全部优先级计算，只要存在健康渠道就视为可用
+	if !healthy {
+		return 0
+	}
+	return len(priorities)
+}
@@ -0,0 +1,82 @@
+package model
+
+// LatencyStat 保存每个时间桶内的延迟分位数（毫秒），由 service 层定期汇总写入
+// ChannelId 为 0 且 Model 为空的行是全局汇总，Model 为空的行是渠道汇总，ChannelId 为 0 的行是模型汇总；
+// 多个节点会各自写入同一时间桶的行，查询时按请求数加权合并
+type LatencyStat struct {
+	Id            int    `json:"id"`
+	BucketStart   int64  `json:"bucket_start" gorm:"bigint;index:idx_latency_stat_bucket"`
+	ChannelId     int    `json:"channel_id" gorm:"index"`
+	Model         string `json:"model" gorm:"type:varchar(255);default:'';index"`
+	Count         int64  `json:"count"`
+	AuthP50       int64  `json:"auth_p50"`
+	AuthP90       int64  `json:"auth_p90"`
+	AuthP99       int64  `json:"auth_p99"`
+	ConnectP50    int64  `json:"connect_p50"`
+	ConnectP90    int64  `json:"connect_p90"`
+	ConnectP99    int64  `json:"connect_p99"`
+	FirstTokenP50 int64  `json:"first_token_p50"`
+	FirstTokenP90 int64  `json:"first_token_p90"`
+	FirstTokenP99 int64  `json:"first_token_p99"`
+}
+
+func SaveLatencyStats(stats []*LatencyStat) error {
+	if len(stats) == 0 {
+		return nil
+	}
+	return DB.CreateInBatches(stats, 100).Error
+}
+
+// GetLatencyStatHistory 查询时间范围内指定渠道或模型的延迟历史，按时间桶合并多个节点的数据
+func GetLatencyStatHistory(channelId int, modelName string, startTimestamp int64, endTimestamp int64) ([]*LatencyStat, error) {
+	var rows []*LatencyStat
+	tx := DB.Where("channel_id = ? and model = ?", channelId, modelName)
+	if startTimestamp != 0 {
+		tx = tx.Where("bucket_start >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("bucket_start <= ?", endTimestamp)
+	}
+	if err := tx.Order("bucket_start asc").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	merged := make([]*LatencyStat, 0, len(rows))
+	for _, row := range rows {
+		if n := len(merged); n > 0 && merged[n-1].BucketStart == row.BucketStart {
+			mergeLatencyStat(merged[n-1], row)
+			continue
+		}
+		merged = append(merged, row)
+	}
+	return merged, nil
+}
+
+// mergeLatencyStat 按请求数加权平均，分位数无法精确合并，这里只作为趋势参考
+func mergeLatencyStat(dst *LatencyStat, src *LatencyStat) {
+	total := dst.Count + src.Count
+	if total == 0 {
+		return
+	}
+	weighted := func(a, b int64) int64 {
+		// 某一阶段没有样本时取另一方的值
+		if a == 0 || b == 0 {
+			return max(a, b)
+		}
+		return (a*dst.Count + b*src.Count) / total
+	}
+	dst.AuthP50 = weighted(dst.AuthP50, src.AuthP50)
+	dst.AuthP90 = weighted(dst.AuthP90, src.AuthP90)
+	dst.AuthP99 = weighted(dst.AuthP99, src.AuthP99)
+	dst.ConnectP50 = weighted(dst.ConnectP50, src.ConnectP50)
+	dst.ConnectP90 = weighted(dst.ConnectP90, src.ConnectP90)
+	dst.ConnectP99 = weighted(dst.ConnectP99, src.ConnectP99)
+	dst.FirstTokenP50 = weighted(dst.FirstTokenP50, src.FirstTokenP50)
+	dst.FirstTokenP90 = weighted(dst.FirstTokenP90, src.FirstTokenP90)
+	dst.FirstTokenP99 = weighted(dst.FirstTokenP99, src.FirstTokenP99)
+	dst.Count = total
+}
+
+func DeleteOldLatencyStats(targetTimestamp int64) (int64, error) {
+	result := DB.Where("bucket_start < ?", targetTimestamp).Delete(&LatencyStat{})
+	return result.RowsAffected, result.Error
+}
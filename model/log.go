@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"tea-api/common"
+	"tea-api/constant"
 	"os"
 	"strings"
 	"time"
@@ -90,11 +91,37 @@ func RecordLog(userId int, logType int, content string) {
 	}
 }
 
+// withTraceId 将链路追踪的 trace id 写入日志的 other 字段，便于从日志定位链路
+func withTraceId(c *gin.Context, other map[string]interface{}) map[string]interface{} {
+	traceId := c.GetString(common.TraceIdKey)
+	if traceId == "" {
+		return other
+	}
+	if other == nil {
+		other = make(map[string]interface{})
+	}
+	other["trace_id"] = traceId
+	return other
+}
+
+// withPayloadCapture 本次请求的内容被留存时，将请求 ID 写入日志的 other 字段，用于从日志查看留存内容
+func withPayloadCapture(c *gin.Context, other map[string]interface{}) map[string]interface{} {
+	if !c.GetBool(constant.ContextKeyPayloadCaptured) {
+		return other
+	}
+	if other == nil {
+		other = make(map[string]interface{})
+	}
+	other["request_id"] = c.GetString(common.RequestIdKey)
+	other["payload_captured"] = true
+	return other
+}
+
 func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string, tokenName string, content string, tokenId int, useTimeSeconds int,
 	isStream bool, group string, other map[string]interface{}) {
 	common.LogInfo(c, fmt.Sprintf("record error log: userId=%d, channelId=%d, modelName=%s, tokenName=%s, content=%s", userId, channelId, modelName, tokenName, content))
 	username := c.GetString("username")
-	otherStr := common.MapToJsonStr(other)
+	otherStr := common.MapToJsonStr(withPayloadCapture(c, withTraceId(c, other)))
 	log := &Log{
 		UserId:           userId,
 		Username:         username,
@@ -123,11 +150,14 @@ func RecordConsumeLog(c *gin.Context, userId int, channelId int, promptTokens in
 	modelName string, tokenName string, quota int, content string, tokenId int, userQuota int, useTimeSeconds int,
 	isStream bool, group string, other map[string]interface{}) {
 	common.LogInfo(c, fmt.Sprintf("record consume log: userId=%d, 用户调用前余额=%d, channelId=%d, promptTokens=%d, completionTokens=%d, modelName=%s, tokenName=%s, quota=%d, content=%s", userId, userQuota, channelId, promptTokens, completionTokens, modelName, tokenName, quota, content))
+	// 令牌的时间窗口用量不受消费日志开关影响
+	RecordTokenUsage(tokenId, quota, promptTokens+completionTokens)
+	common.RecordConsumeMetrics(channelId, c.GetInt("channel_type"), modelName, group, promptTokens, completionTokens, quota)
 	if !common.LogConsumeEnabled {
 		return
 	}
 	username := c.GetString("username")
-	otherStr := common.MapToJsonStr(other)
+	otherStr := common.MapToJsonStr(withPayloadCapture(c, withTraceId(c, other)))
 	log := &Log{
 		UserId:           userId,
 		Username:         username,
@@ -171,7 +171,11 @@ func InitDB() (err error) {
 func InitLogDB() (err error) {
 	if os.Getenv("LOG_SQL_DSN") == "" {
 		LOG_DB = DB
-		return
+		if !common.IsMasterNode {
+			return
+		}
+		// 日志库与主库相同时，日志相关的表同样只在 migrateLOGDB 中迁移
+		return migrateLOGDB()
 	}
 	db, err := chooseDB("LOG_SQL_DSN")
 	if err == nil {
@@ -254,10 +258,43 @@ func migrateDB() error {
 	if err != nil {
 		return err
 	}
+	// 唯一索引创建前先合并重复的统计行，否则 AutoMigrate 会失败
+	err = dedupeChannelStats()
+	if err != nil {
+		return err
+	}
 	err = DB.AutoMigrate(&ChannelStat{})
 	if err != nil {
 		return err
 	}
+	err = DB.AutoMigrate(&LatencyStat{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&ChannelTestLog{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&File{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&Batch{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&StoredResponse{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&SubscriptionPlan{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&Subscription{})
+	if err != nil {
+		return err
+	}
 	err = DB.AutoMigrate(&Setup{})
 	common.SysLog("database migrated")
 	//err = createRootAccountIfNeed()
@@ -269,6 +306,12 @@ func migrateLOGDB() error {
 	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
 		return err
 	}
+	if err = LOG_DB.AutoMigrate(&SecurityEvent{}); err != nil {
+		return err
+	}
+	if err = LOG_DB.AutoMigrate(&PayloadCapture{}); err != nil {
+		return err
+	}
 	return nil
 }
 
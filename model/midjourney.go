@@ -21,6 +21,10 @@ type Midjourney struct {
 	Quota       int    `json:"quota"`
 	Buttons     string `json:"buttons"`
 	Properties  string `json:"properties"`
+
+	// 预扣时从订阅扣除的部分，任务失败时先退回订阅额度
+	SubscriptionId    int `json:"subscription_id" gorm:"default:0"`
+	SubscriptionQuota int `json:"subscription_quota" gorm:"default:0"`
 }
 
 // TaskQueryParams 用于包含所有搜索条件的结构体，可以根据需求添加更多字段
@@ -109,6 +113,16 @@ func GetByOnlyMJId(mjId string) *Midjourney {
 	return mj
 }
 
+// GetLatestMjIdByChannelId 返回渠道最近提交的任务 id，用于渠道测试时查询一个已知任务
+func GetLatestMjIdByChannelId(channelId int) string {
+	var mj Midjourney
+	err := DB.Where("channel_id = ? and mj_id != ?", channelId, "").Order("id desc").First(&mj).Error
+	if err != nil {
+		return ""
+	}
+	return mj.MjId
+}
+
 func GetByMJId(userId int, mjId string) *Midjourney {
 	var mj *Midjourney
 	var err error
@@ -155,6 +169,14 @@ func (midjourney *Midjourney) Update() error {
 	return err
 }
 
+// UpdateMidjourneySubscriptionQuota 记录任务从订阅扣除的额度
+func UpdateMidjourneySubscriptionQuota(id int, subscriptionId int, subscriptionQuota int) error {
+	return DB.Model(&Midjourney{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"subscription_id":    subscriptionId,
+		"subscription_quota": subscriptionQuota,
+	}).Error
+}
+
 func MjBulkUpdate(mjIds []string, params map[string]any) error {
 	return DB.Model(&Midjourney{}).
 		Where("mj_id in (?)", mjIds).
@@ -32,6 +32,7 @@ func InitOptionMap() {
 	common.OptionMap["FileDownloadPermission"] = strconv.Itoa(common.FileDownloadPermission)
 	common.OptionMap["ImageUploadPermission"] = strconv.Itoa(common.ImageUploadPermission)
 	common.OptionMap["ImageDownloadPermission"] = strconv.Itoa(common.ImageDownloadPermission)
+	common.OptionMap["TwoFactorRequiredRole"] = strconv.Itoa(common.TwoFactorRequiredRole)
 	common.OptionMap["PasswordLoginEnabled"] = strconv.FormatBool(common.PasswordLoginEnabled)
 	common.OptionMap["PasswordRegisterEnabled"] = strconv.FormatBool(common.PasswordRegisterEnabled)
 	common.OptionMap["EmailVerificationEnabled"] = strconv.FormatBool(common.EmailVerificationEnabled)
@@ -80,6 +81,12 @@ func InitOptionMap() {
 	common.OptionMap["EpayKey"] = ""
 	common.OptionMap["Price"] = strconv.FormatFloat(setting.Price, 'f', -1, 64)
 	common.OptionMap["MinTopUp"] = strconv.Itoa(setting.MinTopUp)
+	common.OptionMap["PaymentProvider"] = setting.PaymentProvider
+	common.OptionMap["StripeApiAddress"] = setting.StripeApiAddress
+	common.OptionMap["StripeApiSecret"] = ""
+	common.OptionMap["StripeWebhookSecret"] = ""
+	common.OptionMap["StripeCurrency"] = setting.StripeCurrency
+	common.OptionMap["StripePrice"] = strconv.FormatFloat(setting.StripePrice, 'f', -1, 64)
 	common.OptionMap["TopupGroupRatio"] = common.TopupGroupRatio2JSONString()
 	common.OptionMap["Chats"] = setting.Chats2JsonString()
 	common.OptionMap["GitHubClientId"] = ""
@@ -103,8 +110,13 @@ func InitOptionMap() {
 	common.OptionMap["ModelRatio"] = operation_setting.ModelRatio2JSONString()
 	common.OptionMap["ModelPrice"] = operation_setting.ModelPrice2JSONString()
 	common.OptionMap["CacheRatio"] = operation_setting.CacheRatio2JSONString()
+	common.OptionMap["BatchDiscountRatio"] = operation_setting.BatchDiscountRatio2JSONString()
 	common.OptionMap["GroupRatio"] = setting.GroupRatio2JSONString()
 	common.OptionMap["UserUsableGroups"] = setting.UserUsableGroups2JSONString()
+	common.OptionMap["GroupFallbackChains"] = setting.GroupFallbackChains2JSONString()
+	common.OptionMap["GroupFallbackBillingMode"] = setting.GroupFallbackBillingMode
+	common.OptionMap["GroupRoutingModes"] = setting.GroupRoutingModes2JSONString()
+	common.OptionMap["ModelFallbackChains"] = setting.ModelFallbackChains2JSONString()
 	common.OptionMap["CompletionRatio"] = operation_setting.CompletionRatio2JSONString()
 	common.OptionMap["TopUpLink"] = common.TopUpLink
 	//common.OptionMap["ChatLink"] = common.ChatLink
@@ -124,8 +136,16 @@ func InitOptionMap() {
 	common.OptionMap["SelfUseModeEnabled"] = strconv.FormatBool(operation_setting.SelfUseModeEnabled)
 	common.OptionMap["ModelRequestRateLimitEnabled"] = strconv.FormatBool(setting.ModelRequestRateLimitEnabled)
 	common.OptionMap["CheckSensitiveOnPromptEnabled"] = strconv.FormatBool(setting.CheckSensitiveOnPromptEnabled)
+	common.OptionMap["CheckSensitiveOnCompletionEnabled"] = strconv.FormatBool(setting.CheckSensitiveOnCompletionEnabled)
 	common.OptionMap["StopOnSensitiveEnabled"] = strconv.FormatBool(setting.StopOnSensitiveEnabled)
 	common.OptionMap["SensitiveWords"] = setting.SensitiveWordsToString()
+	common.OptionMap["RegexFilterEnabled"] = strconv.FormatBool(setting.RegexFilterEnabled)
+	common.OptionMap["RegexFilterRules"] = setting.RegexFilterRules2JSONString()
+	common.OptionMap["ResponseCacheEnabled"] = strconv.FormatBool(setting.ResponseCacheEnabled)
+	common.OptionMap["ResponseCacheTTLSeconds"] = strconv.Itoa(setting.ResponseCacheTTLSeconds)
+	common.OptionMap["ResponseCacheHitRatio"] = strconv.FormatFloat(setting.ResponseCacheHitRatio, 'f', -1, 64)
+	common.OptionMap["ResponseCacheGroups"] = setting.ResponseCacheGroups2JSONString()
+	common.OptionMap["RegexFilterExemptions"] = setting.RegexFilterExemptions2JSONString()
 	common.OptionMap["StreamCacheQueueLength"] = strconv.Itoa(setting.StreamCacheQueueLength)
 	common.OptionMap["AutomaticDisableKeywords"] = operation_setting.AutomaticDisableKeywordsToString()
 
@@ -266,10 +286,16 @@ func updateOptionMap(key string, value string) (err error) {
 			operation_setting.SelfUseModeEnabled = boolValue
 		case "CheckSensitiveOnPromptEnabled":
 			setting.CheckSensitiveOnPromptEnabled = boolValue
+		case "CheckSensitiveOnCompletionEnabled":
+			setting.CheckSensitiveOnCompletionEnabled = boolValue
 		case "ModelRequestRateLimitEnabled":
 			setting.ModelRequestRateLimitEnabled = boolValue
 		case "StopOnSensitiveEnabled":
 			setting.StopOnSensitiveEnabled = boolValue
+		case "RegexFilterEnabled":
+			setting.RegexFilterEnabled = boolValue
+		case "ResponseCacheEnabled":
+			setting.ResponseCacheEnabled = boolValue
 		case "SMTPSSLEnabled":
 			common.SMTPSSLEnabled = boolValue
 		case "WorkerAllowHttpImageRequestEnabled":
@@ -310,6 +336,18 @@ func updateOptionMap(key string, value string) (err error) {
 		setting.Price, _ = strconv.ParseFloat(value, 64)
 	case "MinTopUp":
 		setting.MinTopUp, _ = strconv.Atoi(value)
+	case "PaymentProvider":
+		setting.PaymentProvider = value
+	case "StripeApiAddress":
+		setting.StripeApiAddress = value
+	case "StripeApiSecret":
+		setting.StripeApiSecret = value
+	case "StripeWebhookSecret":
+		setting.StripeWebhookSecret = value
+	case "StripeCurrency":
+		setting.StripeCurrency = value
+	case "StripePrice":
+		setting.StripePrice, _ = strconv.ParseFloat(value, 64)
 	case "TopupGroupRatio":
 		err = common.UpdateTopupGroupRatioByJSONString(value)
 	case "GitHubClientId":
@@ -340,6 +378,8 @@ func updateOptionMap(key string, value string) (err error) {
 		common.TurnstileSiteKey = value
 	case "TurnstileSecretKey":
 		common.TurnstileSecretKey = value
+	case "TwoFactorRequiredRole":
+		common.TwoFactorRequiredRole, _ = strconv.Atoi(value)
 	case "QuotaForNewUser":
 		common.QuotaForNewUser, _ = strconv.Atoi(value)
 	case "QuotaForInviter":
@@ -370,12 +410,22 @@ func updateOptionMap(key string, value string) (err error) {
 		err = setting.UpdateGroupRatioByJSONString(value)
 	case "UserUsableGroups":
 		err = setting.UpdateUserUsableGroupsByJSONString(value)
+	case "GroupFallbackChains":
+		err = setting.UpdateGroupFallbackChainsByJSONString(value)
+	case "GroupFallbackBillingMode":
+		setting.GroupFallbackBillingMode = value
+	case "GroupRoutingModes":
+		err = setting.UpdateGroupRoutingModesByJSONString(value)
+	case "ModelFallbackChains":
+		err = setting.UpdateModelFallbackChainsByJSONString(value)
 	case "CompletionRatio":
 		err = operation_setting.UpdateCompletionRatioByJSONString(value)
 	case "ModelPrice":
 		err = operation_setting.UpdateModelPriceByJSONString(value)
 	case "CacheRatio":
 		err = operation_setting.UpdateCacheRatioByJSONString(value)
+	case "BatchDiscountRatio":
+		err = operation_setting.UpdateBatchDiscountRatioByJSONString(value)
 	case "TopUpLink":
 		common.TopUpLink = value
 	//case "ChatLink":
@@ -388,6 +438,16 @@ func updateOptionMap(key string, value string) (err error) {
 		common.QuotaPerUnit, _ = strconv.ParseFloat(value, 64)
 	case "SensitiveWords":
 		setting.SensitiveWordsFromString(value)
+	case "RegexFilterRules":
+		err = setting.UpdateRegexFilterRulesByJSONString(value)
+	case "RegexFilterExemptions":
+		err = setting.UpdateRegexFilterExemptionsByJSONString(value)
+	case "ResponseCacheTTLSeconds":
+		setting.ResponseCacheTTLSeconds, _ = strconv.Atoi(value)
+	case "ResponseCacheHitRatio":
+		setting.ResponseCacheHitRatio, _ = strconv.ParseFloat(value, 64)
+	case "ResponseCacheGroups":
+		err = setting.UpdateResponseCacheGroupsByJSONString(value)
 	case "AutomaticDisableKeywords":
 		operation_setting.AutomaticDisableKeywordsFromString(value)
 	case "StreamCacheQueueLength":
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"tea-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// PayloadCapture 令牌或用户开启留存后保存的请求体与响应内容，已按配置脱敏，通过 request_id 与消费日志关联
+type PayloadCapture struct {
+	Id                int    `json:"id"`
+	RequestId         string `json:"request_id" gorm:"type:varchar(64);index"`
+	CreatedAt         int64  `json:"created_at" gorm:"bigint;index"`
+	UserId            int    `json:"user_id" gorm:"index"`
+	TokenId           int    `json:"token_id" gorm:"index"`
+	ModelName         string `json:"model_name" gorm:"default:''"`
+	Path              string `json:"path" gorm:"default:''"`
+	IsStream          bool   `json:"is_stream"`
+	StatusCode        int    `json:"status_code"`
+	RequestBody       string `json:"request_body" gorm:"type:text"`
+	ResponseBody      string `json:"response_body" gorm:"type:text"`
+	StreamText        string `json:"stream_text" gorm:"type:text"` // 流式响应拼接后的文本
+	RequestTruncated  bool   `json:"request_truncated"`
+	ResponseTruncated bool   `json:"response_truncated"`
+}
+
+// RecordPayloadCapture 异步写入留存内容，避免拖慢请求
+func RecordPayloadCapture(capture *PayloadCapture) {
+	if LOG_DB == nil {
+		return
+	}
+	if capture.CreatedAt == 0 {
+		capture.CreatedAt = common.GetTimestamp()
+	}
+	gopool.Go(func() {
+		if err := LOG_DB.Create(capture).Error; err != nil {
+			common.SysError("failed to record payload capture: " + err.Error())
+		}
+	})
+}
+
+// GetPayloadCaptureByRequestId 按请求 ID 查询留存内容，userId 不为 0 时只查询该用户的记录
+func GetPayloadCaptureByRequestId(requestId string, userId int) (*PayloadCapture, error) {
+	var capture PayloadCapture
+	tx := LOG_DB.Where("request_id = ?", requestId)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	err := tx.Order("id desc").First(&capture).Error
+	if err != nil {
+		return nil, err
+	}
+	return &capture, nil
+}
+
+// DeletePayloadCapturesBefore 删除 timestamp 之前的留存内容
+func DeletePayloadCapturesBefore(timestamp int64) (int64, error) {
+	result := LOG_DB.Where("created_at < ?", timestamp).Delete(&PayloadCapture{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"context"
+	"tea-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+// SecurityEvent 安全事件，记录 IP 黑名单、异常行为检测、流保护等规则的触发情况
+type SecurityEvent struct {
+	Id        int    `json:"id"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+	IP        string `json:"ip" gorm:"type:varchar(64);index"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	TokenId   int    `json:"token_id" gorm:"index"`
+	Rule      string `json:"rule" gorm:"type:varchar(64);index"` // 触发的规则
+	Score     int64  `json:"score"`                              // 可疑分数
+	Action    string `json:"action" gorm:"type:varchar(32);index"`
+	Message   string `json:"message"`
+	RequestId string `json:"request_id" gorm:"type:varchar(64);index;default:''"`
+	Path      string `json:"path" gorm:"default:''"`
+	Details   string `json:"details"`
+}
+
+// SecurityEventFilter 安全事件查询条件，零值表示不过滤
+type SecurityEventFilter struct {
+	IP             string
+	Rule           string
+	Action         string
+	UserId         int
+	TokenId        int
+	RequestId      string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+// SecurityEventPersistenceEnabled 日志数据库初始化后才持久化安全事件
+func SecurityEventPersistenceEnabled() bool {
+	return LOG_DB != nil
+}
+
+// RecordSecurityEvent 异步写入安全事件，避免拖慢请求
+func RecordSecurityEvent(event *SecurityEvent) {
+	if !SecurityEventPersistenceEnabled() {
+		return
+	}
+	if event.CreatedAt == 0 {
+		event.CreatedAt = common.GetTimestamp()
+	}
+	gopool.Go(func() {
+		if err := LOG_DB.Create(event).Error; err != nil {
+			common.SysError("failed to record security event: " + err.Error())
+		}
+	})
+}
+
+func (filter *SecurityEventFilter) apply(tx *gorm.DB) *gorm.DB {
+	if filter.IP != "" {
+		tx = tx.Where("ip = ?", filter.IP)
+	}
+	if filter.Rule != "" {
+		tx = tx.Where("rule = ?", filter.Rule)
+	}
+	if filter.Action != "" {
+		tx = tx.Where("action = ?", filter.Action)
+	}
+	if filter.UserId != 0 {
+		tx = tx.Where("user_id = ?", filter.UserId)
+	}
+	if filter.TokenId != 0 {
+		tx = tx.Where("token_id = ?", filter.TokenId)
+	}
+	if filter.RequestId != "" {
+		tx = tx.Where("request_id = ?", filter.RequestId)
+	}
+	if filter.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", filter.StartTimestamp)
+	}
+	if filter.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", filter.EndTimestamp)
+	}
+	return tx
+}
+
+func GetSecurityEvents(filter *SecurityEventFilter, startIdx int, num int) (events []*SecurityEvent, total int64, err error) {
+	tx := filter.apply(LOG_DB.Model(&SecurityEvent{}))
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&events).Error
+	return events, total, err
+}
+
+func DeleteOldSecurityEvents(ctx context.Context, targetTimestamp int64, limit int) (int64, error) {
+	var total int64 = 0
+
+	for {
+		if nil != ctx.Err() {
+			return total, ctx.Err()
+		}
+
+		result := LOG_DB.Where("created_at < ?", targetTimestamp).Limit(limit).Delete(&SecurityEvent{})
+		if nil != result.Error {
+			return total, result.Error
+		}
+
+		total += result.RowsAffected
+
+		if result.RowsAffected < int64(limit) {
+			break
+		}
+	}
+
+	return total, nil
+}
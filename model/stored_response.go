@@ -0,0 +1,41 @@
+package model
+
+import (
+	"errors"
+	"tea-api/common"
+)
+
+// StoredResponse 非 OpenAI 渠道处理 /v1/responses 且 store 为 true 时保存的对话，用于 previous_response_id 续接
+type StoredResponse struct {
+	Id        string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	Model     string `json:"model"`
+	Messages  string `json:"messages" gorm:"type:text"` // 包含本次输出在内的完整对话，Chat Completions 消息数组的 JSON
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (response *StoredResponse) Insert() error {
+	if response.CreatedAt == 0 {
+		response.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(response).Error
+}
+
+// GetUserStoredResponseById 只返回属于该用户的对话
+func GetUserStoredResponseById(id string, userId int) (*StoredResponse, error) {
+	if id == "" {
+		return nil, errors.New("response id 为空")
+	}
+	var response StoredResponse
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&response).Error
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// DeleteStoredResponsesBefore 删除指定时间之前保存的对话
+func DeleteStoredResponsesBefore(timestamp int64) (int64, error) {
+	result := DB.Where("created_at < ?", timestamp).Delete(&StoredResponse{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,421 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"tea-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+const (
+	SubscriptionPeriodDay   = "day"
+	SubscriptionPeriodWeek  = "week"
+	SubscriptionPeriodMonth = "month"
+)
+
+const (
+	// SubscriptionRolloverNone 每期未用完的订阅额度在重置时作废
+	SubscriptionRolloverNone = "none"
+	// SubscriptionRolloverCarryover 未用完的订阅额度结转到下一期，RolloverLimit 大于 0 时限制结转的上限
+	SubscriptionRolloverCarryover = "carryover"
+)
+
+const (
+	SubscriptionPlanStatusEnabled  = 1
+	SubscriptionPlanStatusDisabled = 2
+)
+
+const (
+	SubscriptionStatusActive    = "active"
+	SubscriptionStatusExpired   = "expired"
+	SubscriptionStatusCancelled = "cancelled"
+)
+
+var (
+	ErrSubscriptionPlanNotFound = errors.New("订阅套餐不存在")
+	ErrSubscriptionNotFound     = errors.New("订阅不存在")
+	ErrSubscriptionConflict     = errors.New("用户已有其他套餐的订阅，请先取消")
+)
+
+// SubscriptionPlan 订阅套餐，每个周期为用户发放固定的额度
+type SubscriptionPlan struct {
+	Id          int     `json:"id"`
+	Name        string  `json:"name" gorm:"type:varchar(64);index"`
+	Description string  `json:"description" gorm:"type:text"`
+	Price       float64 `json:"price"`
+	Period      string  `json:"period" gorm:"type:varchar(16);default:'month'"`
+	// Duration 每次开通的周期数
+	Duration int `json:"duration" gorm:"default:1"`
+	// Quota 每个周期发放的额度
+	Quota int `json:"quota" gorm:"default:0"`
+	// Group 订阅期间用户所在的分组，为空时不调整用户分组
+	Group string `json:"group" gorm:"type:varchar(64);default:''"`
+	// AllowedGroups 逗号分隔，只有这些分组的请求使用订阅额度，为空时不限制
+	AllowedGroups string `json:"allowed_groups" gorm:"type:text"`
+	// Models 逗号分隔的模型白名单，只有这些模型的请求使用订阅额度，为空时不限制
+	Models         string `json:"models" gorm:"type:text"`
+	RolloverPolicy string `json:"rollover_policy" gorm:"type:varchar(16);default:'none'"`
+	RolloverLimit  int    `json:"rollover_limit" gorm:"default:0"`
+	Status         int    `json:"status" gorm:"default:1"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+}
+
+// Subscription 用户的订阅，同一用户同时只有一个生效中的订阅。
+// 周期的起止时间都由 StartTime 推算，按月的套餐不会因为月份天数不同而漂移。
+type Subscription struct {
+	Id     int    `json:"id"`
+	UserId int    `json:"user_id" gorm:"index"`
+	PlanId int    `json:"plan_id" gorm:"index"`
+	Status string `json:"status" gorm:"type:varchar(16);index"`
+	// Quota 当前周期剩余的订阅额度
+	Quota     int `json:"quota" gorm:"default:0"`
+	UsedQuota int `json:"used_quota" gorm:"default:0"`
+	// Periods 已开通的周期数，续订时累加
+	Periods int `json:"periods" gorm:"default:1"`
+	// CurrentPeriod 当前所在的周期，从 0 开始
+	CurrentPeriod int   `json:"current_period" gorm:"default:0"`
+	StartTime     int64 `json:"start_time" gorm:"bigint"`
+	EndTime       int64 `json:"end_time" gorm:"bigint"`
+	NextResetTime int64 `json:"next_reset_time" gorm:"bigint;index"`
+	// PreviousGroup 开通订阅前用户所在的分组，订阅结束时恢复
+	PreviousGroup string `json:"previous_group" gorm:"type:varchar(64);default:''"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime   int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// SubscriptionPeriodTime 返回从 start 开始第 n 个周期的起始时间
+func SubscriptionPeriodTime(start int64, period string, n int) int64 {
+	t := time.Unix(start, 0)
+	switch period {
+	case SubscriptionPeriodDay:
+		t = t.AddDate(0, 0, n)
+	case SubscriptionPeriodWeek:
+		t = t.AddDate(0, 0, 7*n)
+	default:
+		t = t.AddDate(0, n, 0)
+	}
+	return t.Unix()
+}
+
+func splitPlanList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// AllowsModel 判断模型是否可以使用套餐额度
+func (plan *SubscriptionPlan) AllowsModel(modelName string) bool {
+	models := splitPlanList(plan.Models)
+	if len(models) == 0 {
+		return true
+	}
+	for _, item := range models {
+		if item == modelName {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsGroup 判断分组的请求是否可以使用套餐额度
+func (plan *SubscriptionPlan) AllowsGroup(group string) bool {
+	groups := splitPlanList(plan.AllowedGroups)
+	if len(groups) == 0 {
+		return true
+	}
+	for _, item := range groups {
+		if item == group {
+			return true
+		}
+	}
+	return false
+}
+
+func GetAllSubscriptionPlans(enabledOnly bool) (plans []*SubscriptionPlan, err error) {
+	query := DB.Order("id asc")
+	if enabledOnly {
+		query = query.Where("status = ?", SubscriptionPlanStatusEnabled)
+	}
+	err = query.Find(&plans).Error
+	return plans, err
+}
+
+func GetSubscriptionPlanById(id int) (*SubscriptionPlan, error) {
+	if id == 0 {
+		return nil, ErrSubscriptionPlanNotFound
+	}
+	plan := SubscriptionPlan{Id: id}
+	if err := DB.First(&plan, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSubscriptionPlanNotFound
+		}
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func (plan *SubscriptionPlan) Insert() error {
+	plan.CreatedTime = common.GetTimestamp()
+	return DB.Create(plan).Error
+}
+
+func (plan *SubscriptionPlan) Update() error {
+	return DB.Model(plan).Select("name", "description", "price", "period", "duration", "quota", "group",
+		"allowed_groups", "models", "rollover_policy", "rollover_limit", "status").Updates(plan).Error
+}
+
+// DeleteSubscriptionPlanById 删除没有生效中订阅的套餐
+func DeleteSubscriptionPlanById(id int) error {
+	var count int64
+	if err := DB.Model(&Subscription{}).Where("plan_id = ? AND status = ?", id, SubscriptionStatusActive).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("该套餐还有生效中的订阅，无法删除")
+	}
+	return DB.Delete(&SubscriptionPlan{}, "id = ?", id).Error
+}
+
+// GetActiveSubscription 返回用户生效中的订阅，没有时返回 nil
+func GetActiveSubscription(userId int) (*Subscription, error) {
+	var subscription Subscription
+	err := DB.Where("user_id = ? AND status = ?", userId, SubscriptionStatusActive).Limit(1).Find(&subscription).Error
+	if err != nil {
+		return nil, err
+	}
+	if subscription.Id == 0 {
+		return nil, nil
+	}
+	return &subscription, nil
+}
+
+func GetSubscriptionById(id int) (*Subscription, error) {
+	var subscription Subscription
+	if err := DB.First(&subscription, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSubscriptionNotFound
+		}
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func GetSubscriptions(userId int, status string, startIdx int, num int) (subscriptions []*Subscription, total int64, err error) {
+	query := DB.Model(&Subscription{})
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&subscriptions).Error
+	return subscriptions, total, err
+}
+
+// GetDueSubscriptions 按 ID 顺序返回 afterId 之后需要重置周期或已到期的订阅
+func GetDueSubscriptions(now int64, afterId int, limit int) (subscriptions []*Subscription, err error) {
+	err = DB.Where("id > ? AND status = ? AND (next_reset_time <= ? OR end_time <= ?)", afterId, SubscriptionStatusActive, now, now).
+		Order("id asc").Limit(limit).Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// setUserGroup 修改用户分组，需在事务提交后调用 refreshUserGroupCache
+func setUserGroup(tx *gorm.DB, userId int, group string) error {
+	return tx.Model(&User{}).Where("id = ?", userId).Update("group", group).Error
+}
+
+func refreshUserGroupCache(userId int, group string) {
+	gopool.Go(func() {
+		if err := updateUserGroupCache(userId, group); err != nil {
+			common.SysError("failed to update user group cache: " + err.Error())
+		}
+	})
+}
+
+// GrantSubscription 为用户开通套餐。已订阅同一套餐时顺延到期时间，订阅了其他套餐时返回 ErrSubscriptionConflict。
+// 套餐设置了分组时将用户移入该分组，并记录原分组以便订阅结束后恢复。
+func GrantSubscription(userId int, planId int) (subscription *Subscription, renewed bool, err error) {
+	plan, err := GetSubscriptionPlanById(planId)
+	if err != nil {
+		return nil, false, err
+	}
+	if plan.Status != SubscriptionPlanStatusEnabled {
+		return nil, false, errors.New("订阅套餐已停用")
+	}
+	subscription = &Subscription{}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Select("id, "+groupCol).First(&user, "id = ?", userId).Error; err != nil {
+			return errors.New("用户不存在")
+		}
+		if err := tx.Where("user_id = ? AND status = ?", userId, SubscriptionStatusActive).Limit(1).Find(subscription).Error; err != nil {
+			return err
+		}
+		now := common.GetTimestamp()
+		if subscription.Id != 0 {
+			if subscription.PlanId != plan.Id {
+				return ErrSubscriptionConflict
+			}
+			subscription.Periods += plan.Duration
+			subscription.EndTime = SubscriptionPeriodTime(subscription.StartTime, plan.Period, subscription.Periods)
+			subscription.UpdatedTime = now
+			renewed = true
+			return tx.Model(subscription).Select("periods", "end_time", "updated_time").Updates(subscription).Error
+		}
+		*subscription = Subscription{
+			UserId:        userId,
+			PlanId:        plan.Id,
+			Status:        SubscriptionStatusActive,
+			Quota:         plan.Quota,
+			Periods:       plan.Duration,
+			StartTime:     now,
+			EndTime:       SubscriptionPeriodTime(now, plan.Period, plan.Duration),
+			NextResetTime: SubscriptionPeriodTime(now, plan.Period, 1),
+			PreviousGroup: user.Group,
+			CreatedTime:   now,
+			UpdatedTime:   now,
+		}
+		if err := tx.Create(subscription).Error; err != nil {
+			return err
+		}
+		if plan.Group != "" && plan.Group != user.Group {
+			return setUserGroup(tx, userId, plan.Group)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if !renewed {
+		invalidateSubscriptionCache(userId)
+		if plan.Group != "" && plan.Group != subscription.PreviousGroup {
+			refreshUserGroupCache(userId, plan.Group)
+		}
+	}
+	return subscription, renewed, nil
+}
+
+// EndSubscription 结束订阅（到期或取消），清空剩余的订阅额度。
+// 用户仍在套餐分组时恢复到开通前的分组，管理员期间手动调整过的分组保持不变。
+func EndSubscription(id int, status string) (subscription *Subscription, ended bool, err error) {
+	subscription = &Subscription{}
+	var restoredGroup string
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(subscription, "id = ?", id).Error; err != nil {
+			return ErrSubscriptionNotFound
+		}
+		result := tx.Model(&Subscription{}).Where("id = ? AND status = ?", id, SubscriptionStatusActive).Updates(map[string]interface{}{
+			"status":       status,
+			"quota":        0,
+			"updated_time": common.GetTimestamp(),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		ended = true
+		var plan SubscriptionPlan
+		if err := tx.Limit(1).Find(&plan, "id = ?", subscription.PlanId).Error; err != nil {
+			return err
+		}
+		if plan.Group == "" || subscription.PreviousGroup == "" || plan.Group == subscription.PreviousGroup {
+			return nil
+		}
+		result = tx.Model(&User{}).Where("id = ? AND "+groupCol+" = ?", subscription.UserId, plan.Group).Update("group", subscription.PreviousGroup)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			restoredGroup = subscription.PreviousGroup
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if ended {
+		subscription.Status = status
+		subscription.Quota = 0
+		invalidateSubscriptionCache(subscription.UserId)
+	}
+	if restoredGroup != "" {
+		refreshUserGroupCache(subscription.UserId, restoredGroup)
+	}
+	return subscription, ended, nil
+}
+
+// ResetSubscriptionPeriod 进入新的周期并按套餐的结转策略发放额度。
+// 以原周期为条件更新，多次执行同一周期的重置只会发放一次额度。
+func ResetSubscriptionPeriod(subscription *Subscription, plan *SubscriptionPlan, now int64) (bool, error) {
+	period := subscription.CurrentPeriod
+	for period+1 < subscription.Periods && SubscriptionPeriodTime(subscription.StartTime, plan.Period, period+1) <= now {
+		period++
+	}
+	nextResetTime := SubscriptionPeriodTime(subscription.StartTime, plan.Period, period+1)
+	if period == subscription.CurrentPeriod {
+		// 套餐的周期被修改后按新的周期推算下次重置时间
+		err := DB.Model(&Subscription{}).Where("id = ? AND current_period = ?", subscription.Id, period).Update("next_reset_time", nextResetTime).Error
+		return false, err
+	}
+	// 在数据库中计算结转，避免覆盖重置期间并发扣除的额度
+	quota := gorm.Expr("?", plan.Quota)
+	if plan.RolloverPolicy == SubscriptionRolloverCarryover {
+		if plan.RolloverLimit > 0 {
+			quota = gorm.Expr("CASE WHEN quota <= 0 THEN 0 WHEN quota > ? THEN ? ELSE quota END + ?", plan.RolloverLimit, plan.RolloverLimit, plan.Quota)
+		} else {
+			quota = gorm.Expr("CASE WHEN quota <= 0 THEN 0 ELSE quota END + ?", plan.Quota)
+		}
+	}
+	result := DB.Model(&Subscription{}).Where("id = ? AND status = ? AND current_period = ?", subscription.Id, SubscriptionStatusActive, subscription.CurrentPeriod).
+		Updates(map[string]interface{}{
+			"quota":           quota,
+			"used_quota":      0,
+			"current_period":  period,
+			"next_reset_time": nextResetTime,
+			"updated_time":    now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ConsumeSubscriptionQuota 扣除订阅额度，以剩余额度足够为条件更新，避免并发请求把订阅额度扣成负数。
+// 剩余额度不足或订阅已结束时返回 false
+func ConsumeSubscriptionQuota(id int, quota int) (bool, error) {
+	if quota <= 0 {
+		return true, nil
+	}
+	result := DB.Model(&Subscription{}).Where("id = ? AND status = ? AND quota >= ?", id, SubscriptionStatusActive, quota).Updates(map[string]interface{}{
+		"quota":      gorm.Expr("quota - ?", quota),
+		"used_quota": gorm.Expr("used_quota + ?", quota),
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// RefundSubscriptionQuota 退回预扣的订阅额度，订阅已结束时不再退回
+func RefundSubscriptionQuota(id int, quota int) error {
+	if quota <= 0 {
+		return nil
+	}
+	return DB.Model(&Subscription{}).Where("id = ? AND status = ?", id, SubscriptionStatusActive).Updates(map[string]interface{}{
+		"quota":      gorm.Expr("quota + ?", quota),
+		"used_quota": gorm.Expr("used_quota - ?", quota),
+	}).Error
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"tea-api/common"
+	"tea-api/constant"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+func getSubscriptionCacheKey(userId int) string {
+	return fmt.Sprintf("user_subscription:%d", userId)
+}
+
+// invalidateSubscriptionCache 开通或结束订阅后清除用户生效中订阅的缓存
+func invalidateSubscriptionCache(userId int) {
+	if !common.RedisEnabled {
+		return
+	}
+	if err := common.RedisDel(getSubscriptionCacheKey(userId)); err != nil {
+		common.SysError("failed to invalidate subscription cache: " + err.Error())
+	}
+}
+
+// GetActiveSubscriptionId 返回用户生效中订阅的 ID，没有时返回 0。
+// 启用 Redis 时缓存查询结果（包括没有订阅的情况），避免每次请求都查询数据库
+func GetActiveSubscriptionId(userId int) (int, error) {
+	if common.RedisEnabled {
+		if value, err := common.RedisGet(getSubscriptionCacheKey(userId)); err == nil {
+			if id, err := strconv.Atoi(value); err == nil {
+				return id, nil
+			}
+		}
+	}
+	subscription, err := GetActiveSubscription(userId)
+	if err != nil {
+		return 0, err
+	}
+	id := 0
+	if subscription != nil {
+		id = subscription.Id
+	}
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			err := common.RedisSet(getSubscriptionCacheKey(userId), strconv.Itoa(id), time.Duration(constant.UserId2QuotaCacheSeconds)*time.Second)
+			if err != nil {
+				common.SysError("failed to update subscription cache: " + err.Error())
+			}
+		})
+	}
+	return id, nil
+}
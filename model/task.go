@@ -39,6 +39,10 @@ type Task struct {
 	Properties Properties            `json:"properties" gorm:"type:json"`
 
 	Data json.RawMessage `json:"data" gorm:"type:json"`
+
+	// 预扣时从订阅扣除的部分，任务失败时先退回订阅额度
+	SubscriptionId    int `json:"subscription_id" gorm:"default:0"`
+	SubscriptionQuota int `json:"subscription_quota" gorm:"default:0"`
 }
 
 func (t *Task) SetData(data any) {
@@ -195,6 +199,16 @@ func GetByOnlyTaskId(taskId string) (*Task, bool, error) {
 	return task, exist, err
 }
 
+// GetLatestTaskIdByChannelId 返回渠道在指定平台最近提交的任务 id，用于渠道测试时查询一个已知任务
+func GetLatestTaskIdByChannelId(channelId int, platform constant.TaskPlatform) string {
+	var task Task
+	err := DB.Where("channel_id = ? and platform = ? and task_id != ?", channelId, platform, "").Order("id desc").First(&task).Error
+	if err != nil {
+		return ""
+	}
+	return task.TaskID
+}
+
 func GetByTaskId(userId int, taskId string) (*Task, bool, error) {
 	if taskId == "" {
 		return nil, false, nil
@@ -240,6 +254,14 @@ func (Task *Task) Update() error {
 	return err
 }
 
+// UpdateTaskSubscriptionQuota 记录任务从订阅扣除的额度
+func UpdateTaskSubscriptionQuota(id int64, subscriptionId int, subscriptionQuota int) error {
+	return DB.Model(&Task{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"subscription_id":    subscriptionId,
+		"subscription_quota": subscriptionQuota,
+	}).Error
+}
+
 func TaskBulkUpdate(TaskIds []string, params map[string]any) error {
 	if len(TaskIds) == 0 {
 		return nil
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"tea-api/common"
@@ -11,22 +12,30 @@ import (
 )
 
 type Token struct {
-	Id                 int            `json:"id"`
-	UserId             int            `json:"user_id" gorm:"index"`
-	Key                string         `json:"key" gorm:"type:char(48);uniqueIndex"`
-	Status             int            `json:"status" gorm:"default:1"`
-	Name               string         `json:"name" gorm:"index" `
-	CreatedTime        int64          `json:"created_time" gorm:"bigint"`
-	AccessedTime       int64          `json:"accessed_time" gorm:"bigint"`
-	ExpiredTime        int64          `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
-	RemainQuota        int            `json:"remain_quota" gorm:"default:0"`
-	UnlimitedQuota     bool           `json:"unlimited_quota" gorm:"default:false"`
-	ModelLimitsEnabled bool           `json:"model_limits_enabled" gorm:"default:false"`
-	ModelLimits        string         `json:"model_limits" gorm:"type:varchar(1024);default:''"`
-	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
-	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
-	Group              string         `json:"group" gorm:"default:''"`
-	DeletedAt          gorm.DeletedAt `gorm:"index"`
+	Id                    int            `json:"id"`
+	UserId                int            `json:"user_id" gorm:"index"`
+	Key                   string         `json:"key" gorm:"type:char(48);uniqueIndex"`
+	Status                int            `json:"status" gorm:"default:1"`
+	Name                  string         `json:"name" gorm:"index" `
+	CreatedTime           int64          `json:"created_time" gorm:"bigint"`
+	AccessedTime          int64          `json:"accessed_time" gorm:"bigint"`
+	ExpiredTime           int64          `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
+	RemainQuota           int            `json:"remain_quota" gorm:"default:0"`
+	UnlimitedQuota        bool           `json:"unlimited_quota" gorm:"default:false"`
+	ModelLimitsEnabled    bool           `json:"model_limits_enabled" gorm:"default:false"`
+	ModelLimits           string         `json:"model_limits" gorm:"type:varchar(1024);default:''"`
+	AllowIps              *string        `json:"allow_ips" gorm:"default:''"`
+	UsedQuota             int            `json:"used_quota" gorm:"default:0"` // used quota
+	Group                 string         `json:"group" gorm:"default:''"`
+	ModelFallbacks        string         `json:"model_fallbacks" gorm:"type:text"`             // JSON，模型 -> 替代模型列表，优先于系统配置
+	DailyQuotaLimit       int            `json:"daily_quota_limit" gorm:"default:0"`           // 每日额度上限，0 表示不限制
+	WeeklyQuotaLimit      int            `json:"weekly_quota_limit" gorm:"default:0"`          // 每周额度上限，0 表示不限制
+	MonthlyQuotaLimit     int            `json:"monthly_quota_limit" gorm:"default:0"`         // 每月额度上限，0 表示不限制
+	RpmLimit              int            `json:"rpm_limit" gorm:"default:0"`                   // 每分钟请求数上限，0 表示不限制
+	TpmLimit              int            `json:"tpm_limit" gorm:"default:0"`                   // 每分钟 token 数上限，0 表示不限制
+	ResponseCacheEnabled  bool           `json:"response_cache_enabled" gorm:"default:false"`  // 确定性请求是否使用响应缓存
+	PayloadCaptureEnabled bool           `json:"payload_capture_enabled" gorm:"default:false"` // 是否留存请求/响应内容，需同时开启全局留存
+	DeletedAt             gorm.DeletedAt `gorm:"index"`
 }
 
 func (token *Token) Clean() {
@@ -193,7 +202,9 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "model_fallbacks",
+		"daily_quota_limit", "weekly_quota_limit", "monthly_quota_limit", "rpm_limit", "tpm_limit",
+		"response_cache_enabled", "payload_capture_enabled").Updates(token).Error
 	return err
 }
 
@@ -227,6 +238,11 @@ func (token *Token) Delete() (err error) {
 	return err
 }
 
+// HasQuotaWindowLimits 是否设置了按日、周、月的额度上限
+func (token *Token) HasQuotaWindowLimits() bool {
+	return token.DailyQuotaLimit > 0 || token.WeeklyQuotaLimit > 0 || token.MonthlyQuotaLimit > 0
+}
+
 func (token *Token) IsModelLimitsEnabled() bool {
 	return token.ModelLimitsEnabled
 }
@@ -247,6 +263,18 @@ func (token *Token) GetModelLimitsMap() map[string]bool {
 	return limitsMap
 }
 
+func (token *Token) GetModelFallbacksMap() map[string][]string {
+	fallbacks := make(map[string][]string)
+	if token.ModelFallbacks == "" {
+		return fallbacks
+	}
+	err := json.Unmarshal([]byte(token.ModelFallbacks), &fallbacks)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to unmarshal model fallbacks of token %d: %s", token.Id, err.Error()))
+	}
+	return fallbacks
+}
+
 func DisableModelLimits(tokenId int) error {
 	token, err := GetTokenById(tokenId)
 	if err != nil {
@@ -0,0 +1,231 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"tea-api/common"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 令牌按自然日、自然周、自然月和分钟统计的用量，用于令牌的额度与速率限制。
+// 启用 Redis 时计数在所有节点间共享，否则保存在本地内存中。时间窗口按服务器时区划分。
+
+const (
+	TokenUsageWindowDaily   = "daily"
+	TokenUsageWindowWeekly  = "weekly"
+	TokenUsageWindowMonthly = "monthly"
+	TokenUsageWindowMinute  = "minute"
+)
+
+// TokenUsageWindow 一个时间窗口内的用量
+type TokenUsageWindow struct {
+	Quota    int64 `json:"quota"`
+	Tokens   int64 `json:"tokens"`
+	Requests int64 `json:"requests"`
+	ResetAt  int64 `json:"reset_at"` // 窗口结束时间，Unix 秒
+}
+
+// TokenUsage 令牌当前各时间窗口的用量
+type TokenUsage struct {
+	Daily   TokenUsageWindow `json:"daily"`
+	Weekly  TokenUsageWindow `json:"weekly"`
+	Monthly TokenUsageWindow `json:"monthly"`
+	Minute  TokenUsageWindow `json:"minute"`
+}
+
+type tokenUsageWindowKey struct {
+	window  string
+	key     string
+	resetAt time.Time
+}
+
+// tokenUsageWindowKeys 返回 now 所在各时间窗口的计数键，分钟窗口固定在最后
+func tokenUsageWindowKeys(tokenId int, now time.Time) []tokenUsageWindowKey {
+	year, month, day := now.Date()
+	dayStart := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+	// 周一为一周的第一天
+	weekStart := dayStart.AddDate(0, 0, -((int(now.Weekday()) + 6) % 7))
+	isoYear, isoWeek := now.ISOWeek()
+	monthStart := time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
+	minuteStart := now.Truncate(time.Minute)
+	prefix := fmt.Sprintf("token_usage:%d:", tokenId)
+	return []tokenUsageWindowKey{
+		{TokenUsageWindowDaily, prefix + "d:" + dayStart.Format("20060102"), dayStart.AddDate(0, 0, 1)},
+		{TokenUsageWindowWeekly, prefix + fmt.Sprintf("w:%dW%02d", isoYear, isoWeek), weekStart.AddDate(0, 0, 7)},
+		{TokenUsageWindowMonthly, prefix + "m:" + monthStart.Format("200601"), monthStart.AddDate(0, 1, 0)},
+		{TokenUsageWindowMinute, prefix + "min:" + strconv.FormatInt(minuteStart.Unix(), 10), minuteStart.Add(time.Minute)},
+	}
+}
+
+const (
+	tokenUsageFieldQuota    = "quota"
+	tokenUsageFieldTokens   = "tokens"
+	tokenUsageFieldRequests = "requests"
+)
+
+type tokenUsageCounter struct {
+	fields   map[string]int64
+	expireAt time.Time
+}
+
+var (
+	tokenUsageCounters     = make(map[string]*tokenUsageCounter)
+	tokenUsageCountersLock sync.Mutex
+	tokenUsageLastSweep    time.Time
+)
+
+func memoryIncrTokenUsage(keys []tokenUsageWindowKey, field string, value int64, now time.Time) map[string]int64 {
+	tokenUsageCountersLock.Lock()
+	defer tokenUsageCountersLock.Unlock()
+	if now.Sub(tokenUsageLastSweep) > time.Minute {
+		for key, counter := range tokenUsageCounters {
+			if now.After(counter.expireAt) {
+				delete(tokenUsageCounters, key)
+			}
+		}
+		tokenUsageLastSweep = now
+	}
+	result := make(map[string]int64, len(keys))
+	for _, k := range keys {
+		counter, ok := tokenUsageCounters[k.key]
+		if !ok {
+			counter = &tokenUsageCounter{fields: make(map[string]int64), expireAt: k.resetAt}
+			tokenUsageCounters[k.key] = counter
+		}
+		counter.fields[field] += value
+		result[k.window] = counter.fields[field]
+	}
+	return result
+}
+
+func memoryGetTokenUsage(keys []tokenUsageWindowKey) map[string]map[string]int64 {
+	tokenUsageCountersLock.Lock()
+	defer tokenUsageCountersLock.Unlock()
+	result := make(map[string]map[string]int64, len(keys))
+	for _, k := range keys {
+		fields := make(map[string]int64)
+		if counter, ok := tokenUsageCounters[k.key]; ok {
+			for field, value := range counter.fields {
+				fields[field] = value
+			}
+		}
+		result[k.window] = fields
+	}
+	return result
+}
+
+func redisIncrTokenUsage(keys []tokenUsageWindowKey, field string, value int64) (map[string]int64, error) {
+	ctx := context.Background()
+	cmds := make([]*redis.IntCmd, len(keys))
+	_, err := common.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, k := range keys {
+			cmds[i] = pipe.HIncrBy(ctx, k.key, field, value)
+			// 多保留一小时，避免窗口结束时刚写入的计数立即过期
+			pipe.ExpireAt(ctx, k.key, k.resetAt.Add(time.Hour))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]int64, len(keys))
+	for i, k := range keys {
+		result[k.window] = cmds[i].Val()
+	}
+	return result, nil
+}
+
+func redisGetTokenUsage(keys []tokenUsageWindowKey) (map[string]map[string]int64, error) {
+	ctx := context.Background()
+	cmds := make([]*redis.StringStringMapCmd, len(keys))
+	_, err := common.RDB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, k := range keys {
+			cmds[i] = pipe.HGetAll(ctx, k.key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]map[string]int64, len(keys))
+	for i, k := range keys {
+		fields := make(map[string]int64)
+		for field, raw := range cmds[i].Val() {
+			fields[field], _ = strconv.ParseInt(raw, 10, 64)
+		}
+		result[k.window] = fields
+	}
+	return result, nil
+}
+
+func incrTokenUsage(tokenId int, keys []tokenUsageWindowKey, field string, value int64, now time.Time) map[string]int64 {
+	if common.RedisEnabled && common.RDB != nil {
+		result, err := redisIncrTokenUsage(keys, field, value)
+		if err == nil {
+			return result
+		}
+		common.SysError(fmt.Sprintf("failed to record token %d usage in redis: %s", tokenId, err.Error()))
+	}
+	return memoryIncrTokenUsage(keys, field, value, now)
+}
+
+// RecordTokenUsage 记录一次消费的额度与 token 数，计入令牌当前所有时间窗口
+func RecordTokenUsage(tokenId int, quota int, tokens int) {
+	if tokenId == 0 || (quota == 0 && tokens == 0) {
+		return
+	}
+	now := time.Now()
+	keys := tokenUsageWindowKeys(tokenId, now)
+	if quota != 0 {
+		incrTokenUsage(tokenId, keys, tokenUsageFieldQuota, int64(quota), now)
+	}
+	if tokens != 0 {
+		// token 数只用于每分钟的速率限制
+		incrTokenUsage(tokenId, keys[len(keys)-1:], tokenUsageFieldTokens, int64(tokens), now)
+	}
+}
+
+// IncrTokenMinuteRequests 记录一次请求，返回当前分钟内的请求数
+func IncrTokenMinuteRequests(tokenId int) int64 {
+	now := time.Now()
+	keys := tokenUsageWindowKeys(tokenId, now)
+	keys = keys[len(keys)-1:]
+	return incrTokenUsage(tokenId, keys, tokenUsageFieldRequests, 1, now)[TokenUsageWindowMinute]
+}
+
+// GetTokenUsage 返回令牌当前各时间窗口的用量
+func GetTokenUsage(tokenId int) *TokenUsage {
+	keys := tokenUsageWindowKeys(tokenId, time.Now())
+	var values map[string]map[string]int64
+	if common.RedisEnabled && common.RDB != nil {
+		var err error
+		values, err = redisGetTokenUsage(keys)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to get token %d usage from redis: %s", tokenId, err.Error()))
+			values = nil
+		}
+	}
+	if values == nil {
+		values = memoryGetTokenUsage(keys)
+	}
+	windows := make(map[string]TokenUsageWindow, len(keys))
+	for _, k := range keys {
+		fields := values[k.window]
+		windows[k.window] = TokenUsageWindow{
+			Quota:    fields[tokenUsageFieldQuota],
+			Tokens:   fields[tokenUsageFieldTokens],
+			Requests: fields[tokenUsageFieldRequests],
+			ResetAt:  k.resetAt.Unix(),
+		}
+	}
+	return &TokenUsage{
+		Daily:   windows[TokenUsageWindowDaily],
+		Weekly:  windows[TokenUsageWindowWeekly],
+		Monthly: windows[TokenUsageWindowMonthly],
+		Minute:  windows[TokenUsageWindowMinute],
+	}
+}
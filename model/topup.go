@@ -1,13 +1,34 @@
 package model
 
+import (
+	"errors"
+	"tea-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	TopUpStatusPending  = "pending"
+	TopUpStatusSuccess   = "success"
+	TopUpStatusRefunding = "refunding"
+	TopUpStatusRefunded  = "refunded"
+)
+
+var ErrTopUpNotFound = errors.New("订单不存在")
+
 type TopUp struct {
-	Id         int     `json:"id"`
-	UserId     int     `json:"user_id" gorm:"index"`
-	Amount     int64   `json:"amount"`
-	Money      float64 `json:"money"`
-	TradeNo    string  `json:"trade_no"`
-	CreateTime int64   `json:"create_time"`
-	Status     string  `json:"status"`
+	Id              int     `json:"id"`
+	UserId          int     `json:"user_id" gorm:"index"`
+	Amount          int64   `json:"amount"`
+	Money           float64 `json:"money"`
+	TradeNo         string  `json:"trade_no" gorm:"type:varchar(64);index"`
+	CreateTime      int64   `json:"create_time"`
+	Status          string  `json:"status"`
+	PaymentProvider string  `json:"payment_provider" gorm:"type:varchar(32);default:'epay'"`
+	ProviderOrderId string  `json:"provider_order_id" gorm:"type:varchar(128);default:''"` // 支付渠道的订单号，Stripe 为 Checkout Session ID
+	CompleteTime    int64   `json:"complete_time" gorm:"bigint;default:0"`
 }
 
 func (topUp *TopUp) Insert() error {
@@ -22,6 +43,13 @@ func (topUp *TopUp) Update() error {
 	return err
 }
 
+// Quota 订单对应的额度
+func (topUp *TopUp) Quota() int {
+	dAmount := decimal.NewFromInt(topUp.Amount)
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	return int(dAmount.Mul(dQuotaPerUnit).IntPart())
+}
+
 func GetTopUpById(id int) *TopUp {
 	var topUp *TopUp
 	var err error
@@ -41,3 +69,113 @@ func GetTopUpByTradeNo(tradeNo string) *TopUp {
 	}
 	return topUp
 }
+
+// topUpQueryError 只有订单不存在时返回 ErrTopUpNotFound，数据库的其他错误原样返回，
+// 以便支付回调返回失败让支付渠道稍后重试
+func topUpQueryError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrTopUpNotFound
+	}
+	return err
+}
+
+// CompleteTopUp 将指定支付渠道的待支付订单标记为成功并为用户增加额度。
+// 通过带状态条件的更新保证同一订单只入账一次，多节点重复收到支付回调时只有一次返回 credited 为 true。
+func CompleteTopUp(tradeNo string, paymentProvider string, providerOrderId string) (topUp *TopUp, credited bool, err error) {
+	topUp = &TopUp{}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("trade_no = ? AND payment_provider = ?", tradeNo, paymentProvider).First(topUp).Error; err != nil {
+			return topUpQueryError(err)
+		}
+		updates := map[string]interface{}{
+			"status":        TopUpStatusSuccess,
+			"complete_time": common.GetTimestamp(),
+		}
+		if providerOrderId != "" {
+			updates["provider_order_id"] = providerOrderId
+		}
+		result := tx.Model(&TopUp{}).Where("id = ? AND status = ?", topUp.Id, TopUpStatusPending).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", topUp.Quota())).Error
+		if err != nil {
+			return err
+		}
+		credited = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if credited {
+		topUp.Status = TopUpStatusSuccess
+		gopool.Go(func() {
+			if err := cacheIncrUserQuota(topUp.UserId, int64(topUp.Quota())); err != nil {
+				common.SysError("failed to increase user quota: " + err.Error())
+			}
+		})
+	}
+	return topUp, credited, nil
+}
+
+// ClaimTopUpRefund 通过带状态条件的更新将已支付的订单标记为退款中，同一订单只有一次返回 claimed 为 true，
+// 避免并发的退款请求重复向支付渠道发起退款
+func ClaimTopUpRefund(tradeNo string) (topUp *TopUp, claimed bool, err error) {
+	topUp = &TopUp{}
+	if err := DB.Where("trade_no = ?", tradeNo).First(topUp).Error; err != nil {
+		return nil, false, topUpQueryError(err)
+	}
+	result := DB.Model(&TopUp{}).Where("id = ? AND status = ?", topUp.Id, TopUpStatusSuccess).Update("status", TopUpStatusRefunding)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return topUp, false, nil
+	}
+	topUp.Status = TopUpStatusRefunding
+	return topUp, true, nil
+}
+
+// ReleaseTopUpRefund 支付渠道退款失败时将退款中的订单恢复为已支付
+func ReleaseTopUpRefund(id int) error {
+	return DB.Model(&TopUp{}).Where("id = ? AND status = ?", id, TopUpStatusRefunding).Update("status", TopUpStatusSuccess).Error
+}
+
+// RefundTopUp 支付渠道退款成功后将退款中的订单标记为已退款并扣回对应的额度，同一订单只扣回一次
+func RefundTopUp(tradeNo string) (topUp *TopUp, refunded bool, err error) {
+	topUp = &TopUp{}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("trade_no = ?", tradeNo).First(topUp).Error; err != nil {
+			return topUpQueryError(err)
+		}
+		result := tx.Model(&TopUp{}).Where("id = ? AND status = ?", topUp.Id, TopUpStatusRefunding).Update("status", TopUpStatusRefunded)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota - ?", topUp.Quota())).Error
+		if err != nil {
+			return err
+		}
+		refunded = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if refunded {
+		topUp.Status = TopUpStatusRefunded
+		gopool.Go(func() {
+			if err := cacheDecrUserQuota(topUp.UserId, int64(topUp.Quota())); err != nil {
+				common.SysError("failed to decrease user quota: " + err.Error())
+			}
+		})
+	}
+	return topUp, refunded, nil
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var ErrTwoFactorStateChanged = errors.New("两步验证状态已变化，请刷新后重试")
+
+// GetTwoFactorRecoveryCodes 返回用户剩余恢复码的摘要
+func (user *User) GetTwoFactorRecoveryCodes() []string {
+	var codes []string
+	if user.RecoveryCodes == "" {
+		return codes
+	}
+	_ = json.Unmarshal([]byte(user.RecoveryCodes), &codes)
+	return codes
+}
+
+// SetTwoFactorSecret 保存待确认的密钥，启用前可以重复生成
+func SetTwoFactorSecret(userId int, secret string) error {
+	result := DB.Model(&User{}).Where("id = ? AND two_factor_enabled = ?", userId, false).
+		Update("two_factor_secret", secret)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("已启用两步验证")
+	}
+	return nil
+}
+
+// EnableTwoFactor 确认密钥后启用两步验证，counter 为确认时使用的时间步
+func EnableTwoFactor(userId int, secret string, counter int64, recoveryCodes []string) error {
+	codes, err := json.Marshal(recoveryCodes)
+	if err != nil {
+		return err
+	}
+	result := DB.Model(&User{}).
+		Where("id = ? AND two_factor_enabled = ? AND two_factor_secret = ?", userId, false, secret).
+		Updates(map[string]interface{}{
+			"two_factor_enabled": true,
+			"two_factor_counter": counter,
+			"recovery_codes":     string(codes),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorStateChanged
+	}
+	return nil
+}
+
+// DisableTwoFactor 关闭两步验证并清除密钥和恢复码
+func DisableTwoFactor(userId int) error {
+	return DB.Model(&User{}).Where("id = ?", userId).Updates(map[string]interface{}{
+		"two_factor_enabled": false,
+		"two_factor_secret":  "",
+		"two_factor_counter": 0,
+		"recovery_codes":     "",
+	}).Error
+}
+
+// UseTwoFactorCounter 记录已使用的时间步，时间步不大于上次使用的值时返回 false，用于防止验证码重放
+func UseTwoFactorCounter(userId int, counter int64) (bool, error) {
+	result := DB.Model(&User{}).
+		Where("id = ? AND two_factor_enabled = ? AND two_factor_counter < ?", userId, true, counter).
+		Update("two_factor_counter", counter)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateTwoFactorRecoveryCodes 替换恢复码，只有恢复码未被其他请求修改时才会更新
+func UpdateTwoFactorRecoveryCodes(user *User, recoveryCodes []string) (bool, error) {
+	codes, err := json.Marshal(recoveryCodes)
+	if err != nil {
+		return false, err
+	}
+	result := DB.Model(&User{}).
+		Where("id = ? AND two_factor_enabled = ? AND recovery_codes = ?", user.Id, true, user.RecoveryCodes).
+		Update("recovery_codes", string(codes))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	user.RecoveryCodes = string(codes)
+	return true, nil
+}
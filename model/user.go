@@ -41,6 +41,10 @@ type User struct {
 	DeletedAt        gorm.DeletedAt `gorm:"index"`
 	LinuxDOId        string         `json:"linux_do_id" gorm:"column:linux_do_id;index"`
 	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
+	TwoFactorSecret  string         `json:"-" gorm:"type:varchar(64);column:two_factor_secret"` // 两步验证的 TOTP 密钥，未启用时为待确认的密钥
+	TwoFactorEnabled bool           `json:"two_factor_enabled" gorm:"default:false;column:two_factor_enabled"`
+	TwoFactorCounter int64          `json:"-" gorm:"default:0;column:two_factor_counter"` // 上次使用的 TOTP 时间步，防止验证码重放
+	RecoveryCodes    string         `json:"-" gorm:"type:text;column:recovery_codes"`     // 恢复码的 SHA-256 摘要，JSON 数组
 }
 
 func (user *User) ToBaseUser() *UserBase {
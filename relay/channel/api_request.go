@@ -18,6 +18,10 @@ import (
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func SetupApiRequestHeader(info *common.RelayInfo, c *gin.Context, req *http.Header) {
@@ -50,6 +54,7 @@ func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 	if err != nil {
 		return nil, fmt.Errorf("setup request header failed: %w", err)
 	}
+	info.ApplyHeaderOverride(req.Header)
 	resp, err := doRequest(c, req, info)
 	if err != nil {
 		return nil, fmt.Errorf("do request failed: %w", err)
@@ -76,6 +81,7 @@ func DoFormRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBod
 	if err != nil {
 		return nil, fmt.Errorf("setup request header failed: %w", err)
 	}
+	info.ApplyHeaderOverride(req.Header)
 	resp, err := doRequest(c, req, info)
 	if err != nil {
 		return nil, fmt.Errorf("do request failed: %w", err)
@@ -94,6 +100,7 @@ func DoWssRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 		return nil, fmt.Errorf("setup request header failed: %w", err)
 	}
 	targetHeader.Set("Content-Type", c.Request.Header.Get("Content-Type"))
+	info.ApplyHeaderOverride(targetHeader)
 	targetConn, _, err := websocket.DefaultDialer.Dial(fullRequestURL, targetHeader)
 	if err != nil {
 		return nil, fmt.Errorf("dial failed to %s: %w", fullRequestURL, err)
@@ -104,9 +111,29 @@ func DoWssRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 	return targetConn, nil
 }
 
-func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http.Response, error) {
+func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (resp *http.Response, err error) {
+	ctx, span := common2.StartSpan(c.Request.Context(), "relay.DoRequest",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.ServerAddress(req.URL.Hostname()),
+			attribute.Int("channel.id", info.ChannelId),
+			attribute.String("model", info.UpstreamModelName),
+		))
+	defer func() {
+		if resp != nil {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+			if resp.StatusCode >= http.StatusBadRequest {
+				span.SetStatus(codes.Error, resp.Status)
+			}
+		}
+		common2.SetSpanError(span, err)
+		span.End()
+	}()
+	// 以 W3C traceparent 向上游传递链路
+	common2.InjectTraceHeaders(ctx, req.Header)
+
 	var client *http.Client
-	var err error
 	if proxyURL, ok := info.ChannelSetting["proxy"]; ok {
 		client, err = service.NewProxyHttpClient(proxyURL.(string))
 		if err != nil {
@@ -166,12 +193,11 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		}
 	}
 
-	resp, err := client.Do(req)
+	common2.RecordUpstreamStart(info.RequestID)
+	resp, err = client.Do(req)
 	// 停止 ping goroutine 并等待其完成
-	if info.IsStream && pingEnabled {
-		if stopPinger != nil {
-			stopPinger()
-		}
+	if stopPinger != nil {
+		stopPinger()
 		pingerWg.Wait()
 	}
 	if err != nil {
@@ -180,6 +206,7 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 	if resp == nil {
 		return nil, errors.New("resp is nil")
 	}
+	common2.RecordUpstreamConnect(info.RequestID)
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
 	return resp, nil
@@ -173,6 +173,7 @@ func awsStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		ResponseText: strings.Builder{},
 		Usage:        &dto.Usage{},
 	}
+	claudeInfo.InitSensitiveCheck(c, info, RequestModeMessage)
 
 	for event := range stream.Events() {
 		switch v := event.(type) {
@@ -182,6 +183,10 @@ func awsStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 			if respErr != nil {
 				return respErr, nil
 			}
+			if claudeInfo.SensitiveStopped() {
+				claude.HandleStreamFinalResponse(c, info, claudeInfo, RequestModeMessage)
+				return nil, claudeInfo.Usage
+			}
 		case *types.UnknownUnionMember:
 			fmt.Println("unknown tag:", v.Tag)
 			return wrapErr(errors.New("unknown response type")), nil
@@ -8,6 +8,7 @@ import (
 	"tea-api/dto"
 	"tea-api/relay/channel"
 	relaycommon "tea-api/relay/common"
+	relayconstant "tea-api/relay/constant"
 	"tea-api/setting/model_setting"
 	"strings"
 
@@ -46,6 +47,9 @@ func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
 }
 
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	if info.RelayMode == relayconstant.RelayModeClaudeCountTokens {
+		return fmt.Sprintf("%s/v1/messages/count_tokens", info.BaseUrl), nil
+	}
 	if a.RequestMode == RequestModeMessage {
 		return fmt.Sprintf("%s/v1/messages", info.BaseUrl), nil
 	} else {
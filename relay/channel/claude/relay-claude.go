@@ -26,6 +26,8 @@ func stopReasonClaude2OpenAI(reason string) string {
 		return "max_tokens"
 	case "tool_use":
 		return "tool_calls"
+	case "refusal":
+		return "content_filter"
 	default:
 		return reason
 	}
@@ -457,6 +459,10 @@ type ClaudeResponseInfo struct {
 	Model        string
 	ResponseText strings.Builder
 	Usage        *dto.Usage
+
+	// 输出内容敏感词检测，分别用于 Claude 原生格式和转换后的 OpenAI 格式
+	sensitiveFilter  *service.SensitiveStreamFilter
+	sensitiveChecker *service.StreamSensitiveChecker
 }
 
 func FormatClaudeResponseInfo(requestMode int, claudeResponse *dto.ClaudeResponse, oaiResponse *dto.ChatCompletionsStreamResponse, claudeInfo *ClaudeResponseInfo) bool {
@@ -509,6 +515,9 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		}
 	}
 	if info.RelayFormat == relaycommon.RelayFormatClaude {
+		if claudeInfo.handleClaudeSensitive(c, info, &claudeResponse) {
+			return nil
+		}
 		if requestMode == RequestModeCompletion {
 			claudeInfo.ResponseText.WriteString(claudeResponse.Completion)
 		} else {
@@ -537,6 +546,9 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		if !FormatClaudeResponseInfo(requestMode, &claudeResponse, response, claudeInfo) {
 			return nil
 		}
+		if claudeInfo.sensitiveChecker != nil && response != nil {
+			claudeInfo.sensitiveChecker.CheckResponse(response)
+		}
 
 		err = helper.ObjectData(c, response)
 		if err != nil {
@@ -570,6 +582,15 @@ func HandleStreamFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, clau
 				claudeInfo.Usage, _ = service.ResponseText2Usage(claudeInfo.ResponseText.String(), info.UpstreamModelName, claudeInfo.Usage.PromptTokens)
 			}
 		}
+		if claudeInfo.sensitiveChecker != nil {
+			if response := claudeInfo.sensitiveChecker.FlushResponse(claudeInfo.ResponseId, claudeInfo.Created, info.UpstreamModelName); response != nil {
+				helper.ObjectData(c, response)
+			}
+			if claudeInfo.sensitiveChecker.Stopped() {
+				// 因敏感词终止输出时按实际下发的内容计费
+				claudeInfo.Usage, _ = service.ResponseText2Usage(claudeInfo.sensitiveChecker.DeliveredText(), info.UpstreamModelName, claudeInfo.Usage.PromptTokens)
+			}
+		}
 		if info.ShouldIncludeUsage {
 			response := helper.GenerateFinalUsageResponse(claudeInfo.ResponseId, claudeInfo.Created, info.UpstreamModelName, *claudeInfo.Usage)
 			err := helper.ObjectData(c, response)
@@ -589,13 +610,14 @@ func ClaudeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.
 		ResponseText: strings.Builder{},
 		Usage:        &dto.Usage{},
 	}
+	claudeInfo.InitSensitiveCheck(c, info, requestMode)
 	var err *dto.OpenAIErrorWithStatusCode
 	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
 		err = HandleStreamResponseData(c, info, claudeInfo, data, requestMode)
 		if err != nil {
 			return false
 		}
-		return true
+		return !claudeInfo.SensitiveStopped()
 	})
 	if err != nil {
 		return err, nil
@@ -0,0 +1,108 @@
+package claude
+
+import (
+	"fmt"
+	"strings"
+	"tea-api/common"
+	"tea-api/dto"
+	relaycommon "tea-api/relay/common"
+	"tea-api/relay/helper"
+	"tea-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// claudeStopReasonRefusal 因内容审核终止输出时的 stop_reason
+const claudeStopReasonRefusal = "refusal"
+
+// InitSensitiveCheck 按输出格式开启流式输出的敏感词检测
+func (claudeInfo *ClaudeResponseInfo) InitSensitiveCheck(c *gin.Context, info *relaycommon.RelayInfo, requestMode int) {
+	if requestMode != RequestModeMessage {
+		return
+	}
+	switch info.RelayFormat {
+	case relaycommon.RelayFormatClaude:
+		claudeInfo.sensitiveFilter = service.NewSensitiveStreamFilter()
+	case relaycommon.RelayFormatOpenAI:
+		claudeInfo.sensitiveChecker = service.NewStreamSensitiveChecker(c)
+	}
+}
+
+// SensitiveStopped 是否因命中敏感词终止了输出
+func (claudeInfo *ClaudeResponseInfo) SensitiveStopped() bool {
+	if claudeInfo.sensitiveFilter != nil {
+		return claudeInfo.sensitiveFilter.Stopped()
+	}
+	if claudeInfo.sensitiveChecker != nil {
+		return claudeInfo.sensitiveChecker.Stopped()
+	}
+	return false
+}
+
+// handleClaudeSensitive 检测 Claude 原生格式的流式事件，已自行下发事件时返回 true
+func (claudeInfo *ClaudeResponseInfo) handleClaudeSensitive(c *gin.Context, info *relaycommon.RelayInfo, claudeResponse *dto.ClaudeResponse) bool {
+	filter := claudeInfo.sensitiveFilter
+	if filter == nil {
+		return false
+	}
+	switch claudeResponse.Type {
+	case "content_block_delta":
+		if claudeResponse.Delta == nil || claudeResponse.Delta.Text == nil {
+			return false
+		}
+		origin := *claudeResponse.Delta.Text
+		text, stop := filter.Push(origin)
+		if text == origin && !stop {
+			return false
+		}
+		if text != "" {
+			claudeResponse.Delta.SetText(text)
+			claudeInfo.ResponseText.WriteString(text)
+			helper.ClaudeData(c, *claudeResponse)
+		}
+		if stop {
+			claudeInfo.stopClaudeStream(c, info, claudeResponse.GetIndex())
+		}
+		return true
+	case "content_block_stop":
+		text, stop := filter.Flush()
+		if text != "" {
+			delta := dto.ClaudeResponse{
+				Type:  "content_block_delta",
+				Index: claudeResponse.Index,
+				Delta: &dto.ClaudeMediaMessage{Type: "text_delta"},
+			}
+			delta.Delta.SetText(text)
+			claudeInfo.ResponseText.WriteString(text)
+			helper.ClaudeData(c, delta)
+		}
+		if stop {
+			claudeInfo.stopClaudeStream(c, info, claudeResponse.GetIndex())
+			return true
+		}
+	}
+	return false
+}
+
+// stopClaudeStream 补齐 content_block_stop、message_delta 和 message_stop 事件，按已下发的内容计算输出用量
+func (claudeInfo *ClaudeResponseInfo) stopClaudeStream(c *gin.Context, info *relaycommon.RelayInfo, index int) {
+	common.LogWarn(c, fmt.Sprintf("completion sensitive words detected: %s, stop streaming", strings.Join(claudeInfo.sensitiveFilter.Words(), ", ")))
+	completionTokens, _ := service.CountTextToken(claudeInfo.ResponseText.String(), info.UpstreamModelName)
+	claudeInfo.Usage.CompletionTokens = completionTokens
+	claudeInfo.Usage.TotalTokens = claudeInfo.Usage.PromptTokens + completionTokens
+
+	blockStop := dto.ClaudeResponse{Type: "content_block_stop"}
+	blockStop.SetIndex(index)
+	helper.ClaudeData(c, blockStop)
+	helper.ClaudeData(c, dto.ClaudeResponse{
+		Type: "message_delta",
+		Delta: &dto.ClaudeMediaMessage{
+			StopReason: common.GetPointer[string](claudeStopReasonRefusal),
+		},
+		Usage: &dto.ClaudeUsage{
+			InputTokens:  claudeInfo.Usage.PromptTokens,
+			OutputTokens: completionTokens,
+		},
+	})
+	helper.ClaudeData(c, dto.ClaudeResponse{Type: "message_stop"})
+}
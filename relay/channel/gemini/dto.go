@@ -6,6 +6,24 @@ type GeminiChatRequest struct {
 	GenerationConfig   GeminiChatGenerationConfig `json:"generationConfig,omitempty"`
 	Tools              []GeminiChatTool           `json:"tools,omitempty"`
 	SystemInstructions *GeminiChatContent         `json:"systemInstruction,omitempty"`
+	ToolConfig         *GeminiToolConfig          `json:"toolConfig,omitempty"`
+}
+
+type GeminiToolConfig struct {
+	FunctionCallingConfig *GeminiFunctionCallingConfig `json:"functionCallingConfig,omitempty"`
+}
+
+type GeminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode,omitempty"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+// GeminiFunctionDeclaration 函数声明，参数可以使用 OpenAPI Schema 或 JSON Schema
+type GeminiFunctionDeclaration struct {
+	Name                 string `json:"name"`
+	Description          string `json:"description,omitempty"`
+	Parameters           any    `json:"parameters,omitempty"`
+	ParametersJsonSchema any    `json:"parametersJsonSchema,omitempty"`
 }
 
 type GeminiThinkingConfig struct {
@@ -33,8 +51,8 @@ type GeminiFunctionResponseContent struct {
 }
 
 type FunctionResponse struct {
-	Name     string                        `json:"name"`
-	Response GeminiFunctionResponseContent `json:"response"`
+	Name     string `json:"name"`
+	Response any    `json:"response"`
 }
 
 type GeminiPartExecutableCode struct {
@@ -96,9 +114,9 @@ type GeminiChatGenerationConfig struct {
 
 type GeminiChatCandidate struct {
 	Content       GeminiChatContent        `json:"content"`
-	FinishReason  *string                  `json:"finishReason"`
+	FinishReason  *string                  `json:"finishReason,omitempty"`
 	Index         int64                    `json:"index"`
-	SafetyRatings []GeminiChatSafetyRating `json:"safetyRatings"`
+	SafetyRatings []GeminiChatSafetyRating `json:"safetyRatings,omitempty"`
 }
 
 type GeminiChatSafetyRating struct {
@@ -111,16 +129,27 @@ type GeminiChatPromptFeedback struct {
 }
 
 type GeminiChatResponse struct {
-	Candidates     []GeminiChatCandidate    `json:"candidates"`
-	PromptFeedback GeminiChatPromptFeedback `json:"promptFeedback"`
-	UsageMetadata  GeminiUsageMetadata      `json:"usageMetadata"`
+	Candidates     []GeminiChatCandidate     `json:"candidates"`
+	PromptFeedback *GeminiChatPromptFeedback `json:"promptFeedback,omitempty"`
+	UsageMetadata  GeminiUsageMetadata       `json:"usageMetadata"`
+	ModelVersion   string                    `json:"modelVersion,omitempty"`
 }
 
 type GeminiUsageMetadata struct {
 	PromptTokenCount     int `json:"promptTokenCount"`
 	CandidatesTokenCount int `json:"candidatesTokenCount"`
 	TotalTokenCount      int `json:"totalTokenCount"`
-	ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+	ThoughtsTokenCount   int `json:"thoughtsTokenCount,omitempty"`
+}
+
+// GeminiCountTokensRequest countTokens 请求，contents 与 generateContentRequest 二选一
+type GeminiCountTokensRequest struct {
+	Contents               []GeminiChatContent `json:"contents,omitempty"`
+	GenerateContentRequest *GeminiChatRequest  `json:"generateContentRequest,omitempty"`
+}
+
+type GeminiCountTokensResponse struct {
+	TotalTokens int `json:"totalTokens"`
 }
 
 // Imagen related structs
@@ -0,0 +1,515 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/dto"
+	relaycommon "tea-api/relay/common"
+	relayconstant "tea-api/relay/constant"
+	"tea-api/relay/helper"
+	"tea-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gemini 原生接口（/v1beta/models/{model}:{action}）相关的转换：
+// Gemini/Vertex 渠道直接透传请求与响应，其他渠道先把 Gemini 请求转换为 OpenAI 格式，再把 OpenAI 响应转换回 Gemini 格式。
+
+// NativeRequestAction 返回 Gemini 原生接口请求对应的上游方法
+func NativeRequestAction(info *relaycommon.RelayInfo) string {
+	switch info.RelayMode {
+	case relayconstant.RelayModeGeminiCountTokens:
+		return relayconstant.GeminiActionCountTokens
+	case relayconstant.RelayModeGeminiEmbedContent:
+		return relayconstant.GeminiActionEmbedContent
+	}
+	if info.IsStream {
+		return relayconstant.GeminiActionStreamGenerateContent + "?alt=sse"
+	}
+	return relayconstant.GeminiActionGenerateContent
+}
+
+// GeminiRequest2OpenAI 将 Gemini generateContent 请求转换为 OpenAI Chat Completions 请求
+func GeminiRequest2OpenAI(geminiRequest *GeminiChatRequest) (*dto.GeneralOpenAIRequest, error) {
+	config := geminiRequest.GenerationConfig
+	openAIRequest := &dto.GeneralOpenAIRequest{
+		Temperature: config.Temperature,
+		TopP:        config.TopP,
+		TopK:        int(config.TopK),
+		MaxTokens:   config.MaxOutputTokens,
+		Seed:        float64(config.Seed),
+	}
+	if config.CandidateCount > 1 {
+		openAIRequest.N = config.CandidateCount
+	}
+	if len(config.StopSequences) > 0 {
+		openAIRequest.Stop = config.StopSequences
+	}
+	if config.ResponseMimeType == "application/json" {
+		if config.ResponseSchema != nil {
+			openAIRequest.ResponseFormat = &dto.ResponseFormat{
+				Type: "json_schema",
+				JsonSchema: &dto.FormatJsonSchema{
+					Name:   "response",
+					Schema: normalizeSchemaTypes(config.ResponseSchema),
+				},
+			}
+		} else {
+			openAIRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_object"}
+		}
+	}
+
+	for _, tool := range geminiRequest.Tools {
+		if tool.FunctionDeclarations == nil {
+			// googleSearch、codeExecution 等内置工具只有 Gemini 支持
+			continue
+		}
+		declarations, err := common.Any2Type[[]GeminiFunctionDeclaration](tool.FunctionDeclarations)
+		if err != nil {
+			return nil, fmt.Errorf("invalid functionDeclarations: %s", err.Error())
+		}
+		for _, declaration := range declarations {
+			parameters := declaration.Parameters
+			if parameters == nil {
+				parameters = declaration.ParametersJsonSchema
+			}
+			openAIRequest.Tools = append(openAIRequest.Tools, dto.ToolCallRequest{
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:        declaration.Name,
+					Description: declaration.Description,
+					Parameters:  normalizeSchemaTypes(parameters),
+				},
+			})
+		}
+	}
+	if geminiRequest.ToolConfig != nil && geminiRequest.ToolConfig.FunctionCallingConfig != nil {
+		callingConfig := geminiRequest.ToolConfig.FunctionCallingConfig
+		switch strings.ToUpper(callingConfig.Mode) {
+		case "AUTO":
+			openAIRequest.ToolChoice = "auto"
+		case "NONE":
+			openAIRequest.ToolChoice = "none"
+		case "ANY":
+			if len(callingConfig.AllowedFunctionNames) == 1 {
+				openAIRequest.ToolChoice = map[string]any{
+					"type":     "function",
+					"function": map[string]string{"name": callingConfig.AllowedFunctionNames[0]},
+				}
+			} else {
+				openAIRequest.ToolChoice = "required"
+			}
+		}
+	}
+
+	if geminiRequest.SystemInstructions != nil {
+		var texts []string
+		for _, part := range geminiRequest.SystemInstructions.Parts {
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+		if len(texts) > 0 {
+			message := dto.Message{Role: "system"}
+			message.SetStringContent(strings.Join(texts, "\n"))
+			openAIRequest.Messages = append(openAIRequest.Messages, message)
+		}
+	}
+
+	// Gemini 旧版本的函数调用没有 id，按函数名依次为调用与结果生成对应的 id
+	pendingCallIds := make(map[string][]string)
+	callCount := 0
+	for _, content := range geminiRequest.Contents {
+		role := "user"
+		if content.Role == "model" {
+			role = "assistant"
+		}
+		var toolCalls []dto.ToolCallRequest
+		var toolMessages []dto.Message
+		mediaContents := make([]dto.MediaContent, 0, len(content.Parts))
+		hasMedia := false
+		for _, part := range content.Parts {
+			switch {
+			case part.Thought:
+				// 思考内容不回传给上游
+			case part.FunctionCall != nil:
+				callCount++
+				id := fmt.Sprintf("call_%d", callCount)
+				pendingCallIds[part.FunctionCall.FunctionName] = append(pendingCallIds[part.FunctionCall.FunctionName], id)
+				arguments, _ := json.Marshal(part.FunctionCall.Arguments)
+				toolCalls = append(toolCalls, dto.ToolCallRequest{
+					ID:   id,
+					Type: "function",
+					Function: dto.FunctionRequest{
+						Name:      part.FunctionCall.FunctionName,
+						Arguments: string(arguments),
+					},
+				})
+			case part.FunctionResponse != nil:
+				name := part.FunctionResponse.Name
+				id := ""
+				if ids := pendingCallIds[name]; len(ids) > 0 {
+					id = ids[0]
+					pendingCallIds[name] = ids[1:]
+				}
+				response, _ := json.Marshal(part.FunctionResponse.Response)
+				toolMessage := dto.Message{
+					Role:       "tool",
+					Name:       common.GetPointer(name),
+					ToolCallId: id,
+				}
+				toolMessage.SetStringContent(string(response))
+				toolMessages = append(toolMessages, toolMessage)
+			case part.InlineData != nil:
+				hasMedia = true
+				mediaContents = append(mediaContents, inlineData2MediaContent(part.InlineData))
+			case part.FileData != nil:
+				if part.FileData.MimeType != "" && !strings.HasPrefix(part.FileData.MimeType, "image/") {
+					return nil, fmt.Errorf("fileData with mime type %s is only supported by Gemini channels", part.FileData.MimeType)
+				}
+				hasMedia = true
+				mediaContents = append(mediaContents, dto.MediaContent{
+					Type:     dto.ContentTypeImageURL,
+					ImageUrl: &dto.MessageImageUrl{Url: part.FileData.FileUri},
+				})
+			case part.Text != "":
+				mediaContents = append(mediaContents, dto.MediaContent{
+					Type: dto.ContentTypeText,
+					Text: part.Text,
+				})
+			}
+		}
+		// 函数结果需要紧跟在对应的函数调用之后
+		openAIRequest.Messages = append(openAIRequest.Messages, toolMessages...)
+		if len(mediaContents) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		message := dto.Message{Role: role}
+		if hasMedia {
+			message.SetMediaContent(mediaContents)
+		} else if len(mediaContents) > 0 {
+			texts := make([]string, 0, len(mediaContents))
+			for _, mediaContent := range mediaContents {
+				texts = append(texts, mediaContent.Text)
+			}
+			message.SetStringContent(strings.Join(texts, ""))
+		}
+		if len(toolCalls) > 0 {
+			message.SetToolCalls(toolCalls)
+		}
+		openAIRequest.Messages = append(openAIRequest.Messages, message)
+	}
+	return openAIRequest, nil
+}
+
+func inlineData2MediaContent(data *GeminiInlineData) dto.MediaContent {
+	dataUrl := fmt.Sprintf("data:%s;base64,%s", data.MimeType, data.Data)
+	switch {
+	case strings.HasPrefix(data.MimeType, "image/"):
+		return dto.MediaContent{
+			Type:     dto.ContentTypeImageURL,
+			ImageUrl: &dto.MessageImageUrl{Url: dataUrl, MimeType: data.MimeType},
+		}
+	case strings.HasPrefix(data.MimeType, "audio/"):
+		format := strings.TrimPrefix(data.MimeType, "audio/")
+		if format == "mpeg" {
+			format = "mp3"
+		}
+		return dto.MediaContent{
+			Type:       dto.ContentTypeInputAudio,
+			InputAudio: &dto.MessageInputAudio{Data: data.Data, Format: format},
+		}
+	default:
+		return dto.MediaContent{
+			Type: dto.ContentTypeFile,
+			File: &dto.MessageFile{FileData: dataUrl},
+		}
+	}
+}
+
+// normalizeSchemaTypes Gemini 的 OpenAPI Schema 中类型名为大写（如 OBJECT），转换为 JSON Schema 使用的小写
+func normalizeSchemaTypes(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		normalized := make(map[string]any, len(v))
+		for key, value := range v {
+			if key == "type" {
+				if typeName, ok := value.(string); ok {
+					normalized[key] = strings.ToLower(typeName)
+					continue
+				}
+			}
+			normalized[key] = normalizeSchemaTypes(value)
+		}
+		return normalized
+	case []any:
+		normalized := make([]any, len(v))
+		for i, value := range v {
+			normalized[i] = normalizeSchemaTypes(value)
+		}
+		return normalized
+	}
+	return schema
+}
+
+func openAIFinishReason2Gemini(finishReason string) string {
+	switch finishReason {
+	case constant.FinishReasonLength:
+		return "MAX_TOKENS"
+	case constant.FinishReasonContentFilter:
+		return "SAFETY"
+	}
+	return "STOP"
+}
+
+func parseToolArguments(arguments string) any {
+	args := make(map[string]any)
+	if arguments != "" {
+		_ = json.Unmarshal([]byte(arguments), &args)
+	}
+	return args
+}
+
+// Usage2UsageMetadata 将 OpenAI 用量转换为 Gemini 的 usageMetadata
+func Usage2UsageMetadata(usage *dto.Usage) GeminiUsageMetadata {
+	if usage == nil {
+		return GeminiUsageMetadata{}
+	}
+	thoughts := usage.CompletionTokenDetails.ReasoningTokens
+	total := usage.TotalTokens
+	if total == 0 {
+		total = usage.PromptTokens + usage.CompletionTokens
+	}
+	return GeminiUsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens - thoughts,
+		ThoughtsTokenCount:   thoughts,
+		TotalTokenCount:      total,
+	}
+}
+
+func usageMetadata2Usage(metadata GeminiUsageMetadata) *dto.Usage {
+	usage := &dto.Usage{
+		PromptTokens:     metadata.PromptTokenCount,
+		CompletionTokens: metadata.TotalTokenCount - metadata.PromptTokenCount,
+		TotalTokens:      metadata.TotalTokenCount,
+	}
+	usage.PromptTokensDetails.TextTokens = usage.PromptTokens
+	usage.CompletionTokenDetails.ReasoningTokens = metadata.ThoughtsTokenCount
+	return usage
+}
+
+// ResponseOpenAI2Gemini 将 OpenAI Chat Completions 响应转换为 Gemini generateContent 响应
+func ResponseOpenAI2Gemini(response *dto.OpenAITextResponse) *GeminiChatResponse {
+	geminiResponse := &GeminiChatResponse{
+		Candidates:    make([]GeminiChatCandidate, 0, len(response.Choices)),
+		UsageMetadata: Usage2UsageMetadata(&response.Usage),
+		ModelVersion:  response.Model,
+	}
+	for _, choice := range response.Choices {
+		parts := make([]GeminiPart, 0)
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			parts = append(parts, GeminiPart{Text: reasoning, Thought: true})
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			parts = append(parts, GeminiPart{Text: text})
+		}
+		for _, call := range choice.Message.ParseToolCalls() {
+			parts = append(parts, GeminiPart{
+				FunctionCall: &FunctionCall{
+					FunctionName: call.Function.Name,
+					Arguments:    parseToolArguments(call.Function.Arguments),
+				},
+			})
+		}
+		finishReason := openAIFinishReason2Gemini(choice.FinishReason)
+		geminiResponse.Candidates = append(geminiResponse.Candidates, GeminiChatCandidate{
+			Content:      GeminiChatContent{Role: "model", Parts: parts},
+			FinishReason: &finishReason,
+			Index:        int64(choice.Index),
+		})
+	}
+	return geminiResponse
+}
+
+// OpenAIStreamConverter 将 OpenAI 流式响应逐块转换为 Gemini 流式响应。
+// 文本与思考内容立即输出；函数调用的参数在 OpenAI 中分多块下发，累积后与结束原因一起在最后一块输出。
+type OpenAIStreamConverter struct {
+	model         string
+	choices       map[int]bool
+	toolCalls     map[int][]*dto.ToolCallResponse
+	finishReasons map[int]string
+}
+
+func NewOpenAIStreamConverter(model string) *OpenAIStreamConverter {
+	return &OpenAIStreamConverter{
+		model:         model,
+		choices:       make(map[int]bool),
+		toolCalls:     make(map[int][]*dto.ToolCallResponse),
+		finishReasons: make(map[int]string),
+	}
+}
+
+// Convert 转换一个 OpenAI 流式块，没有需要立即输出的内容时返回 nil
+func (s *OpenAIStreamConverter) Convert(chunk *dto.ChatCompletionsStreamResponse) *GeminiChatResponse {
+	if chunk.Model != "" {
+		s.model = chunk.Model
+	}
+	var candidates []GeminiChatCandidate
+	for _, choice := range chunk.Choices {
+		s.choices[choice.Index] = true
+		for _, toolCall := range choice.Delta.ToolCalls {
+			s.appendToolCall(choice.Index, toolCall)
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.finishReasons[choice.Index] = *choice.FinishReason
+		}
+		var parts []GeminiPart
+		if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+			parts = append(parts, GeminiPart{Text: reasoning, Thought: true})
+		}
+		if text := choice.Delta.GetContentString(); text != "" {
+			parts = append(parts, GeminiPart{Text: text})
+		}
+		if len(parts) > 0 {
+			candidates = append(candidates, GeminiChatCandidate{
+				Content: GeminiChatContent{Role: "model", Parts: parts},
+				Index:   int64(choice.Index),
+			})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return &GeminiChatResponse{Candidates: candidates, ModelVersion: s.model}
+}
+
+func (s *OpenAIStreamConverter) appendToolCall(choiceIndex int, toolCall dto.ToolCallResponse) {
+	calls := s.toolCalls[choiceIndex]
+	index := len(calls)
+	if toolCall.Index != nil {
+		index = *toolCall.Index
+	} else if toolCall.ID == "" && index > 0 {
+		// 没有序号的后续参数片段属于最近的调用
+		index--
+	}
+	for len(calls) <= index {
+		calls = append(calls, &dto.ToolCallResponse{})
+	}
+	call := calls[index]
+	if toolCall.ID != "" {
+		call.ID = toolCall.ID
+	}
+	if toolCall.Function.Name != "" {
+		call.Function.Name = toolCall.Function.Name
+	}
+	call.Function.Arguments += toolCall.Function.Arguments
+	s.toolCalls[choiceIndex] = calls
+}
+
+// Finish 返回最后一块，包含累积的函数调用、结束原因与用量
+func (s *OpenAIStreamConverter) Finish(usage *dto.Usage) *GeminiChatResponse {
+	indexes := make([]int, 0, len(s.choices))
+	for index := range s.choices {
+		indexes = append(indexes, index)
+	}
+	if len(indexes) == 0 {
+		indexes = append(indexes, 0)
+	}
+	sort.Ints(indexes)
+	candidates := make([]GeminiChatCandidate, 0, len(indexes))
+	for _, index := range indexes {
+		parts := make([]GeminiPart, 0)
+		for _, call := range s.toolCalls[index] {
+			if call.Function.Name == "" {
+				continue
+			}
+			parts = append(parts, GeminiPart{
+				FunctionCall: &FunctionCall{
+					FunctionName: call.Function.Name,
+					Arguments:    parseToolArguments(call.Function.Arguments),
+				},
+			})
+		}
+		finishReason := openAIFinishReason2Gemini(s.finishReasons[index])
+		candidates = append(candidates, GeminiChatCandidate{
+			Content:      GeminiChatContent{Role: "model", Parts: parts},
+			FinishReason: &finishReason,
+			Index:        int64(index),
+		})
+	}
+	return &GeminiChatResponse{
+		Candidates:    candidates,
+		UsageMetadata: Usage2UsageMetadata(usage),
+		ModelVersion:  s.model,
+	}
+}
+
+// GeminiNativeHandler 透传 Gemini 原生接口的非流式响应，并从 usageMetadata 中读取用量
+func GeminiNativeHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.Usage, *dto.OpenAIErrorWithStatusCode) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	_ = resp.Body.Close()
+	if common.DebugEnabled {
+		println(string(responseBody))
+	}
+	usage := &dto.Usage{
+		PromptTokens: info.PromptTokens,
+		TotalTokens:  info.PromptTokens,
+	}
+	if info.RelayMode == relayconstant.RelayModeGeminiGenerateContent {
+		var geminiResponse GeminiChatResponse
+		if err = common.DecodeJson(responseBody, &geminiResponse); err != nil {
+			return nil, service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+		}
+		if geminiResponse.UsageMetadata.TotalTokenCount != 0 {
+			usage = usageMetadata2Usage(geminiResponse.UsageMetadata)
+		}
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(responseBody)
+	return usage, nil
+}
+
+// GeminiNativeStreamHandler 透传 Gemini 原生接口的流式响应，上游未返回用量时按输出文本计算
+func GeminiNativeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.Usage, *dto.OpenAIErrorWithStatusCode) {
+	var usage *dto.Usage
+	var responseText strings.Builder
+	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
+		var geminiResponse GeminiChatResponse
+		if err := common.DecodeJsonStr(data, &geminiResponse); err != nil {
+			common.LogError(c, "error unmarshalling stream response: "+err.Error())
+		} else {
+			for _, candidate := range geminiResponse.Candidates {
+				for _, part := range candidate.Content.Parts {
+					responseText.WriteString(part.Text)
+				}
+			}
+			if geminiResponse.UsageMetadata.TotalTokenCount != 0 {
+				usage = usageMetadata2Usage(geminiResponse.UsageMetadata)
+			}
+		}
+		if err := helper.StringData(c, data); err != nil {
+			common.LogError(c, err.Error())
+			return false
+		}
+		return true
+	})
+	if usage == nil {
+		usage, _ = service.ResponseText2Usage(responseText.String(), info.UpstreamModelName, info.PromptTokens)
+	}
+	return usage, nil
+}
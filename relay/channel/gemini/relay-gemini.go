@@ -149,15 +149,16 @@ func CovertGemini2OpenAI(textRequest dto.GeneralOpenAIRequest, info *relaycommon
 				name = val
 			}
 			content := common.StrToMap(message.StringContent())
-			functionResp := &FunctionResponse{
-				Name: name,
-				Response: GeminiFunctionResponseContent{
-					Name:    name,
-					Content: content,
-				},
+			responseContent := GeminiFunctionResponseContent{
+				Name:    name,
+				Content: content,
 			}
 			if content == nil {
-				functionResp.Response.Content = message.StringContent()
+				responseContent.Content = message.StringContent()
+			}
+			functionResp := &FunctionResponse{
+				Name:     name,
+				Response: responseContent,
 			}
 			*parts = append(*parts, GeminiPart{
 				FunctionResponse: functionResp,
@@ -660,6 +661,7 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 	createAt := common.GetTimestamp()
 	var usage = &dto.Usage{}
 	var imageCount int
+	sensitiveChecker := service.NewStreamSensitiveChecker(c)
 
 	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
 		var geminiResponse GeminiChatResponse
@@ -682,17 +684,37 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 			usage.CompletionTokenDetails.ReasoningTokens = geminiResponse.UsageMetadata.ThoughtsTokenCount
 			usage.TotalTokens = geminiResponse.UsageMetadata.TotalTokenCount
 		}
+		if sensitiveChecker != nil && sensitiveChecker.CheckResponse(response) {
+			helper.ObjectData(c, response)
+			return false
+		}
 		err = helper.ObjectData(c, response)
 		if err != nil {
 			common.LogError(c, err.Error())
 		}
 		if isStop {
-			response := helper.GenerateStopResponse(id, createAt, info.UpstreamModelName, constant.FinishReasonStop)
-			helper.ObjectData(c, response)
+			if !flushSensitiveChecker(c, sensitiveChecker, id, createAt, info.UpstreamModelName) {
+				response := helper.GenerateStopResponse(id, createAt, info.UpstreamModelName, constant.FinishReasonStop)
+				helper.ObjectData(c, response)
+			}
 		}
 		return true
 	})
 
+	if sensitiveChecker != nil {
+		if !sensitiveChecker.Stopped() {
+			flushSensitiveChecker(c, sensitiveChecker, id, createAt, info.UpstreamModelName)
+		}
+		if sensitiveChecker.Stopped() {
+			// 因敏感词终止输出时按实际下发的内容计费
+			promptTokens := usage.PromptTokens
+			if promptTokens == 0 {
+				promptTokens = info.PromptTokens
+			}
+			usage, _ = service.ResponseText2Usage(sensitiveChecker.DeliveredText(), info.UpstreamModelName, promptTokens)
+		}
+	}
+
 	var response *dto.ChatCompletionsStreamResponse
 
 	if imageCount != 0 {
@@ -716,6 +738,17 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 	return nil, usage
 }
 
+// flushSensitiveChecker 下发敏感词检测缓冲区中剩余的内容，因命中敏感词终止输出时返回 true
+func flushSensitiveChecker(c *gin.Context, checker *service.StreamSensitiveChecker, id string, createAt int64, model string) bool {
+	if checker == nil {
+		return false
+	}
+	if response := checker.FlushResponse(id, createAt, model); response != nil {
+		helper.ObjectData(c, response)
+	}
+	return checker.Stopped()
+}
+
 func GeminiChatHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -14,6 +14,7 @@ import (
 	"tea-api/constant"
 	"tea-api/dto"
 	relaycommon "tea-api/relay/common"
+	relayconstant "tea-api/relay/constant"
 	"tea-api/relay/helper"
 	"tea-api/service"
 
@@ -146,23 +147,45 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		lastStreamData string
 	)
 
+	// 输出内容敏感词检测，仅支持对话补全
+	var sensitiveChecker *service.StreamSensitiveChecker
+	if info.RelayMode == relayconstant.RelayModeChatCompletions {
+		sensitiveChecker = service.NewStreamSensitiveChecker(c)
+	}
+
 	var streamDataCount int
 	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
 		streamDataCount++
 		if common.DebugEnabled && streamDataCount <= 3 {
 			common.LogInfo(c, fmt.Sprintf("流式数据 #%d: %s", streamDataCount, data[:min(100, len(data))]))
 		}
+		stop := false
+		if sensitiveChecker != nil {
+			data, stop = sensitiveChecker.CheckData(data)
+		}
 		err := handleStreamFormat(c, info, data, forceFormat, thinkToContent)
 		if err != nil {
 			common.LogError(c, fmt.Sprintf("处理流式格式失败: %v, 数据: %s", err, data[:min(100, len(data))]))
 		}
 		lastStreamData = data
 		streamItems = append(streamItems, data)
-		return true
+		return !stop
 	})
 
 	common.LogInfo(c, fmt.Sprintf("流式响应处理完成，共接收 %d 个数据块", streamDataCount))
 
+	if sensitiveChecker != nil && !sensitiveChecker.Stopped() {
+		// 上游没有发送 finish_reason 就结束时，下发缓冲区中剩余的内容
+		var lastResponse dto.ChatCompletionsStreamResponse
+		_ = common.DecodeJsonStr(lastStreamData, &lastResponse)
+		if flushResponse := sensitiveChecker.FlushResponse(lastResponse.Id, lastResponse.Created, lastResponse.Model); flushResponse != nil {
+			if flushData, err := json.Marshal(flushResponse); err == nil {
+				_ = handleStreamFormat(c, info, string(flushData), forceFormat, thinkToContent)
+				streamItems = append(streamItems, string(flushData))
+			}
+		}
+	}
+
 	var lastStreamResponse dto.ChatCompletionsStreamResponse
 	err := common.DecodeJsonStr(lastStreamData, &lastStreamResponse)
 	if err == nil {
@@ -170,7 +193,8 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		createAt = lastStreamResponse.Created
 		systemFingerprint = lastStreamResponse.GetSystemFingerprint()
 		model = lastStreamResponse.Model
-		if service.ValidUsage(lastStreamResponse.Usage) {
+		// 因敏感词终止输出时上游用量包含未下发的内容，按实际下发的内容计费
+		if service.ValidUsage(lastStreamResponse.Usage) && (sensitiveChecker == nil || !sensitiveChecker.Stopped()) {
 			containStreamUsage = true
 			usage = lastStreamResponse.Usage
 		}
@@ -441,6 +465,13 @@ func OpenaiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*dto.Op
 					return
 				}
 
+				// 渠道的参数覆盖规则作用于 session.update 的 session 对象
+				message, err = info.ApplyRealtimeSessionOverride(message)
+				if err != nil {
+					errChan <- fmt.Errorf("error applying param override: %v", err)
+					return
+				}
+
 				realtimeEvent := &dto.RealtimeEvent{}
 				err = json.Unmarshal(message, realtimeEvent)
 				if err != nil {
@@ -90,7 +90,9 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 			}
 		}
 
-		if info.IsStream {
+		if info.RelayFormat == relaycommon.RelayFormatGemini {
+			suffix = gemini.NativeRequestAction(info)
+		} else if info.IsStream {
 			suffix = "streamGenerateContent?alt=sse"
 		} else {
 			suffix = "generateContent"
@@ -10,7 +10,9 @@ import (
 	"net/http"
 	"tea-api/common"
 	"tea-api/dto"
+	"tea-api/relay/channel"
 	relaycommon "tea-api/relay/common"
+	relayconstant "tea-api/relay/constant"
 	"tea-api/relay/helper"
 	"tea-api/service"
 	"tea-api/setting/model_setting"
@@ -32,9 +34,23 @@ func getAndValidateClaudeRequest(c *gin.Context) (textRequest *dto.ClaudeRequest
 	return textRequest, nil
 }
 
+// isClaudeNativeChannel 渠道是否支持直接透传 Claude Messages 请求，其他渠道转换为 OpenAI 格式请求
+func isClaudeNativeChannel(info *relaycommon.RelayInfo) bool {
+	switch info.ApiType {
+	case relayconstant.APITypeAnthropic, relayconstant.APITypeAws:
+		return true
+	case relayconstant.APITypeVertexAi:
+		return strings.HasPrefix(info.UpstreamModelName, "claude")
+	}
+	return false
+}
+
 func ClaudeHelper(c *gin.Context) (claudeError *dto.ClaudeErrorWithStatusCode) {
 
 	relayInfo := relaycommon.GenRelayInfoClaude(c)
+	if relayInfo.RelayMode == relayconstant.RelayModeClaudeCountTokens {
+		return claudeCountTokensHelper(c, relayInfo)
+	}
 
 	// get & validate textRequest 获取并验证文本请求
 	textRequest, err := getAndValidateClaudeRequest(c)
@@ -46,6 +62,10 @@ func ClaudeHelper(c *gin.Context) (claudeError *dto.ClaudeErrorWithStatusCode) {
 		relayInfo.IsStream = true
 	}
 
+	if err := checkClaudeRequestRegexFilter(c, textRequest, relayInfo); err != nil {
+		return service.ClaudeErrorWrapperLocal(err, "regex_filter_blocked", http.StatusBadRequest)
+	}
+
 	err = helper.ModelMappedHelper(c, relayInfo)
 	if err != nil {
 		return service.ClaudeErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
@@ -81,7 +101,6 @@ func ClaudeHelper(c *gin.Context) (claudeError *dto.ClaudeErrorWithStatusCode) {
 		return service.ClaudeErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
 	}
 	adaptor.Init(relayInfo)
-	var requestBody io.Reader
 
 	if textRequest.MaxTokens == 0 {
 		textRequest.MaxTokens = uint(model_setting.GetClaudeSettings().GetDefaultMaxTokens(textRequest.Model))
@@ -109,45 +128,187 @@ func ClaudeHelper(c *gin.Context) (claudeError *dto.ClaudeErrorWithStatusCode) {
 		relayInfo.UpstreamModelName = textRequest.Model
 	}
 
+	var usage *dto.Usage
+	if isClaudeNativeChannel(relayInfo) {
+		usage, openaiErr = relayClaudeNative(c, adaptor, relayInfo, textRequest)
+	} else {
+		usage, openaiErr = relayClaudeViaOpenAI(c, adaptor, relayInfo, textRequest)
+	}
+	if openaiErr != nil {
+		// reset status code 重置状态码
+		service.ResetStatusCode(openaiErr, c.GetString("status_code_mapping"))
+		return service.OpenAIErrorToClaudeError(openaiErr)
+	}
+	service.PostClaudeConsumeQuota(c, relayInfo, usage, preConsumedQuota, userQuota, priceData, "")
+	return nil
+}
+
+// relayClaudeNative 将 Claude 请求透传给 Anthropic/AWS/Vertex（claude 模型）渠道
+func relayClaudeNative(c *gin.Context, adaptor channel.Adaptor, relayInfo *relaycommon.RelayInfo, textRequest *dto.ClaudeRequest) (*dto.Usage, *dto.OpenAIErrorWithStatusCode) {
 	convertedRequest, err := adaptor.ConvertClaudeRequest(c, relayInfo, textRequest)
 	if err != nil {
-		return service.ClaudeErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
-	}
-	jsonData, err := json.Marshal(convertedRequest)
-	if common.DebugEnabled {
-		println("requestBody: ", string(jsonData))
+		return nil, service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
 	}
+	jsonData, err := marshalUpstreamRequest(convertedRequest, relayInfo)
 	if err != nil {
-		return service.ClaudeErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+		return nil, service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+	}
+	httpResp, openaiErr := doUpstreamRequest(c, adaptor, relayInfo, jsonData)
+	if openaiErr != nil {
+		return nil, openaiErr
 	}
-	requestBody = bytes.NewBuffer(jsonData)
+	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	if openaiErr != nil {
+		return nil, openaiErr
+	}
+	return usage.(*dto.Usage), nil
+}
 
-	statusCodeMappingStr := c.GetString("status_code_mapping")
-	var httpResp *http.Response
-	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
+// relayClaudeViaOpenAI 以 OpenAI Chat Completions 格式请求其他渠道，并把响应转换为 Claude 格式
+func relayClaudeViaOpenAI(c *gin.Context, adaptor channel.Adaptor, relayInfo *relaycommon.RelayInfo, claudeRequest *dto.ClaudeRequest) (*dto.Usage, *dto.OpenAIErrorWithStatusCode) {
+	textRequest, err := service.ClaudeToOpenAIRequest(*claudeRequest, relayInfo)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusBadRequest)
+	}
+	if relayInfo.IsStream && relayInfo.SupportStreamOptions {
+		textRequest.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+	// 渠道处理器按 OpenAI 格式输出，由 ResponseConvertWriter 转换为 Claude 格式
+	relayInfo.RelayFormat = relaycommon.RelayFormatOpenAI
+	relayInfo.RelayMode = relayconstant.RelayModeChatCompletions
+	relayInfo.RequestURLPath = "/v1/chat/completions"
+	adaptor.Init(relayInfo)
+	convertedRequest, err := adaptor.ConvertOpenAIRequest(c, relayInfo, textRequest)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	jsonData, err := marshalUpstreamRequest(convertedRequest, relayInfo)
 	if err != nil {
-		return service.ClaudeErrorWrapperLocal(err, "do_request_failed", http.StatusInternalServerError)
+		return nil, service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+	}
+	httpResp, openaiErr := doUpstreamRequest(c, adaptor, relayInfo, jsonData)
+	if openaiErr != nil {
+		return nil, openaiErr
 	}
 
-	if resp != nil {
-		httpResp = resp.(*http.Response)
-		relayInfo.IsStream = relayInfo.IsStream || strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream")
-		if httpResp.StatusCode != http.StatusOK {
-			openaiErr = service.RelayErrorHandler(httpResp, false)
-			// reset status code 重置状态码
-			service.ResetStatusCode(openaiErr, statusCodeMappingStr)
-			return service.OpenAIErrorToClaudeError(openaiErr)
+	if !relayInfo.IsStream {
+		writer := helper.NewResponseConvertWriter(c, false, nil)
+		usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+		writer.Restore(c)
+		if openaiErr != nil {
+			return nil, openaiErr
 		}
+		var openAIResponse dto.OpenAITextResponse
+		if err := common.DecodeJson(writer.Body(), &openAIResponse); err != nil {
+			return nil, service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+		}
+		// 部分渠道处理器的响应体不含用量，以计费用量为准
+		openAIResponse.Usage = *usage.(*dto.Usage)
+		c.Writer.Header().Del("Content-Length")
+		c.JSON(writer.StatusCode(), service.ResponseOpenAI2Claude(&openAIResponse, relayInfo))
+		return usage.(*dto.Usage), nil
 	}
 
+	writer := helper.NewResponseConvertWriter(c, true, func(data string) []byte {
+		var chunk dto.ChatCompletionsStreamResponse
+		// [DONE] 等非 JSON 负载直接忽略
+		if err := common.DecodeJsonStr(data, &chunk); err != nil {
+			return nil
+		}
+		if chunk.Usage != nil {
+			relayInfo.ClaudeConvertInfo.Usage = chunk.Usage
+		}
+		return claudeStreamEvents(service.StreamResponseOpenAI2Claude(&chunk, relayInfo))
+	})
+	defer writer.Restore(c)
 	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
-	//log.Printf("usage: %v", usage)
+	if openaiErr != nil {
+		return nil, openaiErr
+	}
+	relayInfo.ClaudeConvertInfo.Done = true
+	relayInfo.ClaudeConvertInfo.Usage = usage.(*dto.Usage)
+	writer.WriteRaw(claudeStreamEvents(service.StreamResponseOpenAI2Claude(&dto.ChatCompletionsStreamResponse{}, relayInfo)))
+	return usage.(*dto.Usage), nil
+}
+
+// claudeStreamEvents 将 Claude 流式事件编码为 SSE
+func claudeStreamEvents(claudeResponses []*dto.ClaudeResponse) []byte {
+	var buf bytes.Buffer
+	for _, claudeResponse := range claudeResponses {
+		jsonData, err := json.Marshal(claudeResponse)
+		if err != nil {
+			common.SysError("error marshalling claude stream response: " + err.Error())
+			continue
+		}
+		buf.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", claudeResponse.Type, jsonData))
+	}
+	return buf.Bytes()
+}
+
+func doUpstreamRequest(c *gin.Context, adaptor channel.Adaptor, info *relaycommon.RelayInfo, body []byte) (*http.Response, *dto.OpenAIErrorWithStatusCode) {
+	resp, err := adaptor.DoRequest(c, info, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp == nil {
+		return nil, service.OpenAIErrorWrapper(fmt.Errorf("empty upstream response"), "empty_upstream_response", http.StatusInternalServerError)
+	}
+	httpResp := resp.(*http.Response)
+	info.IsStream = info.IsStream || strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream")
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, service.RelayErrorHandler(httpResp, false)
+	}
+	return httpResp, nil
+}
+
+// claudeCountTokensHelper count_tokens 不计费；Anthropic 渠道由上游计算，其他渠道在本地计算
+func claudeCountTokensHelper(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dto.ClaudeErrorWithStatusCode {
+	textRequest, err := getAndValidateClaudeRequest(c)
+	if err != nil {
+		return service.ClaudeErrorWrapperLocal(err, "invalid_claude_request", http.StatusBadRequest)
+	}
+	err = helper.ModelMappedHelper(c, relayInfo)
+	if err != nil {
+		return service.ClaudeErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
+	}
+	textRequest.Model = relayInfo.UpstreamModelName
+
+	if relayInfo.ApiType != relayconstant.APITypeAnthropic {
+		promptTokens, err := service.CountTokenClaudeRequest(*textRequest, relayInfo.UpstreamModelName)
+		if err != nil {
+			return service.ClaudeErrorWrapperLocal(err, "count_token_messages_failed", http.StatusInternalServerError)
+		}
+		c.JSON(http.StatusOK, dto.ClaudeCountTokensResponse{InputTokens: promptTokens})
+		return nil
+	}
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.ClaudeErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(relayInfo)
+	// count_tokens 不接受 max_tokens 等字段，原样转发请求体，只替换映射后的模型名
+	reqMap := make(map[string]any)
+	if err := common.UnmarshalBodyReusable(c, &reqMap); err != nil {
+		return service.ClaudeErrorWrapperLocal(err, "invalid_claude_request", http.StatusBadRequest)
+	}
+	reqMap["model"] = relayInfo.UpstreamModelName
+	jsonData, err := marshalUpstreamRequest(reqMap, relayInfo)
+	if err != nil {
+		return service.ClaudeErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+	}
+	httpResp, openaiErr := doUpstreamRequest(c, adaptor, relayInfo, jsonData)
 	if openaiErr != nil {
 		// reset status code 重置状态码
-		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+		service.ResetStatusCode(openaiErr, c.GetString("status_code_mapping"))
 		return service.OpenAIErrorToClaudeError(openaiErr)
 	}
-	service.PostClaudeConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
+	defer httpResp.Body.Close()
+	responseBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return service.ClaudeErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	c.Data(http.StatusOK, "application/json", responseBody)
 	return nil
 }
 
@@ -0,0 +1,493 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 参数覆盖操作
+const (
+	ParamOverrideModeSet          = "set"           // 设置 path 的值，中间层级不存在时自动创建
+	ParamOverrideModeDelete       = "delete"        // 删除 path
+	ParamOverrideModeAppend       = "append"        // 向 path 的数组追加元素（value 为数组时逐个追加），或向字符串追加文本
+	ParamOverrideModeMove         = "move"          // 将 from 的值移动到 path
+	ParamOverrideModeSetHeader    = "set_header"    // 设置上游请求头 path
+	ParamOverrideModeDeleteHeader = "delete_header" // 删除上游请求头 path
+)
+
+// 条件匹配方式
+const (
+	ParamOverrideConditionFull     = "full"
+	ParamOverrideConditionPrefix   = "prefix"
+	ParamOverrideConditionSuffix   = "suffix"
+	ParamOverrideConditionContains = "contains"
+	ParamOverrideConditionRegex    = "regex"
+	ParamOverrideConditionGt       = "gt"
+	ParamOverrideConditionGte      = "gte"
+	ParamOverrideConditionLt       = "lt"
+	ParamOverrideConditionLte      = "lte"
+	ParamOverrideConditionExists   = "exists"
+)
+
+// 条件中以 $ 开头的 path 表示请求的属性而不是请求体字段
+const (
+	paramOverrideConditionModel         = "$model"          // 映射后的上游模型名
+	paramOverrideConditionOriginalModel = "$original_model" // 用户请求的模型名
+)
+
+// ParamOverrideCondition 操作生效的条件，path 为请求体中以 . 分隔的字段路径，数组使用下标（-1 表示最后一个元素）
+type ParamOverrideCondition struct {
+	Path   string `json:"path"`
+	Mode   string `json:"mode"`
+	Value  any    `json:"value,omitempty"`
+	Invert bool   `json:"invert,omitempty"`
+}
+
+// ParamOverrideOperation 一条覆盖规则，conditions 默认全部满足才生效，logic 为 OR 时满足任意一个即生效
+type ParamOverrideOperation struct {
+	Mode       string                   `json:"mode"`
+	Path       string                   `json:"path"`
+	From       string                   `json:"from,omitempty"`
+	Value      any                      `json:"value,omitempty"`
+	Conditions []ParamOverrideCondition `json:"conditions,omitempty"`
+	Logic      string                   `json:"logic,omitempty"`
+
+	literalPath bool             // 旧版平铺配置的键不按 . 拆分
+	patterns    []*regexp.Regexp // regex 条件预编译的正则，与 Conditions 一一对应
+}
+
+// ParamOverrideRules 渠道的参数覆盖规则，按顺序执行。
+// 渠道的 param_override 为 {"operations": [...]} 时使用规则，否则按旧版平铺格式整体替换顶层字段
+type ParamOverrideRules struct {
+	Operations []ParamOverrideOperation `json:"operations"`
+}
+
+type headerOverride struct {
+	name   string
+	value  string
+	delete bool
+}
+
+// ParseParamOverride 解析渠道的参数覆盖配置并校验规则
+func ParseParamOverride(paramOverride map[string]any) (*ParamOverrideRules, error) {
+	rules := &ParamOverrideRules{}
+	operations, ok := paramOverride["operations"].([]any)
+	if !ok {
+		for key, value := range paramOverride {
+			rules.Operations = append(rules.Operations, ParamOverrideOperation{
+				Mode:        ParamOverrideModeSet,
+				Path:        key,
+				Value:       value,
+				literalPath: true,
+			})
+		}
+		return rules, nil
+	}
+	data, err := json.Marshal(operations)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &rules.Operations); err != nil {
+		return nil, err
+	}
+	for i := range rules.Operations {
+		if err = rules.Operations[i].prepare(); err != nil {
+			return nil, fmt.Errorf("第 %d 条覆盖规则无效: %w", i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+// CheckParamOverride 校验渠道配置中的参数覆盖 JSON
+func CheckParamOverride(jsonStr string) error {
+	if strings.TrimSpace(jsonStr) == "" {
+		return nil
+	}
+	paramOverride := make(map[string]any)
+	if err := json.Unmarshal([]byte(jsonStr), &paramOverride); err != nil {
+		return fmt.Errorf("参数覆盖必须是合法的 JSON 对象: %w", err)
+	}
+	_, err := ParseParamOverride(paramOverride)
+	return err
+}
+
+func (op *ParamOverrideOperation) prepare() error {
+	switch op.Mode {
+	case ParamOverrideModeSet, ParamOverrideModeAppend:
+		if op.Value == nil {
+			return errors.New("缺少 value")
+		}
+	case ParamOverrideModeDelete:
+	case ParamOverrideModeMove:
+		if op.From == "" {
+			return errors.New("缺少 from")
+		}
+	case ParamOverrideModeSetHeader:
+		if _, ok := op.Value.(string); !ok {
+			return errors.New("请求头的 value 必须是字符串")
+		}
+	case ParamOverrideModeDeleteHeader:
+	default:
+		return fmt.Errorf("不支持的操作 %s", op.Mode)
+	}
+	if op.Path == "" {
+		return errors.New("缺少 path")
+	}
+	if op.Logic != "" && !strings.EqualFold(op.Logic, "AND") && !strings.EqualFold(op.Logic, "OR") {
+		return fmt.Errorf("不支持的条件逻辑 %s", op.Logic)
+	}
+	op.patterns = make([]*regexp.Regexp, len(op.Conditions))
+	for i, cond := range op.Conditions {
+		if cond.Path == "" {
+			return errors.New("条件缺少 path")
+		}
+		switch cond.Mode {
+		case ParamOverrideConditionFull, ParamOverrideConditionPrefix, ParamOverrideConditionSuffix,
+			ParamOverrideConditionContains, ParamOverrideConditionExists:
+		case ParamOverrideConditionGt, ParamOverrideConditionGte, ParamOverrideConditionLt, ParamOverrideConditionLte:
+			if _, ok := overrideNumber(cond.Value); !ok {
+				return fmt.Errorf("条件 %s 的 value 必须是数字", cond.Path)
+			}
+		case ParamOverrideConditionRegex:
+			pattern, ok := cond.Value.(string)
+			if !ok {
+				return fmt.Errorf("条件 %s 的 value 必须是正则表达式", cond.Path)
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("条件 %s 的正则无效: %w", cond.Path, err)
+			}
+			op.patterns[i] = re
+		default:
+			return fmt.Errorf("不支持的条件匹配方式 %s", cond.Mode)
+		}
+	}
+	return nil
+}
+
+// ApplyParamOverride 按渠道的参数覆盖规则改写上游请求体，并记录需要覆盖的上游请求头
+func (info *RelayInfo) ApplyParamOverride(jsonData []byte) ([]byte, error) {
+	info.headerOverrides = nil
+	info.headerOverrideResolved = true
+	if len(info.ParamOverride) == 0 {
+		return jsonData, nil
+	}
+	rules, err := ParseParamOverride(info.ParamOverride)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.UseNumber()
+	var body any
+	if err = decoder.Decode(&body); err != nil {
+		return nil, err
+	}
+	if body, err = info.applyOverrideOperations(rules, body); err != nil {
+		return nil, err
+	}
+	return json.Marshal(body)
+}
+
+// ApplyRealtimeSessionOverride 按渠道的参数覆盖规则改写 Realtime 客户端 session.update 事件中的 session 对象，
+// 规则路径相对于 session，其他事件原样返回
+func (info *RelayInfo) ApplyRealtimeSessionOverride(message []byte) ([]byte, error) {
+	if len(info.ParamOverride) == 0 {
+		return message, nil
+	}
+	event := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(message, &event); err != nil {
+		return nil, err
+	}
+	var eventType string
+	if err := json.Unmarshal(event["type"], &eventType); err != nil || eventType != "session.update" {
+		return message, nil
+	}
+	session, ok := event["session"]
+	if !ok {
+		return message, nil
+	}
+	session, err := info.ApplyParamOverride(session)
+	if err != nil {
+		return nil, err
+	}
+	event["session"] = session
+	return json.Marshal(event)
+}
+
+// ApplyHeaderOverride 设置或删除上游请求头。请求体未经过 ApplyParamOverride（如表单、WebSocket 请求）时，
+// 依赖请求体字段的条件均视为不满足
+func (info *RelayInfo) ApplyHeaderOverride(header http.Header) {
+	if !info.headerOverrideResolved {
+		info.headerOverrideResolved = true
+		if len(info.ParamOverride) > 0 {
+			if rules, err := ParseParamOverride(info.ParamOverride); err == nil {
+				_, _ = info.applyOverrideOperations(rules, nil)
+			}
+		}
+	}
+	for _, override := range info.headerOverrides {
+		if override.delete {
+			header.Del(override.name)
+		} else {
+			header.Set(override.name, override.value)
+		}
+	}
+}
+
+func (info *RelayInfo) applyOverrideOperations(rules *ParamOverrideRules, body any) (any, error) {
+	var err error
+	for i := range rules.Operations {
+		op := &rules.Operations[i]
+		if !info.matchOverrideConditions(op, body) {
+			continue
+		}
+		switch op.Mode {
+		case ParamOverrideModeSetHeader:
+			info.headerOverrides = append(info.headerOverrides, headerOverride{name: op.Path, value: op.Value.(string)})
+			continue
+		case ParamOverrideModeDeleteHeader:
+			info.headerOverrides = append(info.headerOverrides, headerOverride{name: op.Path, delete: true})
+			continue
+		}
+		if body == nil {
+			continue
+		}
+		if op.literalPath {
+			if m, ok := body.(map[string]any); ok {
+				m[op.Path] = op.Value
+			}
+			continue
+		}
+		keys := strings.Split(op.Path, ".")
+		switch op.Mode {
+		case ParamOverrideModeSet:
+			body, err = setOverridePath(body, keys, op.Value)
+		case ParamOverrideModeDelete:
+			body = deleteOverridePath(body, keys)
+		case ParamOverrideModeAppend:
+			current, _ := getOverridePath(body, keys)
+			var value any
+			if value, err = appendOverrideValue(current, op.Value); err == nil {
+				body, err = setOverridePath(body, keys, value)
+			}
+		case ParamOverrideModeMove:
+			fromKeys := strings.Split(op.From, ".")
+			if value, ok := getOverridePath(body, fromKeys); ok {
+				body = deleteOverridePath(body, fromKeys)
+				body, err = setOverridePath(body, keys, value)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("param override %s %s: %w", op.Mode, op.Path, err)
+		}
+	}
+	return body, nil
+}
+
+func (info *RelayInfo) matchOverrideConditions(op *ParamOverrideOperation, body any) bool {
+	if len(op.Conditions) == 0 {
+		return true
+	}
+	or := strings.EqualFold(op.Logic, "OR")
+	for i, cond := range op.Conditions {
+		var value any
+		var found bool
+		switch cond.Path {
+		case paramOverrideConditionModel:
+			value, found = info.UpstreamModelName, true
+		case paramOverrideConditionOriginalModel:
+			value, found = info.OriginModelName, true
+		default:
+			value, found = getOverridePath(body, strings.Split(cond.Path, "."))
+		}
+		var pattern *regexp.Regexp
+		if i < len(op.patterns) {
+			pattern = op.patterns[i]
+		}
+		matched := matchOverrideCondition(cond, pattern, value, found) != cond.Invert
+		if or && matched {
+			return true
+		}
+		if !or && !matched {
+			return false
+		}
+	}
+	return !or
+}
+
+func matchOverrideCondition(cond ParamOverrideCondition, pattern *regexp.Regexp, value any, found bool) bool {
+	if cond.Mode == ParamOverrideConditionExists {
+		return found
+	}
+	if !found {
+		return false
+	}
+	switch cond.Mode {
+	case ParamOverrideConditionGt, ParamOverrideConditionGte, ParamOverrideConditionLt, ParamOverrideConditionLte:
+		actual, ok := overrideNumber(value)
+		expected, _ := overrideNumber(cond.Value)
+		if !ok {
+			return false
+		}
+		switch cond.Mode {
+		case ParamOverrideConditionGt:
+			return actual > expected
+		case ParamOverrideConditionGte:
+			return actual >= expected
+		case ParamOverrideConditionLt:
+			return actual < expected
+		default:
+			return actual <= expected
+		}
+	case ParamOverrideConditionFull:
+		if actual, ok := overrideNumber(value); ok {
+			expected, ok := overrideNumber(cond.Value)
+			return ok && actual == expected
+		}
+		return fmt.Sprint(value) == fmt.Sprint(cond.Value)
+	}
+	actual, ok := value.(string)
+	if !ok {
+		return false
+	}
+	expected := fmt.Sprint(cond.Value)
+	switch cond.Mode {
+	case ParamOverrideConditionPrefix:
+		return strings.HasPrefix(actual, expected)
+	case ParamOverrideConditionSuffix:
+		return strings.HasSuffix(actual, expected)
+	case ParamOverrideConditionContains:
+		return strings.Contains(actual, expected)
+	case ParamOverrideConditionRegex:
+		return pattern != nil && pattern.MatchString(actual)
+	}
+	return false
+}
+
+func overrideNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// overrideArrayIndex 解析数组下标，负数从末尾计数
+func overrideArrayIndex(key string, length int) (int, bool) {
+	index, err := strconv.Atoi(key)
+	if err != nil {
+		return 0, false
+	}
+	if index < 0 {
+		index += length
+	}
+	return index, index >= 0 && index < length
+}
+
+func getOverridePath(node any, keys []string) (any, bool) {
+	for _, key := range keys {
+		switch n := node.(type) {
+		case map[string]any:
+			value, ok := n[key]
+			if !ok {
+				return nil, false
+			}
+			node = value
+		case []any:
+			index, ok := overrideArrayIndex(key, len(n))
+			if !ok {
+				return nil, false
+			}
+			node = n[index]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+func setOverridePath(node any, keys []string, value any) (any, error) {
+	if len(keys) == 0 {
+		return value, nil
+	}
+	key := keys[0]
+	switch n := node.(type) {
+	case nil:
+		return setOverridePath(map[string]any{}, keys, value)
+	case map[string]any:
+		child, err := setOverridePath(n[key], keys[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[key] = child
+		return n, nil
+	case []any:
+		index, ok := overrideArrayIndex(key, len(n))
+		if !ok {
+			return nil, fmt.Errorf("array index %s out of range", key)
+		}
+		child, err := setOverridePath(n[index], keys[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[index] = child
+		return n, nil
+	}
+	return nil, fmt.Errorf("cannot set field %s on a non-object value", key)
+}
+
+func deleteOverridePath(node any, keys []string) any {
+	if len(keys) == 0 {
+		return node
+	}
+	key := keys[0]
+	switch n := node.(type) {
+	case map[string]any:
+		if len(keys) == 1 {
+			delete(n, key)
+		} else if child, ok := n[key]; ok {
+			n[key] = deleteOverridePath(child, keys[1:])
+		}
+	case []any:
+		index, ok := overrideArrayIndex(key, len(n))
+		if !ok {
+			return n
+		}
+		if len(keys) == 1 {
+			return append(n[:index], n[index+1:]...)
+		}
+		n[index] = deleteOverridePath(n[index], keys[1:])
+	}
+	return node
+}
+
+func appendOverrideValue(current any, value any) (any, error) {
+	switch c := current.(type) {
+	case nil:
+		if values, ok := value.([]any); ok {
+			return values, nil
+		}
+		return []any{value}, nil
+	case []any:
+		if values, ok := value.([]any); ok {
+			return append(c, values...), nil
+		}
+		return append(c, value), nil
+	case string:
+		if s, ok := value.(string); ok {
+			return c + s, nil
+		}
+	}
+	return nil, errors.New("append target must be an array or a string")
+}
@@ -5,6 +5,7 @@ import (
 	"tea-api/constant"
 	"tea-api/dto"
 	relayconstant "tea-api/relay/constant"
+	"tea-api/setting"
 	"strings"
 	"time"
 
@@ -31,6 +32,8 @@ type ClaudeConvertInfo struct {
 	Usage            *dto.Usage
 	FinishReason     string
 	Done             bool
+	MessageStarted   bool // 是否已发送 message_start
+	ToolCallIndex    int  // 当前 tool_use 块对应的 OpenAI tool_calls 序号
 }
 
 const (
@@ -61,6 +64,8 @@ type RelayInfo struct {
 	TokenKey          string
 	UserId            int
 	Group             string
+	UsingGroup        string // 分组回退后实际使用的分组
+	BatchId           string // 批处理任务中的请求所属的批处理任务 ID
 	TokenUnlimited    bool
 	StartTime         time.Time
 	FirstResponseTime time.Time
@@ -94,9 +99,17 @@ type RelayInfo struct {
 	ReasoningEffort      string
 	ChannelSetting       map[string]interface{}
 	ParamOverride        map[string]interface{}
+	// 参数覆盖规则中命中的上游请求头
+	headerOverrides        []headerOverride
+	headerOverrideResolved bool
 	UserSetting          map[string]interface{}
 	UserEmail            string
 	UserQuota            int
+	// 本次请求使用的订阅，以及已从订阅额度和余额中扣除的额度，用于按先订阅后余额的顺序结算
+	SubscriptionId       int
+	SubscriptionResolved bool
+	SubscriptionConsumed int
+	BalanceConsumed      int
 	RelayFormat          string
 	SendResponseCount    int
 	ChannelCreateTime    int64
@@ -205,6 +218,8 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 		TokenKey:          tokenKey,
 		UserId:            userId,
 		Group:             group,
+		UsingGroup:        c.GetString(constant.ContextKeyUsingGroup),
+		BatchId:           c.GetString(constant.ContextKeyBatchId),
 		TokenUnlimited:    tokenUnlimited,
 		StartTime:         startTime,
 		FirstResponseTime: startTime.Add(-time.Second),
@@ -247,9 +262,15 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 	if relayconstant.RelayModeResponses == info.RelayMode {
 		info.SupportStreamOptions = false
 	}
+	c.Set(constant.ContextKeyRelayInfo, info)
 	return info
 }
 
+// BillingGroup 返回计费使用的分组，发生分组回退时按配置决定使用原分组还是回退分组
+func (info *RelayInfo) BillingGroup() string {
+	return setting.GetFallbackBillingGroup(info.Group, info.UsingGroup)
+}
+
 func (info *RelayInfo) SetPromptTokens(promptTokens int) {
 	info.PromptTokens = promptTokens
 }
@@ -267,6 +288,7 @@ func (info *RelayInfo) SetFirstResponseTime() {
 		if info.RequestID != "" {
 			common.RecordFirstToken(info.RequestID)
 		}
+		common.RecordFirstTokenMetrics(info.ChannelId, info.ChannelType, info.OriginModelName, info.Group, info.FirstResponseTime.Sub(info.StartTime))
 	}
 }
 
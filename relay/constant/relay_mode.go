@@ -43,11 +43,56 @@ const (
 	RelayModeResponses
 
 	RelayModeRealtime
+
+	RelayModeGeminiGenerateContent // generateContent 与 streamGenerateContent
+	RelayModeGeminiCountTokens
+	RelayModeGeminiEmbedContent
+
+	RelayModeClaudeCountTokens // /v1/messages/count_tokens
+)
+
+// Gemini 原生接口的方法名，路径形如 /v1beta/models/{model}:{action}
+const (
+	GeminiActionGenerateContent       = "generateContent"
+	GeminiActionStreamGenerateContent = "streamGenerateContent"
+	GeminiActionCountTokens           = "countTokens"
+	GeminiActionEmbedContent          = "embedContent"
 )
 
+// ParseGeminiModelAction 从 Gemini 原生接口路径中解析模型名与方法名
+func ParseGeminiModelAction(path string) (string, string) {
+	idx := strings.Index(path, "/models/")
+	if idx < 0 {
+		return "", ""
+	}
+	modelAction := path[idx+len("/models/"):]
+	sep := strings.LastIndex(modelAction, ":")
+	if sep < 0 {
+		return modelAction, ""
+	}
+	return modelAction[:sep], modelAction[sep+1:]
+}
+
+func IsGeminiRelayMode(relayMode int) bool {
+	return relayMode == RelayModeGeminiGenerateContent ||
+		relayMode == RelayModeGeminiCountTokens ||
+		relayMode == RelayModeGeminiEmbedContent
+}
+
 func Path2RelayMode(path string) int {
 	relayMode := RelayModeUnknown
-	if strings.HasPrefix(path, "/v1/chat/completions") || strings.HasPrefix(path, "/pg/chat/completions") {
+	if strings.HasPrefix(path, "/v1beta/models/") {
+		switch _, action := ParseGeminiModelAction(path); action {
+		case GeminiActionGenerateContent, GeminiActionStreamGenerateContent:
+			relayMode = RelayModeGeminiGenerateContent
+		case GeminiActionCountTokens:
+			relayMode = RelayModeGeminiCountTokens
+		case GeminiActionEmbedContent:
+			relayMode = RelayModeGeminiEmbedContent
+		}
+	} else if strings.HasPrefix(path, "/v1/messages/count_tokens") {
+		relayMode = RelayModeClaudeCountTokens
+	} else if strings.HasPrefix(path, "/v1/chat/completions") || strings.HasPrefix(path, "/pg/chat/completions") {
 		relayMode = RelayModeChatCompletions
 	} else if strings.HasPrefix(path, "/v1/completions") {
 		relayMode = RelayModeCompletions
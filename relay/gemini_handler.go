@@ -0,0 +1,553 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/dto"
+	"tea-api/relay/channel"
+	"tea-api/relay/channel/gemini"
+	relaycommon "tea-api/relay/common"
+	relayconstant "tea-api/relay/constant"
+	"tea-api/relay/helper"
+	"tea-api/service"
+	"tea-api/setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GeminiHelper 处理 Gemini 原生接口 /v1beta/models/{model}:{action}。
+// Gemini 与 Vertex（gemini 模型）渠道直接透传，其他渠道转换为 OpenAI 格式请求后再把响应转换回 Gemini 格式。
+func GeminiHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
+	relayInfo := relaycommon.GenRelayInfo(c)
+	switch relayInfo.RelayMode {
+	case relayconstant.RelayModeGeminiCountTokens:
+		return geminiCountTokensHelper(c, relayInfo)
+	case relayconstant.RelayModeGeminiEmbedContent:
+		return geminiEmbedContentHelper(c, relayInfo)
+	}
+	return geminiGenerateContentHelper(c, relayInfo)
+}
+
+func getAndValidateGeminiRequest(c *gin.Context) (*gemini.GeminiChatRequest, error) {
+	geminiRequest := &gemini.GeminiChatRequest{}
+	if err := common.UnmarshalBodyReusable(c, geminiRequest); err != nil {
+		return nil, err
+	}
+	if len(geminiRequest.Contents) == 0 {
+		return nil, errors.New("field contents is required")
+	}
+	if geminiRequest.GenerationConfig.MaxOutputTokens > math.MaxInt32/2 {
+		return nil, errors.New("maxOutputTokens is invalid")
+	}
+	return geminiRequest, nil
+}
+
+// isGeminiNativeChannel 渠道是否支持直接透传 Gemini 原生请求
+func isGeminiNativeChannel(info *relaycommon.RelayInfo) bool {
+	switch info.ApiType {
+	case relayconstant.APITypeGemini:
+		return true
+	case relayconstant.APITypeVertexAi:
+		// Vertex 的向量接口不是 embedContent
+		return strings.HasPrefix(info.UpstreamModelName, "gemini") && info.RelayMode != relayconstant.RelayModeGeminiEmbedContent
+	}
+	return false
+}
+
+func geminiContentText(content *gemini.GeminiChatContent) string {
+	var texts []string
+	for _, part := range content.Parts {
+		if part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func geminiRequestText(geminiRequest *gemini.GeminiChatRequest) string {
+	var texts []string
+	if geminiRequest.SystemInstructions != nil {
+		texts = append(texts, geminiContentText(geminiRequest.SystemInstructions))
+	}
+	for i := range geminiRequest.Contents {
+		texts = append(texts, geminiContentText(&geminiRequest.Contents[i]))
+	}
+	return strings.Join(texts, "\n")
+}
+
+// getGeminiPromptTokens 优先按转换后的 OpenAI 请求计算，无法转换时（仅透传渠道）按文本计算
+func getGeminiPromptTokens(info *relaycommon.RelayInfo, geminiRequest *gemini.GeminiChatRequest, textRequest *dto.GeneralOpenAIRequest) (int, error) {
+	if textRequest != nil {
+		return service.CountTokenChatRequest(info, *textRequest)
+	}
+	return service.CountTokenInput(geminiRequestText(geminiRequest), info.UpstreamModelName)
+}
+
+// geminiNativeRequestBody 返回透传给 Gemini/Vertex 渠道的请求体：默认使用原始请求体，命中正则过滤规则时使用过滤后的请求，
+// 最后按渠道的参数覆盖规则改写
+func geminiNativeRequestBody(c *gin.Context, request any, info *relaycommon.RelayInfo) ([]byte, error) {
+	var body []byte
+	var err error
+	if len(c.GetStringSlice(constant.ContextKeyRegexFilterRules)) > 0 {
+		body, err = json.Marshal(request)
+	} else {
+		body, err = common.GetRequestBody(c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info.ApplyParamOverride(body)
+}
+
+func marshalUpstreamRequest(request any, info *relaycommon.RelayInfo) ([]byte, error) {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	if jsonData, err = info.ApplyParamOverride(jsonData); err != nil {
+		return nil, err
+	}
+	if common.DebugEnabled {
+		println("requestBody: ", string(jsonData))
+	}
+	return jsonData, nil
+}
+
+func doGeminiUpstreamRequest(c *gin.Context, adaptor channel.Adaptor, info *relaycommon.RelayInfo, body []byte) (*http.Response, *dto.OpenAIErrorWithStatusCode) {
+	resp, err := adaptor.DoRequest(c, info, bytes.NewBuffer(body))
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("上游请求失败: %v", err))
+		return nil, service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp == nil {
+		return nil, service.OpenAIErrorWrapper(fmt.Errorf("empty upstream response"), "empty_upstream_response", http.StatusInternalServerError)
+	}
+	httpResp := resp.(*http.Response)
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, service.RelayErrorHandler(httpResp, false)
+	}
+	return httpResp, nil
+}
+
+// geminiStreamWriter 按客户端要求的格式写出 Gemini 流式响应：alt=sse 时为 SSE，否则为一个逐步写出的 JSON 数组
+type geminiStreamWriter struct {
+	*helper.ResponseConvertWriter
+	sse   bool
+	count int
+}
+
+// newGeminiStreamWriter convert 把上游的一条 data 负载转换为 Gemini 响应，为 nil 时原样输出
+func newGeminiStreamWriter(c *gin.Context, convert func(data string) []byte) *geminiStreamWriter {
+	w := &geminiStreamWriter{sse: c.Query("alt") == "sse"}
+	w.ResponseConvertWriter = helper.NewResponseConvertWriter(c, true, func(data string) []byte {
+		if convert == nil {
+			return w.frame([]byte(data))
+		}
+		return w.frame(convert(data))
+	})
+	if !w.sse {
+		w.SetPassComments(false)
+		w.SetContentType("application/json")
+	}
+	return w
+}
+
+func (w *geminiStreamWriter) frame(payload []byte) []byte {
+	if len(payload) == 0 {
+		return nil
+	}
+	if w.sse {
+		return []byte("data: " + string(payload) + "\r\n\r\n")
+	}
+	prefix := ",\r\n"
+	if w.count == 0 {
+		prefix = "["
+	}
+	w.count++
+	return append([]byte(prefix), payload...)
+}
+
+// WriteResponse 写出一块 Gemini 响应
+func (w *geminiStreamWriter) WriteResponse(response *gemini.GeminiChatResponse) {
+	if response == nil {
+		return
+	}
+	payload, err := json.Marshal(response)
+	if err != nil {
+		common.SysError("error marshalling gemini stream response: " + err.Error())
+		return
+	}
+	w.WriteRaw(w.frame(payload))
+}
+
+// Finish 结束 JSON 数组
+func (w *geminiStreamWriter) Finish() {
+	if w.sse {
+		return
+	}
+	if w.count == 0 {
+		w.WriteRaw([]byte("[]"))
+		return
+	}
+	w.WriteRaw([]byte("]"))
+}
+
+func geminiGenerateContentHelper(c *gin.Context, relayInfo *relaycommon.RelayInfo) (openaiErr *dto.OpenAIErrorWithStatusCode) {
+	_, action := relayconstant.ParseGeminiModelAction(c.Request.URL.Path)
+	relayInfo.IsStream = action == relayconstant.GeminiActionStreamGenerateContent
+
+	geminiRequest, err := getAndValidateGeminiRequest(c)
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("getAndValidateGeminiRequest failed: %s", err.Error()))
+		return service.OpenAIErrorWrapperLocal(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+
+	if err := checkGeminiRequestRegexFilter(c, geminiRequest, relayInfo); err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "regex_filter_blocked", http.StatusBadRequest)
+	}
+
+	err = helper.ModelMappedHelper(c, relayInfo)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
+	}
+
+	native := isGeminiNativeChannel(relayInfo)
+	textRequest, err := gemini.GeminiRequest2OpenAI(geminiRequest)
+	if err != nil {
+		if !native {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusBadRequest)
+		}
+		// 透传渠道不依赖转换结果，仅影响 token 计算
+		textRequest = nil
+	}
+	if textRequest != nil {
+		textRequest.Model = relayInfo.UpstreamModelName
+		textRequest.Stream = relayInfo.IsStream
+	}
+
+	if setting.ShouldCheckPromptSensitive() {
+		var words []string
+		if textRequest != nil {
+			words, err = service.CheckSensitiveMessages(textRequest.Messages)
+		} else {
+			words, err = service.CheckSensitiveInput(geminiRequestText(geminiRequest))
+		}
+		if err != nil {
+			common.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(words, ", ")))
+			return service.OpenAIErrorWrapperLocal(err, "sensitive_words_detected", http.StatusBadRequest)
+		}
+	}
+
+	promptTokens, err := getGeminiPromptTokens(relayInfo, geminiRequest, textRequest)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
+	}
+	relayInfo.PromptTokens = promptTokens
+	c.Set("prompt_tokens", promptTokens)
+
+	priceData, err := helper.ModelPriceHelper(c, relayInfo, promptTokens, int(geminiRequest.GenerationConfig.MaxOutputTokens))
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
+	}
+
+	// pre-consume quota 预消耗配额
+	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, priceData.ShouldPreConsumedQuota, relayInfo)
+	if openaiErr != nil {
+		return openaiErr
+	}
+	defer func() {
+		if openaiErr != nil {
+			returnPreConsumedQuota(c, relayInfo, userQuota, preConsumedQuota)
+		}
+	}()
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+
+	var usage *dto.Usage
+	if native {
+		usage, openaiErr = relayGeminiNative(c, adaptor, relayInfo, geminiRequest)
+	} else {
+		usage, openaiErr = relayGeminiViaOpenAI(c, adaptor, relayInfo, textRequest)
+	}
+	if openaiErr != nil {
+		// reset status code 重置状态码
+		service.ResetStatusCode(openaiErr, c.GetString("status_code_mapping"))
+		return openaiErr
+	}
+	postConsumeQuota(c, relayInfo, usage, preConsumedQuota, userQuota, priceData, "")
+	return nil
+}
+
+// relayGeminiNative 将 generateContent 请求透传给 Gemini/Vertex 渠道
+func relayGeminiNative(c *gin.Context, adaptor channel.Adaptor, relayInfo *relaycommon.RelayInfo, geminiRequest *gemini.GeminiChatRequest) (*dto.Usage, *dto.OpenAIErrorWithStatusCode) {
+	relayInfo.RelayFormat = relaycommon.RelayFormatGemini
+	adaptor.Init(relayInfo)
+	body, err := geminiNativeRequestBody(c, geminiRequest, relayInfo)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(err, "get_request_body_failed", http.StatusInternalServerError)
+	}
+	httpResp, openaiErr := doGeminiUpstreamRequest(c, adaptor, relayInfo, body)
+	if openaiErr != nil {
+		return nil, openaiErr
+	}
+	if !relayInfo.IsStream {
+		return gemini.GeminiNativeHandler(c, httpResp, relayInfo)
+	}
+	writer := newGeminiStreamWriter(c, nil)
+	defer writer.Restore(c)
+	usage, openaiErr := gemini.GeminiNativeStreamHandler(c, httpResp, relayInfo)
+	if openaiErr != nil {
+		return nil, openaiErr
+	}
+	writer.Finish()
+	return usage, nil
+}
+
+// relayGeminiViaOpenAI 以 OpenAI Chat Completions 格式请求其他渠道，并把响应转换为 Gemini 格式
+func relayGeminiViaOpenAI(c *gin.Context, adaptor channel.Adaptor, relayInfo *relaycommon.RelayInfo, textRequest *dto.GeneralOpenAIRequest) (*dto.Usage, *dto.OpenAIErrorWithStatusCode) {
+	relayInfo.RelayMode = relayconstant.RelayModeChatCompletions
+	relayInfo.RequestURLPath = "/v1/chat/completions"
+	if relayInfo.IsStream && relayInfo.SupportStreamOptions {
+		textRequest.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+	adaptor.Init(relayInfo)
+	convertedRequest, err := adaptor.ConvertOpenAIRequest(c, relayInfo, textRequest)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	jsonData, err := marshalUpstreamRequest(convertedRequest, relayInfo)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+	}
+	httpResp, openaiErr := doGeminiUpstreamRequest(c, adaptor, relayInfo, jsonData)
+	if openaiErr != nil {
+		return nil, openaiErr
+	}
+	relayInfo.IsStream = relayInfo.IsStream || strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream")
+
+	if !relayInfo.IsStream {
+		writer := helper.NewResponseConvertWriter(c, false, nil)
+		usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+		writer.Restore(c)
+		if openaiErr != nil {
+			return nil, openaiErr
+		}
+		var openAIResponse dto.OpenAITextResponse
+		if err := common.DecodeJson(writer.Body(), &openAIResponse); err != nil {
+			return nil, service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+		}
+		c.Writer.Header().Del("Content-Length")
+		c.JSON(writer.StatusCode(), gemini.ResponseOpenAI2Gemini(&openAIResponse))
+		return usage.(*dto.Usage), nil
+	}
+
+	converter := gemini.NewOpenAIStreamConverter(relayInfo.UpstreamModelName)
+	writer := newGeminiStreamWriter(c, func(data string) []byte {
+		var chunk dto.ChatCompletionsStreamResponse
+		// [DONE] 等非 JSON 负载直接忽略
+		if err := common.DecodeJsonStr(data, &chunk); err != nil {
+			return nil
+		}
+		response := converter.Convert(&chunk)
+		if response == nil {
+			return nil
+		}
+		payload, err := json.Marshal(response)
+		if err != nil {
+			common.SysError("error marshalling gemini stream response: " + err.Error())
+			return nil
+		}
+		return payload
+	})
+	defer writer.Restore(c)
+	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	if openaiErr != nil {
+		return nil, openaiErr
+	}
+	writer.WriteResponse(converter.Finish(usage.(*dto.Usage)))
+	writer.Finish()
+	return usage.(*dto.Usage), nil
+}
+
+func geminiEmbedContentHelper(c *gin.Context, relayInfo *relaycommon.RelayInfo) (openaiErr *dto.OpenAIErrorWithStatusCode) {
+	embedRequest := &gemini.GeminiEmbeddingRequest{}
+	if err := common.UnmarshalBodyReusable(c, embedRequest); err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+	err := applyRegexFilter(c, relayInfo, embedRequest, func(scope *service.RegexFilterScope) {
+		applyGeminiContentRegexFilter(scope, &embedRequest.Content)
+	})
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "regex_filter_blocked", http.StatusBadRequest)
+	}
+	text := geminiContentText(&embedRequest.Content)
+	if text == "" {
+		return service.OpenAIErrorWrapperLocal(errors.New("field content is required"), "invalid_gemini_request", http.StatusBadRequest)
+	}
+
+	err = helper.ModelMappedHelper(c, relayInfo)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
+	}
+
+	if setting.ShouldCheckPromptSensitive() {
+		words, err := service.CheckSensitiveInput(text)
+		if err != nil {
+			common.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(words, ", ")))
+			return service.OpenAIErrorWrapperLocal(err, "sensitive_words_detected", http.StatusBadRequest)
+		}
+	}
+
+	promptTokens, _ := service.CountTokenInput(text, relayInfo.UpstreamModelName)
+	relayInfo.PromptTokens = promptTokens
+
+	priceData, err := helper.ModelPriceHelper(c, relayInfo, promptTokens, 0)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
+	}
+	// pre-consume quota 预消耗配额
+	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, priceData.ShouldPreConsumedQuota, relayInfo)
+	if openaiErr != nil {
+		return openaiErr
+	}
+	defer func() {
+		if openaiErr != nil {
+			returnPreConsumedQuota(c, relayInfo, userQuota, preConsumedQuota)
+		}
+	}()
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+
+	var usage *dto.Usage
+	if isGeminiNativeChannel(relayInfo) {
+		relayInfo.RelayFormat = relaycommon.RelayFormatGemini
+		adaptor.Init(relayInfo)
+		body, err := geminiNativeRequestBody(c, embedRequest, relayInfo)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "get_request_body_failed", http.StatusInternalServerError)
+		}
+		var httpResp *http.Response
+		httpResp, openaiErr = doGeminiUpstreamRequest(c, adaptor, relayInfo, body)
+		if openaiErr == nil {
+			usage, openaiErr = gemini.GeminiNativeHandler(c, httpResp, relayInfo)
+		}
+	} else {
+		usage, openaiErr = relayGeminiEmbeddingViaOpenAI(c, adaptor, relayInfo, embedRequest, text)
+	}
+	if openaiErr != nil {
+		// reset status code 重置状态码
+		service.ResetStatusCode(openaiErr, c.GetString("status_code_mapping"))
+		return openaiErr
+	}
+	postConsumeQuota(c, relayInfo, usage, preConsumedQuota, userQuota, priceData, "")
+	return nil
+}
+
+// relayGeminiEmbeddingViaOpenAI 以 OpenAI Embeddings 格式请求其他渠道，并把响应转换为 embedContent 格式
+func relayGeminiEmbeddingViaOpenAI(c *gin.Context, adaptor channel.Adaptor, relayInfo *relaycommon.RelayInfo, embedRequest *gemini.GeminiEmbeddingRequest, text string) (*dto.Usage, *dto.OpenAIErrorWithStatusCode) {
+	relayInfo.RelayMode = relayconstant.RelayModeEmbeddings
+	relayInfo.RequestURLPath = "/v1/embeddings"
+	adaptor.Init(relayInfo)
+	embeddingRequest := dto.EmbeddingRequest{
+		Model:      relayInfo.UpstreamModelName,
+		Input:      text,
+		Dimensions: embedRequest.OutputDimensionality,
+	}
+	convertedRequest, err := adaptor.ConvertEmbeddingRequest(c, relayInfo, embeddingRequest)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	jsonData, err := marshalUpstreamRequest(convertedRequest, relayInfo)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+	}
+	httpResp, openaiErr := doGeminiUpstreamRequest(c, adaptor, relayInfo, jsonData)
+	if openaiErr != nil {
+		return nil, openaiErr
+	}
+
+	writer := helper.NewResponseConvertWriter(c, false, nil)
+	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	writer.Restore(c)
+	if openaiErr != nil {
+		return nil, openaiErr
+	}
+	var embeddingResponse dto.OpenAIEmbeddingResponse
+	if err := common.DecodeJson(writer.Body(), &embeddingResponse); err != nil {
+		return nil, service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	geminiResponse := gemini.GeminiEmbeddingResponse{}
+	if len(embeddingResponse.Data) > 0 {
+		geminiResponse.Embedding.Values = embeddingResponse.Data[0].Embedding
+	}
+	c.Writer.Header().Del("Content-Length")
+	c.JSON(writer.StatusCode(), geminiResponse)
+	return usage.(*dto.Usage), nil
+}
+
+// geminiCountTokensHelper countTokens 不计费；透传渠道由上游计算，其他渠道在本地计算
+func geminiCountTokensHelper(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dto.OpenAIErrorWithStatusCode {
+	countRequest := &gemini.GeminiCountTokensRequest{}
+	if err := common.UnmarshalBodyReusable(c, countRequest); err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+	geminiRequest := countRequest.GenerateContentRequest
+	if geminiRequest == nil {
+		geminiRequest = &gemini.GeminiChatRequest{Contents: countRequest.Contents}
+	}
+	if len(geminiRequest.Contents) == 0 {
+		return service.OpenAIErrorWrapperLocal(errors.New("field contents is required"), "invalid_gemini_request", http.StatusBadRequest)
+	}
+
+	err := helper.ModelMappedHelper(c, relayInfo)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
+	}
+
+	if !isGeminiNativeChannel(relayInfo) {
+		textRequest, err := gemini.GeminiRequest2OpenAI(geminiRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusBadRequest)
+		}
+		textRequest.Model = relayInfo.UpstreamModelName
+		promptTokens, err := service.CountTokenChatRequest(relayInfo, *textRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
+		}
+		c.JSON(http.StatusOK, gemini.GeminiCountTokensResponse{TotalTokens: promptTokens})
+		return nil
+	}
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+	relayInfo.RelayFormat = relaycommon.RelayFormatGemini
+	adaptor.Init(relayInfo)
+	body, err := geminiNativeRequestBody(c, countRequest, relayInfo)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "get_request_body_failed", http.StatusInternalServerError)
+	}
+	httpResp, openaiErr := doGeminiUpstreamRequest(c, adaptor, relayInfo, body)
+	if openaiErr == nil {
+		_, openaiErr = gemini.GeminiNativeHandler(c, httpResp, relayInfo)
+	}
+	if openaiErr != nil {
+		// reset status code 重置状态码
+		service.ResetStatusCode(openaiErr, c.GetString("status_code_mapping"))
+	}
+	return openaiErr
+}
@@ -0,0 +1,61 @@
+package helper
+
+import (
+	"bytes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResponseCaptureWriter 在正常写出响应的同时保留一份副本，用于请求结束后写入响应缓存。
+// 副本超过 limit 字节后停止保留并标记为溢出，避免缓存过大的响应。
+type ResponseCaptureWriter struct {
+	gin.ResponseWriter
+	buffer   bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+// NewResponseCaptureWriter 替换 c.Writer，处理完成后需调用 Restore 恢复
+func NewResponseCaptureWriter(c *gin.Context, limit int) *ResponseCaptureWriter {
+	w := &ResponseCaptureWriter{
+		ResponseWriter: c.Writer,
+		limit:          limit,
+	}
+	c.Writer = w
+	return w
+}
+
+// Restore 恢复原始的 c.Writer
+func (w *ResponseCaptureWriter) Restore(c *gin.Context) {
+	c.Writer = w.ResponseWriter
+}
+
+// Body 返回保留的响应副本，溢出时返回 nil
+func (w *ResponseCaptureWriter) Body() []byte {
+	if w.overflow {
+		return nil
+	}
+	return w.buffer.Bytes()
+}
+
+func (w *ResponseCaptureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *ResponseCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *ResponseCaptureWriter) capture(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.buffer.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.buffer.Reset()
+		return
+	}
+	w.buffer.Write(data)
+}
@@ -0,0 +1,135 @@
+package helper
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResponseConvertWriter 拦截渠道处理器写出的 OpenAI 格式响应，用于转换为客户端请求的其他格式。
+// 非流式响应完整缓存在内存中，由调用方在处理器返回后读取并转换；
+// 流式响应按行解析 SSE，每条 data 负载交给 convert 转换后立即写出，注释行（如 PING）按 passComments 决定是否透传。
+type ResponseConvertWriter struct {
+	gin.ResponseWriter
+	stream       bool
+	status       int
+	buffer       bytes.Buffer
+	convert      func(data string) []byte
+	passComments bool
+	contentType  string
+}
+
+// NewResponseConvertWriter 替换 c.Writer，处理完成后需调用 Restore 恢复
+func NewResponseConvertWriter(c *gin.Context, stream bool, convert func(data string) []byte) *ResponseConvertWriter {
+	w := &ResponseConvertWriter{
+		ResponseWriter: c.Writer,
+		stream:         stream,
+		status:         http.StatusOK,
+		convert:        convert,
+		passComments:   true,
+	}
+	c.Writer = w
+	return w
+}
+
+// SetPassComments 设置流式响应中的 SSE 注释行是否透传给客户端
+func (w *ResponseConvertWriter) SetPassComments(pass bool) {
+	w.passComments = pass
+}
+
+// SetContentType 设置实际写出时使用的 Content-Type，覆盖渠道处理器设置的值
+func (w *ResponseConvertWriter) SetContentType(contentType string) {
+	w.contentType = contentType
+}
+
+// Restore 恢复原始的 c.Writer
+func (w *ResponseConvertWriter) Restore(c *gin.Context) {
+	c.Writer = w.ResponseWriter
+}
+
+// Body 返回缓存的非流式响应体
+func (w *ResponseConvertWriter) Body() []byte {
+	return w.buffer.Bytes()
+}
+
+// StatusCode 返回渠道处理器设置的状态码
+func (w *ResponseConvertWriter) StatusCode() int {
+	return w.status
+}
+
+// WriteRaw 直接写出已转换的数据
+func (w *ResponseConvertWriter) WriteRaw(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	if w.contentType != "" && !w.ResponseWriter.Written() {
+		w.ResponseWriter.Header().Set("Content-Type", w.contentType)
+	}
+	w.ResponseWriter.Header().Del("Content-Length")
+	_, _ = w.ResponseWriter.Write(data)
+	w.ResponseWriter.Flush()
+}
+
+func (w *ResponseConvertWriter) WriteHeader(code int) {
+	w.status = code
+	if w.stream {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *ResponseConvertWriter) WriteHeaderNow() {
+	if w.stream {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *ResponseConvertWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if w.stream {
+		w.processLines()
+	}
+	return len(data), nil
+}
+
+func (w *ResponseConvertWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *ResponseConvertWriter) Flush() {
+	if w.stream {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *ResponseConvertWriter) Written() bool {
+	return w.buffer.Len() > 0 || w.ResponseWriter.Written()
+}
+
+func (w *ResponseConvertWriter) Status() int {
+	return w.status
+}
+
+// processLines 处理缓冲区中完整的 SSE 行，不完整的行留待下次写入
+func (w *ResponseConvertWriter) processLines() {
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// 没有完整的行，放回缓冲区
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "data:"):
+			data := strings.TrimLeft(strings.TrimPrefix(line, "data:"), " ")
+			w.WriteRaw(w.convert(data))
+		case strings.HasPrefix(line, ":"):
+			if w.passComments {
+				w.WriteRaw([]byte(line + "\n\n"))
+			}
+		}
+	}
+}
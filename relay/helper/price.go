@@ -28,7 +28,11 @@ func (p PriceData) ToSetting() string {
 
 func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens int, maxTokens int) (PriceData, error) {
 	modelPrice, usePrice := operation_setting.GetModelPrice(info.OriginModelName, false)
-	groupRatio := setting.GetGroupRatio(info.Group)
+	groupRatio := setting.GetGroupRatio(info.BillingGroup())
+	// 批处理任务中的请求按模型的批处理折扣计费
+	if c.GetString(constant2.ContextKeyBatchId) != "" {
+		groupRatio *= operation_setting.GetBatchDiscountRatio(info.OriginModelName)
+	}
 	var preConsumedQuota int
 	var modelRatio float64
 	var completionRatio float64
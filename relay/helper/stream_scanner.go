@@ -3,6 +3,7 @@ package helper
 import (
 	"bufio"
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"tea-api/common"
@@ -36,6 +37,10 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 
 	defer resp.Body.Close()
 
+	// 扫描协程在超时后可能仍在运行，这里不替换 c.Request 的上下文
+	_, span := common.StartSpan(c.Request.Context(), "relay.StreamScannerHandler")
+	defer span.End()
+
 	streamingTimeout := time.Duration(constant.StreamingTimeout) * time.Second
 	if strings.HasPrefix(info.UpstreamModelName, "o") {
 		// twice timeout for thinking model
@@ -132,6 +137,7 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 				if !firstTokenSent {
 					info.SetFirstResponseTime()
 					firstTokenSent = true
+					span.AddEvent("first_token")
 				}
 
 				writeMutex.Lock() // Lock before writing
@@ -164,6 +170,7 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 	case <-ticker.C:
 		// 超时处理逻辑
 		common.LogError(c, "streaming timeout")
+		common.SetSpanError(span, errors.New("streaming timeout"))
 		common.SafeSendBool(stopChan, true)
 	case <-stopChan:
 		// 正常结束
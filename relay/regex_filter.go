@@ -0,0 +1,95 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/dto"
+	"tea-api/relay/channel/gemini"
+	relaycommon "tea-api/relay/common"
+	"tea-api/service"
+	"tea-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// applyRegexFilter 对请求内容执行正则过滤，apply 负责把 scope 应用到具体的请求字段。
+// 命中的规则写入上下文供错误日志使用，命中 block 规则时返回错误。
+// 透传模式下上游直接使用原始请求体，发生 mask 时用过滤后的请求重新生成请求体。
+func applyRegexFilter(c *gin.Context, info *relaycommon.RelayInfo, request any, apply func(scope *service.RegexFilterScope)) error {
+	scope := service.NewRegexFilterScope(info.Group, info.TokenId)
+	if scope == nil {
+		return nil
+	}
+	apply(scope)
+	if len(scope.Matches()) == 0 {
+		return nil
+	}
+	rules := scope.MatchedRules()
+	c.Set(constant.ContextKeyRegexFilterRules, rules)
+	common.LogWarn(c, fmt.Sprintf("regex filter rules matched: %s", strings.Join(rules, ", ")))
+
+	if blocked := scope.Blocked(); blocked != nil {
+		return fmt.Errorf("request blocked by content filter rule: %s", blocked.String())
+	}
+	if scope.Masked() && model_setting.GetGlobalSettings().PassThroughRequestEnabled {
+		body, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		c.Set(common.KeyRequestBody, body)
+	}
+	return nil
+}
+
+func checkRequestRegexFilter(c *gin.Context, textRequest *dto.GeneralOpenAIRequest, info *relaycommon.RelayInfo) error {
+	return applyRegexFilter(c, info, textRequest, func(scope *service.RegexFilterScope) {
+		scope.ApplyMessages(textRequest.Messages)
+		if textRequest.Prompt != nil {
+			textRequest.Prompt = scope.ApplyValue(textRequest.Prompt)
+		}
+		if textRequest.Input != nil {
+			textRequest.Input = scope.ApplyValue(textRequest.Input)
+		}
+	})
+}
+
+func checkClaudeRequestRegexFilter(c *gin.Context, textRequest *dto.ClaudeRequest, info *relaycommon.RelayInfo) error {
+	return applyRegexFilter(c, info, textRequest, func(scope *service.RegexFilterScope) {
+		if textRequest.System != nil {
+			textRequest.System = scope.ApplyValue(textRequest.System)
+		}
+		textRequest.Prompt = scope.ApplyText(textRequest.Prompt)
+		for i := range textRequest.Messages {
+			textRequest.Messages[i].Content = scope.ApplyValue(textRequest.Messages[i].Content)
+		}
+	})
+}
+
+func checkResponsesRegexFilter(c *gin.Context, req *dto.OpenAIResponsesRequest, info *relaycommon.RelayInfo) error {
+	return applyRegexFilter(c, info, req, func(scope *service.RegexFilterScope) {
+		req.Instructions = scope.ApplyRawJSON(req.Instructions)
+		req.Input = scope.ApplyRawJSON(req.Input)
+	})
+}
+
+func checkGeminiRequestRegexFilter(c *gin.Context, req *gemini.GeminiChatRequest, info *relaycommon.RelayInfo) error {
+	return applyRegexFilter(c, info, req, func(scope *service.RegexFilterScope) {
+		if req.SystemInstructions != nil {
+			applyGeminiContentRegexFilter(scope, req.SystemInstructions)
+		}
+		for i := range req.Contents {
+			applyGeminiContentRegexFilter(scope, &req.Contents[i])
+		}
+	})
+}
+
+func applyGeminiContentRegexFilter(scope *service.RegexFilterScope, content *gemini.GeminiChatContent) {
+	for i := range content.Parts {
+		if content.Parts[i].Text != "" {
+			content.Parts[i].Text = scope.ApplyText(content.Parts[i].Text)
+		}
+	}
+}
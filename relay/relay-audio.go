@@ -1,9 +1,11 @@
 package relay
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"io"
 	"net/http"
 	"tea-api/common"
 	"tea-api/dto"
@@ -106,6 +108,18 @@ func AudioHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 	if err != nil {
 		return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
 	}
+	// 语音合成的请求体为 JSON，转写与翻译为表单，只覆盖请求头
+	if relayInfo.RelayMode == relayconstant.RelayModeAudioSpeech && len(relayInfo.ParamOverride) > 0 {
+		jsonData, err := io.ReadAll(ioReader)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "read_request_body_failed", http.StatusInternalServerError)
+		}
+		jsonData, err = relayInfo.ApplyParamOverride(jsonData)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "param_override_failed", http.StatusInternalServerError)
+		}
+		ioReader = bytes.NewReader(jsonData)
+	}
 
 	resp, err := adaptor.DoRequest(c, relayInfo, ioReader)
 	if err != nil {
@@ -9,7 +9,6 @@ import (
 	"net/http"
 	"tea-api/common"
 	"tea-api/dto"
-	"tea-api/model"
 	relaycommon "tea-api/relay/common"
 	relayconstant "tea-api/relay/constant"
 	"tea-api/relay/helper"
@@ -160,7 +159,7 @@ func ImageHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		// reset model price
 		priceData.ModelPrice *= sizeRatio * qualityRatio * float64(imageRequest.N)
 		quota = int(priceData.ModelPrice * priceData.GroupRatio * common.QuotaPerUnit)
-		userQuota, err = model.GetUserQuota(relayInfo.UserId, false)
+		userQuota, err = service.GetUserAvailableQuota(relayInfo)
 		if err != nil {
 			return service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
 		}
@@ -188,6 +187,10 @@ func ImageHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		if err != nil {
 			return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
 		}
+		jsonData, err = relayInfo.ApplyParamOverride(jsonData)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "param_override_failed", http.StatusInternalServerError)
+		}
 		requestBody = bytes.NewBuffer(jsonData)
 	}
 
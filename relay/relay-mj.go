@@ -184,9 +184,9 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 			modelPrice = defaultPrice
 		}
 	}
-	groupRatio := setting.GetGroupRatio(group)
+	groupRatio := setting.GetGroupRatio(setting.GetFallbackBillingGroup(group, c.GetString(constant.ContextKeyUsingGroup)))
 	ratio := modelPrice * groupRatio
-	userQuota, err := model.GetUserQuota(userId, false)
+	userQuota, err := service.GetUserAvailableQuota(relayInfo)
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
@@ -208,11 +208,14 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 	if err != nil {
 		return &mjResp.Response
 	}
+	var midjourneyTask *model.Midjourney
 	defer func() {
 		if mjResp.StatusCode == 200 && mjResp.Response.Code == 1 {
 			err := service.PostConsumeQuota(relayInfo, quota, 0, true)
 			if err != nil {
 				common.SysError("error consuming token remain quota: " + err.Error())
+			} else {
+				recordMidjourneySubscriptionQuota(midjourneyTask, relayInfo)
 			}
 			//err = model.CacheUpdateUserQuota(userId)
 			if err != nil {
@@ -233,7 +236,7 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 		}
 	}()
 	midjResponse := &mjResp.Response
-	midjourneyTask := &model.Midjourney{
+	midjourneyTask = &model.Midjourney{
 		UserId:      userId,
 		Code:        midjResponse.Code,
 		Action:      constant.MjActionSwapFace,
@@ -268,6 +271,16 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 	return nil
 }
 
+// recordMidjourneySubscriptionQuota 记录任务预扣时从订阅扣除的额度，任务失败时按原路退回
+func recordMidjourneySubscriptionQuota(task *model.Midjourney, relayInfo *relaycommon.RelayInfo) {
+	if task == nil || task.Id == 0 || relayInfo.SubscriptionConsumed <= 0 {
+		return
+	}
+	if err := model.UpdateMidjourneySubscriptionQuota(task.Id, relayInfo.SubscriptionId, relayInfo.SubscriptionConsumed); err != nil {
+		common.SysError("error record midjourney subscription quota: " + err.Error())
+	}
+}
+
 func RelayMidjourneyTaskImageSeed(c *gin.Context) *dto.MidjourneyResponse {
 	taskId := c.Param("id")
 	userId := c.GetInt("id")
@@ -283,7 +296,7 @@ func RelayMidjourneyTaskImageSeed(c *gin.Context) *dto.MidjourneyResponse {
 		return service.MidjourneyErrorWrapper(constant.MjRequestError, "该任务所属渠道已被禁用")
 	}
 	c.Set("channel_id", originTask.ChannelId)
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.GetDefaultKey()))
 
 	requestURL := getMjRequestPath(c.Request.URL.String())
 	fullRequestURL := fmt.Sprintf("%s%s", channel.GetBaseURL(), requestURL)
@@ -453,7 +466,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 			}
 			c.Set("base_url", channel.GetBaseURL())
 			c.Set("channel_id", originTask.ChannelId)
-			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.GetDefaultKey()))
 			log.Printf("检测到此操作为放大、变换、重绘，获取原channel信息: %s,%s", strconv.Itoa(originTask.ChannelId), channel.GetBaseURL())
 		}
 		midjRequest.Prompt = originTask.Prompt
@@ -490,9 +503,9 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 			modelPrice = defaultPrice
 		}
 	}
-	groupRatio := setting.GetGroupRatio(group)
+	groupRatio := setting.GetGroupRatio(setting.GetFallbackBillingGroup(group, c.GetString(constant.ContextKeyUsingGroup)))
 	ratio := modelPrice * groupRatio
-	userQuota, err := model.GetUserQuota(userId, false)
+	userQuota, err := service.GetUserAvailableQuota(relayInfo)
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
@@ -514,11 +527,14 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 	}
 	midjResponse := &midjResponseWithStatus.Response
 
+	var midjourneyTask *model.Midjourney
 	defer func() {
 		if consumeQuota && midjResponseWithStatus.StatusCode == 200 {
 			err := service.PostConsumeQuota(relayInfo, quota, 0, true)
 			if err != nil {
 				common.SysError("error consuming token remain quota: " + err.Error())
+			} else {
+				recordMidjourneySubscriptionQuota(midjourneyTask, relayInfo)
 			}
 			if quota != 0 {
 				tokenName := c.GetString("token_name")
@@ -542,7 +558,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 	// 23-队列已满，请稍后再试 {"code":23,"description":"队列已满，请稍后尝试","result":"14001929738841620","properties":{"discordInstanceId":"1118138338562560102"}}
 	// 24-prompt包含敏感词 {"code":24,"description":"可能包含敏感词","properties":{"promptEn":"nude body","bannedWord":"nude"}}
 	// other: 提交错误，description为错误描述
-	midjourneyTask := &model.Midjourney{
+	midjourneyTask = &model.Midjourney{
 		UserId:      userId,
 		Code:        midjResponse.Code,
 		Action:      midjRequest.Action,
@@ -9,7 +9,9 @@ import (
 	"net/http"
 	"tea-api/common"
 	"tea-api/dto"
+	"tea-api/relay/channel"
 	relaycommon "tea-api/relay/common"
+	relayconstant "tea-api/relay/constant"
 	"tea-api/relay/helper"
 	"tea-api/service"
 	"tea-api/setting"
@@ -47,17 +49,6 @@ func getInputTokens(req *dto.OpenAIResponsesRequest, info *relaycommon.RelayInfo
 }
 
 func ResponsesHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
-	// 开始延迟监控
-	requestID := c.GetString(common.RequestIdKey)
-	common.StartLatencyTracking(requestID)
-
-	// 延迟监控：记录请求完成时间并清理
-	defer func() {
-		if metrics := common.RecordRequestComplete(requestID); metrics != nil {
-			common.LogLatencyMetrics(requestID, metrics)
-		}
-	}()
-
 	req, err := getAndValidateResponsesRequest(c)
 	if err != nil {
 		common.LogError(c, fmt.Sprintf("getAndValidateResponsesRequest error: %s", err.Error()))
@@ -74,16 +65,44 @@ func ResponsesHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 		}
 	}
 
+	if err := checkResponsesRegexFilter(c, req, relayInfo); err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "regex_filter_blocked", http.StatusBadRequest)
+	}
+
 	err = helper.ModelMappedHelper(c, relayInfo)
 	if err != nil {
 		return service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusBadRequest)
 	}
 	req.Model = relayInfo.UpstreamModelName
+
+	// 非 OpenAI 渠道转换为 Chat Completions 请求
+	native := isResponsesNativeChannel(relayInfo)
+	var history []dto.Message
+	var textRequest *dto.GeneralOpenAIRequest
+	if !native {
+		if req.PreviousResponseID != "" {
+			history, err = service.GetStoredResponseMessages(req.PreviousResponseID, relayInfo.UserId)
+			if err != nil {
+				return service.OpenAIErrorWrapperLocal(err, "previous_response_not_found", http.StatusBadRequest)
+			}
+		}
+		textRequest, err = service.ResponsesRequestToOpenAIRequest(req, history)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_error", http.StatusBadRequest)
+		}
+	}
+
 	if value, exists := c.Get("prompt_tokens"); exists {
 		promptTokens := value.(int)
 		relayInfo.SetPromptTokens(promptTokens)
 	} else {
-		promptTokens, err := getInputTokens(req, relayInfo)
+		var promptTokens int
+		if native {
+			promptTokens, err = getInputTokens(req, relayInfo)
+		} else {
+			promptTokens, err = service.CountTokenChatRequest(relayInfo, *textRequest)
+			relayInfo.SetPromptTokens(promptTokens)
+		}
 		if err != nil {
 			return service.OpenAIErrorWrapperLocal(err, "count_input_tokens_error", http.StatusBadRequest)
 		}
@@ -108,37 +127,56 @@ func ResponsesHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 	if adaptor == nil {
 		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
 	}
+
+	var usage *dto.Usage
+	if native {
+		usage, openaiErr = relayResponsesNative(c, adaptor, relayInfo, req)
+	} else {
+		usage, openaiErr = relayResponsesViaOpenAI(c, adaptor, relayInfo, req, textRequest, history)
+	}
+	if openaiErr != nil {
+		// reset status code 重置状态码
+		service.ResetStatusCode(openaiErr, c.GetString("status_code_mapping"))
+		return openaiErr
+	}
+
+	if strings.HasPrefix(relayInfo.OriginModelName, "gpt-4o-audio") {
+		service.PostAudioConsumeQuota(c, relayInfo, usage, preConsumedQuota, userQuota, priceData, "")
+	} else {
+		postConsumeQuota(c, relayInfo, usage, preConsumedQuota, userQuota, priceData, "")
+	}
+	return nil
+}
+
+// isResponsesNativeChannel 走 OpenAI 适配器的渠道（含 Azure 及其他 OpenAI 兼容渠道）原生支持 /v1/responses，
+// 其他渠道转换为 Chat Completions 请求
+func isResponsesNativeChannel(info *relaycommon.RelayInfo) bool {
+	return info.ApiType == relayconstant.APITypeOpenAI
+}
+
+// relayResponsesNative 将 /v1/responses 请求透传给 OpenAI/Azure 渠道
+func relayResponsesNative(c *gin.Context, adaptor channel.Adaptor, relayInfo *relaycommon.RelayInfo, req *dto.OpenAIResponsesRequest) (*dto.Usage, *dto.OpenAIErrorWithStatusCode) {
 	adaptor.Init(relayInfo)
 	var requestBody io.Reader
 	if model_setting.GetGlobalSettings().PassThroughRequestEnabled {
 		body, err := common.GetRequestBody(c)
 		if err != nil {
-			return service.OpenAIErrorWrapperLocal(err, "get_request_body_error", http.StatusInternalServerError)
+			return nil, service.OpenAIErrorWrapperLocal(err, "get_request_body_error", http.StatusInternalServerError)
 		}
 		requestBody = bytes.NewBuffer(body)
 	} else {
 		convertedRequest, err := adaptor.ConvertOpenAIResponsesRequest(c, relayInfo, *req)
 		if err != nil {
-			return service.OpenAIErrorWrapperLocal(err, "convert_request_error", http.StatusBadRequest)
+			return nil, service.OpenAIErrorWrapperLocal(err, "convert_request_error", http.StatusBadRequest)
 		}
 		jsonData, err := json.Marshal(convertedRequest)
 		if err != nil {
-			return service.OpenAIErrorWrapperLocal(err, "marshal_request_error", http.StatusInternalServerError)
+			return nil, service.OpenAIErrorWrapperLocal(err, "marshal_request_error", http.StatusInternalServerError)
 		}
 		// apply param override
-		if len(relayInfo.ParamOverride) > 0 {
-			reqMap := make(map[string]interface{})
-			err = json.Unmarshal(jsonData, &reqMap)
-			if err != nil {
-				return service.OpenAIErrorWrapperLocal(err, "param_override_unmarshal_failed", http.StatusInternalServerError)
-			}
-			for key, value := range relayInfo.ParamOverride {
-				reqMap[key] = value
-			}
-			jsonData, err = json.Marshal(reqMap)
-			if err != nil {
-				return service.OpenAIErrorWrapperLocal(err, "param_override_marshal_failed", http.StatusInternalServerError)
-			}
+		jsonData, err = relayInfo.ApplyParamOverride(jsonData)
+		if err != nil {
+			return nil, service.OpenAIErrorWrapperLocal(err, "param_override_failed", http.StatusInternalServerError)
 		}
 
 		if common.DebugEnabled {
@@ -147,39 +185,110 @@ func ResponsesHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 		requestBody = bytes.NewBuffer(jsonData)
 	}
 
-	// 延迟监控：记录上游连接开始
-	common.RecordUpstreamConnect(requestID)
-
 	var httpResp *http.Response
 	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
 	if err != nil {
-		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+		return nil, service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
 
-	statusCodeMappingStr := c.GetString("status_code_mapping")
-
 	if resp != nil {
 		httpResp = resp.(*http.Response)
 
 		if httpResp.StatusCode != http.StatusOK {
-			openaiErr = service.RelayErrorHandler(httpResp, false)
-			// reset status code 重置状态码
-			service.ResetStatusCode(openaiErr, statusCodeMappingStr)
-			return openaiErr
+			return nil, service.RelayErrorHandler(httpResp, false)
 		}
 	}
 
 	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
 	if openaiErr != nil {
-		// reset status code 重置状态码
-		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
-		return openaiErr
+		return nil, openaiErr
+	}
+	return usage.(*dto.Usage), nil
+}
+
+// relayResponsesViaOpenAI 以 Chat Completions 格式请求其他渠道，并把响应转换为 /v1/responses 格式；
+// store 为 true 时保存对话，供后续请求通过 previous_response_id 续接
+func relayResponsesViaOpenAI(c *gin.Context, adaptor channel.Adaptor, relayInfo *relaycommon.RelayInfo, req *dto.OpenAIResponsesRequest, textRequest *dto.GeneralOpenAIRequest, history []dto.Message) (*dto.Usage, *dto.OpenAIErrorWithStatusCode) {
+	textRequest.Model = relayInfo.UpstreamModelName
+	if relayInfo.IsStream && relayInfo.SupportStreamOptions {
+		textRequest.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+	relayInfo.RelayMode = relayconstant.RelayModeChatCompletions
+	relayInfo.RequestURLPath = "/v1/chat/completions"
+	adaptor.Init(relayInfo)
+	convertedRequest, err := adaptor.ConvertOpenAIRequest(c, relayInfo, textRequest)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(err, "convert_request_error", http.StatusBadRequest)
+	}
+	jsonData, err := marshalUpstreamRequest(convertedRequest, relayInfo)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(err, "marshal_request_error", http.StatusInternalServerError)
 	}
 
-	if strings.HasPrefix(relayInfo.OriginModelName, "gpt-4o-audio") {
-		service.PostAudioConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
+	httpResp, openaiErr := doUpstreamRequest(c, adaptor, relayInfo, jsonData)
+	if openaiErr != nil {
+		return nil, openaiErr
+	}
+
+	responseId := "resp_" + common.GetUUID()
+	var response *dto.OpenAIResponsesResponse
+	var usage *dto.Usage
+	if !relayInfo.IsStream {
+		writer := helper.NewResponseConvertWriter(c, false, nil)
+		usageAny, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+		writer.Restore(c)
+		if openaiErr != nil {
+			return nil, openaiErr
+		}
+		usage = usageAny.(*dto.Usage)
+		var openAIResponse dto.OpenAITextResponse
+		if err := common.DecodeJson(writer.Body(), &openAIResponse); err != nil {
+			return nil, service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+		}
+		openAIResponse.Usage = *usage
+		response = service.ResponseOpenAI2Responses(&openAIResponse, req, responseId)
+		c.Writer.Header().Del("Content-Length")
+		c.JSON(writer.StatusCode(), response)
 	} else {
-		postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
+		converter := service.NewResponsesStreamConverter(req, responseId)
+		writer := helper.NewResponseConvertWriter(c, true, func(data string) []byte {
+			var chunk dto.ChatCompletionsStreamResponse
+			// [DONE] 等非 JSON 负载直接忽略
+			if err := common.DecodeJsonStr(data, &chunk); err != nil {
+				return nil
+			}
+			return responsesStreamEvents(converter.Convert(&chunk))
+		})
+		usageAny, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+		if openaiErr != nil {
+			writer.Restore(c)
+			return nil, openaiErr
+		}
+		usage = usageAny.(*dto.Usage)
+		writer.WriteRaw(responsesStreamEvents(converter.Finish(usage)))
+		writer.Restore(c)
+		response = converter.Response()
 	}
-	return nil
+
+	if req.Store {
+		inputMessages, _ := service.ResponsesInputToMessages(req.Input)
+		if err := service.StoreResponse(response, relayInfo.UserId, append(history, inputMessages...)); err != nil {
+			common.LogError(c, "failed to store response: "+err.Error())
+		}
+	}
+	return usage, nil
+}
+
+// responsesStreamEvents 将 /v1/responses 流式事件编码为 SSE
+func responsesStreamEvents(events []dto.ResponsesStreamResponse) []byte {
+	var buf bytes.Buffer
+	for _, event := range events {
+		jsonData, err := json.Marshal(event)
+		if err != nil {
+			common.SysError("error marshalling responses stream event: " + err.Error())
+			continue
+		}
+		buf.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", event.Type, jsonData))
+	}
+	return buf.Bytes()
 }
@@ -26,6 +26,7 @@ import (
 	"github.com/shopspring/decimal"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func getAndValidateTextRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo) (*dto.GeneralOpenAIRequest, error) {
@@ -107,6 +108,10 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		}
 	}
 
+	if err := checkRequestRegexFilter(c, textRequest, relayInfo); err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "regex_filter_blocked", http.StatusBadRequest)
+	}
+
 	err = helper.ModelMappedHelper(c, relayInfo)
 	if err != nil {
 		return service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
@@ -120,7 +125,11 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		promptTokens = value.(int)
 		relayInfo.PromptTokens = promptTokens
 	} else {
+		span, endSpan := common.StartGinSpan(c, "relay.getPromptTokens")
 		promptTokens, err = getPromptTokens(textRequest, relayInfo)
+		span.SetAttributes(attribute.Int("prompt_tokens", promptTokens))
+		common.SetSpanError(span, err)
+		endSpan()
 		// count messages token error 计算promptTokens错误
 		if err != nil {
 			return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
@@ -165,6 +174,11 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		relayInfo.ShouldIncludeUsage = true
 	}
 
+	cacheKey, cacheEntry := lookupResponseCache(c, relayInfo, textRequest)
+	if cacheEntry != nil {
+		return relayResponseCacheHit(c, relayInfo, cacheEntry, service.WriteChatResponseCache, preConsumedQuota, userQuota, priceData)
+	}
+
 	adaptor := GetAdaptor(relayInfo.ApiType)
 	if adaptor == nil {
 		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
@@ -189,19 +203,9 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		}
 
 		// apply param override
-		if len(relayInfo.ParamOverride) > 0 {
-			reqMap := make(map[string]interface{})
-			err = json.Unmarshal(jsonData, &reqMap)
-			if err != nil {
-				return service.OpenAIErrorWrapperLocal(err, "param_override_unmarshal_failed", http.StatusInternalServerError)
-			}
-			for key, value := range relayInfo.ParamOverride {
-				reqMap[key] = value
-			}
-			jsonData, err = json.Marshal(reqMap)
-			if err != nil {
-				return service.OpenAIErrorWrapperLocal(err, "param_override_marshal_failed", http.StatusInternalServerError)
-			}
+		jsonData, err = relayInfo.ApplyParamOverride(jsonData)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "param_override_failed", http.StatusInternalServerError)
 		}
 
 		if common.DebugEnabled {
@@ -236,12 +240,25 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		return service.OpenAIErrorWrapper(fmt.Errorf("empty upstream response"), "empty_upstream_response", http.StatusInternalServerError)
 	}
 
+	var captureWriter *helper.ResponseCaptureWriter
+	if cacheKey != "" {
+		captureWriter = helper.NewResponseCaptureWriter(c, constant.ResponseCacheMaxBodyKB*1024)
+	}
 	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	if captureWriter != nil {
+		captureWriter.Restore(c)
+	}
 	if openaiErr != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
 		return openaiErr
 	}
+	if captureWriter != nil {
+		body, isStream := captureWriter.Body(), relayInfo.IsStream
+		saveResponseCache(cacheKey, func() (*service.ResponseCacheEntry, error) {
+			return service.BuildChatResponseCacheEntry(body, isStream, usage.(*dto.Usage))
+		})
+	}
 
 	if strings.HasPrefix(relayInfo.OriginModelName, "gpt-4o-audio") {
 		service.PostAudioConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
@@ -289,7 +306,7 @@ func checkRequestSensitive(textRequest *dto.GeneralOpenAIRequest, info *relaycom
 
 // 预扣费并返回用户剩余配额
 func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommon.RelayInfo) (int, int, *dto.OpenAIErrorWithStatusCode) {
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	userQuota, err := service.GetUserAvailableQuota(relayInfo)
 	if err != nil {
 		return 0, 0, service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -300,7 +317,8 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 		return 0, 0, service.OpenAIErrorWrapperLocal(fmt.Errorf("chat pre-consumed quota failed, user quota: %s, need quota: %s", common.FormatQuota(userQuota), common.FormatQuota(preConsumedQuota)), "insufficient_user_quota", http.StatusForbidden)
 	}
 	relayInfo.UserQuota = userQuota
-	if userQuota > 100*preConsumedQuota {
+	// 令牌设置了按时间窗口的额度上限时，需要预扣费以检查窗口额度
+	if userQuota > 100*preConsumedQuota && !c.GetBool(constant.ContextKeyTokenWindowLimited) {
 		// 用户额度充足，判断令牌额度是否充足
 		if !relayInfo.TokenUnlimited {
 			// 非无限令牌，判断令牌额度是否充足
@@ -323,7 +341,7 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 		if err != nil {
 			return 0, 0, service.OpenAIErrorWrapperLocal(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
-		err = model.DecreaseUserQuota(relayInfo.UserId, preConsumedQuota)
+		err = service.PreConsumeUserQuota(relayInfo, preConsumedQuota)
 		if err != nil {
 			return 0, 0, service.OpenAIErrorWrapperLocal(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 		}
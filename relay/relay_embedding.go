@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"tea-api/common"
+	"tea-api/constant"
 	"tea-api/dto"
 	relaycommon "tea-api/relay/common"
 	relayconstant "tea-api/relay/constant"
@@ -72,6 +73,11 @@ func EmbeddingHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 		}
 	}()
 
+	cacheKey, cacheEntry := lookupResponseCache(c, relayInfo, nil)
+	if cacheEntry != nil {
+		return relayResponseCacheHit(c, relayInfo, cacheEntry, service.WriteEmbeddingResponseCache, preConsumedQuota, userQuota, priceData)
+	}
+
 	adaptor := GetAdaptor(relayInfo.ApiType)
 	if adaptor == nil {
 		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
@@ -87,6 +93,10 @@ func EmbeddingHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 	if err != nil {
 		return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
 	}
+	jsonData, err = relayInfo.ApplyParamOverride(jsonData)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "param_override_failed", http.StatusInternalServerError)
+	}
 	requestBody := bytes.NewBuffer(jsonData)
 	statusCodeMappingStr := c.GetString("status_code_mapping")
 	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
@@ -105,12 +115,25 @@ func EmbeddingHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 		}
 	}
 
+	var captureWriter *helper.ResponseCaptureWriter
+	if cacheKey != "" {
+		captureWriter = helper.NewResponseCaptureWriter(c, constant.ResponseCacheMaxBodyKB*1024)
+	}
 	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	if captureWriter != nil {
+		captureWriter.Restore(c)
+	}
 	if openaiErr != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
 		return openaiErr
 	}
+	if captureWriter != nil {
+		body := captureWriter.Body()
+		saveResponseCache(cacheKey, func() (*service.ResponseCacheEntry, error) {
+			return service.BuildEmbeddingResponseCacheEntry(body, usage.(*dto.Usage))
+		})
+	}
 	postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
 	return nil
 }
@@ -81,6 +81,10 @@ func RerankHelper(c *gin.Context, relayMode int) (openaiErr *dto.OpenAIErrorWith
 	if err != nil {
 		return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
 	}
+	jsonData, err = relayInfo.ApplyParamOverride(jsonData)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "param_override_failed", http.StatusInternalServerError)
+	}
 	requestBody := bytes.NewBuffer(jsonData)
 	statusCodeMappingStr := c.GetString("status_code_mapping")
 	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
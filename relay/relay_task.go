@@ -49,9 +49,9 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 	}
 
 	// 预扣
-	groupRatio := setting.GetGroupRatio(relayInfo.Group)
+	groupRatio := setting.GetGroupRatio(relayInfo.BillingGroup())
 	ratio := modelPrice * groupRatio
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	userQuota, err := service.GetUserAvailableQuota(relayInfo.RelayInfo)
 	if err != nil {
 		taskErr = service.TaskErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 		return
@@ -83,7 +83,7 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 			}
 			c.Set("base_url", channel.GetBaseURL())
 			c.Set("channel_id", originTask.ChannelId)
-			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.GetDefaultKey()))
 
 			relayInfo.BaseUrl = channel.GetBaseURL()
 			relayInfo.ChannelId = originTask.ChannelId
@@ -109,6 +109,7 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 		return
 	}
 
+	var task *model.Task
 	defer func() {
 		// release quota
 		if relayInfo.ConsumeQuota && taskErr == nil {
@@ -116,6 +117,11 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 			err := service.PostConsumeQuota(relayInfo.RelayInfo, quota, 0, true)
 			if err != nil {
 				common.SysError("error consuming token remain quota: " + err.Error())
+			} else if task != nil && task.ID != 0 && relayInfo.SubscriptionConsumed > 0 {
+				// 记录从订阅扣除的额度，任务失败时按原路退回
+				if err = model.UpdateTaskSubscriptionQuota(task.ID, relayInfo.SubscriptionId, relayInfo.SubscriptionConsumed); err != nil {
+					common.SysError("error record task subscription quota: " + err.Error())
+				}
 			}
 			if quota != 0 {
 				tokenName := c.GetString("token_name")
@@ -137,7 +143,7 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 	}
 	relayInfo.ConsumeQuota = true
 	// insert task
-	task := model.InitTask(constant.TaskPlatformSuno, relayInfo)
+	task = model.InitTask(constant.TaskPlatformSuno, relayInfo)
 	task.TaskID = taskID
 	task.Quota = quota
 	task.Data = taskData
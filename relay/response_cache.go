@@ -0,0 +1,61 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/dto"
+	relaycommon "tea-api/relay/common"
+	"tea-api/relay/helper"
+	"tea-api/service"
+	"tea-api/setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// lookupResponseCache 查询响应缓存，返回缓存键与命中的条目；请求不参与缓存时缓存键为空
+func lookupResponseCache(c *gin.Context, relayInfo *relaycommon.RelayInfo, textRequest *dto.GeneralOpenAIRequest) (string, *service.ResponseCacheEntry) {
+	if !service.ShouldUseResponseCache(c, relayInfo, textRequest) {
+		return "", nil
+	}
+	cacheKey, err := service.ResponseCacheKey(c, relayInfo)
+	if err != nil {
+		common.LogWarn(c, "generate response cache key failed: "+err.Error())
+		return "", nil
+	}
+	if entry, ok := service.GetResponseCache(cacheKey); ok {
+		c.Header(constant.HeaderCache, "HIT")
+		return cacheKey, entry
+	}
+	c.Header(constant.HeaderCache, "MISS")
+	return cacheKey, nil
+}
+
+// relayResponseCacheHit 将缓存的响应写给客户端，并按缓存命中计费倍率结算
+func relayResponseCacheHit(c *gin.Context, relayInfo *relaycommon.RelayInfo, entry *service.ResponseCacheEntry,
+	write func(*gin.Context, *relaycommon.RelayInfo, *service.ResponseCacheEntry) error,
+	preConsumedQuota int, userQuota int, priceData helper.PriceData) *dto.OpenAIErrorWithStatusCode {
+	if err := write(c, relayInfo, entry); err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "write_response_cache_failed", http.StatusInternalServerError)
+	}
+	c.Set(constant.ContextKeyResponseCacheHit, true)
+	priceData.GroupRatio *= setting.ResponseCacheHitRatio
+	usage := entry.Usage
+	postConsumeQuota(c, relayInfo, &usage, preConsumedQuota, userQuota, priceData, fmt.Sprintf("命中响应缓存，计费倍率 %.2f", setting.ResponseCacheHitRatio))
+	return nil
+}
+
+// saveResponseCache 异步保存上游响应，build 返回错误时说明响应不适合缓存
+func saveResponseCache(cacheKey string, build func() (*service.ResponseCacheEntry, error)) {
+	gopool.Go(func() {
+		entry, err := build()
+		if err != nil {
+			return
+		}
+		if err := service.SetResponseCache(cacheKey, entry); err != nil {
+			common.SysError("save response cache failed: " + err.Error())
+		}
+	})
+}
@@ -41,7 +41,7 @@ func WssHelper(c *gin.Context, ws *websocket.Conn) (openaiErr *dto.OpenAIErrorWi
 	}
 	//relayInfo.UpstreamModelName = textRequest.Model
 	modelPrice, getModelPriceSuccess := operation_setting.GetModelPrice(relayInfo.UpstreamModelName, false)
-	groupRatio := setting.GetGroupRatio(relayInfo.Group)
+	groupRatio := setting.GetGroupRatio(relayInfo.BillingGroup())
 
 	var preConsumedQuota int
 	var ratio float64
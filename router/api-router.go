@@ -45,9 +45,11 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Register)
 			userRoute.POST("/login", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Login)
+			userRoute.POST("/login/2fa", middleware.CriticalRateLimit(), controller.LoginTwoFactor)
 			//userRoute.POST("/tokenlog", middleware.CriticalRateLimit(), controller.TokenLog)
 			userRoute.GET("/logout", controller.Logout)
 			userRoute.GET("/epay/notify", controller.EpayNotify)
+			userRoute.POST("/stripe/webhook", controller.StripeWebhook)
 			userRoute.GET("/groups", controller.GetUserGroups)
 
 			selfRoute := userRoute.Group("/")
@@ -61,10 +63,16 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/token", controller.GenerateAccessToken)
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.POST("/topup", controller.TopUp)
-				selfRoute.POST("/pay", controller.RequestEpay)
+				selfRoute.POST("/pay", controller.RequestPayment)
 				selfRoute.POST("/amount", controller.RequestAmount)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
 				selfRoute.PUT("/setting", controller.UpdateUserSetting)
+				selfRoute.GET("/2fa/status", controller.GetTwoFactorStatus)
+				selfRoute.POST("/2fa/setup", controller.SetupTwoFactor)
+				selfRoute.POST("/2fa/enable", controller.EnableTwoFactor)
+				selfRoute.POST("/2fa/disable", controller.DisableTwoFactor)
+				selfRoute.POST("/2fa/recovery_codes", controller.RegenerateTwoFactorRecoveryCodes)
+				selfRoute.POST("/2fa/verify", controller.VerifyTwoFactor)
 			}
 
 			adminRoute := userRoute.Group("/")
@@ -77,13 +85,14 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.POST("/manage", controller.ManageUser)
 				adminRoute.PUT("/", controller.UpdateUser)
 				adminRoute.DELETE("/:id", controller.DeleteUser)
+				adminRoute.DELETE("/:id/2fa", middleware.TwoFactorAuth(), controller.ResetUserTwoFactor)
 			}
 		}
 		optionRoute := apiRouter.Group("/option")
 		optionRoute.Use(middleware.RootAuth())
 		{
 			optionRoute.GET("/", controller.GetOptions)
-			optionRoute.PUT("/", controller.UpdateOption)
+			optionRoute.PUT("/", middleware.TwoFactorAuth(), controller.UpdateOption)
 			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
 		}
 		channelRoute := apiRouter.Group("/channel")
@@ -96,6 +105,12 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/:id", controller.GetChannel)
 			channelRoute.GET("/test", controller.TestAllChannels)
 			channelRoute.GET("/test/:id", controller.TestChannel)
+			channelRoute.GET("/:id/key", middleware.TwoFactorAuth(), controller.GetChannelKey)
+			channelRoute.GET("/:id/keys", controller.GetChannelKeys)
+			channelRoute.GET("/:id/keys/:index/test", controller.TestChannelKey)
+			channelRoute.POST("/:id/keys/:index/enable", controller.EnableChannelKey)
+			channelRoute.POST("/:id/keys/:index/disable", controller.DisableChannelKey)
+			channelRoute.POST("/:id/param_override/preview", controller.PreviewChannelParamOverride)
 			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
 			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
 			channelRoute.POST("/", controller.AddChannel)
@@ -111,6 +126,11 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.POST("/fetch_models", controller.FetchModels)
                 channelRoute.POST("/batch/tag", controller.BatchSetChannelTag)
                 channelRoute.GET("/stats", controller.GetChannelStats)
+                channelRoute.GET("/health", controller.GetChannelHealth)
+                channelRoute.GET("/weights", controller.GetChannelEffectiveWeights)
+                channelRoute.GET("/test_logs", controller.GetChannelTestLogs)
+                channelRoute.GET("/auto_test", controller.GetChannelAutoTestStatus)
+                channelRoute.POST("/health/reset/:id", controller.ResetChannelHealth)
         }
         tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
@@ -118,6 +138,7 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.GET("/", controller.GetAllTokens)
 			tokenRoute.GET("/search", controller.SearchTokens)
 			tokenRoute.GET("/:id", controller.GetToken)
+			tokenRoute.GET("/:id/usage", controller.GetTokenUsage)
 			tokenRoute.POST("/", controller.AddToken)
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
@@ -140,6 +161,8 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		logRoute.GET("/payload/:request_id", middleware.AdminAuth(), controller.GetPayloadCapture)
+		logRoute.GET("/self/payload/:request_id", middleware.UserAuth(), controller.GetUserPayloadCapture)
 
 		dataRoute := apiRouter.Group("/data")
 		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
@@ -174,6 +197,8 @@ func SetApiRouter(router *gin.Engine) {
 			securityRoute.GET("/config", controller.GetSecurityConfig)
 			securityRoute.PUT("/config", controller.UpdateSecurityConfig)
 			securityRoute.GET("/logs", controller.GetSecurityLogs)
+			securityRoute.GET("/logs/export", controller.ExportSecurityLogs)
+			securityRoute.DELETE("/logs", controller.DeleteHistorySecurityLogs)
 
 			// IP黑名单管理
 			securityRoute.GET("/blacklist", controller.GetBlacklist)
@@ -188,5 +213,41 @@ func SetApiRouter(router *gin.Engine) {
 			securityRoute.GET("/abnormal", controller.GetAbnormalDetectionConfig)
 			securityRoute.PUT("/abnormal", controller.UpdateAbnormalDetectionConfig)
 		}
+
+		// 延迟监控路由
+		latencyRoute := apiRouter.Group("/latency")
+		latencyRoute.Use(middleware.AdminAuth())
+		{
+			latencyRoute.GET("/stats", controller.GetLatencyStats)
+			latencyRoute.POST("/reset", controller.ResetLatencyStats)
+			latencyRoute.GET("/history", controller.GetLatencyHistory)
+			latencyRoute.GET("/config", controller.GetLatencyOptimizationConfig)
+			// 修改运行时配置仅限 root 用户并需要两步验证
+			latencyRoute.PUT("/config", middleware.RootAuth(), middleware.TwoFactorAuth(), controller.UpdateLatencyOptimizationConfig)
+		}
+
+		// 充值订单查询与退款
+		paymentRoute := apiRouter.Group("/payment")
+		paymentRoute.Use(middleware.AdminAuth())
+		{
+			paymentRoute.GET("/order/:trade_no", controller.GetPaymentOrder)
+			// 退款会原路退回资金，仅限 root 用户并需要两步验证
+			paymentRoute.POST("/order/:trade_no/refund", middleware.RootAuth(), middleware.TwoFactorAuth(), controller.RefundPaymentOrder)
+		}
+
+		// 订阅套餐与用户订阅
+		subscriptionRoute := apiRouter.Group("/subscription")
+		subscriptionRoute.GET("/plans", middleware.UserAuth(), controller.GetUserSubscriptionPlans)
+		subscriptionRoute.GET("/self", middleware.UserAuth(), controller.GetSelfSubscription)
+		subscriptionRoute.Use(middleware.AdminAuth())
+		{
+			subscriptionRoute.GET("/plan", controller.GetAllSubscriptionPlans)
+			subscriptionRoute.POST("/plan", controller.AddSubscriptionPlan)
+			subscriptionRoute.PUT("/plan", controller.UpdateSubscriptionPlan)
+			subscriptionRoute.DELETE("/plan/:id", controller.DeleteSubscriptionPlan)
+			subscriptionRoute.GET("/", controller.GetAllSubscriptions)
+			subscriptionRoute.POST("/", controller.GrantSubscription)
+			subscriptionRoute.POST("/:id/cancel", controller.CancelSubscription)
+		}
 	}
 }
@@ -0,0 +1,38 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"tea-api/common"
+	"tea-api/controller"
+	"tea-api/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewBatchRelayHandler 批处理任务使用的内部路由，只注册批处理支持的接口，
+// 与对外的中转路由使用相同的令牌校验、内容检查和渠道分发，但不经过基于 IP 的限流与异常检测
+func NewBatchRelayHandler() http.Handler {
+	server := gin.New()
+	server.Use(gin.CustomRecovery(func(c *gin.Context, err any) {
+		common.SysError(fmt.Sprintf("panic detected in batch request: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"message": fmt.Sprintf("Panic detected, error: %v", err),
+				"type":    "new_api_panic",
+			},
+		})
+	}))
+	server.Use(middleware.RequestId())
+	server.Use(middleware.RequestSizeLimit())
+	server.Use(middleware.BatchRequest())
+	relayRouter := server.Group("/v1")
+	relayRouter.Use(middleware.TokenAuth(), middleware.Distribute())
+	{
+		relayRouter.POST("/chat/completions", controller.Relay)
+		relayRouter.POST("/completions", controller.Relay)
+		relayRouter.POST("/embeddings", controller.Relay)
+		relayRouter.POST("/responses", controller.Relay)
+	}
+	return server
+}
@@ -0,0 +1,20 @@
+package router
+
+import (
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetMetricsRouter(router *gin.Engine) {
+	if !constant.MetricsEnabled {
+		return
+	}
+	if constant.MetricsToken == "" {
+		common.SysError("METRICS_ENABLED is set but METRICS_TOKEN is empty, /metrics endpoint is not registered")
+		return
+	}
+	router.GET("/metrics", middleware.MetricsAuth(), gin.WrapH(common.MetricsHandler()))
+}
@@ -36,7 +36,9 @@ func SetRelayRouter(router *gin.Engine) {
 		//http router
 		httpRouter := relayV1Router.Group("")
 		httpRouter.Use(middleware.Distribute())
+		httpRouter.Use(middleware.PayloadCapture())
 		httpRouter.POST("/messages", controller.RelayClaude)
+		httpRouter.POST("/messages/count_tokens", controller.RelayClaude)
 		httpRouter.POST("/completions", controller.Relay)
 		httpRouter.POST("/chat/completions", controller.Relay)
 		httpRouter.POST("/edits", controller.Relay)
@@ -49,11 +51,6 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/audio/translations", controller.Relay)
 		httpRouter.POST("/audio/speech", controller.Relay)
 		httpRouter.POST("/responses", controller.Relay)
-		httpRouter.GET("/files", controller.RelayNotImplemented)
-		httpRouter.POST("/files", controller.RelayNotImplemented)
-		httpRouter.DELETE("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id/content", controller.RelayNotImplemented)
 		httpRouter.POST("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes/:id", controller.RelayNotImplemented)
@@ -64,6 +61,35 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/rerank", controller.Relay)
 	}
 
+	// Gemini 原生接口，路径形如 /v1beta/models/{model}:generateContent
+	geminiRouter := router.Group("/v1beta/models")
+	geminiRouter.Use(middleware.TokenAuth())
+	geminiRouter.Use(middleware.ModelRequestRateLimit())
+	geminiRouter.Use(middleware.Distribute())
+	geminiRouter.Use(middleware.PayloadCapture())
+	{
+		geminiRouter.POST("/:model", controller.Relay)
+	}
+
+	// Files 与 Batch API 由网关自身实现，不转发到上游渠道
+	filesRouter := router.Group("/v1/files")
+	filesRouter.Use(middleware.TokenAuth())
+	{
+		filesRouter.POST("", controller.UploadFile)
+		filesRouter.GET("", controller.ListFiles)
+		filesRouter.GET("/:id", controller.RetrieveFile)
+		filesRouter.DELETE("/:id", controller.DeleteFile)
+		filesRouter.GET("/:id/content", controller.RetrieveFileContent)
+	}
+	batchesRouter := router.Group("/v1/batches")
+	batchesRouter.Use(middleware.TokenAuth())
+	{
+		batchesRouter.POST("", controller.CreateBatch)
+		batchesRouter.GET("", controller.ListBatches)
+		batchesRouter.GET("/:id", controller.RetrieveBatch)
+		batchesRouter.POST("/:id/cancel", controller.CancelBatch)
+	}
+
 	relayMjRouter := router.Group("/mj")
 	registerMjRouterGroup(relayMjRouter)
 
@@ -0,0 +1,427 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/dto"
+	"tea-api/model"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	batchPollInterval     = 10 * time.Second
+	batchProgressInterval = 5 * time.Second
+	// 校验失败时最多返回的错误条数
+	batchMaxValidationErrors = 100
+)
+
+type batchContextKey struct{}
+
+// WithBatchId 标记请求来自批处理任务，只能由后台任务设置，客户端无法伪造
+func WithBatchId(ctx context.Context, batchId string) context.Context {
+	return context.WithValue(ctx, batchContextKey{}, batchId)
+}
+
+// GetBatchIdFromContext 返回请求所属的批处理任务 ID，不是批处理请求时返回空字符串
+func GetBatchIdFromContext(ctx context.Context) string {
+	batchId, _ := ctx.Value(batchContextKey{}).(string)
+	return batchId
+}
+
+// NewBatchId 生成 Batch API 的任务 ID
+func NewBatchId() string {
+	return "batch_" + common.GetRandomString(24)
+}
+
+// ParseBatchInput 解析并校验批处理输入文件，每行都必须是请求 endpoint 的 POST 请求
+func ParseBatchInput(content []byte, endpoint string) ([]*dto.BatchRequestLine, []dto.BatchError) {
+	var lines []*dto.BatchRequestLine
+	var batchErrors []dto.BatchError
+	addError := func(lineNo int, code string, message string) {
+		if len(batchErrors) < batchMaxValidationErrors {
+			batchErrors = append(batchErrors, dto.BatchError{Code: code, Message: message, Line: common.GetPointer[int](lineNo)})
+		}
+	}
+	customIds := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), len(content)+1)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var line dto.BatchRequestLine
+		if err := common.DecodeJsonStr(text, &line); err != nil {
+			addError(lineNo, "invalid_json_line", "This line is not parseable as valid JSON.")
+			continue
+		}
+		if line.CustomId == "" {
+			addError(lineNo, "missing_required_parameter", "The custom_id parameter is required.")
+			continue
+		}
+		if customIds[line.CustomId] {
+			addError(lineNo, "duplicate_custom_id", fmt.Sprintf("The custom_id '%s' is duplicated.", line.CustomId))
+			continue
+		}
+		customIds[line.CustomId] = true
+		if line.Method != http.MethodPost {
+			addError(lineNo, "invalid_method", "Only the POST method is supported.")
+			continue
+		}
+		if line.Url != endpoint {
+			addError(lineNo, "mismatched_endpoint", fmt.Sprintf("The url '%s' does not match the batch endpoint '%s'.", line.Url, endpoint))
+			continue
+		}
+		var body struct {
+			Stream bool `json:"stream"`
+		}
+		if len(line.Body) == 0 || line.Body[0] != '{' || common.DecodeJson(line.Body, &body) != nil {
+			addError(lineNo, "invalid_request", "The body must be a JSON object.")
+			continue
+		}
+		if body.Stream {
+			addError(lineNo, "invalid_request", "Streaming is not supported in batch requests.")
+			continue
+		}
+		lines = append(lines, &line)
+	}
+	if err := scanner.Err(); err != nil {
+		addError(lineNo+1, "invalid_file", err.Error())
+	}
+	if len(batchErrors) == 0 {
+		if len(lines) == 0 {
+			batchErrors = append(batchErrors, dto.BatchError{Code: "empty_file", Message: "The input file contains no requests."})
+		} else if constant.BatchMaxRequests > 0 && len(lines) > constant.BatchMaxRequests {
+			batchErrors = append(batchErrors, dto.BatchError{Code: "too_many_requests", Message: fmt.Sprintf("The input file contains more than %d requests.", constant.BatchMaxRequests)})
+		}
+	}
+	return lines, batchErrors
+}
+
+// BatchErrors2JSONString 将错误列表序列化后保存到 Batch.Errors
+func BatchErrors2JSONString(batchErrors []dto.BatchError) string {
+	jsonBytes, err := json.Marshal(dto.BatchErrors{Object: "list", Data: batchErrors})
+	if err != nil {
+		common.SysError("error marshalling batch errors: " + err.Error())
+		return ""
+	}
+	return string(jsonBytes)
+}
+
+var (
+	batchRelayHandler  http.Handler
+	runningBatches     = make(map[string]bool)
+	runningBatchesLock sync.Mutex
+)
+
+// RunBatchWorker 在主节点上轮询待执行的批处理任务，handler 是只包含中转路由的内部 http.Handler
+func RunBatchWorker(handler http.Handler) {
+	batchRelayHandler = handler
+	interrupted := BatchErrors2JSONString([]dto.BatchError{{Code: "batch_interrupted", Message: "The batch was interrupted by a gateway restart."}})
+	if err := model.FailInterruptedBatches(interrupted); err != nil {
+		common.SysError("failed to mark interrupted batches: " + err.Error())
+	}
+	for {
+		dispatchBatches()
+		time.Sleep(batchPollInterval)
+	}
+}
+
+func dispatchBatches() {
+	runningBatchesLock.Lock()
+	defer runningBatchesLock.Unlock()
+	free := constant.BatchMaxRunning - len(runningBatches)
+	if free <= 0 {
+		return
+	}
+	batches, err := model.GetBatchesByStatus(constant.BatchStatusValidating, free+len(runningBatches))
+	if err != nil {
+		common.SysError("failed to get pending batches: " + err.Error())
+		return
+	}
+	for _, batch := range batches {
+		if free <= 0 {
+			break
+		}
+		if runningBatches[batch.Id] {
+			continue
+		}
+		runningBatches[batch.Id] = true
+		free--
+		batch := batch
+		gopool.Go(func() {
+			defer func() {
+				if r := recover(); r != nil {
+					common.SysError(fmt.Sprintf("batch %s panic: %v", batch.Id, r))
+				}
+				runningBatchesLock.Lock()
+				delete(runningBatches, batch.Id)
+				runningBatchesLock.Unlock()
+			}()
+			runBatch(batch)
+		})
+	}
+}
+
+func failBatch(batch *model.Batch, from []string, batchErrors []dto.BatchError) {
+	_, err := model.UpdateBatchStatus(batch.Id, from, constant.BatchStatusFailed, map[string]interface{}{
+		"failed_at": common.GetTimestamp(),
+		"errors":    BatchErrors2JSONString(batchErrors),
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+	}
+}
+
+func runBatch(batch *model.Batch) {
+	ctx := context.Background()
+	validating := []string{constant.BatchStatusValidating}
+	inputFile, err := model.GetUserFileById(batch.InputFileId, batch.UserId)
+	if err != nil {
+		failBatch(batch, validating, []dto.BatchError{{Code: "file_not_found", Message: "The input file was not found."}})
+		return
+	}
+	content, err := ReadStorageFile(ctx, inputFile.StorageKey)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to read batch input file %s: %s", inputFile.Id, err.Error()))
+		failBatch(batch, validating, []dto.BatchError{{Code: "file_read_error", Message: "Failed to read the input file."}})
+		return
+	}
+	lines, batchErrors := ParseBatchInput(content, batch.Endpoint)
+	if len(batchErrors) > 0 {
+		failBatch(batch, validating, batchErrors)
+		return
+	}
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		failBatch(batch, validating, []dto.BatchError{{Code: "token_not_found", Message: "The API key used to create the batch no longer exists."}})
+		return
+	}
+	ok, err := model.UpdateBatchStatus(batch.Id, validating, constant.BatchStatusInProgress, map[string]interface{}{
+		"in_progress_at": common.GetTimestamp(),
+		"request_total":  len(lines),
+	})
+	if err != nil || !ok {
+		// 校验期间任务被取消
+		return
+	}
+
+	executor := &batchExecutor{batch: batch, tokenKey: token.Key, lines: lines}
+	stopCode := executor.run()
+
+	from := []string{constant.BatchStatusInProgress, constant.BatchStatusCancelling}
+	if ok, err = model.UpdateBatchStatus(batch.Id, from, constant.BatchStatusFinalizing, map[string]interface{}{
+		"finalizing_at":     common.GetTimestamp(),
+		"request_completed": executor.completed.Load(),
+		"request_failed":    executor.failed.Load(),
+	}); err != nil || !ok {
+		return
+	}
+	fields := map[string]interface{}{}
+	output, errorOutput := executor.output()
+	if output.Len() > 0 {
+		file, err := SaveUserFile(ctx, batch.UserId, fmt.Sprintf("%s_output.jsonl", batch.Id), constant.FilePurposeBatchOutput, bytes.NewReader(output.Bytes()), int64(output.Len()))
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to save batch %s output: %s", batch.Id, err.Error()))
+		} else {
+			fields["output_file_id"] = file.Id
+		}
+	}
+	if errorOutput.Len() > 0 {
+		file, err := SaveUserFile(ctx, batch.UserId, fmt.Sprintf("%s_error.jsonl", batch.Id), constant.FilePurposeBatchOutput, bytes.NewReader(errorOutput.Bytes()), int64(errorOutput.Len()))
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to save batch %s errors: %s", batch.Id, err.Error()))
+		} else {
+			fields["error_file_id"] = file.Id
+		}
+	}
+
+	status := constant.BatchStatusCompleted
+	now := common.GetTimestamp()
+	switch stopCode {
+	case "batch_cancelled":
+		status = constant.BatchStatusCancelled
+		fields["cancelled_at"] = now
+	case "batch_expired":
+		status = constant.BatchStatusExpired
+		fields["expired_at"] = now
+	default:
+		fields["completed_at"] = now
+	}
+	if _, err = model.UpdateBatchStatus(batch.Id, []string{constant.BatchStatusFinalizing}, status, fields); err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+	}
+}
+
+// batchExecutor 以有限并发将每行请求交给内部中转路由执行，计费与渠道选择均由中转流程完成
+type batchExecutor struct {
+	batch     *model.Batch
+	tokenKey  string
+	lines     []*dto.BatchRequestLine
+	results   []*dto.BatchResponseLine
+	completed atomic.Int64
+	failed    atomic.Int64
+}
+
+// run 执行全部请求，被取消或超过完成时限时返回对应的错误码
+func (e *batchExecutor) run() string {
+	e.results = make([]*dto.BatchResponseLine, len(e.lines))
+	stop := make(chan struct{})
+	var stopCode atomic.Value
+	stopOnce := sync.Once{}
+	stopWith := func(code string) {
+		stopOnce.Do(func() {
+			stopCode.Store(code)
+			close(stop)
+		})
+	}
+
+	// 定时保存进度，并检查任务是否被取消或已超过完成时限
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(batchProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := model.UpdateBatchProgress(e.batch.Id, int(e.completed.Load()), int(e.failed.Load())); err != nil {
+					common.SysError(fmt.Sprintf("failed to update batch %s progress: %s", e.batch.Id, err.Error()))
+				}
+				if status, err := model.GetBatchStatus(e.batch.Id); err == nil && status == constant.BatchStatusCancelling {
+					stopWith("batch_cancelled")
+				}
+				if e.batch.ExpiresAt > 0 && common.GetTimestamp() >= e.batch.ExpiresAt {
+					stopWith("batch_expired")
+				}
+			}
+		}
+	}()
+
+	concurrency := constant.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				e.results[index] = e.execute(e.lines[index])
+			}
+		}()
+	}
+dispatch:
+	for i := range e.lines {
+		select {
+		case <-stop:
+			break dispatch
+		case indexes <- i:
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	close(done)
+
+	// 全部请求都已执行时，即使随后收到取消也视为已完成
+	code, _ := stopCode.Load().(string)
+	stopped := false
+	for i, result := range e.results {
+		if result != nil {
+			continue
+		}
+		// 未执行的请求计入失败并写入错误文件
+		stopped = true
+		e.results[i] = &dto.BatchResponseLine{
+			Id:       "batch_req_" + common.GetRandomString(24),
+			CustomId: e.lines[i].CustomId,
+			Error:    &dto.BatchLineError{Code: code, Message: "This request could not be executed before the batch was stopped."},
+		}
+		e.failed.Add(1)
+	}
+	if !stopped {
+		return ""
+	}
+	return code
+}
+
+// execute 构造内部请求并交给中转路由，与客户端直接调用使用相同的令牌、分组与渠道选择逻辑
+func (e *batchExecutor) execute(line *dto.BatchRequestLine) *dto.BatchResponseLine {
+	result := &dto.BatchResponseLine{
+		Id:       "batch_req_" + common.GetRandomString(24),
+		CustomId: line.CustomId,
+	}
+	req, err := http.NewRequestWithContext(WithBatchId(context.Background(), e.batch.Id), http.MethodPost, line.Url, bytes.NewReader(line.Body))
+	if err != nil {
+		result.Error = &dto.BatchLineError{Code: "invalid_request", Message: err.Error()}
+		e.failed.Add(1)
+		return result
+	}
+	req.Header.Set("Authorization", "Bearer sk-"+e.tokenKey)
+	req.Header.Set("Content-Type", "application/json")
+	// 沿用创建任务时的客户端 IP，使令牌的 IP 限制依然生效
+	if e.batch.ClientIp != "" {
+		req.RemoteAddr = net.JoinHostPort(e.batch.ClientIp, "0")
+	}
+
+	recorder := httptest.NewRecorder()
+	batchRelayHandler.ServeHTTP(recorder, req)
+	body := recorder.Body.Bytes()
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(body))
+	}
+	result.Response = &dto.BatchLineResponse{
+		StatusCode: recorder.Code,
+		RequestId:  recorder.Header().Get(common.RequestIdKey),
+		Body:       body,
+	}
+	if recorder.Code >= http.StatusOK && recorder.Code < http.StatusMultipleChoices {
+		e.completed.Add(1)
+	} else {
+		e.failed.Add(1)
+	}
+	return result
+}
+
+// output 按输入顺序生成输出文件与错误文件的内容
+func (e *batchExecutor) output() (*bytes.Buffer, *bytes.Buffer) {
+	output := &bytes.Buffer{}
+	errorOutput := &bytes.Buffer{}
+	for _, result := range e.results {
+		if result == nil {
+			continue
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			common.SysError("error marshalling batch result: " + err.Error())
+			continue
+		}
+		if result.Error == nil && result.Response.StatusCode >= http.StatusOK && result.Response.StatusCode < http.StatusMultipleChoices {
+			output.Write(data)
+			output.WriteByte('\n')
+		} else {
+			errorOutput.Write(data)
+			errorOutput.WriteByte('\n')
+		}
+	}
+	return output, errorOutput
+}
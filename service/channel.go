@@ -8,6 +8,7 @@ import (
 	"tea-api/model"
 	"tea-api/setting/operation_setting"
 	"strings"
+	"time"
 )
 
 func formatNotifyType(channelId int, status int) string {
@@ -33,6 +34,32 @@ func EnableChannel(channelId int, channelName string) {
 	}
 }
 
+// DisableChannelKey 禁用多密钥渠道中的单个密钥，当所有密钥都被禁用时禁用整个渠道
+func DisableChannelKey(channelId int, channelName string, keyIndex int, reason string) {
+	enabled, err := model.UpdateChannelKeyStatus(channelId, keyIndex, common.ChannelStatusAutoDisabled, reason)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to disable key #%d of channel #%d: %s", keyIndex, channelId, err.Error()))
+		return
+	}
+	common.SysLog(fmt.Sprintf("key #%d of channel #%d disabled, %d keys remaining: %s", keyIndex, channelId, enabled, reason))
+	if enabled == 0 {
+		DisableChannel(channelId, channelName, "所有密钥均已被禁用，最后一个密钥的禁用原因："+reason)
+	}
+}
+
+// EnableChannelKey 启用多密钥渠道中的单个密钥，渠道因密钥耗尽被自动禁用时一并启用
+func EnableChannelKey(channelId int, channelName string, keyIndex int) error {
+	_, err := model.UpdateChannelKeyStatus(channelId, keyIndex, common.ChannelStatusEnabled, "")
+	if err != nil {
+		return err
+	}
+	channel, err := model.GetChannelById(channelId, false)
+	if err == nil && channel.Status == common.ChannelStatusAutoDisabled {
+		EnableChannel(channelId, channelName)
+	}
+	return nil
+}
+
 func ShouldDisableChannel(channelType int, err *dto.OpenAIErrorWithStatusCode) bool {
 	if !common.AutomaticDisableChannelEnabled {
 		return false
@@ -98,3 +125,28 @@ func ShouldEnableChannel(err error, openaiWithStatusErr *dto.OpenAIErrorWithStat
 	}
 	return true
 }
+
+// ChannelAutoTestDelay 计算渠道下一次自动测试的间隔，被自动禁用的渠道按连续失败次数指数退避，
+// 最长不超过 MaxBackoffMinutes
+func ChannelAutoTestDelay(interval time.Duration, status int, consecutiveFailures int) time.Duration {
+	if status != common.ChannelStatusAutoDisabled || consecutiveFailures <= 1 {
+		return interval
+	}
+	maxBackoff := time.Duration(operation_setting.GetChannelAutoTestSetting().MaxBackoffMinutes) * time.Minute
+	delay := interval
+	for i := 1; i < consecutiveFailures; i++ {
+		delay *= 2
+		if maxBackoff > 0 && delay >= maxBackoff {
+			return max(maxBackoff, interval)
+		}
+	}
+	return delay
+}
+
+// ShouldAutoEnableChannel 被自动禁用的渠道连续通过足够次数的自动测试后才重新启用，避免渠道反复切换状态
+func ShouldAutoEnableChannel(err error, openaiWithStatusErr *dto.OpenAIErrorWithStatusCode, status int, consecutivePasses int) bool {
+	if !ShouldEnableChannel(err, openaiWithStatusErr, status) {
+		return false
+	}
+	return consecutivePasses >= max(operation_setting.GetChannelAutoTestSetting().EnablePassThreshold, 1)
+}
@@ -1,81 +1,524 @@
 package service
 
 import (
-	"math/rand"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/dto"
 	"tea-api/model"
+	relaycommon "tea-api/relay/common"
+	"tea-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	CircuitStateClosed   = "closed"
+	CircuitStateOpen     = "open"
+	CircuitStateHalfOpen = "half_open"
 )
 
-// ChannelManager implements a basic weighted round-robin scheduler for channels.
+// halfOpenProbeTimeout 半开探测请求的最长占用时间，超时未上报结果时允许发起新的探测
+const halfOpenProbeTimeout = time.Minute
+
+// channelHealth 记录单个渠道+模型的近期健康状况
+type channelHealth struct {
+	ChannelId           int
+	Model               string
+	State               string
+	ConsecutiveFailures int
+	HalfOpenSuccesses   int
+	OpenedAt            time.Time
+	SuccessRate         float64 // EWMA
+	AvgLatency          float64 // EWMA, in milliseconds
+	LatencySamples      int64
+	// 首字时延 EWMA（毫秒），非流式请求按完整响应耗时计算
+	AvgFirstTokenLatency float64
+	FirstTokenSamples    int64
+	// 半开状态下同一时间只允许一个探测请求
+	ProbeInFlight  bool
+	ProbeStartedAt time.Time
+
+	// 自上次持久化以来的增量
+	pendingTotal   int64
+	pendingSuccess int64
+	dirty          bool
+}
+
+// ChannelHealthSnapshot 用于管理接口展示
+type ChannelHealthSnapshot struct {
+	ChannelId            int     `json:"channel_id"`
+	Model                string  `json:"model"`
+	State                string  `json:"state"`
+	ConsecutiveFailures  int     `json:"consecutive_failures"`
+	SuccessRate          float64 `json:"success_rate"`
+	AvgLatency           float64 `json:"avg_latency"`
+	AvgFirstTokenLatency float64 `json:"avg_first_token_latency"`
+	WeightFactor         float64 `json:"weight_factor"`
+	OpenedAt             int64   `json:"opened_at,omitempty"`
+}
+
+// ChannelManager 按渠道+模型维护成功率、延迟以及熔断状态，
+// 在 model.CacheGetRandomSatisfiedChannel 选择渠道时过滤熔断中的渠道并调整权重。
 type ChannelManager struct {
-	mu       sync.RWMutex
-	channels []*model.Channel
-	index    int
-	stats    map[int]*model.ChannelStat
+	mu     sync.Mutex
+	health map[string]*channelHealth
 }
 
-func NewChannelManager() *ChannelManager {
-	cm := &ChannelManager{stats: make(map[int]*model.ChannelStat)}
-	cm.refresh()
-	go cm.healthLoop()
-	return cm
+var channelManager = &ChannelManager{health: make(map[string]*channelHealth)}
+var channelManagerOnce sync.Once
+
+func GetChannelManager() *ChannelManager {
+	return channelManager
+}
+
+// InitChannelManager 从 channel_stats 恢复健康快照并注册到渠道选择流程
+func InitChannelManager() {
+	channelManagerOnce.Do(func() {
+		channelManager.load()
+		model.SetChannelHealthChecker(channelManager)
+		go channelManager.healthLoop()
+	})
+}
+
+func healthKey(channelId int, modelName string) string {
+	return fmt.Sprintf("%d:%s", channelId, modelName)
 }
 
-func (cm *ChannelManager) refresh() {
-	chs, err := model.GetAllChannels(0, -1, true, false)
+func (cm *ChannelManager) load() {
+	stats, err := model.GetAllChannelStats()
 	if err != nil {
+		common.SysError("failed to load channel stats: " + err.Error())
 		return
 	}
 	cm.mu.Lock()
-	cm.channels = chs
-	cm.index = 0
+	defer cm.mu.Unlock()
+	for _, stat := range stats {
+		if stat.Model == "" {
+			continue
+		}
+		h := &channelHealth{
+			ChannelId:           stat.ChannelID,
+			Model:               stat.Model,
+			State:               CircuitStateClosed,
+			ConsecutiveFailures: stat.ConsecutiveFailures,
+			SuccessRate:         stat.RecentSuccessRate,
+			AvgLatency:          stat.AvgLatency,
+		}
+		if stat.AvgLatency > 0 {
+			h.LatencySamples = 1
+		}
+		if stat.AvgFirstTokenLatency > 0 {
+			// 重启后沿用历史值，但需要重新积累样本才参与延迟优先调权
+			h.AvgFirstTokenLatency = stat.AvgFirstTokenLatency
+			h.FirstTokenSamples = 1
+		}
+		if stat.CircuitState == CircuitStateOpen || stat.CircuitState == CircuitStateHalfOpen {
+			// 重启后直接进入半开状态，由下一次请求探测
+			h.State = CircuitStateHalfOpen
+		}
+		cm.health[healthKey(stat.ChannelID, stat.Model)] = h
+	}
+}
+
+func (cm *ChannelManager) getOrCreate(channelId int, modelName string) *channelHealth {
+	key := healthKey(channelId, modelName)
+	h, ok := cm.health[key]
+	if !ok {
+		h = &channelHealth{
+			ChannelId:   channelId,
+			Model:       modelName,
+			State:       CircuitStateClosed,
+			SuccessRate: 1,
+		}
+		cm.health[key] = h
+	}
+	return h
+}
+
+// Allow 判断渠道是否可以接收该模型的请求，熔断冷却结束后进入半开状态，
+// 半开状态下以最低权重放行，已有探测请求在途时不再放行
+func (cm *ChannelManager) Allow(channelId int, modelName string) bool {
+	setting := operation_setting.GetChannelHealthSetting()
+	if !setting.Enabled {
+		return true
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	h, ok := cm.health[healthKey(channelId, modelName)]
+	if !ok {
+		return true
+	}
+	switch h.State {
+	case CircuitStateOpen:
+		if time.Since(h.OpenedAt) < time.Duration(setting.OpenSeconds)*time.Second {
+			return false
+		}
+		h.State = CircuitStateHalfOpen
+		h.HalfOpenSuccesses = 0
+		h.ProbeInFlight = false
+		h.dirty = true
+	case CircuitStateHalfOpen:
+		return !probeBusy(h)
+	}
+	return true
+}
+
+// AcquireProbe 渠道被选中时调用，半开状态下占用探测名额，已有探测请求在途时返回 false
+func (cm *ChannelManager) AcquireProbe(channelId int, modelName string) bool {
+	if !operation_setting.GetChannelHealthSetting().Enabled {
+		return true
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	h, ok := cm.health[healthKey(channelId, modelName)]
+	if !ok || h.State != CircuitStateHalfOpen {
+		return true
+	}
+	if probeBusy(h) {
+		return false
+	}
+	h.ProbeInFlight = true
+	h.ProbeStartedAt = time.Now()
+	return true
+}
+
+func probeBusy(h *channelHealth) bool {
+	return h.ProbeInFlight && time.Since(h.ProbeStartedAt) < halfOpenProbeTimeout
+}
+
+// releaseProbe 释放探测名额，用于探测请求未产生渠道层面结果的情况
+func (cm *ChannelManager) releaseProbe(channelId int, modelName string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if h, ok := cm.health[healthKey(channelId, modelName)]; ok {
+		h.ProbeInFlight = false
+	}
+}
+
+// WeightFactor 根据近期成功率和平均延迟计算权重系数，范围 [MinWeightFactor, 1]
+func (cm *ChannelManager) WeightFactor(channelId int, modelName string) float64 {
+	setting := operation_setting.GetChannelHealthSetting()
+	if !setting.Enabled {
+		return 1
+	}
+	cm.mu.Lock()
+	h, ok := cm.health[healthKey(channelId, modelName)]
+	if !ok {
+		cm.mu.Unlock()
+		return 1
+	}
+	factor := weightFactor(h, setting)
 	cm.mu.Unlock()
+	return factor
+}
+
+func weightFactor(h *channelHealth, setting *operation_setting.ChannelHealthSetting) float64 {
+	if h.State != CircuitStateClosed {
+		return setting.MinWeightFactor
+	}
+	// 成功率取平方，放大失败渠道的降权效果
+	factor := h.SuccessRate * h.SuccessRate
+	if h.LatencySamples > 0 && setting.LatencyBaselineMs > 0 && h.AvgLatency > float64(setting.LatencyBaselineMs) {
+		factor *= float64(setting.LatencyBaselineMs) / h.AvgLatency
+	}
+	return math.Max(setting.MinWeightFactor, math.Min(1, factor))
 }
 
-func (cm *ChannelManager) next() *model.Channel {
+// FirstTokenLatency 返回渠道+模型的首字时延 EWMA（毫秒），样本不足时返回 0
+func (cm *ChannelManager) FirstTokenLatency(channelId int, modelName string) float64 {
+	setting := operation_setting.GetChannelHealthSetting()
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
-	if len(cm.channels) == 0 {
-		return nil
+	h, ok := cm.health[healthKey(channelId, modelName)]
+	if !ok || h.FirstTokenSamples < int64(max(setting.LatencyRoutingMinSamples, 1)) {
+		return 0
 	}
-	ch := cm.channels[cm.index]
-	cm.index = (cm.index + 1) % len(cm.channels)
-	return ch
+	return h.AvgFirstTokenLatency
 }
 
-// Select returns a channel using weighted random algorithm.
-func (cm *ChannelManager) Select() *model.Channel {
-	cm.mu.RLock()
-	list := cm.channels
-	cm.mu.RUnlock()
-	if len(list) == 0 {
-		return nil
+// LatencyWeightFactor 延迟优先模式下的权重系数，fastest 为候选渠道中最低的首字时延，
+// 按 (fastest / 首字时延)^LatencyRoutingExponent 降权并叠加成功率，范围 [MinWeightFactor, 1]
+func (cm *ChannelManager) LatencyWeightFactor(channelId int, modelName string, fastest float64) float64 {
+	setting := operation_setting.GetChannelHealthSetting()
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	h, ok := cm.health[healthKey(channelId, modelName)]
+	if !ok {
+		// 没有数据的渠道按最快渠道对待，尽快获得样本
+		return 1
 	}
-	total := 0
-	for _, c := range list {
-		total += c.GetWeight() + 1
+	return latencyWeightFactor(h, fastest, setting)
+}
+
+func latencyWeightFactor(h *channelHealth, fastest float64, setting *operation_setting.ChannelHealthSetting) float64 {
+	if setting.Enabled && h.State != CircuitStateClosed {
+		return setting.MinWeightFactor
+	}
+	factor := h.SuccessRate * h.SuccessRate
+	exponent := setting.LatencyRoutingExponent
+	if exponent <= 0 {
+		exponent = 1
+	}
+	if fastest > 0 && h.FirstTokenSamples >= int64(max(setting.LatencyRoutingMinSamples, 1)) && h.AvgFirstTokenLatency > fastest {
+		factor *= math.Pow(fastest/h.AvgFirstTokenLatency, exponent)
+	}
+	return math.Max(setting.MinWeightFactor, math.Min(1, factor))
+}
+
+// Report 记录一次请求结果，latency 为 0 时不计入延迟统计
+func (cm *ChannelManager) Report(channelId int, modelName string, success bool, latency time.Duration) {
+	setting := operation_setting.GetChannelHealthSetting()
+	alpha := setting.EwmaAlpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.2
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	h := cm.getOrCreate(channelId, modelName)
+	h.ProbeInFlight = false
+	h.pendingTotal++
+	h.dirty = true
+	result := 0.0
+	if success {
+		result = 1
+		h.pendingSuccess++
 	}
-	w := rand.Intn(total)
-	for _, c := range list {
-		w -= c.GetWeight() + 1
-		if w < 0 {
-			return c
+	h.SuccessRate = alpha*result + (1-alpha)*h.SuccessRate
+	if success && latency > 0 {
+		ms := float64(latency.Milliseconds())
+		if h.LatencySamples == 0 {
+			h.AvgLatency = ms
+		} else {
+			h.AvgLatency = alpha*ms + (1-alpha)*h.AvgLatency
 		}
+		h.LatencySamples++
 	}
-	return list[0]
+
+	if success {
+		h.ConsecutiveFailures = 0
+		if h.State == CircuitStateHalfOpen {
+			h.HalfOpenSuccesses++
+			if h.HalfOpenSuccesses >= setting.HalfOpenSuccessThreshold {
+				h.State = CircuitStateClosed
+				common.SysLog(fmt.Sprintf("channel #%d model %s circuit closed", channelId, modelName))
+			}
+		}
+		return
+	}
+
+	h.ConsecutiveFailures++
+	switch h.State {
+	case CircuitStateHalfOpen:
+		// 探测失败，重新熔断
+		h.State = CircuitStateOpen
+		h.OpenedAt = time.Now()
+		common.SysLog(fmt.Sprintf("channel #%d model %s circuit re-opened after failed probe", channelId, modelName))
+	case CircuitStateClosed:
+		if setting.FailureThreshold > 0 && h.ConsecutiveFailures >= setting.FailureThreshold {
+			h.State = CircuitStateOpen
+			h.OpenedAt = time.Now()
+			common.SysLog(fmt.Sprintf("channel #%d model %s circuit opened after %d consecutive failures", channelId, modelName, h.ConsecutiveFailures))
+		}
+	}
+}
+
+// ReportFirstToken 记录一次成功请求的首字时延
+func (cm *ChannelManager) ReportFirstToken(channelId int, modelName string, firstToken time.Duration) {
+	if firstToken <= 0 {
+		return
+	}
+	alpha := operation_setting.GetChannelHealthSetting().EwmaAlpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.2
+	}
+	ms := float64(firstToken.Milliseconds())
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	h := cm.getOrCreate(channelId, modelName)
+	if h.FirstTokenSamples == 0 {
+		h.AvgFirstTokenLatency = ms
+	} else {
+		h.AvgFirstTokenLatency = alpha*ms + (1-alpha)*h.AvgFirstTokenLatency
+	}
+	h.FirstTokenSamples++
+	h.dirty = true
+}
+
+// ReportRelayResult 根据转发结果记录渠道健康状况，本地错误和请求参数错误不计入渠道失败，
+// firstToken 为首字时延，为 0 时不计入
+func (cm *ChannelManager) ReportRelayResult(channelId int, modelName string, err *dto.OpenAIErrorWithStatusCode, latency time.Duration, firstToken time.Duration) {
+	if err == nil {
+		cm.Report(channelId, modelName, true, latency)
+		cm.ReportFirstToken(channelId, modelName, firstToken)
+		return
+	}
+	if !IsChannelFailure(err) {
+		cm.releaseProbe(channelId, modelName)
+		return
+	}
+	cm.Report(channelId, modelName, false, 0)
 }
 
-// Report records usage result of a channel.
-func (cm *ChannelManager) Report(channelID int, success bool) {
-	_ = model.UpdateChannelStat(nil, channelID, success)
+// ReportRelayAttempt 记录一次渠道尝试的健康状况与监控指标。
+// 命中响应缓存时没有请求上游，只释放半开探测名额，不计入健康统计和尝试指标
+func ReportRelayAttempt(c *gin.Context, channelId int, modelName string, err *dto.OpenAIErrorWithStatusCode, attemptStart time.Time) {
+	cm := GetChannelManager()
+	if c.GetBool(constant.ContextKeyResponseCacheHit) {
+		cm.releaseProbe(channelId, modelName)
+		return
+	}
+	latency := time.Since(attemptStart)
+	// 首字时延：流式响应取首个数据块的时间，非流式响应取完整响应耗时
+	firstToken := latency
+	// 流式响应的耗时包含生成时间，不计入延迟统计
+	if strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "text/event-stream") {
+		latency = 0
+		firstToken = 0
+		if info, ok := c.Get(constant.ContextKeyRelayInfo); ok {
+			relayInfo := info.(*relaycommon.RelayInfo)
+			if relayInfo.ChannelId == channelId && relayInfo.HasSendResponse() && relayInfo.FirstResponseTime.After(attemptStart) {
+				firstToken = relayInfo.FirstResponseTime.Sub(attemptStart)
+			}
+		}
+	}
+	cm.ReportRelayResult(channelId, modelName, err, latency, firstToken)
+
+	errorCode := ""
+	if err != nil {
+		errorCode = fmt.Sprint(err.Error.Code)
+		if err.Error.Code == nil || errorCode == "" {
+			errorCode = strconv.Itoa(err.StatusCode)
+		}
+	}
+	common.RecordRelayAttemptMetrics(channelId, c.GetInt("channel_type"), modelName, c.GetString("group"), errorCode, time.Since(attemptStart))
+}
+
+// IsChannelFailure 判断错误是否应当归咎于渠道本身
+func IsChannelFailure(err *dto.OpenAIErrorWithStatusCode) bool {
+	if err == nil || err.LocalError {
+		return false
+	}
+	switch err.StatusCode {
+	case http.StatusTooManyRequests, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout:
+		return true
+	}
+	return err.StatusCode >= 500
+}
+
+// Reset 清除某个渠道的健康状态，modelName 为空时清除该渠道所有模型
+func (cm *ChannelManager) Reset(channelId int, modelName string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	for _, h := range cm.health {
+		if h.ChannelId != channelId {
+			continue
+		}
+		if modelName != "" && h.Model != modelName {
+			continue
+		}
+		h.State = CircuitStateClosed
+		h.ConsecutiveFailures = 0
+		h.ProbeInFlight = false
+		h.SuccessRate = 1
+		h.dirty = true
+	}
+}
+
+// Snapshot 返回所有渠道+模型的健康状态
+func (cm *ChannelManager) Snapshot() []ChannelHealthSnapshot {
+	setting := operation_setting.GetChannelHealthSetting()
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	snapshots := make([]ChannelHealthSnapshot, 0, len(cm.health))
+	for _, h := range cm.health {
+		snapshot := ChannelHealthSnapshot{
+			ChannelId:            h.ChannelId,
+			Model:                h.Model,
+			State:                h.State,
+			ConsecutiveFailures:  h.ConsecutiveFailures,
+			SuccessRate:          h.SuccessRate,
+			AvgLatency:           h.AvgLatency,
+			AvgFirstTokenLatency: h.AvgFirstTokenLatency,
+			WeightFactor:         weightFactor(h, setting),
+		}
+		if h.State != CircuitStateClosed {
+			snapshot.OpenedAt = h.OpenedAt.Unix()
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots
+}
+
+func (cm *ChannelManager) flush() {
+	cm.mu.Lock()
+	stats := make([]*model.ChannelStat, 0)
+	for _, h := range cm.health {
+		if !h.dirty {
+			continue
+		}
+		stats = append(stats, &model.ChannelStat{
+			ChannelID:            h.ChannelId,
+			Model:                h.Model,
+			Total:                h.pendingTotal,
+			Success:              h.pendingSuccess,
+			RecentSuccessRate:    h.SuccessRate,
+			AvgLatency:           h.AvgLatency,
+			AvgFirstTokenLatency: h.AvgFirstTokenLatency,
+			ConsecutiveFailures:  h.ConsecutiveFailures,
+			CircuitState:         h.State,
+			UpdatedAt:            time.Now().UnixMilli(),
+		})
+		h.pendingTotal = 0
+		h.pendingSuccess = 0
+		h.dirty = false
+	}
+	cm.mu.Unlock()
+	for _, stat := range stats {
+		if err := model.SaveChannelHealthStat(stat); err != nil {
+			common.SysError(fmt.Sprintf("failed to save channel stat #%d %s: %s", stat.ChannelID, stat.Model, err.Error()))
+		}
+	}
+}
+
+// removeDeleted 清理已删除渠道的健康数据
+func (cm *ChannelManager) removeDeleted() {
+	channels, err := model.GetAllChannels(0, 0, true, false)
+	if err != nil {
+		return
+	}
+	exists := make(map[int]bool, len(channels))
+	for _, channel := range channels {
+		exists[channel.Id] = true
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	for key, h := range cm.health {
+		if !exists[h.ChannelId] {
+			delete(cm.health, key)
+		}
+	}
 }
 
 func (cm *ChannelManager) healthLoop() {
-	ticker := time.NewTicker(time.Minute * 5)
+	interval := operation_setting.GetChannelHealthSetting().FlushIntervalSeconds
+	if interval <= 0 {
+		interval = 60
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	rounds := 0
 	for range ticker.C {
-		// TODO: implement real health check
-		cm.refresh()
+		cm.flush()
+		rounds++
+		if rounds%10 == 0 {
+			cm.removeDeleted()
+		}
 	}
 }
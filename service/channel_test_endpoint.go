@@ -0,0 +1,72 @@
+package service
+
+import (
+	"strings"
+	"tea-api/common"
+)
+
+// 渠道测试请求的接口
+const (
+	ChannelTestEndpointChat          = "chat"
+	ChannelTestEndpointEmbeddings    = "embeddings"
+	ChannelTestEndpointImage         = "image"
+	ChannelTestEndpointSpeech        = "speech"
+	ChannelTestEndpointTranscription = "transcription"
+	ChannelTestEndpointRerank        = "rerank"
+	ChannelTestEndpointResponses     = "responses"
+	ChannelTestEndpointMidjourney    = "midjourney"
+	ChannelTestEndpointSuno          = "suno"
+)
+
+// channelTestConfigurableEndpoints 可以通过渠道设置指定的测试接口，Midjourney、Suno 由渠道类型决定
+var channelTestConfigurableEndpoints = map[string]bool{
+	ChannelTestEndpointChat:          true,
+	ChannelTestEndpointEmbeddings:    true,
+	ChannelTestEndpointImage:         true,
+	ChannelTestEndpointSpeech:        true,
+	ChannelTestEndpointTranscription: true,
+	ChannelTestEndpointRerank:        true,
+	ChannelTestEndpointResponses:     true,
+}
+
+// GetChannelTestEndpoint 返回测试渠道时应当请求的接口，使自动禁用依据的是用户实际调用的接口。
+// configured 为渠道设置中指定的接口，为空或无效时按渠道类型和测试模型推断
+func GetChannelTestEndpoint(channelType int, modelName string, configured string) string {
+	switch channelType {
+	case common.ChannelTypeMidjourney, common.ChannelTypeMidjourneyPlus:
+		return ChannelTestEndpointMidjourney
+	case common.ChannelTypeSunoAPI:
+		return ChannelTestEndpointSuno
+	}
+	if channelTestConfigurableEndpoints[configured] {
+		return configured
+	}
+
+	lowerModel := strings.ToLower(modelName)
+	switch {
+	case strings.Contains(lowerModel, "rerank"):
+		return ChannelTestEndpointRerank
+	case strings.Contains(lowerModel, "embedding") ||
+		strings.HasPrefix(lowerModel, "m3e") || // m3e 系列模型
+		strings.Contains(lowerModel, "bge-") || // bge 系列模型
+		strings.Contains(lowerModel, "embed") ||
+		channelType == common.ChannelTypeMokaAI: // 其他 embedding 模型
+		return ChannelTestEndpointEmbeddings
+	case strings.HasPrefix(lowerModel, "tts-") || strings.HasSuffix(lowerModel, "-tts"):
+		return ChannelTestEndpointSpeech
+	case strings.HasPrefix(lowerModel, "whisper") || strings.HasSuffix(lowerModel, "-transcribe"):
+		return ChannelTestEndpointTranscription
+	case strings.HasPrefix(lowerModel, "dall-e") || strings.HasPrefix(lowerModel, "gpt-image") ||
+		strings.HasPrefix(lowerModel, "flux") || strings.Contains(lowerModel, "stable-diffusion") ||
+		strings.HasPrefix(lowerModel, "imagen") || strings.HasPrefix(lowerModel, "kolors"):
+		return ChannelTestEndpointImage
+	}
+	// 只能通过 Responses API 调用的模型，仅 OpenAI、Azure 渠道原生支持
+	if channelType == common.ChannelTypeOpenAI || channelType == common.ChannelTypeAzure {
+		if strings.Contains(lowerModel, "codex") || strings.HasPrefix(lowerModel, "computer-use") ||
+			strings.HasPrefix(lowerModel, "o1-pro") || strings.HasPrefix(lowerModel, "o3-pro") {
+			return ChannelTestEndpointResponses
+		}
+	}
+	return ChannelTestEndpointChat
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"tea-api/common"
 	"tea-api/dto"
 	relaycommon "tea-api/relay/common"
@@ -15,6 +16,7 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 		MaxTokens:   claudeRequest.MaxTokens,
 		Temperature: claudeRequest.Temperature,
 		TopP:        claudeRequest.TopP,
+		TopK:        claudeRequest.TopK,
 		Stream:      claudeRequest.Stream,
 	}
 
@@ -36,6 +38,10 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 	tools, _ := common.Any2Type[[]dto.Tool](claudeRequest.Tools)
 	openAITools := make([]dto.ToolCallRequest, 0)
 	for _, claudeTool := range tools {
+		// web_search 等服务端工具没有 input_schema，只有 Claude 支持
+		if claudeTool.InputSchema == nil {
+			continue
+		}
 		openAITool := dto.ToolCallRequest{
 			Type: "function",
 			Function: dto.FunctionRequest{
@@ -46,7 +52,10 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 		}
 		openAITools = append(openAITools, openAITool)
 	}
-	openAIRequest.Tools = openAITools
+	if len(openAITools) > 0 {
+		openAIRequest.Tools = openAITools
+		openAIRequest.ToolChoice, openAIRequest.ParallelTooCalls = toolChoiceClaude2OpenAI(claudeRequest.ToolChoice)
+	}
 
 	// Convert messages
 	openAIMessages := make([]dto.Message, 0)
@@ -92,6 +101,7 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 			contents := content
 			var toolCalls []dto.ToolCallRequest
 			mediaMessages := make([]dto.MediaContent, 0, len(contents))
+			hasMedia := false
 
 			for _, mediaMsg := range contents {
 				switch mediaMsg.Type {
@@ -102,14 +112,20 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 					}
 					mediaMessages = append(mediaMessages, message)
 				case "image":
-					// Handle image conversion (base64 to URL or keep as is)
-					imageData := fmt.Sprintf("data:%s;base64,%s", mediaMsg.Source.MediaType, mediaMsg.Source.Data)
-					//textContent += fmt.Sprintf("[Image: %s]", imageData)
-					mediaMessage := dto.MediaContent{
+					hasMedia = true
+					mediaMessages = append(mediaMessages, dto.MediaContent{
 						Type:     "image_url",
-						ImageUrl: &dto.MessageImageUrl{Url: imageData},
-					}
-					mediaMessages = append(mediaMessages, mediaMessage)
+						ImageUrl: &dto.MessageImageUrl{Url: claudeSourceUrl(mediaMsg.Source)},
+					})
+				case "document":
+					hasMedia = true
+					mediaMessages = append(mediaMessages, dto.MediaContent{
+						Type: dto.ContentTypeFile,
+						File: &dto.MessageFile{FileData: claudeSourceUrl(mediaMsg.Source)},
+					})
+				case "thinking":
+					// 历史消息中的思考内容作为 reasoning_content 回传
+					openAIMessage.ReasoningContent += mediaMsg.Thinking
 				case "tool_use":
 					toolCall := dto.ToolCallRequest{
 						ID:   mediaMsg.Id,
@@ -124,16 +140,13 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 					// Add tool result as a separate message
 					oaiToolMessage := dto.Message{
 						Role:       "tool",
-						Name:       &mediaMsg.Name,
 						ToolCallId: mediaMsg.ToolUseId,
 					}
 					//oaiToolMessage.SetStringContent(*mediaMsg.GetMediaContent().Text)
 					if mediaMsg.IsStringContent() {
 						oaiToolMessage.SetStringContent(mediaMsg.GetStringContent())
 					} else {
-						mediaContents := mediaMsg.ParseMediaContent()
-						encodeJson, _ := common.EncodeJson(mediaContents)
-						oaiToolMessage.SetStringContent(string(encodeJson))
+						oaiToolMessage.SetStringContent(claudeToolResultText(mediaMsg.ParseMediaContent()))
 					}
 					openAIMessages = append(openAIMessages, oaiToolMessage)
 				}
@@ -143,8 +156,14 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 				openAIMessage.SetToolCalls(toolCalls)
 			}
 
-			if len(mediaMessages) > 0 && len(toolCalls) == 0 {
+			if hasMedia {
 				openAIMessage.SetMediaContent(mediaMessages)
+			} else if len(mediaMessages) > 0 {
+				texts := make([]string, 0, len(mediaMessages))
+				for _, mediaMessage := range mediaMessages {
+					texts = append(texts, mediaMessage.Text)
+				}
+				openAIMessage.SetStringContent(strings.Join(texts, "\n"))
 			}
 		}
 		if len(openAIMessage.ParseContent()) > 0 || len(openAIMessage.ToolCalls) > 0 {
@@ -157,6 +176,56 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 	return &openAIRequest, nil
 }
 
+// claudeSourceUrl 将 Claude 图片、文档的 source 转换为 URL，base64 数据转换为 data URI
+func claudeSourceUrl(source *dto.ClaudeMessageSource) string {
+	if source == nil {
+		return ""
+	}
+	if source.Type == "url" {
+		return source.Url
+	}
+	return fmt.Sprintf("data:%s;base64,%v", source.MediaType, source.Data)
+}
+
+// claudeToolResultText tool_result 的内容为多个块时，纯文本直接拼接，包含图片等其他块时保留 JSON
+func claudeToolResultText(contents []dto.ClaudeMediaMessage) string {
+	texts := make([]string, 0, len(contents))
+	for _, content := range contents {
+		if content.Type != "text" {
+			encodeJson, _ := common.EncodeJson(contents)
+			return string(encodeJson)
+		}
+		texts = append(texts, content.GetText())
+	}
+	return strings.Join(texts, "\n")
+}
+
+// toolChoiceClaude2OpenAI 转换 tool_choice，返回 OpenAI 的 tool_choice 与 parallel_tool_calls
+func toolChoiceClaude2OpenAI(toolChoice any) (any, *bool) {
+	choice, ok := toolChoice.(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	var parallelToolCalls *bool
+	if disable, ok := choice["disable_parallel_tool_use"].(bool); ok && disable {
+		parallelToolCalls = common.GetPointer(false)
+	}
+	switch choice["type"] {
+	case "auto":
+		return "auto", parallelToolCalls
+	case "any":
+		return "required", parallelToolCalls
+	case "none":
+		return "none", parallelToolCalls
+	case "tool":
+		return map[string]any{
+			"type":     "function",
+			"function": map[string]any{"name": choice["name"]},
+		}, parallelToolCalls
+	}
+	return nil, parallelToolCalls
+}
+
 func OpenAIErrorToClaudeError(openAIError *dto.OpenAIErrorWithStatusCode) *dto.ClaudeErrorWithStatusCode {
 	claudeError := dto.ClaudeError{
 		Type:    "new_api_error",
@@ -168,6 +237,32 @@ func OpenAIErrorToClaudeError(openAIError *dto.OpenAIErrorWithStatusCode) *dto.C
 	}
 }
 
+// geminiErrorStatus HTTP 状态码对应的 Google API 错误状态
+var geminiErrorStatus = map[int]string{
+	http.StatusBadRequest:          "INVALID_ARGUMENT",
+	http.StatusUnauthorized:        "UNAUTHENTICATED",
+	http.StatusForbidden:           "PERMISSION_DENIED",
+	http.StatusNotFound:            "NOT_FOUND",
+	http.StatusConflict:            "ALREADY_EXISTS",
+	http.StatusTooManyRequests:     "RESOURCE_EXHAUSTED",
+	http.StatusNotImplemented:      "UNIMPLEMENTED",
+	http.StatusServiceUnavailable:  "UNAVAILABLE",
+	http.StatusGatewayTimeout:      "DEADLINE_EXCEEDED",
+	http.StatusInternalServerError: "INTERNAL",
+}
+
+func OpenAIErrorToGeminiError(openAIError *dto.OpenAIErrorWithStatusCode) dto.GeminiError {
+	status, ok := geminiErrorStatus[openAIError.StatusCode]
+	if !ok {
+		status = "UNKNOWN"
+	}
+	return dto.GeminiError{
+		Code:    openAIError.StatusCode,
+		Message: openAIError.Error.Message,
+		Status:  status,
+	}
+}
+
 func ClaudeErrorToOpenAIError(claudeError *dto.ClaudeErrorWithStatusCode) *dto.OpenAIErrorWithStatusCode {
 	openAIError := dto.OpenAIError{
 		Message: claudeError.Error.Message,
@@ -186,9 +281,13 @@ func generateStopBlock(index int) *dto.ClaudeResponse {
 	}
 }
 
+// StreamResponseOpenAI2Claude 将一个 OpenAI 流式块转换为 Claude 流式事件，转换状态保存在 info.ClaudeConvertInfo 中。
+// 第一次调用时先发送 message_start；info.Done 为 true 时关闭当前内容块并发送 message_delta 与 message_stop。
 func StreamResponseOpenAI2Claude(openAIResponse *dto.ChatCompletionsStreamResponse, info *relaycommon.RelayInfo) []*dto.ClaudeResponse {
+	convertInfo := info.ClaudeConvertInfo
 	var claudeResponses []*dto.ClaudeResponse
-	if info.SendResponseCount == 1 {
+	if !convertInfo.MessageStarted {
+		convertInfo.MessageStarted = true
 		msg := &dto.ClaudeMediaMessage{
 			Id:    openAIResponse.Id,
 			Model: openAIResponse.Model,
@@ -204,147 +303,120 @@ func StreamResponseOpenAI2Claude(openAIResponse *dto.ChatCompletionsStreamRespon
 			Type:    "message_start",
 			Message: msg,
 		})
-		//claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-		//	Type: "ping",
-		//})
-		if openAIResponse.IsToolCall() {
-			resp := &dto.ClaudeResponse{
-				Type: "content_block_start",
-				ContentBlock: &dto.ClaudeMediaMessage{
-					Id:   openAIResponse.GetFirstToolCall().ID,
-					Type: "tool_use",
-					Name: openAIResponse.GetFirstToolCall().Function.Name,
-				},
-			}
-			resp.SetIndex(0)
-			claudeResponses = append(claudeResponses, resp)
-		} else {
-			//resp := &dto.ClaudeResponse{
-			//	Type: "content_block_start",
-			//	ContentBlock: &dto.ClaudeMediaMessage{
-			//		Type: "text",
-			//		Text: common.GetPointer[string](""),
-			//	},
-			//}
-			//resp.SetIndex(0)
-			//claudeResponses = append(claudeResponses, resp)
+	}
+
+	if convertInfo.Done {
+		if convertInfo.LastMessagesType != relaycommon.LastMessageTypeNone {
+			claudeResponses = append(claudeResponses, generateStopBlock(convertInfo.Index))
+			convertInfo.LastMessagesType = relaycommon.LastMessageTypeNone
+		}
+		usage := &dto.ClaudeUsage{InputTokens: info.PromptTokens}
+		if convertInfo.Usage != nil {
+			usage.InputTokens = convertInfo.Usage.PromptTokens
+			usage.OutputTokens = convertInfo.Usage.CompletionTokens
 		}
+		claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+			Type:  "message_delta",
+			Usage: usage,
+			Delta: &dto.ClaudeMediaMessage{
+				StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(convertInfo.FinishReason)),
+			},
+		})
+		claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+			Type: "message_stop",
+		})
 		return claudeResponses
 	}
 
 	if len(openAIResponse.Choices) == 0 {
-		// no choices
-		// TODO: handle this case
+		// 只包含用量的块
 		return claudeResponses
-	} else {
-		chosenChoice := openAIResponse.Choices[0]
-		if chosenChoice.FinishReason != nil && *chosenChoice.FinishReason != "" {
-			// should be done
-			info.FinishReason = *chosenChoice.FinishReason
-			return claudeResponses
+	}
+	chosenChoice := openAIResponse.Choices[0]
+	if reasoning := chosenChoice.Delta.GetReasoningContent(); reasoning != "" {
+		if convertInfo.LastMessagesType != relaycommon.LastMessageTypeThinking {
+			claudeResponses = append(claudeResponses, startClaudeContentBlock(convertInfo, relaycommon.LastMessageTypeThinking, &dto.ClaudeMediaMessage{
+				Type:     "thinking",
+				Thinking: "",
+			})...)
 		}
-		if info.Done {
-			claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-			if info.ClaudeConvertInfo.Usage != nil {
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Type: "message_delta",
-					Usage: &dto.ClaudeUsage{
-						InputTokens:  info.ClaudeConvertInfo.Usage.PromptTokens,
-						OutputTokens: info.ClaudeConvertInfo.Usage.CompletionTokens,
-					},
-					Delta: &dto.ClaudeMediaMessage{
-						StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(info.FinishReason)),
-					},
-				})
-			}
+		claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+			Type:  "content_block_delta",
+			Index: common.GetPointer[int](convertInfo.Index),
+			Delta: &dto.ClaudeMediaMessage{
+				Type:     "thinking_delta",
+				Thinking: reasoning,
+			},
+		})
+	}
+	if textContent := chosenChoice.Delta.GetContentString(); textContent != "" {
+		if convertInfo.LastMessagesType != relaycommon.LastMessageTypeText {
+			claudeResponses = append(claudeResponses, startClaudeContentBlock(convertInfo, relaycommon.LastMessageTypeText, &dto.ClaudeMediaMessage{
+				Type: "text",
+				Text: common.GetPointer[string](""),
+			})...)
+		}
+		claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+			Type:  "content_block_delta",
+			Index: common.GetPointer[int](convertInfo.Index),
+			Delta: &dto.ClaudeMediaMessage{
+				Type: "text_delta",
+				Text: common.GetPointer[string](textContent),
+			},
+		})
+	}
+	for _, toolCall := range chosenChoice.Delta.ToolCalls {
+		// 每个函数调用对应一个 tool_use 块，序号变化或出现新的 id 时开启新块
+		toolCallIndex := convertInfo.ToolCallIndex
+		if toolCall.Index != nil {
+			toolCallIndex = *toolCall.Index
+		} else if toolCall.ID != "" && convertInfo.LastMessagesType == relaycommon.LastMessageTypeTools {
+			toolCallIndex++
+		}
+		if convertInfo.LastMessagesType != relaycommon.LastMessageTypeTools || toolCallIndex != convertInfo.ToolCallIndex {
+			claudeResponses = append(claudeResponses, startClaudeContentBlock(convertInfo, relaycommon.LastMessageTypeTools, &dto.ClaudeMediaMessage{
+				Id:    toolCall.ID,
+				Type:  "tool_use",
+				Name:  toolCall.Function.Name,
+				Input: map[string]interface{}{},
+			})...)
+			convertInfo.ToolCallIndex = toolCallIndex
+		}
+		if toolCall.Function.Arguments != "" {
 			claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-				Type: "message_stop",
-			})
-		} else {
-			var claudeResponse dto.ClaudeResponse
-			var isEmpty bool
-			claudeResponse.Type = "content_block_delta"
-			if len(chosenChoice.Delta.ToolCalls) > 0 {
-				if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeTools {
-					claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-					info.ClaudeConvertInfo.Index++
-					claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-						Index: &info.ClaudeConvertInfo.Index,
-						Type:  "content_block_start",
-						ContentBlock: &dto.ClaudeMediaMessage{
-							Id:    openAIResponse.GetFirstToolCall().ID,
-							Type:  "tool_use",
-							Name:  openAIResponse.GetFirstToolCall().Function.Name,
-							Input: map[string]interface{}{},
-						},
-					})
-				}
-				info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeTools
-				// tools delta
-				claudeResponse.Delta = &dto.ClaudeMediaMessage{
+				Type:  "content_block_delta",
+				Index: common.GetPointer[int](convertInfo.Index),
+				Delta: &dto.ClaudeMediaMessage{
 					Type:        "input_json_delta",
-					PartialJson: &chosenChoice.Delta.ToolCalls[0].Function.Arguments,
-				}
-			} else {
-				reasoning := chosenChoice.Delta.GetReasoningContent()
-				textContent := chosenChoice.Delta.GetContentString()
-				if reasoning != "" || textContent != "" {
-					if reasoning != "" {
-						if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeThinking {
-							//info.ClaudeConvertInfo.Index++
-							claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-								Index: &info.ClaudeConvertInfo.Index,
-								Type:  "content_block_start",
-								ContentBlock: &dto.ClaudeMediaMessage{
-									Type:     "thinking",
-									Thinking: "",
-								},
-							})
-						}
-						info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeThinking
-						// text delta
-						claudeResponse.Delta = &dto.ClaudeMediaMessage{
-							Type:     "thinking_delta",
-							Thinking: reasoning,
-						}
-					} else {
-						if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeText {
-							if info.LastMessagesType == relaycommon.LastMessageTypeThinking || info.LastMessagesType == relaycommon.LastMessageTypeTools {
-								claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-								info.ClaudeConvertInfo.Index++
-							}
-							claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-								Index: &info.ClaudeConvertInfo.Index,
-								Type:  "content_block_start",
-								ContentBlock: &dto.ClaudeMediaMessage{
-									Type: "text",
-									Text: common.GetPointer[string](""),
-								},
-							})
-						}
-						info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeText
-						// text delta
-						claudeResponse.Delta = &dto.ClaudeMediaMessage{
-							Type: "text_delta",
-							Text: common.GetPointer[string](textContent),
-						}
-					}
-				} else {
-					isEmpty = true
-				}
-			}
-			claudeResponse.Index = &info.ClaudeConvertInfo.Index
-			if !isEmpty {
-				claudeResponses = append(claudeResponses, &claudeResponse)
-			}
+					PartialJson: common.GetPointer[string](toolCall.Function.Arguments),
+				},
+			})
 		}
 	}
+	if chosenChoice.FinishReason != nil && *chosenChoice.FinishReason != "" {
+		convertInfo.FinishReason = *chosenChoice.FinishReason
+	}
+	return claudeResponses
+}
 
+// startClaudeContentBlock 关闭当前内容块（如果有）并开启新的内容块
+func startClaudeContentBlock(convertInfo *relaycommon.ClaudeConvertInfo, messageType string, contentBlock *dto.ClaudeMediaMessage) []*dto.ClaudeResponse {
+	var claudeResponses []*dto.ClaudeResponse
+	if convertInfo.LastMessagesType != relaycommon.LastMessageTypeNone {
+		claudeResponses = append(claudeResponses, generateStopBlock(convertInfo.Index))
+		convertInfo.Index++
+	}
+	convertInfo.LastMessagesType = messageType
+	claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+		Type:         "content_block_start",
+		Index:        common.GetPointer[int](convertInfo.Index),
+		ContentBlock: contentBlock,
+	})
 	return claudeResponses
 }
 
 func ResponseOpenAI2Claude(openAIResponse *dto.OpenAITextResponse, info *relaycommon.RelayInfo) *dto.ClaudeResponse {
-	var stopReason string
+	stopReason := stopReasonOpenAI2Claude("")
 	contents := make([]dto.ClaudeMediaMessage, 0)
 	claudeResponse := &dto.ClaudeResponse{
 		Id:    openAIResponse.Id,
@@ -352,24 +424,39 @@ func ResponseOpenAI2Claude(openAIResponse *dto.OpenAITextResponse, info *relayco
 		Role:  "assistant",
 		Model: openAIResponse.Model,
 	}
-	for _, choice := range openAIResponse.Choices {
+	// Claude 每次只返回一个结果，只转换第一个 choice
+	if len(openAIResponse.Choices) > 0 {
+		choice := openAIResponse.Choices[0]
 		stopReason = stopReasonOpenAI2Claude(choice.FinishReason)
-		claudeContent := dto.ClaudeMediaMessage{}
-		if choice.FinishReason == "tool_calls" {
-			claudeContent.Type = "tool_use"
-			claudeContent.Id = choice.Message.ToolCallId
-			claudeContent.Name = choice.Message.ParseToolCalls()[0].Function.Name
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			contents = append(contents, dto.ClaudeMediaMessage{
+				Type:     "thinking",
+				Thinking: reasoning,
+			})
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			claudeContent := dto.ClaudeMediaMessage{Type: "text"}
+			claudeContent.SetText(text)
+			contents = append(contents, claudeContent)
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			claudeContent := dto.ClaudeMediaMessage{
+				Type: "tool_use",
+				Id:   toolCall.ID,
+				Name: toolCall.Function.Name,
+			}
 			var mapParams map[string]interface{}
-			if err := json.Unmarshal([]byte(choice.Message.ParseToolCalls()[0].Function.Arguments), &mapParams); err == nil {
+			if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &mapParams); err == nil {
 				claudeContent.Input = mapParams
 			} else {
-				claudeContent.Input = choice.Message.ParseToolCalls()[0].Function.Arguments
+				claudeContent.Input = map[string]interface{}{}
 			}
-		} else {
-			claudeContent.Type = "text"
-			claudeContent.SetText(choice.Message.StringContent())
+			contents = append(contents, claudeContent)
 		}
-		contents = append(contents, claudeContent)
 	}
 	claudeResponse.Content = contents
 	claudeResponse.StopReason = stopReason
@@ -387,10 +474,14 @@ func stopReasonOpenAI2Claude(reason string) string {
 		return "end_turn"
 	case "stop_sequence":
 		return "stop_sequence"
-	case "max_tokens":
+	case "max_tokens", "length":
 		return "max_tokens"
 	case "tool_calls":
 		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	case "":
+		return "end_turn"
 	default:
 		return reason
 	}
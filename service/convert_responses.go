@@ -0,0 +1,591 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"tea-api/common"
+	"tea-api/dto"
+)
+
+// ResponsesRequestToOpenAIRequest 将 /v1/responses 请求转换为 Chat Completions 请求。
+// history 为 previous_response_id 对应的历史消息，位于 instructions 之后、本次 input 之前。
+func ResponsesRequestToOpenAIRequest(request *dto.OpenAIResponsesRequest, history []dto.Message) (*dto.GeneralOpenAIRequest, error) {
+	openAIRequest := &dto.GeneralOpenAIRequest{
+		Model:     request.Model,
+		Stream:    request.Stream,
+		MaxTokens: request.MaxOutputTokens,
+		TopP:      request.TopP,
+		User:      request.User,
+		// temperature 为 0 表示确定性采样，请求中设置了就原样转发
+		Temperature: request.Temperature,
+	}
+	if request.Reasoning != nil {
+		openAIRequest.ReasoningEffort = request.Reasoning.Effort
+	}
+
+	for _, tool := range request.Tools {
+		if tool.Type != "function" {
+			return nil, fmt.Errorf("tool type %s is not supported by this channel", tool.Type)
+		}
+		var parameters map[string]any
+		if len(tool.Parameters) > 0 {
+			if err := json.Unmarshal(tool.Parameters, &parameters); err != nil {
+				return nil, fmt.Errorf("invalid parameters of function %s: %w", tool.Name, err)
+			}
+		}
+		openAIRequest.Tools = append(openAIRequest.Tools, dto.ToolCallRequest{
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  parameters,
+			},
+		})
+	}
+	if len(openAIRequest.Tools) > 0 {
+		openAIRequest.ToolChoice = toolChoiceResponses2OpenAI(request.ToolChoice)
+	}
+
+	if len(request.Text) > 0 {
+		var text dto.ResponsesText
+		if err := json.Unmarshal(request.Text, &text); err != nil {
+			return nil, fmt.Errorf("invalid text: %w", err)
+		}
+		if text.Format != nil {
+			switch text.Format.Type {
+			case "json_object":
+				openAIRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_object"}
+			case "json_schema":
+				openAIRequest.ResponseFormat = &dto.ResponseFormat{
+					Type: "json_schema",
+					JsonSchema: &dto.FormatJsonSchema{
+						Name:        text.Format.Name,
+						Description: text.Format.Description,
+						Schema:      text.Format.Schema,
+						Strict:      text.Format.Strict,
+					},
+				}
+			}
+		}
+	}
+
+	messages := make([]dto.Message, 0, len(history)+2)
+	if instructions := responsesInstructions(request.Instructions); instructions != "" {
+		systemMessage := dto.Message{Role: "system"}
+		systemMessage.SetStringContent(instructions)
+		messages = append(messages, systemMessage)
+	}
+	messages = append(messages, history...)
+	inputMessages, err := ResponsesInputToMessages(request.Input)
+	if err != nil {
+		return nil, err
+	}
+	openAIRequest.Messages = append(messages, inputMessages...)
+	return openAIRequest, nil
+}
+
+func responsesInstructions(instructions json.RawMessage) string {
+	if len(instructions) == 0 {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(instructions, &text); err != nil {
+		return ""
+	}
+	return text
+}
+
+// toolChoiceResponses2OpenAI 转换 tool_choice，内置工具等无法转换的选项交给上游默认处理
+func toolChoiceResponses2OpenAI(toolChoice json.RawMessage) any {
+	if len(toolChoice) == 0 {
+		return nil
+	}
+	var choice any
+	if err := json.Unmarshal(toolChoice, &choice); err != nil {
+		return nil
+	}
+	switch v := choice.(type) {
+	case string:
+		return v
+	case map[string]any:
+		if v["type"] == "function" {
+			return map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": v["name"]},
+			}
+		}
+	}
+	return nil
+}
+
+// ResponsesInputToMessages 将 input（字符串或输入项数组）转换为 Chat Completions 消息。
+// 连续的函数调用合并到同一条 assistant 消息中，推理内容作为下一条 assistant 消息的 reasoning_content。
+func ResponsesInputToMessages(input json.RawMessage) ([]dto.Message, error) {
+	messages := make([]dto.Message, 0)
+	if len(input) == 0 {
+		return messages, nil
+	}
+	var text string
+	if err := json.Unmarshal(input, &text); err == nil {
+		message := dto.Message{Role: "user"}
+		message.SetStringContent(text)
+		return append(messages, message), nil
+	}
+
+	var items []dto.ResponsesInputItem
+	if err := json.Unmarshal(input, &items); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	reasoning := ""
+	for _, item := range items {
+		switch item.Type {
+		case "", dto.ResponsesItemTypeMessage:
+			message, err := responsesMessage(item)
+			if err != nil {
+				return nil, err
+			}
+			if message.Role == "assistant" {
+				message.ReasoningContent = reasoning
+				reasoning = ""
+			}
+			messages = append(messages, message)
+		case dto.ResponsesItemTypeFunctionCall:
+			toolCall := dto.ToolCallRequest{
+				ID:   item.CallId,
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			}
+			last := len(messages) - 1
+			if last >= 0 && messages[last].Role == "assistant" {
+				messages[last].SetToolCalls(append(messages[last].ParseToolCalls(), toolCall))
+			} else {
+				message := dto.Message{Role: "assistant", ReasoningContent: reasoning}
+				message.SetToolCalls([]dto.ToolCallRequest{toolCall})
+				messages = append(messages, message)
+			}
+			reasoning = ""
+		case dto.ResponsesItemTypeFunctionCallOutput:
+			message := dto.Message{Role: "tool", ToolCallId: item.CallId}
+			message.SetStringContent(responsesFunctionOutput(item.Output))
+			messages = append(messages, message)
+		case dto.ResponsesItemTypeReasoning:
+			for _, summary := range item.Summary {
+				reasoning += summary.Text
+			}
+		default:
+			return nil, fmt.Errorf("input item type %s is not supported by this channel", item.Type)
+		}
+	}
+	return messages, nil
+}
+
+func responsesMessage(item dto.ResponsesInputItem) (dto.Message, error) {
+	message := dto.Message{Role: item.Role}
+	if message.Role == "developer" {
+		message.Role = "system"
+	}
+	var text string
+	if err := json.Unmarshal(item.Content, &text); err == nil {
+		message.SetStringContent(text)
+		return message, nil
+	}
+
+	var contents []dto.ResponsesInputContent
+	if err := json.Unmarshal(item.Content, &contents); err != nil {
+		return message, fmt.Errorf("invalid message content: %w", err)
+	}
+	mediaContents := make([]dto.MediaContent, 0, len(contents))
+	texts := make([]string, 0, len(contents))
+	hasMedia := false
+	for _, content := range contents {
+		switch content.Type {
+		case "input_text", "output_text":
+			texts = append(texts, content.Text)
+			mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeText, Text: content.Text})
+		case "refusal":
+			texts = append(texts, content.Refusal)
+			mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeText, Text: content.Refusal})
+		case "input_image":
+			hasMedia = true
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type:     dto.ContentTypeImageURL,
+				ImageUrl: &dto.MessageImageUrl{Url: content.ImageUrl, Detail: content.Detail},
+			})
+		case "input_file":
+			hasMedia = true
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeFile,
+				File: &dto.MessageFile{FileName: content.Filename, FileData: content.FileData, FileId: content.FileId},
+			})
+		default:
+			return message, fmt.Errorf("content type %s is not supported by this channel", content.Type)
+		}
+	}
+	if hasMedia {
+		message.SetMediaContent(mediaContents)
+	} else {
+		message.SetStringContent(strings.Join(texts, "\n"))
+	}
+	return message, nil
+}
+
+// responsesFunctionOutput 函数调用结果为字符串时直接使用，为内容数组时拼接其中的文本
+func responsesFunctionOutput(output json.RawMessage) string {
+	if len(output) == 0 {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(output, &text); err == nil {
+		return text
+	}
+	var contents []dto.ResponsesInputContent
+	if err := json.Unmarshal(output, &contents); err != nil {
+		return string(output)
+	}
+	texts := make([]string, 0, len(contents))
+	for _, content := range contents {
+		if content.Type != "input_text" && content.Type != "output_text" {
+			return string(output)
+		}
+		texts = append(texts, content.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+// UsageToResponsesUsage 将计费用量转换为 /v1/responses 响应中的用量
+func UsageToResponsesUsage(usage *dto.Usage) *dto.ResponsesUsage {
+	if usage == nil {
+		return &dto.ResponsesUsage{}
+	}
+	return &dto.ResponsesUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.PromptTokens + usage.CompletionTokens,
+		InputTokensDetails: dto.ResponsesInputTokensDetails{
+			CachedTokens: usage.PromptTokensDetails.CachedTokens,
+		},
+		OutputTokensDetails: dto.ResponsesOutputTokensDetails{
+			ReasoningTokens: usage.CompletionTokenDetails.ReasoningTokens,
+		},
+	}
+}
+
+// NewResponsesResponse 生成回显请求参数的响应骨架，状态为 in_progress
+func NewResponsesResponse(request *dto.OpenAIResponsesRequest, responseId string, model string) *dto.OpenAIResponsesResponse {
+	response := &dto.OpenAIResponsesResponse{
+		ID:                 responseId,
+		Object:             "response",
+		CreatedAt:          int(common.GetTimestamp()),
+		Status:             "in_progress",
+		Instructions:       responsesInstructions(request.Instructions),
+		MaxOutputTokens:    int(request.MaxOutputTokens),
+		Model:              model,
+		Output:             make([]dto.ResponsesOutput, 0),
+		ParallelToolCalls:  true,
+		PreviousResponseID: request.PreviousResponseID,
+		Reasoning:          request.Reasoning,
+		Store:              request.Store,
+		Temperature:        1,
+		ToolChoice:         "auto",
+		Tools:              request.Tools,
+		TopP:               request.TopP,
+		Truncation:         common.GetStringIfEmpty(request.Truncation, "disabled"),
+		Metadata:           request.Metadata,
+	}
+	if response.Tools == nil {
+		response.Tools = make([]dto.ResponsesToolsCall, 0)
+	}
+	var toolChoice string
+	if err := json.Unmarshal(request.ToolChoice, &toolChoice); err == nil && toolChoice != "" {
+		response.ToolChoice = toolChoice
+	}
+	if request.Temperature != nil {
+		response.Temperature = *request.Temperature
+	}
+	if request.TopP == 0 {
+		response.TopP = 1
+	}
+	if request.User != "" {
+		response.User, _ = json.Marshal(request.User)
+	}
+	return response
+}
+
+// completeResponsesResponse 根据结束原因设置响应状态与用量
+func completeResponsesResponse(response *dto.OpenAIResponsesResponse, finishReason string, usage *dto.Usage) {
+	response.Status = "completed"
+	switch finishReason {
+	case "length":
+		response.Status = "incomplete"
+		response.IncompleteDetails = &dto.IncompleteDetails{Reason: "max_output_tokens"}
+	case "content_filter":
+		response.Status = "incomplete"
+		response.IncompleteDetails = &dto.IncompleteDetails{Reason: "content_filter"}
+	}
+	response.Usage = UsageToResponsesUsage(usage)
+}
+
+func newResponsesItemId(prefix string) string {
+	return prefix + "_" + common.GetUUID()
+}
+
+func newResponsesMessageItem(status string, text string) dto.ResponsesOutput {
+	return dto.ResponsesOutput{
+		Type:   dto.ResponsesItemTypeMessage,
+		ID:     newResponsesItemId("msg"),
+		Status: status,
+		Role:   "assistant",
+		Content: []dto.ResponsesOutputContent{
+			{Type: "output_text", Text: text, Annotations: make([]interface{}, 0)},
+		},
+	}
+}
+
+// ResponseOpenAI2Responses 将 Chat Completions 非流式响应转换为 /v1/responses 响应
+func ResponseOpenAI2Responses(openAIResponse *dto.OpenAITextResponse, request *dto.OpenAIResponsesRequest, responseId string) *dto.OpenAIResponsesResponse {
+	response := NewResponsesResponse(request, responseId, common.GetStringIfEmpty(openAIResponse.Model, request.Model))
+	finishReason := ""
+	if len(openAIResponse.Choices) > 0 {
+		choice := openAIResponse.Choices[0]
+		finishReason = choice.FinishReason
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			response.Output = append(response.Output, dto.ResponsesOutput{
+				Type:    dto.ResponsesItemTypeReasoning,
+				ID:      newResponsesItemId("rs"),
+				Summary: []dto.ResponsesReasoningSummary{{Type: "summary_text", Text: reasoning}},
+			})
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			response.Output = append(response.Output, newResponsesMessageItem("completed", text))
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			response.Output = append(response.Output, dto.ResponsesOutput{
+				Type:      dto.ResponsesItemTypeFunctionCall,
+				ID:        newResponsesItemId("fc"),
+				Status:    "completed",
+				CallId:    toolCall.ID,
+				Name:      toolCall.Function.Name,
+				Arguments: toolCall.Function.Arguments,
+			})
+		}
+	}
+	completeResponsesResponse(response, finishReason, &openAIResponse.Usage)
+	return response
+}
+
+// ResponsesStreamConverter 将 Chat Completions 流式块转换为 /v1/responses 流式事件
+type ResponsesStreamConverter struct {
+	response       *dto.OpenAIResponsesResponse
+	sequenceNumber int
+	started        bool
+	finishReason   string
+	// 当前正在输出的项，nil 表示没有
+	current      *dto.ResponsesOutput
+	toolCallIdx  int
+	reasoningBuf strings.Builder
+	textBuf      strings.Builder
+	argsBuf      strings.Builder
+}
+
+func NewResponsesStreamConverter(request *dto.OpenAIResponsesRequest, responseId string) *ResponsesStreamConverter {
+	return &ResponsesStreamConverter{
+		response:    NewResponsesResponse(request, responseId, request.Model),
+		toolCallIdx: -1,
+	}
+}
+
+// Response 返回当前的响应，Finish 之后包含完整的输出与用量
+func (s *ResponsesStreamConverter) Response() *dto.OpenAIResponsesResponse {
+	return s.response
+}
+
+func (s *ResponsesStreamConverter) event(event dto.ResponsesStreamResponse) dto.ResponsesStreamResponse {
+	event.SequenceNumber = s.sequenceNumber
+	s.sequenceNumber++
+	return event
+}
+
+// snapshot 复制响应，避免后续修改影响已生成的事件
+func (s *ResponsesStreamConverter) snapshot() *dto.OpenAIResponsesResponse {
+	response := *s.response
+	response.Output = append([]dto.ResponsesOutput(nil), s.response.Output...)
+	return &response
+}
+
+func (s *ResponsesStreamConverter) start() []dto.ResponsesStreamResponse {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	return []dto.ResponsesStreamResponse{
+		s.event(dto.ResponsesStreamResponse{Type: "response.created", Response: s.snapshot()}),
+		s.event(dto.ResponsesStreamResponse{Type: "response.in_progress", Response: s.snapshot()}),
+	}
+}
+
+func (s *ResponsesStreamConverter) outputIndex() *int {
+	return common.GetPointer(len(s.response.Output))
+}
+
+// openItem 关闭当前项并开始新的输出项
+func (s *ResponsesStreamConverter) openItem(item dto.ResponsesOutput) []dto.ResponsesStreamResponse {
+	events := s.closeItem()
+	s.current = &item
+	events = append(events, s.event(dto.ResponsesStreamResponse{
+		Type:        dto.ResponsesOutputTypeItemAdded,
+		OutputIndex: s.outputIndex(),
+		Item:        &item,
+	}))
+	switch item.Type {
+	case dto.ResponsesItemTypeMessage:
+		events = append(events, s.event(dto.ResponsesStreamResponse{
+			Type:         "response.content_part.added",
+			ItemId:       item.ID,
+			OutputIndex:  s.outputIndex(),
+			ContentIndex: common.GetPointer(0),
+			Part:         dto.ResponsesOutputContent{Type: "output_text", Annotations: make([]interface{}, 0)},
+		}))
+	case dto.ResponsesItemTypeReasoning:
+		events = append(events, s.event(dto.ResponsesStreamResponse{
+			Type:         "response.reasoning_summary_part.added",
+			ItemId:       item.ID,
+			OutputIndex:  s.outputIndex(),
+			SummaryIndex: common.GetPointer(0),
+			Part:         dto.ResponsesReasoningSummary{Type: "summary_text"},
+		}))
+	}
+	return events
+}
+
+// closeItem 结束当前输出项并加入响应的 output
+func (s *ResponsesStreamConverter) closeItem() []dto.ResponsesStreamResponse {
+	if s.current == nil {
+		return nil
+	}
+	item := *s.current
+	s.current = nil
+	var events []dto.ResponsesStreamResponse
+	switch item.Type {
+	case dto.ResponsesItemTypeMessage:
+		text := s.textBuf.String()
+		s.textBuf.Reset()
+		part := dto.ResponsesOutputContent{Type: "output_text", Text: text, Annotations: make([]interface{}, 0)}
+		events = append(events,
+			s.event(dto.ResponsesStreamResponse{Type: "response.output_text.done", ItemId: item.ID, OutputIndex: s.outputIndex(), ContentIndex: common.GetPointer(0), Text: text}),
+			s.event(dto.ResponsesStreamResponse{Type: "response.content_part.done", ItemId: item.ID, OutputIndex: s.outputIndex(), ContentIndex: common.GetPointer(0), Part: part}),
+		)
+		item.Content = []dto.ResponsesOutputContent{part}
+		item.Status = "completed"
+	case dto.ResponsesItemTypeReasoning:
+		summary := dto.ResponsesReasoningSummary{Type: "summary_text", Text: s.reasoningBuf.String()}
+		s.reasoningBuf.Reset()
+		events = append(events,
+			s.event(dto.ResponsesStreamResponse{Type: "response.reasoning_summary_text.done", ItemId: item.ID, OutputIndex: s.outputIndex(), SummaryIndex: common.GetPointer(0), Text: summary.Text}),
+			s.event(dto.ResponsesStreamResponse{Type: "response.reasoning_summary_part.done", ItemId: item.ID, OutputIndex: s.outputIndex(), SummaryIndex: common.GetPointer(0), Part: summary}),
+		)
+		item.Summary = []dto.ResponsesReasoningSummary{summary}
+	case dto.ResponsesItemTypeFunctionCall:
+		item.Arguments = s.argsBuf.String()
+		s.argsBuf.Reset()
+		events = append(events, s.event(dto.ResponsesStreamResponse{Type: "response.function_call_arguments.done", ItemId: item.ID, OutputIndex: s.outputIndex(), Arguments: item.Arguments}))
+		item.Status = "completed"
+	}
+	events = append(events, s.event(dto.ResponsesStreamResponse{Type: dto.ResponsesOutputTypeItemDone, OutputIndex: s.outputIndex(), Item: &item}))
+	s.response.Output = append(s.response.Output, item)
+	return events
+}
+
+// Convert 转换一个流式块，第一次调用时先发送 response.created 与 response.in_progress
+func (s *ResponsesStreamConverter) Convert(chunk *dto.ChatCompletionsStreamResponse) []dto.ResponsesStreamResponse {
+	events := s.start()
+	if chunk.Model != "" {
+		s.response.Model = chunk.Model
+	}
+	if len(chunk.Choices) == 0 {
+		return events
+	}
+	choice := chunk.Choices[0]
+	if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+		if s.current == nil || s.current.Type != dto.ResponsesItemTypeReasoning {
+			events = append(events, s.openItem(dto.ResponsesOutput{
+				Type:    dto.ResponsesItemTypeReasoning,
+				ID:      newResponsesItemId("rs"),
+				Summary: make([]dto.ResponsesReasoningSummary, 0),
+			})...)
+		}
+		s.reasoningBuf.WriteString(reasoning)
+		events = append(events, s.event(dto.ResponsesStreamResponse{
+			Type:         "response.reasoning_summary_text.delta",
+			ItemId:       s.current.ID,
+			OutputIndex:  s.outputIndex(),
+			SummaryIndex: common.GetPointer(0),
+			Delta:        reasoning,
+		}))
+	}
+	if text := choice.Delta.GetContentString(); text != "" {
+		if s.current == nil || s.current.Type != dto.ResponsesItemTypeMessage {
+			item := newResponsesMessageItem("in_progress", "")
+			item.Content = make([]dto.ResponsesOutputContent, 0)
+			events = append(events, s.openItem(item)...)
+		}
+		s.textBuf.WriteString(text)
+		events = append(events, s.event(dto.ResponsesStreamResponse{
+			Type:         "response.output_text.delta",
+			ItemId:       s.current.ID,
+			OutputIndex:  s.outputIndex(),
+			ContentIndex: common.GetPointer(0),
+			Delta:        text,
+		}))
+	}
+	for _, toolCall := range choice.Delta.ToolCalls {
+		toolCallIdx := s.toolCallIdx
+		if toolCall.Index != nil {
+			toolCallIdx = *toolCall.Index
+		} else if toolCall.ID != "" {
+			toolCallIdx++
+		}
+		if s.current == nil || s.current.Type != dto.ResponsesItemTypeFunctionCall || toolCallIdx != s.toolCallIdx {
+			s.toolCallIdx = toolCallIdx
+			events = append(events, s.openItem(dto.ResponsesOutput{
+				Type:   dto.ResponsesItemTypeFunctionCall,
+				ID:     newResponsesItemId("fc"),
+				Status: "in_progress",
+				CallId: toolCall.ID,
+				Name:   toolCall.Function.Name,
+			})...)
+		}
+		if toolCall.Function.Arguments != "" {
+			s.argsBuf.WriteString(toolCall.Function.Arguments)
+			events = append(events, s.event(dto.ResponsesStreamResponse{
+				Type:        "response.function_call_arguments.delta",
+				ItemId:      s.current.ID,
+				OutputIndex: s.outputIndex(),
+				Delta:       toolCall.Function.Arguments,
+			}))
+		}
+	}
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		s.finishReason = *choice.FinishReason
+	}
+	return events
+}
+
+// Finish 结束当前输出项并发送 response.completed（因长度截断时为 response.incomplete）
+func (s *ResponsesStreamConverter) Finish(usage *dto.Usage) []dto.ResponsesStreamResponse {
+	events := s.start()
+	events = append(events, s.closeItem()...)
+	completeResponsesResponse(s.response, s.finishReason, usage)
+	eventType := "response.completed"
+	if s.response.Status == "incomplete" {
+		eventType = "response.incomplete"
+	}
+	return append(events, s.event(dto.ResponsesStreamResponse{Type: eventType, Response: s.snapshot()}))
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/model"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// FileStorage Files API 的文件存储，key 由网关生成，不包含用户输入
+type FileStorage interface {
+	Save(ctx context.Context, key string, reader io.Reader, size int64) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	fileStorage     FileStorage
+	fileStorageErr  error
+	fileStorageOnce sync.Once
+)
+
+// GetFileStorage 按 FILE_STORAGE_TYPE 初始化文件存储
+func GetFileStorage() (FileStorage, error) {
+	fileStorageOnce.Do(func() {
+		switch constant.FileStorageType {
+		case constant.FileStorageTypeLocal:
+			fileStorage, fileStorageErr = newLocalFileStorage(constant.FileStoragePath)
+		case constant.FileStorageTypeS3:
+			fileStorage, fileStorageErr = newS3FileStorage()
+		default:
+			fileStorageErr = fmt.Errorf("unsupported file storage type: %s", constant.FileStorageType)
+		}
+		if fileStorageErr != nil {
+			common.SysError("failed to init file storage: " + fileStorageErr.Error())
+		}
+	})
+	return fileStorage, fileStorageErr
+}
+
+// ReadStorageFile 读取文件的全部内容
+func ReadStorageFile(ctx context.Context, key string) ([]byte, error) {
+	storage, err := GetFileStorage()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := storage.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// NewFileId 生成 Files API 的文件 ID
+func NewFileId() string {
+	return "file-" + common.GetRandomString(24)
+}
+
+// SaveUserFile 将文件内容写入文件存储并记录到数据库
+func SaveUserFile(ctx context.Context, userId int, filename string, purpose string, reader io.Reader, size int64) (*model.File, error) {
+	storage, err := GetFileStorage()
+	if err != nil {
+		return nil, err
+	}
+	file := &model.File{
+		Id:       NewFileId(),
+		UserId:   userId,
+		Filename: filename,
+		Purpose:  purpose,
+		Bytes:    size,
+	}
+	file.StorageKey = fmt.Sprintf("%d/%s", userId, file.Id)
+	if err = storage.Save(ctx, file.StorageKey, reader, size); err != nil {
+		return nil, err
+	}
+	if err = file.Insert(); err != nil {
+		_ = storage.Delete(ctx, file.StorageKey)
+		return nil, err
+	}
+	return file, nil
+}
+
+// DeleteUserFile 删除文件记录以及文件存储中的内容
+func DeleteUserFile(ctx context.Context, file *model.File) error {
+	if err := model.DeleteUserFileById(file.Id, file.UserId); err != nil {
+		return err
+	}
+	storage, err := GetFileStorage()
+	if err != nil {
+		return err
+	}
+	return storage.Delete(ctx, file.StorageKey)
+}
+
+type localFileStorage struct {
+	root string
+}
+
+func newLocalFileStorage(root string) (*localFileStorage, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &localFileStorage{root: root}, nil
+}
+
+func (s *localFileStorage) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+func (s *localFileStorage) Save(ctx context.Context, key string, reader io.Reader, size int64) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// 先写入临时文件再重命名，避免读到写了一半的文件
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *localFileStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+func (s *localFileStorage) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// s3FileStorage S3 兼容的对象存储，使用 SigV4 签名直接调用 REST 接口
+type s3FileStorage struct {
+	endpoint    *url.URL
+	bucket      string
+	region      string
+	pathStyle   bool
+	credentials aws.Credentials
+	signer      *v4.Signer
+	client      *http.Client
+}
+
+func newS3FileStorage() (*s3FileStorage, error) {
+	if constant.FileStorageS3Endpoint == "" || constant.FileStorageS3Bucket == "" {
+		return nil, errors.New("FILE_STORAGE_S3_ENDPOINT and FILE_STORAGE_S3_BUCKET are required")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(constant.FileStorageS3Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid FILE_STORAGE_S3_ENDPOINT: %s", constant.FileStorageS3Endpoint)
+	}
+	return &s3FileStorage{
+		endpoint:  endpoint,
+		bucket:    constant.FileStorageS3Bucket,
+		region:    constant.FileStorageS3Region,
+		pathStyle: constant.FileStorageS3PathStyle,
+		credentials: aws.Credentials{
+			AccessKeyID:     constant.FileStorageS3AccessKeyId,
+			SecretAccessKey: constant.FileStorageS3SecretAccessKey,
+		},
+		signer: v4.NewSigner(),
+		client: &http.Client{},
+	}, nil
+}
+
+func (s *s3FileStorage) objectURL(key string) string {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = u.Path + "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = u.Path + "/" + key
+	}
+	return u.String()
+}
+
+func (s *s3FileStorage) do(ctx context.Context, method string, key string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	// 上传的文件可能较大，不对请求体做签名
+	payloadHash := "UNSIGNED-PAYLOAD"
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if err = s.signer.SignHTTP(ctx, s.credentials, req, payloadHash, "s3", s.region, time.Now()); err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s failed: status code %d, %s", method, key, resp.StatusCode, string(message))
+	}
+	return resp, nil
+}
+
+func (s *s3FileStorage) Save(ctx context.Context, key string, reader io.Reader, size int64) error {
+	resp, err := s.do(ctx, http.MethodPut, key, reader, size)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *s3FileStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *s3FileStorage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,275 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/model"
+)
+
+// 每个时间桶每个阶段最多保留的样本数
+const latencyReservoirSize = 1000
+
+type latencyStatKey struct {
+	ChannelId int
+	Model     string
+}
+
+// latencyReservoir 以蓄水池抽样保留固定数量的样本（毫秒）
+type latencyReservoir struct {
+	seen    int64
+	samples []int64
+}
+
+func (r *latencyReservoir) add(ms int64) {
+	r.seen++
+	if len(r.samples) < latencyReservoirSize {
+		r.samples = append(r.samples, ms)
+		return
+	}
+	if i := rand.Int63n(r.seen); i < latencyReservoirSize {
+		r.samples[i] = ms
+	}
+}
+
+type latencySampleSet struct {
+	count      int64
+	auth       latencyReservoir
+	connect    latencyReservoir
+	firstToken latencyReservoir
+}
+
+type latencyBucket struct {
+	start int64
+	sets  map[latencyStatKey]*latencySampleSet
+}
+
+func newLatencyBucket(start int64) *latencyBucket {
+	return &latencyBucket{start: start, sets: make(map[latencyStatKey]*latencySampleSet)}
+}
+
+// LatencyPercentiles 单个阶段的延迟分位数（毫秒）
+type LatencyPercentiles struct {
+	P50 int64 `json:"p50"`
+	P90 int64 `json:"p90"`
+	P99 int64 `json:"p99"`
+}
+
+// LatencyStatsSnapshot 最近两个时间桶内的延迟分位数
+type LatencyStatsSnapshot struct {
+	ChannelId  int                `json:"channel_id,omitempty"`
+	Model      string             `json:"model,omitempty"`
+	Count      int64              `json:"count"`
+	Auth       LatencyPercentiles `json:"auth"`
+	Connect    LatencyPercentiles `json:"connect"`
+	FirstToken LatencyPercentiles `json:"first_token"`
+}
+
+// LatencyStatsCollector 按全局、渠道、模型三个维度汇总各阶段延迟，
+// 每个时间桶结束时把分位数写入 latency_stats，当前桶与上一个桶保留在内存中用于实时查询
+type LatencyStatsCollector struct {
+	mu       sync.Mutex
+	current  *latencyBucket
+	previous *latencyBucket
+}
+
+var latencyStatsCollector = &LatencyStatsCollector{}
+var latencyStatsOnce sync.Once
+
+func GetLatencyStatsCollector() *LatencyStatsCollector {
+	return latencyStatsCollector
+}
+
+// InitLatencyStats 启动定时落库与历史清理
+func InitLatencyStats() {
+	latencyStatsOnce.Do(func() {
+		go latencyStatsCollector.loop()
+	})
+}
+
+func latencyBucketSeconds() int64 {
+	if constant.LatencyStatBucketSeconds <= 0 {
+		return 300
+	}
+	return int64(constant.LatencyStatBucketSeconds)
+}
+
+func latencyBucketStart(now time.Time) int64 {
+	size := latencyBucketSeconds()
+	return now.Unix() / size * size
+}
+
+// Record 记录一次请求的各阶段延迟，未经过的阶段（如没有首字）不计入对应分位数
+func (lc *LatencyStatsCollector) Record(channelId int, modelName string, metrics *common.LatencyMetrics) {
+	if metrics == nil {
+		return
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.rotateLocked(time.Now())
+	keys := []latencyStatKey{{}, {ChannelId: channelId}}
+	if modelName != "" {
+		keys = append(keys, latencyStatKey{Model: modelName})
+	}
+	for _, key := range keys {
+		set := lc.current.sets[key]
+		if set == nil {
+			set = &latencySampleSet{}
+			lc.current.sets[key] = set
+		}
+		set.count++
+		if metrics.AuthLatency > 0 {
+			set.auth.add(metrics.AuthLatency.Milliseconds())
+		}
+		if metrics.ConnLatency > 0 {
+			set.connect.add(metrics.ConnLatency.Milliseconds())
+		}
+		if metrics.FirstTokenLatency > 0 {
+			set.firstToken.add(metrics.FirstTokenLatency.Milliseconds())
+		}
+	}
+}
+
+// rotateLocked 进入新的时间桶时异步保存已结束的桶
+func (lc *LatencyStatsCollector) rotateLocked(now time.Time) {
+	start := latencyBucketStart(now)
+	if lc.current == nil {
+		lc.current = newLatencyBucket(start)
+		return
+	}
+	if lc.current.start == start {
+		return
+	}
+	finished := lc.current
+	lc.previous = finished
+	if finished.start < start-latencyBucketSeconds() {
+		// 中间有空闲的桶，上一个桶已不属于最近的统计窗口
+		lc.previous = nil
+	}
+	lc.current = newLatencyBucket(start)
+	go saveLatencyBucket(finished)
+}
+
+func saveLatencyBucket(bucket *latencyBucket) {
+	stats := make([]*model.LatencyStat, 0, len(bucket.sets))
+	for key, set := range bucket.sets {
+		snapshot := set.snapshot(key)
+		stats = append(stats, &model.LatencyStat{
+			BucketStart:   bucket.start,
+			ChannelId:     key.ChannelId,
+			Model:         key.Model,
+			Count:         snapshot.Count,
+			AuthP50:       snapshot.Auth.P50,
+			AuthP90:       snapshot.Auth.P90,
+			AuthP99:       snapshot.Auth.P99,
+			ConnectP50:    snapshot.Connect.P50,
+			ConnectP90:    snapshot.Connect.P90,
+			ConnectP99:    snapshot.Connect.P99,
+			FirstTokenP50: snapshot.FirstToken.P50,
+			FirstTokenP90: snapshot.FirstToken.P90,
+			FirstTokenP99: snapshot.FirstToken.P99,
+		})
+	}
+	if err := model.SaveLatencyStats(stats); err != nil {
+		common.SysError("failed to save latency stats: " + err.Error())
+	}
+}
+
+func (set *latencySampleSet) snapshot(key latencyStatKey) LatencyStatsSnapshot {
+	return LatencyStatsSnapshot{
+		ChannelId:  key.ChannelId,
+		Model:      key.Model,
+		Count:      set.count,
+		Auth:       computePercentiles(set.auth.samples),
+		Connect:    computePercentiles(set.connect.samples),
+		FirstToken: computePercentiles(set.firstToken.samples),
+	}
+}
+
+func computePercentiles(samples []int64) LatencyPercentiles {
+	if len(samples) == 0 {
+		return LatencyPercentiles{}
+	}
+	sorted := make([]int64, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := func(p float64) int64 {
+		index := int(math.Ceil(p*float64(len(sorted)))) - 1
+		return sorted[max(index, 0)]
+	}
+	return LatencyPercentiles{P50: rank(0.5), P90: rank(0.9), P99: rank(0.99)}
+}
+
+// Snapshot 合并当前桶与上一个桶，返回全局、各渠道、各模型的实时分位数
+func (lc *LatencyStatsCollector) Snapshot() (global LatencyStatsSnapshot, channels []LatencyStatsSnapshot, models []LatencyStatsSnapshot) {
+	lc.mu.Lock()
+	lc.rotateLocked(time.Now())
+	merged := make(map[latencyStatKey]*latencySampleSet)
+	for _, bucket := range []*latencyBucket{lc.previous, lc.current} {
+		if bucket == nil {
+			continue
+		}
+		for key, set := range bucket.sets {
+			m := merged[key]
+			if m == nil {
+				m = &latencySampleSet{}
+				merged[key] = m
+			}
+			m.count += set.count
+			m.auth.samples = append(m.auth.samples, set.auth.samples...)
+			m.connect.samples = append(m.connect.samples, set.connect.samples...)
+			m.firstToken.samples = append(m.firstToken.samples, set.firstToken.samples...)
+		}
+	}
+	lc.mu.Unlock()
+
+	channels = make([]LatencyStatsSnapshot, 0)
+	models = make([]LatencyStatsSnapshot, 0)
+	for key, set := range merged {
+		snapshot := set.snapshot(key)
+		switch {
+		case key.ChannelId == 0 && key.Model == "":
+			global = snapshot
+		case key.Model == "":
+			channels = append(channels, snapshot)
+		default:
+			models = append(models, snapshot)
+		}
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].ChannelId < channels[j].ChannelId })
+	sort.Slice(models, func(i, j int) bool { return models[i].Model < models[j].Model })
+	return
+}
+
+// Reset 清空内存中的统计，已写入数据库的历史不受影响
+func (lc *LatencyStatsCollector) Reset() {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.current = nil
+	lc.previous = nil
+}
+
+func (lc *LatencyStatsCollector) loop() {
+	ticker := time.NewTicker(30 * time.Second)
+	lastCleanup := time.Time{}
+	for now := range ticker.C {
+		lc.mu.Lock()
+		lc.rotateLocked(now)
+		lc.mu.Unlock()
+		if common.IsMasterNode && constant.LatencyStatRetentionDays > 0 && now.Sub(lastCleanup) > time.Hour {
+			lastCleanup = now
+			target := now.AddDate(0, 0, -constant.LatencyStatRetentionDays).Unix()
+			if count, err := model.DeleteOldLatencyStats(target); err != nil {
+				common.SysError("failed to delete old latency stats: " + err.Error())
+			} else if count > 0 {
+				common.SysLog(fmt.Sprintf("deleted %d old latency stats", count))
+			}
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package service
 
 import (
+	"tea-api/constant"
 	"tea-api/dto"
 	relaycommon "tea-api/relay/common"
+	"tea-api/setting"
+	"tea-api/setting/operation_setting"
 
 	"github.com/gin-gonic/gin"
 )
@@ -24,6 +27,21 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
+	if chain := ctx.GetStringSlice(constant.ContextKeyGroupFallbackChain); len(chain) > 1 {
+		other["group_fallback"] = chain
+		other["billing_group"] = relayInfo.BillingGroup()
+	}
+	if requestedModel := ctx.GetString(constant.ContextKeyRequestedModel); requestedModel != "" && requestedModel != relayInfo.OriginModelName {
+		other["requested_model"] = requestedModel
+	}
+	if batchId := ctx.GetString(constant.ContextKeyBatchId); batchId != "" {
+		other["batch_id"] = batchId
+		other["batch_discount_ratio"] = operation_setting.GetBatchDiscountRatio(relayInfo.OriginModelName)
+	}
+	if ctx.GetBool(constant.ContextKeyResponseCacheHit) {
+		other["response_cache_hit"] = true
+		other["response_cache_ratio"] = setting.ResponseCacheHitRatio
+	}
 	adminInfo := make(map[string]interface{})
 	adminInfo["use_channel"] = ctx.GetStringSlice("use_channel")
 	other["admin_info"] = adminInfo
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"tea-api/setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetModelFallbackChain 返回模型请求失败后依次尝试的替代模型，
+// 令牌配置优先于分组/全局配置，令牌限制了可用模型时只保留允许的模型
+func GetModelFallbackChain(c *gin.Context, group string, modelName string) []string {
+	var fallbacks []string
+	if tokenFallbacks, ok := c.Get("token_model_fallbacks"); ok {
+		if m, ok := tokenFallbacks.(map[string][]string); ok {
+			fallbacks = m[modelName]
+		}
+	}
+	if len(fallbacks) == 0 {
+		fallbacks = setting.GetModelFallbacks(group, modelName)
+	}
+	if len(fallbacks) == 0 {
+		return nil
+	}
+
+	var tokenModelLimit map[string]bool
+	if c.GetBool("token_model_limit_enabled") {
+		if s, ok := c.Get("token_model_limit"); ok {
+			tokenModelLimit, _ = s.(map[string]bool)
+		}
+		if tokenModelLimit == nil {
+			return nil
+		}
+	}
+	seen := map[string]bool{modelName: true}
+	chain := make([]string, 0, len(fallbacks))
+	for _, fallback := range fallbacks {
+		if fallback == "" || seen[fallback] {
+			continue
+		}
+		seen[fallback] = true
+		if tokenModelLimit != nil && !tokenModelLimit[fallback] {
+			continue
+		}
+		chain = append(chain, fallback)
+	}
+	return chain
+}
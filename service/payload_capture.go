@@ -0,0 +1,337 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/model"
+	"tea-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const payloadRedacted = "[REDACTED]"
+
+var (
+	payloadApiKeyRegex = regexp.MustCompile(`\b(?:sk|ak|rk|pk)-[A-Za-z0-9_\-]{16,}|\bBearer\s+[A-Za-z0-9._~+/\-]{16,}=*|\bAKIA[0-9A-Z]{16}\b|\bAIza[0-9A-Za-z_\-]{35}`)
+	payloadEmailRegex  = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)
+)
+
+// 自定义脱敏正则按配置内容缓存，配置变化后重新编译
+var (
+	payloadPatternsMutex sync.Mutex
+	payloadPatternsKey   string
+	payloadPatterns      []*regexp.Regexp
+)
+
+// ShouldCapturePayload 全局留存开启，且令牌或用户开启了留存时返回 true
+func ShouldCapturePayload(c *gin.Context) bool {
+	if !operation_setting.GetPayloadCaptureSetting().Enabled {
+		return false
+	}
+	if c.GetBool(constant.ContextKeyTokenPayloadCapture) {
+		return true
+	}
+	enabled, _ := c.GetStringMap(constant.ContextKeyUserSetting)[constant.UserSettingPayloadCapture].(bool)
+	return enabled
+}
+
+// PayloadCaptureLimit 请求体和响应体各自保存的最大字节数
+func PayloadCaptureLimit() int {
+	maxBodyKB := operation_setting.GetPayloadCaptureSetting().MaxBodyKB
+	if maxBodyKB <= 0 {
+		maxBodyKB = 64
+	}
+	return maxBodyKB * 1024
+}
+
+func getPayloadRedactPatterns(patterns []string) []*regexp.Regexp {
+	key := strings.Join(patterns, "\x00")
+	payloadPatternsMutex.Lock()
+	defer payloadPatternsMutex.Unlock()
+	if key == payloadPatternsKey && payloadPatterns != nil {
+		return payloadPatterns
+	}
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			common.SysError(fmt.Sprintf("invalid payload redact pattern %s: %v", pattern, err))
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	payloadPatternsKey = key
+	payloadPatterns = compiled
+	return compiled
+}
+
+// RedactPayload 按配置脱敏请求或响应内容：先按字段名替换 JSON 字段的值，再按正则替换 API 密钥、邮箱和自定义内容。
+// 支持完整的 JSON、SSE 流以及被截断的 JSON，后者只能替换字符串和标量类型的字段值。
+func RedactPayload(text string) string {
+	setting := operation_setting.GetPayloadCaptureSetting()
+	if len(setting.RedactFields) > 0 {
+		fields := make(map[string]bool, len(setting.RedactFields))
+		for _, field := range setting.RedactFields {
+			fields[strings.ToLower(field)] = true
+		}
+		text = redactPayloadFields(text, fields)
+	}
+	if setting.RedactApiKeys {
+		text = payloadApiKeyRegex.ReplaceAllString(text, payloadRedacted)
+	}
+	if setting.RedactEmails {
+		text = payloadEmailRegex.ReplaceAllString(text, payloadRedacted)
+	}
+	for _, re := range getPayloadRedactPatterns(setting.RedactPatterns) {
+		text = re.ReplaceAllString(text, payloadRedacted)
+	}
+	return text
+}
+
+func redactPayloadFields(text string, fields map[string]bool) string {
+	if redacted, ok := redactPayloadJSONFields(text, fields); ok {
+		return redacted
+	}
+	// SSE 流逐行处理 data 中的 JSON
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if data, ok := strings.CutPrefix(line, "data:"); ok {
+			if redacted, ok := redactPayloadJSONFields(strings.TrimSpace(data), fields); ok {
+				lines[i] = "data: " + redacted
+				continue
+			}
+		}
+		lines[i] = redactPayloadFieldsByRegex(line, fields)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func redactPayloadJSONFields(text string, fields map[string]bool) (string, bool) {
+	if !json.Valid([]byte(text)) {
+		return "", false
+	}
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return "", false
+	}
+	// 没有命中的字段时保留原文，避免重新编码改变字段顺序
+	if !redactPayloadValue(value, fields) {
+		return text, true
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+// redactPayloadValue 原地替换命中字段的值，返回是否有字段被替换
+func redactPayloadValue(value any, fields map[string]bool) bool {
+	redacted := false
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if fields[strings.ToLower(key)] {
+				v[key] = payloadRedacted
+				redacted = true
+			} else if redactPayloadValue(item, fields) {
+				redacted = true
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if redactPayloadValue(item, fields) {
+				redacted = true
+			}
+		}
+	}
+	return redacted
+}
+
+// payloadFieldRegex 匹配 JSON 中字符串或标量类型的字段值，用于无法完整解析的内容
+var payloadFieldRegex = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"(\s*:\s*)("(?:[^"\\]|\\.)*"?|-?[0-9][0-9.eE+\-]*|true|false|null)`)
+
+func redactPayloadFieldsByRegex(text string, fields map[string]bool) string {
+	return payloadFieldRegex.ReplaceAllStringFunc(text, func(match string) string {
+		groups := payloadFieldRegex.FindStringSubmatch(match)
+		if !fields[strings.ToLower(groups[1])] {
+			return match
+		}
+		return `"` + groups[1] + `"` + groups[2] + `"` + payloadRedacted + `"`
+	})
+}
+
+// truncatePayload 截断到 limit 字节以内，不截断多字节字符
+func truncatePayload(text string, limit int) (string, bool) {
+	if len(text) <= limit {
+		return text, false
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut], true
+}
+
+// payloadStreamChunk 兼容 OpenAI Chat/Completions、Claude、Responses 和 Gemini 流式数据块中的文本字段
+type payloadStreamChunk struct {
+	Type    string          `json:"type"`
+	Delta   json.RawMessage `json:"delta"`
+	Choices []struct {
+		Text  string `json:"text"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+	} `json:"candidates"`
+}
+
+// ReassembleStreamText 将 SSE 流式响应中的增量文本拼接为完整的输出文本，不包括思考内容
+func ReassembleStreamText(body []byte) string {
+	var builder strings.Builder
+	for _, line := range strings.Split(string(body), "\n") {
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		var chunk payloadStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+		switch chunk.Type {
+		case "content_block_delta":
+			var delta struct {
+				Text string `json:"text"`
+			}
+			if json.Unmarshal(chunk.Delta, &delta) == nil {
+				builder.WriteString(delta.Text)
+			}
+			continue
+		case "response.output_text.delta":
+			var delta string
+			if json.Unmarshal(chunk.Delta, &delta) == nil {
+				builder.WriteString(delta)
+			}
+			continue
+		}
+		for _, choice := range chunk.Choices {
+			builder.WriteString(choice.Delta.Content)
+			builder.WriteString(choice.Text)
+		}
+		for _, candidate := range chunk.Candidates {
+			for _, part := range candidate.Content.Parts {
+				builder.WriteString(part.Text)
+			}
+		}
+	}
+	return builder.String()
+}
+
+// describeMultipartForm 表单请求只保存文本字段和文件名、大小，不保存文件内容
+func describeMultipartForm(form *multipart.Form) string {
+	description := make(map[string]any)
+	for name, values := range form.Value {
+		if len(values) == 1 {
+			description[name] = values[0]
+		} else {
+			description[name] = values
+		}
+	}
+	for name, files := range form.File {
+		items := make([]string, 0, len(files))
+		for _, file := range files {
+			items = append(items, fmt.Sprintf("%s (%d bytes)", file.Filename, file.Size))
+		}
+		sort.Strings(items)
+		description[name] = items
+	}
+	data, _ := json.Marshal(description)
+	return string(data)
+}
+
+func isTextualContentType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return contentType == "" || strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "json") || strings.Contains(contentType, "xml")
+}
+
+// RecordPayloadCapture 脱敏、截断后保存本次请求的请求体与响应内容。
+// responseBody 为响应的前若干字节，responseTruncated 表示响应超出了保留上限，responseSize 为响应的实际大小。
+func RecordPayloadCapture(c *gin.Context, requestBody []byte, responseBody []byte, responseTruncated bool, responseSize int) {
+	limit := PayloadCaptureLimit()
+	capture := &model.PayloadCapture{
+		RequestId:  c.GetString(common.RequestIdKey),
+		UserId:     c.GetInt("id"),
+		TokenId:    c.GetInt("token_id"),
+		ModelName:  c.GetString("original_model"),
+		Path:       c.Request.URL.Path,
+		StatusCode: c.Writer.Status(),
+	}
+
+	requestContentType := c.Request.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(requestContentType, "multipart/form-data") && c.Request.MultipartForm != nil:
+		capture.RequestBody = RedactPayload(describeMultipartForm(c.Request.MultipartForm))
+	case isTextualContentType(requestContentType):
+		capture.RequestBody, capture.RequestTruncated = truncatePayload(RedactPayload(string(requestBody)), limit)
+	default:
+		capture.RequestBody = fmt.Sprintf("[%s, %d bytes]", requestContentType, len(requestBody))
+	}
+
+	responseContentType := c.Writer.Header().Get("Content-Type")
+	switch {
+	case strings.HasPrefix(responseContentType, "text/event-stream"):
+		capture.IsStream = true
+		capture.StreamText, _ = truncatePayload(RedactPayload(ReassembleStreamText(responseBody)), limit)
+		fallthrough
+	case isTextualContentType(responseContentType):
+		var truncated bool
+		capture.ResponseBody, truncated = truncatePayload(RedactPayload(string(responseBody)), limit)
+		capture.ResponseTruncated = responseTruncated || truncated
+	default:
+		capture.ResponseBody = fmt.Sprintf("[%s, %d bytes]", responseContentType, responseSize)
+	}
+	model.RecordPayloadCapture(capture)
+}
+
+// CleanPayloadCaptures 定期删除超过保留天数的留存内容，仅在主节点运行
+func CleanPayloadCaptures() {
+	for {
+		retentionDays := operation_setting.GetPayloadCaptureSetting().RetentionDays
+		if retentionDays > 0 {
+			expiredAt := time.Now().AddDate(0, 0, -retentionDays).Unix()
+			count, err := model.DeletePayloadCapturesBefore(expiredAt)
+			if err != nil {
+				common.SysError("failed to clean payload captures: " + err.Error())
+			} else if count > 0 {
+				common.SysLog(fmt.Sprintf("cleaned %d payload captures", count))
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"tea-api/model"
+	"tea-api/setting"
+)
+
+// PaymentOrder 发起支付的充值订单
+type PaymentOrder struct {
+	TradeNo string
+	Name    string
+	Money   float64
+	// PaymentMethod 易支付的支付方式，alipay 或 wxpay
+	PaymentMethod string
+	NotifyUrl     string
+	ReturnUrl     string
+	CancelUrl     string
+}
+
+// PaymentCheckout 拉起支付的结果，前端跳转到 URL，Params 不为空时以表单提交
+type PaymentCheckout struct {
+	URL             string
+	Params          map[string]string
+	ProviderOrderId string
+}
+
+// PaymentEvent 验签通过的支付回调
+type PaymentEvent struct {
+	TradeNo         string
+	ProviderOrderId string
+	// Paid 为 false 表示与支付成功无关的回调，只需确认收到
+	Paid bool
+}
+
+// PaymentOrderStatus 支付渠道查询到的订单状态
+type PaymentOrderStatus struct {
+	TradeNo         string `json:"trade_no"`
+	ProviderOrderId string `json:"provider_order_id"`
+	Paid            bool   `json:"paid"`
+	Raw             string `json:"raw"`
+}
+
+// PaymentProvider 在线充值的支付渠道
+type PaymentProvider interface {
+	// Name 支付渠道名称，保存在充值订单中
+	Name() string
+	// CreateCheckout 在支付渠道创建订单，返回前端跳转的支付页面
+	CreateCheckout(ctx context.Context, order *PaymentOrder) (*PaymentCheckout, error)
+	// VerifyWebhook 校验支付回调的签名并解析订单的支付结果
+	VerifyWebhook(r *http.Request, body []byte) (*PaymentEvent, error)
+	// Refund 对已支付的订单全额原路退款
+	Refund(ctx context.Context, topUp *model.TopUp) error
+	// QueryOrder 向支付渠道查询订单的支付状态
+	QueryOrder(ctx context.Context, topUp *model.TopUp) (*PaymentOrderStatus, error)
+}
+
+// paymentRequestTimeout 请求支付渠道接口的超时时间
+const paymentRequestTimeout = 30 * time.Second
+
+var ErrPaymentNotConfigured = errors.New("当前管理员未配置支付信息")
+
+// GetPaymentProvider 返回当前部署选择的支付渠道
+func GetPaymentProvider() (PaymentProvider, error) {
+	return GetPaymentProviderByName(setting.PaymentProvider)
+}
+
+// GetPaymentProviderByName 按名称返回支付渠道，用于处理已创建订单的回调、查询和退款
+func GetPaymentProviderByName(name string) (PaymentProvider, error) {
+	switch name {
+	case setting.PaymentProviderEpay, "":
+		if setting.PayAddress == "" || setting.EpayId == "" || setting.EpayKey == "" {
+			return nil, ErrPaymentNotConfigured
+		}
+		return newEpayProvider()
+	case setting.PaymentProviderStripe:
+		if setting.StripeApiSecret == "" || setting.StripeWebhookSecret == "" {
+			return nil, ErrPaymentNotConfigured
+		}
+		return newStripeProvider(), nil
+	}
+	return nil, fmt.Errorf("unsupported payment provider: %s", name)
+}
+
+// IsOnlineTopUpEnabled 当前选择的支付渠道已配置时开启在线充值
+func IsOnlineTopUpEnabled() bool {
+	_, err := GetPaymentProvider()
+	return err == nil
+}
+
+// GetPaymentPrice 每美金额度在当前支付渠道结算币种下的价格
+func GetPaymentPrice() float64 {
+	if setting.PaymentProvider == setting.PaymentProviderStripe {
+		return setting.StripePrice
+	}
+	return setting.Price
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"tea-api/model"
+	"tea-api/setting"
+
+	"github.com/Calcium-Ion/go-epay/epay"
+)
+
+// epayProvider 易支付，下单和回调验签使用 go-epay，查询和退款使用易支付的 api.php 接口
+type epayProvider struct {
+	client *epay.Client
+}
+
+func newEpayProvider() (*epayProvider, error) {
+	client, err := epay.NewClient(&epay.Config{
+		PartnerID: setting.EpayId,
+		Key:       setting.EpayKey,
+	}, setting.PayAddress)
+	if err != nil {
+		return nil, err
+	}
+	return &epayProvider{client: client}, nil
+}
+
+func (p *epayProvider) Name() string {
+	return setting.PaymentProviderEpay
+}
+
+func (p *epayProvider) CreateCheckout(ctx context.Context, order *PaymentOrder) (*PaymentCheckout, error) {
+	notifyUrl, err := url.Parse(order.NotifyUrl)
+	if err != nil {
+		return nil, err
+	}
+	returnUrl, err := url.Parse(order.ReturnUrl)
+	if err != nil {
+		return nil, err
+	}
+	uri, params, err := p.client.Purchase(&epay.PurchaseArgs{
+		Type:           order.PaymentMethod,
+		ServiceTradeNo: order.TradeNo,
+		Name:           order.Name,
+		Money:          strconv.FormatFloat(order.Money, 'f', 2, 64),
+		Device:         epay.PC,
+		NotifyUrl:      notifyUrl,
+		ReturnUrl:      returnUrl,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentCheckout{URL: uri, Params: params}, nil
+}
+
+// VerifyWebhook 易支付以 GET 参数回调
+func (p *epayProvider) VerifyWebhook(r *http.Request, body []byte) (*PaymentEvent, error) {
+	params := make(map[string]string)
+	for key := range r.URL.Query() {
+		params[key] = r.URL.Query().Get(key)
+	}
+	verifyInfo, err := p.client.Verify(params)
+	if err != nil {
+		return nil, err
+	}
+	if !verifyInfo.VerifyStatus {
+		return nil, errors.New("易支付回调签名验证失败")
+	}
+	return &PaymentEvent{
+		TradeNo:         verifyInfo.ServiceTradeNo,
+		ProviderOrderId: verifyInfo.TradeNo,
+		Paid:            verifyInfo.TradeStatus == epay.StatusTradeSuccess,
+	}, nil
+}
+
+func (p *epayProvider) Refund(ctx context.Context, topUp *model.TopUp) error {
+	form := url.Values{}
+	form.Set("pid", setting.EpayId)
+	form.Set("key", setting.EpayKey)
+	form.Set("out_trade_no", topUp.TradeNo)
+	form.Set("money", strconv.FormatFloat(topUp.Money, 'f', 2, 64))
+	result, _, err := p.doApiRequest(ctx, http.MethodPost, "refund", form)
+	if err != nil {
+		return err
+	}
+	if fmt.Sprint(result["code"]) != "1" {
+		return fmt.Errorf("易支付退款失败: %v", result["msg"])
+	}
+	return nil
+}
+
+func (p *epayProvider) QueryOrder(ctx context.Context, topUp *model.TopUp) (*PaymentOrderStatus, error) {
+	query := url.Values{}
+	query.Set("pid", setting.EpayId)
+	query.Set("key", setting.EpayKey)
+	query.Set("out_trade_no", topUp.TradeNo)
+	result, raw, err := p.doApiRequest(ctx, http.MethodGet, "order", query)
+	if err != nil {
+		return nil, err
+	}
+	if fmt.Sprint(result["code"]) != "1" {
+		return nil, fmt.Errorf("易支付查询订单失败: %v", result["msg"])
+	}
+	providerOrderId, _ := result["trade_no"].(string)
+	return &PaymentOrderStatus{
+		TradeNo:         topUp.TradeNo,
+		ProviderOrderId: providerOrderId,
+		Paid:            fmt.Sprint(result["status"]) == "1",
+		Raw:             raw,
+	}, nil
+}
+
+// doApiRequest 请求易支付的 api.php?act=xxx 接口，返回解析后的 JSON 与原始响应
+func (p *epayProvider) doApiRequest(ctx context.Context, method string, act string, params url.Values) (map[string]any, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, paymentRequestTimeout)
+	defer cancel()
+	requestUrl := strings.TrimSuffix(setting.PayAddress, "/") + "/api.php?act=" + act
+	var body io.Reader
+	if method == http.MethodGet {
+		requestUrl += "&" + params.Encode()
+	} else {
+		body = strings.NewReader(params.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, requestUrl, body)
+	if err != nil {
+		return nil, "", err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	var result map[string]any
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, "", fmt.Errorf("易支付返回了无效的响应: %s", string(data))
+	}
+	return result, string(data), nil
+}
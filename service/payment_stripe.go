@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"tea-api/model"
+	"tea-api/setting"
+)
+
+// stripeWebhookTolerance 回调签名时间戳允许的最大偏差，防止重放
+const stripeWebhookTolerance = 5 * time.Minute
+
+// stripeZeroDecimalCurrencies 没有小数单位的币种，金额不需要乘以 100
+var stripeZeroDecimalCurrencies = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, "jpy": true, "kmf": true, "krw": true, "mga": true,
+	"pyg": true, "rwf": true, "ugx": true, "vnd": true, "vuv": true, "xaf": true, "xof": true, "xpf": true,
+}
+
+// stripeProvider Stripe Checkout，直接调用 Stripe 的 REST API
+type stripeProvider struct {
+	apiAddress    string
+	apiSecret     string
+	webhookSecret string
+	currency      string
+}
+
+func newStripeProvider() *stripeProvider {
+	return &stripeProvider{
+		apiAddress:    strings.TrimSuffix(setting.StripeApiAddress, "/"),
+		apiSecret:     setting.StripeApiSecret,
+		webhookSecret: setting.StripeWebhookSecret,
+		currency:      strings.ToLower(setting.StripeCurrency),
+	}
+}
+
+type stripeCheckoutSession struct {
+	Id                string            `json:"id"`
+	Url               string            `json:"url"`
+	ClientReferenceId string            `json:"client_reference_id"`
+	PaymentIntent     string            `json:"payment_intent"`
+	PaymentStatus     string            `json:"payment_status"`
+	Status            string            `json:"status"`
+	Metadata          map[string]string `json:"metadata"`
+}
+
+type stripeEvent struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+func (p *stripeProvider) Name() string {
+	return setting.PaymentProviderStripe
+}
+
+// StripeUnitAmount 将支付金额转换为 Stripe 使用的最小货币单位
+func StripeUnitAmount(money float64, currency string) int64 {
+	if stripeZeroDecimalCurrencies[strings.ToLower(currency)] {
+		return int64(math.Round(money))
+	}
+	return int64(math.Round(money * 100))
+}
+
+func (p *stripeProvider) CreateCheckout(ctx context.Context, order *PaymentOrder) (*PaymentCheckout, error) {
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("success_url", order.ReturnUrl)
+	form.Set("cancel_url", order.CancelUrl)
+	form.Set("client_reference_id", order.TradeNo)
+	form.Set("metadata[trade_no]", order.TradeNo)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", p.currency)
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(StripeUnitAmount(order.Money, p.currency), 10))
+	form.Set("line_items[0][price_data][product_data][name]", order.Name)
+	var session stripeCheckoutSession
+	if err := p.doRequest(ctx, http.MethodPost, "/v1/checkout/sessions", form, order.TradeNo, &session); err != nil {
+		return nil, err
+	}
+	return &PaymentCheckout{URL: session.Url, ProviderOrderId: session.Id}, nil
+}
+
+// VerifyWebhook 按 Stripe-Signature 校验回调，只有 Checkout 支付完成的事件视为支付成功
+func (p *stripeProvider) VerifyWebhook(r *http.Request, body []byte) (*PaymentEvent, error) {
+	if err := VerifyStripeSignature(body, r.Header.Get("Stripe-Signature"), p.webhookSecret, time.Now()); err != nil {
+		return nil, err
+	}
+	var event stripeEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	switch event.Type {
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded":
+	default:
+		return &PaymentEvent{}, nil
+	}
+	var session stripeCheckoutSession
+	if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+		return nil, err
+	}
+	tradeNo := session.ClientReferenceId
+	if tradeNo == "" {
+		tradeNo = session.Metadata["trade_no"]
+	}
+	return &PaymentEvent{
+		TradeNo:         tradeNo,
+		ProviderOrderId: session.Id,
+		// 异步支付方式（如银行转账）完成 Checkout 时尚未到账，等待 async_payment_succeeded
+		Paid: session.PaymentStatus == "paid",
+	}, nil
+}
+
+// VerifyStripeSignature 校验 Stripe-Signature 请求头：t 为时间戳，v1 为 HMAC-SHA256(t.body) 的签名，可能有多个
+func VerifyStripeSignature(body []byte, header string, secret string, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, item := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return errors.New("invalid stripe signature header")
+	}
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid stripe signature timestamp")
+	}
+	if diff := now.Sub(time.Unix(signedAt, 0)); diff > stripeWebhookTolerance || diff < -stripeWebhookTolerance {
+		return errors.New("stripe signature timestamp outside the tolerance")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+	for _, signature := range signatures {
+		actual, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(actual, expected) {
+			return nil
+		}
+	}
+	return errors.New("stripe signature mismatch")
+}
+
+func (p *stripeProvider) Refund(ctx context.Context, topUp *model.TopUp) error {
+	session, err := p.getSession(ctx, topUp)
+	if err != nil {
+		return err
+	}
+	if session.PaymentIntent == "" {
+		return errors.New("订单尚未支付")
+	}
+	form := url.Values{}
+	form.Set("payment_intent", session.PaymentIntent)
+	form.Set("metadata[trade_no]", topUp.TradeNo)
+	return p.doRequest(ctx, http.MethodPost, "/v1/refunds", form, "refund-"+topUp.TradeNo, nil)
+}
+
+func (p *stripeProvider) QueryOrder(ctx context.Context, topUp *model.TopUp) (*PaymentOrderStatus, error) {
+	session, err := p.getSession(ctx, topUp)
+	if err != nil {
+		return nil, err
+	}
+	raw, _ := json.Marshal(session)
+	return &PaymentOrderStatus{
+		TradeNo:         topUp.TradeNo,
+		ProviderOrderId: session.Id,
+		Paid:            session.PaymentStatus == "paid",
+		Raw:             string(raw),
+	}, nil
+}
+
+func (p *stripeProvider) getSession(ctx context.Context, topUp *model.TopUp) (*stripeCheckoutSession, error) {
+	if topUp.ProviderOrderId == "" {
+		return nil, errors.New("订单没有对应的 Stripe Checkout Session")
+	}
+	var session stripeCheckoutSession
+	if err := p.doRequest(ctx, http.MethodGet, "/v1/checkout/sessions/"+url.PathEscape(topUp.ProviderOrderId), nil, "", &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// doRequest 以表单格式请求 Stripe API，idempotencyKey 不为空时重复请求只会执行一次
+func (p *stripeProvider) doRequest(ctx context.Context, method string, path string, form url.Values, idempotencyKey string, result any) error {
+	ctx, cancel := context.WithTimeout(ctx, paymentRequestTimeout)
+	defer cancel()
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.apiAddress+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.apiSecret)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var stripeErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &stripeErr) == nil && stripeErr.Error.Message != "" {
+			return fmt.Errorf("stripe error: %s", stripeErr.Error.Message)
+		}
+		return fmt.Errorf("stripe error: status code %d", resp.StatusCode)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
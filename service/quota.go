@@ -78,7 +78,7 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 	if relayInfo.UsePrice {
 		return nil
 	}
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	userQuota, err := GetUserAvailableQuota(relayInfo)
 	if err != nil {
 		return err
 	}
@@ -93,7 +93,7 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 	textOutTokens := usage.OutputTokenDetails.TextTokens
 	audioInputTokens := usage.InputTokenDetails.AudioTokens
 	audioOutTokens := usage.OutputTokenDetails.AudioTokens
-	groupRatio := setting.GetGroupRatio(relayInfo.Group)
+	groupRatio := setting.GetGroupRatio(relayInfo.BillingGroup())
 	modelRatio, _ := operation_setting.GetModelRatio(modelName)
 
 	quotaInfo := QuotaInfo{
@@ -120,6 +120,15 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 	if !token.UnlimitedQuota && token.RemainQuota < quota {
 		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", common.FormatQuota(token.RemainQuota), common.FormatQuota(quota))
 	}
+	if token.HasQuotaWindowLimits() || token.TpmLimit > 0 {
+		usage := model.GetTokenUsage(token.Id)
+		if err = CheckTokenQuotaWindows(token, usage, quota); err != nil {
+			return err
+		}
+		if token.TpmLimit > 0 && relayInfo.BatchId == "" && usage.Minute.Tokens+int64(relayInfo.PromptTokens) > int64(token.TpmLimit) {
+			return fmt.Errorf("令牌 token 用量超出限制，每分钟最多 %d tokens", token.TpmLimit)
+		}
+	}
 
 	err = PostConsumeQuota(relayInfo, quota, 0, false)
 	if err != nil {
@@ -338,6 +347,17 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 		tokenName, quota, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), relayInfo.IsStream, relayInfo.Group, other)
 }
 
+// CheckTokenPreConsumeQuota 检查令牌剩余额度以及按时间窗口的额度上限是否足够预扣 quota
+func CheckTokenPreConsumeQuota(token *model.Token, unlimited bool, quota int) error {
+	if !unlimited && token.RemainQuota < quota {
+		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", common.FormatQuota(token.RemainQuota), common.FormatQuota(quota))
+	}
+	if token.HasQuotaWindowLimits() {
+		return CheckTokenQuotaWindows(token, model.GetTokenUsage(token.Id), quota)
+	}
+	return nil
+}
+
 func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
@@ -352,8 +372,8 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	if err != nil {
 		return err
 	}
-	if !relayInfo.TokenUnlimited && token.RemainQuota < quota {
-		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", common.FormatQuota(token.RemainQuota), common.FormatQuota(quota))
+	if err = CheckTokenPreConsumeQuota(token, relayInfo.TokenUnlimited, quota); err != nil {
+		return err
 	}
 	err = model.DecreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota)
 	if err != nil {
@@ -364,10 +384,15 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 
 func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool) (err error) {
 
-	if quota > 0 {
-		err = model.DecreaseUserQuota(relayInfo.UserId, quota)
+	// 优先使用订阅额度，剩余部分从余额中扣除
+	userQuota, err := splitSubscriptionQuota(relayInfo, quota)
+	if err != nil {
+		return err
+	}
+	if userQuota > 0 {
+		err = model.DecreaseUserQuota(relayInfo.UserId, userQuota)
 	} else {
-		err = model.IncreaseUserQuota(relayInfo.UserId, -quota, false)
+		err = model.IncreaseUserQuota(relayInfo.UserId, -userQuota, false)
 	}
 	if err != nil {
 		return err
@@ -1,15 +1,23 @@
 package service
 
 import (
+	"encoding/json"
 	"regexp"
+	"sort"
 	"sync"
+	"tea-api/common"
+	"tea-api/dto"
+	"tea-api/setting"
 )
 
 // RegexRule represents a filter rule.
 type RegexRule struct {
-	Pattern *regexp.Regexp
-	Group   string
-	Raw     string
+	Pattern     *regexp.Regexp
+	Group       string
+	Raw         string
+	Name        string
+	Action      string
+	Replacement string
 }
 
 type RegexFilter struct {
@@ -22,12 +30,28 @@ func NewRegexFilter() *RegexFilter {
 }
 
 func (f *RegexFilter) AddRule(group, expr string) error {
-	r, err := regexp.Compile(expr)
+	return f.AddFilterRule(group, setting.RegexFilterRule{
+		Name:    expr,
+		Pattern: expr,
+		Action:  setting.RegexFilterActionBlock,
+	})
+}
+
+// AddFilterRule 添加一条带动作的规则
+func (f *RegexFilter) AddFilterRule(group string, rule setting.RegexFilterRule) error {
+	r, err := regexp.Compile(rule.Pattern)
 	if err != nil {
 		return err
 	}
 	f.mu.Lock()
-	f.rules = append(f.rules, RegexRule{Pattern: r, Group: group, Raw: expr})
+	f.rules = append(f.rules, RegexRule{
+		Pattern:     r,
+		Group:       group,
+		Raw:         rule.Pattern,
+		Name:        rule.Name,
+		Action:      rule.Action,
+		Replacement: rule.GetReplacement(),
+	})
 	f.mu.Unlock()
 	return nil
 }
@@ -43,3 +67,218 @@ func (f *RegexFilter) Check(text string) (bool, string) {
 	}
 	return false, ""
 }
+
+// RegexMatch 命中的规则
+type RegexMatch struct {
+	Group  string `json:"group"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+}
+
+func (m RegexMatch) String() string {
+	return m.Group + "/" + m.Name
+}
+
+// Filter 依次应用全部规则，返回 mask 后的文本和命中的规则，skip 返回 true 的规则组不参与匹配
+func (f *RegexFilter) Filter(text string, skip func(group string) bool) (string, []RegexMatch) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var matches []RegexMatch
+	for _, rule := range f.rules {
+		if skip != nil && skip(rule.Group) {
+			continue
+		}
+		if !rule.Pattern.MatchString(text) {
+			continue
+		}
+		matches = append(matches, RegexMatch{Group: rule.Group, Name: rule.Name, Action: rule.Action})
+		if rule.Action == setting.RegexFilterActionMask {
+			text = rule.Pattern.ReplaceAllLiteralString(text, rule.Replacement)
+		}
+	}
+	return text, matches
+}
+
+var (
+	regexFilterLock    sync.Mutex
+	regexFilter        *RegexFilter
+	regexFilterVersion int64 = -1
+)
+
+// GetRegexFilter 返回按当前配置编译的过滤器，规则更新后自动重新编译
+func GetRegexFilter() *RegexFilter {
+	regexFilterLock.Lock()
+	defer regexFilterLock.Unlock()
+	if regexFilter != nil && regexFilterVersion == setting.GetRegexFilterRuleVersion() {
+		return regexFilter
+	}
+	groups, version := setting.GetRegexFilterRuleGroups()
+	// 按规则组名排序，保证 mask 的先后顺序稳定
+	groupNames := make([]string, 0, len(groups))
+	for groupName := range groups {
+		groupNames = append(groupNames, groupName)
+	}
+	sort.Strings(groupNames)
+	filter := NewRegexFilter()
+	for _, groupName := range groupNames {
+		group := groups[groupName]
+		if !group.Enabled {
+			continue
+		}
+		for _, rule := range group.Rules {
+			if err := filter.AddFilterRule(groupName, rule); err != nil {
+				common.SysError("invalid regex filter rule " + groupName + "/" + rule.Name + ": " + err.Error())
+			}
+		}
+	}
+	regexFilter = filter
+	regexFilterVersion = version
+	return regexFilter
+}
+
+// RegexFilterScope 单次请求的正则过滤，已应用分组和令牌豁免
+type RegexFilterScope struct {
+	filter  *RegexFilter
+	exempt  map[string]bool
+	matches []RegexMatch
+	blocked *RegexMatch
+	masked  bool
+}
+
+// NewRegexFilterScope 未启用正则过滤或已全部豁免时返回 nil
+func NewRegexFilterScope(group string, tokenId int) *RegexFilterScope {
+	if !setting.RegexFilterEnabled {
+		return nil
+	}
+	exempt := setting.GetRegexFilterExemptGroups(group, tokenId)
+	if exempt[setting.RegexFilterExemptAll] {
+		return nil
+	}
+	return &RegexFilterScope{
+		filter: GetRegexFilter(),
+		exempt: exempt,
+	}
+}
+
+// ApplyText 过滤一段文本，返回 mask 后的文本
+func (s *RegexFilterScope) ApplyText(text string) string {
+	if text == "" || s.blocked != nil {
+		return text
+	}
+	filtered, matches := s.filter.Filter(text, func(group string) bool {
+		return s.exempt[group]
+	})
+	for i, match := range matches {
+		switch match.Action {
+		case setting.RegexFilterActionBlock:
+			if s.blocked == nil {
+				s.blocked = &matches[i]
+			}
+		case setting.RegexFilterActionMask:
+			s.masked = true
+		}
+	}
+	s.matches = append(s.matches, matches...)
+	return filtered
+}
+
+// ApplyValue 过滤 JSON 解码后的任意内容：字符串、字符串数组，以及对象中 text 和 content 字段
+func (s *RegexFilterScope) ApplyValue(value any) any {
+	switch v := value.(type) {
+	case string:
+		return s.ApplyText(v)
+	case []string:
+		for i := range v {
+			v[i] = s.ApplyText(v[i])
+		}
+		return v
+	case []any:
+		for i := range v {
+			v[i] = s.ApplyValue(v[i])
+		}
+		return v
+	case map[string]any:
+		for key, item := range v {
+			if key == "text" || key == "content" {
+				v[key] = s.ApplyValue(item)
+			}
+		}
+		return v
+	}
+	return value
+}
+
+// ApplyRawJSON 过滤原始 JSON 内容，未发生 mask 时原样返回
+func (s *RegexFilterScope) ApplyRawJSON(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return raw
+	}
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return raw
+	}
+	masked := s.masked
+	s.masked = false
+	value = s.ApplyValue(value)
+	if !s.masked {
+		s.masked = masked
+		return raw
+	}
+	filtered, err := json.Marshal(value)
+	if err != nil {
+		return raw
+	}
+	return filtered
+}
+
+// ApplyMessages 过滤 OpenAI 格式消息中的文本内容
+func (s *RegexFilterScope) ApplyMessages(messages []dto.Message) {
+	for i := range messages {
+		message := &messages[i]
+		if message.IsStringContent() {
+			content := message.StringContent()
+			if filtered := s.ApplyText(content); filtered != content {
+				message.SetStringContent(filtered)
+			}
+			continue
+		}
+		contents := message.ParseContent()
+		changed := false
+		for j := range contents {
+			if contents[j].Type != dto.ContentTypeText {
+				continue
+			}
+			if filtered := s.ApplyText(contents[j].Text); filtered != contents[j].Text {
+				contents[j].Text = filtered
+				changed = true
+			}
+		}
+		if changed {
+			message.SetMediaContent(contents)
+		}
+	}
+}
+
+// Matches 返回全部命中的规则
+func (s *RegexFilterScope) Matches() []RegexMatch {
+	return s.matches
+}
+
+// Blocked 返回第一条命中的拦截规则，未命中时返回 nil
+func (s *RegexFilterScope) Blocked() *RegexMatch {
+	return s.blocked
+}
+
+// Masked 是否有内容被 mask
+func (s *RegexFilterScope) Masked() bool {
+	return s.masked
+}
+
+// MatchedRules 返回命中的规则名称，格式为 规则组/规则名
+func (s *RegexFilterScope) MatchedRules() []string {
+	rules := make([]string, 0, len(s.matches))
+	for _, match := range s.matches {
+		rules = append(rules, match.String())
+	}
+	return rules
+}
@@ -0,0 +1,420 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/dto"
+	relaycommon "tea-api/relay/common"
+	relayconstant "tea-api/relay/constant"
+	"tea-api/relay/helper"
+	"tea-api/setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const responseCacheKeyPrefix = "response_cache:"
+
+// responseCacheChunkRunes 流式重放时每个 SSE 块包含的字符数
+const responseCacheChunkRunes = 16
+
+// ResponseCacheEntry 缓存的响应。对话请求保存为非流式格式，流式请求命中时重新分块输出
+type ResponseCacheEntry struct {
+	Body  json.RawMessage `json:"body"`
+	Usage dto.Usage       `json:"usage"`
+}
+
+// responseCacheLRU 未启用 Redis 时使用的本地有界 LRU 缓存
+type responseCacheLRU struct {
+	mu       sync.Mutex
+	items    map[string]*list.Element
+	order    *list.List
+	capacity int
+}
+
+type responseCacheLRUItem struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+}
+
+var localResponseCache *responseCacheLRU
+var localResponseCacheOnce sync.Once
+
+func getLocalResponseCache() *responseCacheLRU {
+	localResponseCacheOnce.Do(func() {
+		localResponseCache = newResponseCacheLRU(constant.ResponseCacheMaxEntries)
+	})
+	return localResponseCache
+}
+
+func newResponseCacheLRU(capacity int) *responseCacheLRU {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &responseCacheLRU{
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+		capacity: capacity,
+	}
+}
+
+func (l *responseCacheLRU) get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	element, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := element.Value.(*responseCacheLRUItem)
+	if time.Now().After(item.expireAt) {
+		l.order.Remove(element)
+		delete(l.items, key)
+		return nil, false
+	}
+	l.order.MoveToFront(element)
+	return item.value, true
+}
+
+func (l *responseCacheLRU) set(key string, value []byte, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if element, ok := l.items[key]; ok {
+		item := element.Value.(*responseCacheLRUItem)
+		item.value = value
+		item.expireAt = time.Now().Add(ttl)
+		l.order.MoveToFront(element)
+		return
+	}
+	l.items[key] = l.order.PushFront(&responseCacheLRUItem{key: key, value: value, expireAt: time.Now().Add(ttl)})
+	for l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*responseCacheLRUItem).key)
+	}
+}
+
+// ShouldUseResponseCache 判断请求是否参与响应缓存：总开关开启，且令牌或分组启用了缓存。
+// 对话请求还需要是确定性的，即显式设置 temperature=0 且只生成一个候选
+func ShouldUseResponseCache(c *gin.Context, info *relaycommon.RelayInfo, textRequest *dto.GeneralOpenAIRequest) bool {
+	if !setting.ResponseCacheEnabled {
+		return false
+	}
+	if !c.GetBool(constant.ContextKeyTokenResponseCache) && !setting.IsResponseCacheGroup(info.Group) {
+		return false
+	}
+	switch info.RelayMode {
+	case relayconstant.RelayModeEmbeddings:
+		return true
+	case relayconstant.RelayModeChatCompletions:
+		return textRequest != nil && textRequest.Temperature != nil && *textRequest.Temperature == 0 && textRequest.N <= 1
+	}
+	return false
+}
+
+// ResponseCacheKey 根据规范化后的请求体与上游模型生成缓存键。
+// 规范化会忽略字段顺序与空白、去掉流式相关参数，并应用渠道的参数覆盖
+func ResponseCacheKey(c *gin.Context, info *relaycommon.RelayInfo) (string, error) {
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return "", err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	request := make(map[string]any)
+	if err := decoder.Decode(&request); err != nil {
+		return "", err
+	}
+	delete(request, "stream")
+	delete(request, "stream_options")
+	request["model"] = info.UpstreamModelName
+	requestData, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	if requestData, err = info.ApplyParamOverride(requestData); err != nil {
+		return "", err
+	}
+	normalized, err := json.Marshal(map[string]any{
+		"relay_mode": info.RelayMode,
+		"request":    json.RawMessage(requestData),
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(normalized)
+	return responseCacheKeyPrefix + hex.EncodeToString(sum[:]), nil
+}
+
+func GetResponseCache(key string) (*ResponseCacheEntry, bool) {
+	var data []byte
+	if common.RedisEnabled {
+		value, err := common.RedisGet(key)
+		if err != nil {
+			return nil, false
+		}
+		data = []byte(value)
+	} else {
+		value, ok := getLocalResponseCache().get(key)
+		if !ok {
+			return nil, false
+		}
+		data = value
+	}
+	var entry ResponseCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+func SetResponseCache(key string, entry *ResponseCacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	ttl := time.Duration(setting.ResponseCacheTTLSeconds) * time.Second
+	if common.RedisEnabled {
+		return common.RedisSet(key, string(data), ttl)
+	}
+	getLocalResponseCache().set(key, data, ttl)
+	return nil
+}
+
+// BuildChatResponseCacheEntry 根据写给客户端的响应生成缓存条目，流式响应会先聚合为非流式格式
+func BuildChatResponseCacheEntry(body []byte, stream bool, usage *dto.Usage) (*ResponseCacheEntry, error) {
+	if len(body) == 0 || usage == nil {
+		return nil, errors.New("empty response")
+	}
+	var response *dto.OpenAITextResponse
+	if stream {
+		var err error
+		response, err = aggregateChatStream(body)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		response = &dto.OpenAITextResponse{}
+		if err := json.Unmarshal(body, response); err != nil {
+			return nil, err
+		}
+	}
+	if response.Error != nil || len(response.Choices) == 0 {
+		return nil, errors.New("response has no choices")
+	}
+	for _, choice := range response.Choices {
+		// 被截断或过滤的响应不缓存
+		if choice.FinishReason != constant.FinishReasonStop && choice.FinishReason != constant.FinishReasonToolCalls {
+			return nil, errors.New("response is not finished normally")
+		}
+	}
+	response.Usage = *usage
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	return &ResponseCacheEntry{Body: data, Usage: *usage}, nil
+}
+
+// BuildEmbeddingResponseCacheEntry 根据嵌入响应生成缓存条目，原样保存响应体
+func BuildEmbeddingResponseCacheEntry(body []byte, usage *dto.Usage) (*ResponseCacheEntry, error) {
+	if len(body) == 0 || usage == nil {
+		return nil, errors.New("empty response")
+	}
+	var response dto.OpenAIEmbeddingResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Data) == 0 {
+		return nil, errors.New("response has no data")
+	}
+	return &ResponseCacheEntry{Body: body, Usage: *usage}, nil
+}
+
+// aggregateChatStream 将 SSE 流中的对话增量块合并为完整的非流式响应
+func aggregateChatStream(body []byte) (*dto.OpenAITextResponse, error) {
+	response := &dto.OpenAITextResponse{Object: "chat.completion"}
+	type choiceState struct {
+		content   strings.Builder
+		reasoning strings.Builder
+		toolCalls []dto.ToolCallResponse
+		finish    string
+	}
+	states := make(map[int]*choiceState)
+	var indexes []int
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, err
+		}
+		if response.Id == "" {
+			response.Id = chunk.Id
+			response.Created = chunk.Created
+		}
+		if chunk.Model != "" {
+			response.Model = chunk.Model
+		}
+		for _, choice := range chunk.Choices {
+			state, ok := states[choice.Index]
+			if !ok {
+				state = &choiceState{}
+				states[choice.Index] = state
+				indexes = append(indexes, choice.Index)
+			}
+			state.content.WriteString(choice.Delta.GetContentString())
+			if choice.Delta.ReasoningContent != nil {
+				state.reasoning.WriteString(*choice.Delta.ReasoningContent)
+			} else if choice.Delta.Reasoning != nil {
+				state.reasoning.WriteString(*choice.Delta.Reasoning)
+			}
+			for _, toolCall := range choice.Delta.ToolCalls {
+				index := len(state.toolCalls)
+				if toolCall.Index != nil {
+					index = *toolCall.Index
+				}
+				for len(state.toolCalls) <= index {
+					state.toolCalls = append(state.toolCalls, dto.ToolCallResponse{Type: "function"})
+				}
+				merged := &state.toolCalls[index]
+				if toolCall.ID != "" {
+					merged.ID = toolCall.ID
+				}
+				if toolCall.Function.Name != "" {
+					merged.Function.Name = toolCall.Function.Name
+				}
+				merged.Function.Arguments += toolCall.Function.Arguments
+			}
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				state.finish = *choice.FinishReason
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		state := states[index]
+		message := dto.Message{Role: "assistant", ReasoningContent: state.reasoning.String()}
+		message.SetStringContent(state.content.String())
+		if len(state.toolCalls) > 0 {
+			message.SetToolCalls(state.toolCalls)
+		}
+		response.Choices = append(response.Choices, dto.OpenAITextResponseChoice{
+			Index:        index,
+			Message:      message,
+			FinishReason: state.finish,
+		})
+	}
+	return response, nil
+}
+
+// WriteChatResponseCache 将缓存的对话响应写给客户端，流式请求按 SSE 重新分块
+func WriteChatResponseCache(c *gin.Context, info *relaycommon.RelayInfo, entry *ResponseCacheEntry) error {
+	var response dto.OpenAITextResponse
+	if err := json.Unmarshal(entry.Body, &response); err != nil {
+		return err
+	}
+	response.Id = helper.GetResponseID(c)
+	response.Created = common.GetTimestamp()
+	response.Usage = entry.Usage
+	info.SetFirstResponseTime()
+	if !info.IsStream {
+		c.JSON(http.StatusOK, response)
+		return nil
+	}
+
+	helper.SetEventStreamHeaders(c)
+	for _, chunk := range splitChatResponse(&response) {
+		if err := helper.ObjectData(c, chunk); err != nil {
+			return err
+		}
+	}
+	if info.ShouldIncludeUsage {
+		if err := helper.ObjectData(c, helper.GenerateFinalUsageResponse(response.Id, response.Created, response.Model, entry.Usage)); err != nil {
+			return err
+		}
+	}
+	helper.Done(c)
+	return nil
+}
+
+// WriteEmbeddingResponseCache 将缓存的嵌入响应原样写给客户端
+func WriteEmbeddingResponseCache(c *gin.Context, info *relaycommon.RelayInfo, entry *ResponseCacheEntry) error {
+	info.SetFirstResponseTime()
+	c.Data(http.StatusOK, "application/json", entry.Body)
+	return nil
+}
+
+// splitChatResponse 将非流式响应拆分为流式增量块：推理内容、正文、工具调用，最后是结束原因
+func splitChatResponse(response *dto.OpenAITextResponse) []*dto.ChatCompletionsStreamResponse {
+	var chunks []*dto.ChatCompletionsStreamResponse
+	newChunk := func(index int, delta dto.ChatCompletionsStreamResponseChoiceDelta) *dto.ChatCompletionsStreamResponse {
+		return &dto.ChatCompletionsStreamResponse{
+			Id:      response.Id,
+			Object:  "chat.completion.chunk",
+			Created: response.Created,
+			Model:   response.Model,
+			Choices: []dto.ChatCompletionsStreamResponseChoice{{Index: index, Delta: delta}},
+		}
+	}
+	for _, choice := range response.Choices {
+		chunks = append(chunks, newChunk(choice.Index, dto.ChatCompletionsStreamResponseChoiceDelta{Role: "assistant"}))
+		for _, piece := range splitRunes(choice.Message.ReasoningContent, responseCacheChunkRunes) {
+			piece := piece
+			chunks = append(chunks, newChunk(choice.Index, dto.ChatCompletionsStreamResponseChoiceDelta{ReasoningContent: &piece}))
+		}
+		for _, piece := range splitRunes(choice.Message.StringContent(), responseCacheChunkRunes) {
+			delta := dto.ChatCompletionsStreamResponseChoiceDelta{}
+			delta.SetContentString(piece)
+			chunks = append(chunks, newChunk(choice.Index, delta))
+		}
+		var toolCalls []dto.ToolCallResponse
+		if len(choice.Message.ToolCalls) > 0 {
+			_ = json.Unmarshal(choice.Message.ToolCalls, &toolCalls)
+		}
+		for i, toolCall := range toolCalls {
+			index := i
+			toolCall.Index = &index
+			chunks = append(chunks, newChunk(choice.Index, dto.ChatCompletionsStreamResponseChoiceDelta{ToolCalls: []dto.ToolCallResponse{toolCall}}))
+		}
+		finishReason := choice.FinishReason
+		stop := newChunk(choice.Index, dto.ChatCompletionsStreamResponseChoiceDelta{})
+		stop.Choices[0].FinishReason = &finishReason
+		chunks = append(chunks, stop)
+	}
+	return chunks
+}
+
+func splitRunes(s string, size int) []string {
+	runes := []rune(s)
+	var pieces []string
+	for start := 0; start < len(runes); start += size {
+		end := start + size
+		if end > len(runes) {
+			end = len(runes)
+		}
+		pieces = append(pieces, string(runes[start:end]))
+	}
+	return pieces
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/dto"
+	"tea-api/model"
+	"time"
+)
+
+// GetStoredResponseMessages 读取 previous_response_id 对应的完整对话
+func GetStoredResponseMessages(responseId string, userId int) ([]dto.Message, error) {
+	storedResponse, err := model.GetUserStoredResponseById(responseId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("previous response %s not found", responseId)
+	}
+	var messages []dto.Message
+	if err := json.Unmarshal([]byte(storedResponse.Messages), &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// StoreResponse 保存本次请求的对话与输出，供后续请求通过 previous_response_id 续接。
+// messages 为不含 instructions 的输入消息（包括历史消息）。
+func StoreResponse(response *dto.OpenAIResponsesResponse, userId int, messages []dto.Message) error {
+	output, err := json.Marshal(response.Output)
+	if err != nil {
+		return err
+	}
+	outputMessages, err := ResponsesInputToMessages(output)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(append(messages, outputMessages...))
+	if err != nil {
+		return err
+	}
+	storedResponse := &model.StoredResponse{
+		Id:       response.ID,
+		UserId:   userId,
+		Model:    response.Model,
+		Messages: string(data),
+	}
+	return storedResponse.Insert()
+}
+
+// CleanStoredResponses 定期删除超过保留天数的对话，仅在主节点运行
+func CleanStoredResponses() {
+	if constant.ResponsesStoreRetentionDays <= 0 {
+		return
+	}
+	for {
+		expiredAt := time.Now().AddDate(0, 0, -constant.ResponsesStoreRetentionDays).Unix()
+		count, err := model.DeleteStoredResponsesBefore(expiredAt)
+		if err != nil {
+			common.SysError("failed to clean stored responses: " + err.Error())
+		} else if count > 0 {
+			common.SysLog(fmt.Sprintf("cleaned %d stored responses", count))
+		}
+		time.Sleep(time.Hour)
+	}
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/dto"
+	"tea-api/setting"
+	"unicode"
+
+	goahocorasick "github.com/anknown/ahocorasick"
+	"github.com/gin-gonic/gin"
+)
+
+// SensitiveStreamFilter 流式输出的敏感词检测。
+// 每次只输出缓冲区中不可能再组成敏感词的部分，末尾保留最长敏感词长度减一个字符，
+// 这样跨分块的敏感词也能被完整识别。
+type SensitiveStreamFilter struct {
+	machine   *goahocorasick.Machine
+	holdBack  int
+	stopOnHit bool
+	pending   []rune
+	stopped   bool
+	words     []string
+	delivered strings.Builder
+}
+
+// NewSensitiveStreamFilter 未开启输出检测或没有配置敏感词时返回 nil
+func NewSensitiveStreamFilter() *SensitiveStreamFilter {
+	if !setting.ShouldCheckCompletionSensitive() || len(setting.SensitiveWords) == 0 {
+		return nil
+	}
+	machine := InitAc(setting.SensitiveWords)
+	if machine == nil {
+		return nil
+	}
+	maxLen := 0
+	for _, word := range setting.SensitiveWords {
+		if l := len([]rune(strings.ToLower(strings.TrimSpace(word)))); l > maxLen {
+			maxLen = l
+		}
+	}
+	return &SensitiveStreamFilter{
+		machine:   machine,
+		holdBack:  maxLen - 1,
+		stopOnHit: setting.StopOnSensitiveEnabled,
+	}
+}
+
+// Push 写入一段输出文本，返回可以立即下发的文本，以及是否需要终止输出
+func (f *SensitiveStreamFilter) Push(text string) (string, bool) {
+	if f.stopped {
+		return "", true
+	}
+	f.pending = append(f.pending, []rune(text)...)
+	return f.drain(len(f.pending) - f.holdBack)
+}
+
+// Flush 输出结束时下发缓冲区中剩余的文本
+func (f *SensitiveStreamFilter) Flush() (string, bool) {
+	if f.stopped {
+		return "", true
+	}
+	return f.drain(len(f.pending))
+}
+
+// Stopped 是否因命中敏感词终止了输出
+func (f *SensitiveStreamFilter) Stopped() bool {
+	return f.stopped
+}
+
+// Words 返回命中的敏感词
+func (f *SensitiveStreamFilter) Words() []string {
+	return RemoveDuplicate(f.words)
+}
+
+// DeliveredText 返回已经下发给客户端的文本
+func (f *SensitiveStreamFilter) DeliveredText() string {
+	return f.delivered.String()
+}
+
+// drain 下发 pending[:boundary]，命中的敏感词跨越边界时整体下发
+func (f *SensitiveStreamFilter) drain(boundary int) (string, bool) {
+	if boundary < 0 {
+		boundary = 0
+	}
+	lower := make([]rune, len(f.pending))
+	for i, r := range f.pending {
+		lower[i] = unicode.ToLower(r)
+	}
+	hits := f.machine.MultiPatternSearch(lower, false)
+	if len(hits) > 0 && f.stopOnHit {
+		first := len(f.pending)
+		for _, hit := range hits {
+			f.words = append(f.words, string(hit.Word))
+			if hit.Pos < first {
+				first = hit.Pos
+			}
+		}
+		text := string(f.pending[:first])
+		f.delivered.WriteString(text)
+		f.pending = nil
+		f.stopped = true
+		return text, true
+	}
+
+	masked := make([]bool, len(f.pending))
+	for _, hit := range hits {
+		f.words = append(f.words, string(hit.Word))
+		end := hit.Pos + len(hit.Word)
+		for i := hit.Pos; i < end && i < len(masked); i++ {
+			masked[i] = true
+		}
+		if hit.Pos < boundary && end > boundary {
+			boundary = end
+		}
+	}
+	// 避免把一段连续的替换内容拆到两次下发中
+	for boundary > 0 && boundary < len(f.pending) && masked[boundary-1] && masked[boundary] {
+		boundary++
+	}
+
+	var builder strings.Builder
+	for i := 0; i < boundary; i++ {
+		if !masked[i] {
+			builder.WriteRune(f.pending[i])
+			continue
+		}
+		if i == 0 || !masked[i-1] {
+			builder.WriteString("**###**")
+		}
+	}
+	f.pending = f.pending[boundary:]
+	text := builder.String()
+	f.delivered.WriteString(text)
+	return text, false
+}
+
+// StreamSensitiveChecker 按 choice 检测 OpenAI 格式流式响应中的敏感词
+type StreamSensitiveChecker struct {
+	c        *gin.Context
+	filters  map[int]*SensitiveStreamFilter
+	stopped  bool
+	hitCount int
+}
+
+// NewStreamSensitiveChecker 未开启输出检测时返回 nil
+func NewStreamSensitiveChecker(c *gin.Context) *StreamSensitiveChecker {
+	if NewSensitiveStreamFilter() == nil {
+		return nil
+	}
+	return &StreamSensitiveChecker{
+		c:       c,
+		filters: make(map[int]*SensitiveStreamFilter),
+	}
+}
+
+func (s *StreamSensitiveChecker) getFilter(index int) *SensitiveStreamFilter {
+	filter, ok := s.filters[index]
+	if !ok {
+		filter = NewSensitiveStreamFilter()
+		s.filters[index] = filter
+	}
+	return filter
+}
+
+// CheckResponse 过滤响应块中的 content，choice 结束时一并下发缓冲内容。
+// 需要终止输出时将 finish_reason 设为 content_filter 并返回 true
+func (s *StreamSensitiveChecker) CheckResponse(response *dto.ChatCompletionsStreamResponse) bool {
+	_, stop := s.checkResponse(response)
+	return stop
+}
+
+func (s *StreamSensitiveChecker) checkResponse(response *dto.ChatCompletionsStreamResponse) (bool, bool) {
+	changed := false
+	for i := range response.Choices {
+		choice := &response.Choices[i]
+		filter := s.getFilter(choice.Index)
+		if filter == nil {
+			continue
+		}
+		content := choice.Delta.GetContentString()
+		text, stop := filter.Push(content)
+		if !stop && choice.FinishReason != nil {
+			var rest string
+			rest, stop = filter.Flush()
+			text += rest
+		}
+		if text != content {
+			choice.Delta.SetContentString(text)
+			changed = true
+		}
+		if stop {
+			choice.FinishReason = &constant.FinishReasonContentFilter
+			s.stopped = true
+			changed = true
+		}
+	}
+	s.logWords()
+	return changed, s.stopped
+}
+
+// CheckData 检测原始 JSON 响应块，内容未改动时原样返回
+func (s *StreamSensitiveChecker) CheckData(data string) (string, bool) {
+	var response dto.ChatCompletionsStreamResponse
+	if err := common.DecodeJsonStr(data, &response); err != nil || len(response.Choices) == 0 {
+		return data, false
+	}
+	changed, stop := s.checkResponse(&response)
+	if !changed {
+		return data, stop
+	}
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		common.SysError("error marshalling stream response: " + err.Error())
+		return data, stop
+	}
+	return string(jsonData), stop
+}
+
+// FlushResponse 上游结束时仍有 choice 未收到 finish_reason，生成包含剩余缓冲内容的响应块，没有剩余内容时返回 nil
+func (s *StreamSensitiveChecker) FlushResponse(id string, createAt int64, model string) *dto.ChatCompletionsStreamResponse {
+	indexes := make([]int, 0, len(s.filters))
+	for index := range s.filters {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var choices []dto.ChatCompletionsStreamResponseChoice
+	for _, index := range indexes {
+		if s.filters[index].Stopped() {
+			continue
+		}
+		text, stop := s.filters[index].Flush()
+		if text == "" && !stop {
+			continue
+		}
+		choice := dto.ChatCompletionsStreamResponseChoice{Index: index}
+		choice.Delta.SetContentString(text)
+		if stop && !s.stopped {
+			choice.FinishReason = &constant.FinishReasonContentFilter
+			s.stopped = true
+		}
+		choices = append(choices, choice)
+	}
+	s.logWords()
+	if len(choices) == 0 {
+		return nil
+	}
+	return &dto.ChatCompletionsStreamResponse{
+		Id:      id,
+		Object:  "chat.completion.chunk",
+		Created: createAt,
+		Model:   model,
+		Choices: choices,
+	}
+}
+
+// Stopped 是否因命中敏感词终止了输出
+func (s *StreamSensitiveChecker) Stopped() bool {
+	return s.stopped
+}
+
+// DeliveredText 返回已经下发给客户端的全部文本，用于终止输出后按实际下发内容计费
+func (s *StreamSensitiveChecker) DeliveredText() string {
+	var builder strings.Builder
+	for _, filter := range s.filters {
+		builder.WriteString(filter.DeliveredText())
+	}
+	return builder.String()
+}
+
+func (s *StreamSensitiveChecker) logWords() {
+	var words []string
+	for _, filter := range s.filters {
+		words = append(words, filter.Words()...)
+	}
+	if len(words) == s.hitCount {
+		return
+	}
+	s.hitCount = len(words)
+	common.LogWarn(s.c, fmt.Sprintf("completion sensitive words detected: %s, stopped: %v", strings.Join(RemoveDuplicate(words), ", "), s.stopped))
+}
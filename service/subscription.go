@@ -0,0 +1,209 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"tea-api/common"
+	"tea-api/model"
+	relaycommon "tea-api/relay/common"
+)
+
+// subscriptionBatchSize 每次处理的到期订阅数量
+const subscriptionBatchSize = 100
+
+// subscriptionConsumeRetry 并发扣除订阅额度失败时的最大尝试次数，超过后全部从余额扣除
+const subscriptionConsumeRetry = 3
+
+// getRequestSubscription 确定本次请求可以使用的订阅并记录在 relayInfo 中，每个请求只确定一次。
+// 没有生效中的订阅或套餐限制了模型、分组且不匹配时返回 nil
+func getRequestSubscription(relayInfo *relaycommon.RelayInfo) (*model.Subscription, error) {
+	relayInfo.SubscriptionResolved = true
+	relayInfo.SubscriptionId = 0
+	id, err := model.GetActiveSubscriptionId(relayInfo.UserId)
+	if err != nil || id == 0 {
+		return nil, err
+	}
+	subscription, err := model.GetSubscriptionById(id)
+	if err != nil {
+		if errors.Is(err, model.ErrSubscriptionNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if subscription.Status != model.SubscriptionStatusActive {
+		return nil, nil
+	}
+	plan, err := model.GetSubscriptionPlanById(subscription.PlanId)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.AllowsModel(relayInfo.OriginModelName) || !plan.AllowsGroup(relayInfo.BillingGroup()) {
+		return nil, nil
+	}
+	relayInfo.SubscriptionId = subscription.Id
+	return subscription, nil
+}
+
+// GetUserAvailableQuota 返回用户本次请求可用的额度，即余额加上可用的订阅额度
+func GetUserAvailableQuota(relayInfo *relaycommon.RelayInfo) (int, error) {
+	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	if err != nil {
+		return 0, err
+	}
+	subscription, err := getRequestSubscription(relayInfo)
+	if err != nil {
+		return 0, err
+	}
+	if subscription != nil && subscription.Quota > 0 {
+		userQuota += subscription.Quota
+	}
+	return userQuota, nil
+}
+
+// consumeSubscriptionQuota 从本次请求可用的订阅中扣除额度，订阅额度不足时只扣除剩余部分，返回实际扣除的额度。
+// 扣除以剩余额度足够为条件，额度不足或并发请求先扣除了订阅额度时按最新的剩余额度重试，不足的部分由调用方从余额扣除。
+func consumeSubscriptionQuota(relayInfo *relaycommon.RelayInfo, quota int) (int, error) {
+	if quota <= 0 {
+		return 0, nil
+	}
+	if !relayInfo.SubscriptionResolved {
+		if _, err := getRequestSubscription(relayInfo); err != nil {
+			return 0, err
+		}
+	}
+	if relayInfo.SubscriptionId == 0 {
+		return 0, nil
+	}
+	subscriptionQuota := quota
+	for i := 0; i < subscriptionConsumeRetry; i++ {
+		consumed, err := model.ConsumeSubscriptionQuota(relayInfo.SubscriptionId, subscriptionQuota)
+		if err != nil {
+			return 0, err
+		}
+		if consumed {
+			relayInfo.SubscriptionConsumed += subscriptionQuota
+			return subscriptionQuota, nil
+		}
+		subscription, err := model.GetSubscriptionById(relayInfo.SubscriptionId)
+		if err != nil {
+			return 0, err
+		}
+		if subscription.Status != model.SubscriptionStatusActive || subscription.Quota <= 0 {
+			return 0, nil
+		}
+		subscriptionQuota = min(quota, subscription.Quota)
+	}
+	return 0, nil
+}
+
+// PreConsumeUserQuota 预扣用户额度，优先扣除订阅额度，不足的部分扣除余额
+func PreConsumeUserQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
+	subscriptionQuota, err := consumeSubscriptionQuota(relayInfo, quota)
+	if err != nil {
+		return err
+	}
+	relayInfo.BalanceConsumed += quota - subscriptionQuota
+	if quota > subscriptionQuota {
+		return model.DecreaseUserQuota(relayInfo.UserId, quota-subscriptionQuota)
+	}
+	return nil
+}
+
+// splitSubscriptionQuota 结算本次请求补扣（quota 为正）或退回（quota 为负）的额度，返回余额需要变动的额度。
+// 补扣时优先使用订阅额度；退回时先退回余额再退回订阅额度，使最终的扣费仍然是先订阅后余额。
+func splitSubscriptionQuota(relayInfo *relaycommon.RelayInfo, quota int) (int, error) {
+	if quota >= 0 {
+		subscriptionQuota, err := consumeSubscriptionQuota(relayInfo, quota)
+		if err != nil {
+			return 0, err
+		}
+		relayInfo.BalanceConsumed += quota - subscriptionQuota
+		return quota - subscriptionQuota, nil
+	}
+	refund := -quota
+	balanceRefund := min(refund, max(relayInfo.BalanceConsumed, 0))
+	subscriptionRefund := min(refund-balanceRefund, max(relayInfo.SubscriptionConsumed, 0))
+	if subscriptionRefund > 0 {
+		if err := model.RefundSubscriptionQuota(relayInfo.SubscriptionId, subscriptionRefund); err != nil {
+			return 0, err
+		}
+		relayInfo.SubscriptionConsumed -= subscriptionRefund
+	}
+	relayInfo.BalanceConsumed -= refund - subscriptionRefund
+	return quota + subscriptionRefund, nil
+}
+
+// RefundTaskQuota 退回失败的异步任务预扣的额度，subscriptionQuota 为预扣时从订阅扣除的部分，
+// 先退回订阅额度，其余退回余额，避免订阅额度被转换成余额
+func RefundTaskQuota(userId int, quota int, subscriptionId int, subscriptionQuota int) error {
+	subscriptionRefund := 0
+	if subscriptionId != 0 {
+		subscriptionRefund = min(max(subscriptionQuota, 0), quota)
+	}
+	if subscriptionRefund > 0 {
+		if err := model.RefundSubscriptionQuota(subscriptionId, subscriptionRefund); err != nil {
+			return err
+		}
+	}
+	if quota > subscriptionRefund {
+		return model.IncreaseUserQuota(userId, quota-subscriptionRefund, false)
+	}
+	return nil
+}
+
+// UpdateSubscriptions 定期为订阅发放新周期的额度并处理到期的订阅，仅在主节点运行
+func UpdateSubscriptions() {
+	for {
+		ProcessDueSubscriptions(time.Now().Unix())
+		time.Sleep(time.Minute)
+	}
+}
+
+// ProcessDueSubscriptions 处理截至 now 需要进入新周期或已到期的订阅
+func ProcessDueSubscriptions(now int64) {
+	lastId := 0
+	for {
+		subscriptions, err := model.GetDueSubscriptions(now, lastId, subscriptionBatchSize)
+		if err != nil {
+			common.SysError("failed to get due subscriptions: " + err.Error())
+			return
+		}
+		for _, subscription := range subscriptions {
+			lastId = subscription.Id
+			if err = processDueSubscription(subscription, now); err != nil {
+				common.SysError(fmt.Sprintf("failed to update subscription %d: %s", subscription.Id, err.Error()))
+			}
+		}
+		if len(subscriptions) < subscriptionBatchSize {
+			return
+		}
+	}
+}
+
+func processDueSubscription(subscription *model.Subscription, now int64) error {
+	plan, err := model.GetSubscriptionPlanById(subscription.PlanId)
+	if err != nil && !errors.Is(err, model.ErrSubscriptionPlanNotFound) {
+		return err
+	}
+	if plan == nil || subscription.EndTime <= now {
+		// 套餐被删除时同样结束订阅
+		_, ended, err := model.EndSubscription(subscription.Id, model.SubscriptionStatusExpired)
+		if err != nil {
+			return err
+		}
+		if ended {
+			model.RecordLog(subscription.UserId, model.LogTypeSystem, fmt.Sprintf("订阅已到期，订阅 ID：%d", subscription.Id))
+		}
+		return nil
+	}
+	reset, err := model.ResetSubscriptionPeriod(subscription, plan, now)
+	if err != nil {
+		return err
+	}
+	if reset {
+		model.RecordLog(subscription.UserId, model.LogTypeSystem, fmt.Sprintf("订阅套餐 %s 进入新周期，发放 %s", plan.Name, common.LogQuota(plan.Quota)))
+	}
+	return nil
+}
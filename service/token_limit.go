@@ -0,0 +1,113 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/model"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenQuotaWindow 令牌的一个额度时间窗口及其上限
+type tokenQuotaWindow struct {
+	name  string
+	label string
+	limit int
+	usage model.TokenUsageWindow
+}
+
+func tokenQuotaWindows(token *model.Token, usage *model.TokenUsage) []tokenQuotaWindow {
+	return []tokenQuotaWindow{
+		{name: "Daily", label: "每日", limit: token.DailyQuotaLimit, usage: usage.Daily},
+		{name: "Weekly", label: "每周", limit: token.WeeklyQuotaLimit, usage: usage.Weekly},
+		{name: "Monthly", label: "每月", limit: token.MonthlyQuotaLimit, usage: usage.Monthly},
+	}
+}
+
+// CheckTokenQuotaWindows 检查令牌在各时间窗口内已用额度加上 quota 是否超出上限
+func CheckTokenQuotaWindows(token *model.Token, usage *model.TokenUsage, quota int) error {
+	for _, window := range tokenQuotaWindows(token, usage) {
+		if window.limit <= 0 {
+			continue
+		}
+		if window.usage.Quota >= int64(window.limit) || window.usage.Quota+int64(quota) > int64(window.limit) {
+			return fmt.Errorf("令牌%s额度已用尽，已用 %s，上限 %s，将于 %s 重置", window.label,
+				common.FormatQuota(int(window.usage.Quota)), common.FormatQuota(window.limit),
+				time.Unix(window.usage.ResetAt, 0).Format("2006-01-02 15:04:05"))
+		}
+	}
+	return nil
+}
+
+func formatResetDuration(resetAt int64, now time.Time) string {
+	d := time.Unix(resetAt, 0).Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	return d.Round(time.Second).String()
+}
+
+func remaining(limit int64, used int64) int64 {
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
+
+func setTokenLimitHeaders(c *gin.Context, token *model.Token, usage *model.TokenUsage) {
+	now := time.Now()
+	if token.RpmLimit > 0 {
+		c.Header("X-RateLimit-Limit-Requests", strconv.Itoa(token.RpmLimit))
+		c.Header("X-RateLimit-Remaining-Requests", strconv.FormatInt(remaining(int64(token.RpmLimit), usage.Minute.Requests), 10))
+		c.Header("X-RateLimit-Reset-Requests", formatResetDuration(usage.Minute.ResetAt, now))
+	}
+	if token.TpmLimit > 0 {
+		c.Header("X-RateLimit-Limit-Tokens", strconv.Itoa(token.TpmLimit))
+		c.Header("X-RateLimit-Remaining-Tokens", strconv.FormatInt(remaining(int64(token.TpmLimit), usage.Minute.Tokens), 10))
+		c.Header("X-RateLimit-Reset-Tokens", formatResetDuration(usage.Minute.ResetAt, now))
+	}
+	for _, window := range tokenQuotaWindows(token, usage) {
+		if window.limit <= 0 {
+			continue
+		}
+		c.Header("X-Token-Quota-Limit-"+window.name, strconv.Itoa(window.limit))
+		c.Header("X-Token-Quota-Remaining-"+window.name, strconv.FormatInt(remaining(int64(window.limit), window.usage.Quota), 10))
+		c.Header("X-Token-Quota-Reset-"+window.name, strconv.FormatInt(window.usage.ResetAt, 10))
+	}
+}
+
+// CheckTokenLimits 检查令牌的 RPM/TPM 限制与按日/周/月的额度上限，并通过响应头返回剩余额度。
+// 超出限制时返回对应的 HTTP 状态码与错误，批处理任务中的请求不受 RPM/TPM 限制。
+func CheckTokenLimits(c *gin.Context, token *model.Token) (int, error) {
+	if token.RpmLimit <= 0 && token.TpmLimit <= 0 && !token.HasQuotaWindowLimits() {
+		return http.StatusOK, nil
+	}
+	c.Set(constant.ContextKeyTokenWindowLimited, token.HasQuotaWindowLimits())
+	isBatch := c.GetString(constant.ContextKeyBatchId) != ""
+	var requests int64
+	if token.RpmLimit > 0 && !isBatch {
+		requests = model.IncrTokenMinuteRequests(token.Id)
+	}
+	usage := model.GetTokenUsage(token.Id)
+	if requests > usage.Minute.Requests {
+		usage.Minute.Requests = requests
+	}
+	setTokenLimitHeaders(c, token, usage)
+
+	if !isBatch {
+		if token.RpmLimit > 0 && requests > int64(token.RpmLimit) {
+			return http.StatusTooManyRequests, fmt.Errorf("令牌请求频率超出限制，每分钟最多 %d 次请求", token.RpmLimit)
+		}
+		if token.TpmLimit > 0 && usage.Minute.Tokens >= int64(token.TpmLimit) {
+			return http.StatusTooManyRequests, fmt.Errorf("令牌 token 用量超出限制，每分钟最多 %d tokens", token.TpmLimit)
+		}
+	}
+	if err := CheckTokenQuotaWindows(token, usage, 0); err != nil {
+		return http.StatusTooManyRequests, err
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"tea-api/common"
+	"tea-api/model"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// TwoFactorRecoveryCodeCount 每次生成的恢复码数量
+	TwoFactorRecoveryCodeCount = 10
+	// TwoFactorVerifyWindow 通过两步验证后，在该时长（秒）内执行敏感操作无需再次输入验证码
+	TwoFactorVerifyWindow = 10 * 60
+	// TwoFactorMaxFailures 连续验证失败达到该次数后，在 TwoFactorLockDuration（秒）内拒绝该用户的验证
+	TwoFactorMaxFailures  = 5
+	TwoFactorLockDuration = 5 * 60
+)
+
+var (
+	ErrTwoFactorNotEnabled  = errors.New("未启用两步验证")
+	ErrTwoFactorCodeInvalid = errors.New("两步验证码无效或已被使用")
+	ErrTwoFactorLocked      = errors.New("两步验证失败次数过多，请稍后再试")
+)
+
+type twoFactorFailure struct {
+	count     int
+	firstTime int64
+}
+
+// twoFactorFailures 记录各用户连续验证失败的次数，防止暴力猜测验证码。
+// 启用 Redis 时计数保存在 Redis 中，由所有节点共享
+var (
+	twoFactorFailures     = make(map[int]*twoFactorFailure)
+	twoFactorFailuresLock sync.Mutex
+)
+
+func twoFactorFailureKey(userId int) string {
+	return fmt.Sprintf("twoFactorFailures:%d", userId)
+}
+
+func isTwoFactorLocked(userId int, now int64) (bool, error) {
+	if common.RedisEnabled {
+		return redisIsTwoFactorLocked(userId)
+	}
+	return memoryIsTwoFactorLocked(userId, now), nil
+}
+
+func recordTwoFactorResult(userId int, success bool, now int64) {
+	if common.RedisEnabled {
+		if err := redisRecordTwoFactorResult(userId, success); err != nil {
+			common.SysError("记录两步验证失败次数失败: " + err.Error())
+		}
+		return
+	}
+	memoryRecordTwoFactorResult(userId, success, now)
+}
+
+func redisIsTwoFactorLocked(userId int) (bool, error) {
+	count, err := common.RDB.Get(context.Background(), twoFactorFailureKey(userId)).Int()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return count >= TwoFactorMaxFailures, nil
+}
+
+func redisRecordTwoFactorResult(userId int, success bool) error {
+	ctx := context.Background()
+	key := twoFactorFailureKey(userId)
+	if success {
+		return common.RDB.Del(ctx, key).Err()
+	}
+	count, err := common.RDB.Incr(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	// 与进程内计数一致，锁定时长从第一次失败开始计算
+	if count == 1 {
+		return common.RDB.Expire(ctx, key, TwoFactorLockDuration*time.Second).Err()
+	}
+	return nil
+}
+
+func memoryIsTwoFactorLocked(userId int, now int64) bool {
+	twoFactorFailuresLock.Lock()
+	defer twoFactorFailuresLock.Unlock()
+	failure, ok := twoFactorFailures[userId]
+	if !ok {
+		return false
+	}
+	if now-failure.firstTime >= TwoFactorLockDuration {
+		delete(twoFactorFailures, userId)
+		return false
+	}
+	return failure.count >= TwoFactorMaxFailures
+}
+
+func memoryRecordTwoFactorResult(userId int, success bool, now int64) {
+	twoFactorFailuresLock.Lock()
+	defer twoFactorFailuresLock.Unlock()
+	if success {
+		delete(twoFactorFailures, userId)
+		return
+	}
+	failure, ok := twoFactorFailures[userId]
+	if !ok || now-failure.firstTime >= TwoFactorLockDuration {
+		failure = &twoFactorFailure{firstTime: now}
+		twoFactorFailures[userId] = failure
+	}
+	failure.count++
+}
+
+// IsTwoFactorRequired 返回该角色是否必须启用两步验证
+func IsTwoFactorRequired(role int) bool {
+	return common.TwoFactorRequiredRole > common.RoleGuestUser && role >= common.TwoFactorRequiredRole
+}
+
+// NormalizeRecoveryCode 忽略恢复码中的大小写、空格和连字符
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// HashRecoveryCode 返回恢复码的摘要，数据库中只保存摘要
+func HashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(NormalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateTwoFactorRecoveryCodes 生成一组恢复码，返回明文和对应的摘要，明文只展示给用户一次
+func GenerateTwoFactorRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, TwoFactorRecoveryCodeCount)
+	hashes := make([]string, 0, TwoFactorRecoveryCodeCount)
+	for i := 0; i < TwoFactorRecoveryCodeCount; i++ {
+		key, err := common.GenerateRandomCharsKey(10)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(key[:5] + "-" + key[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// VerifyUserTwoFactor 校验用户输入的动态验证码或恢复码，每个时间步的验证码和每个恢复码都只能使用一次
+func VerifyUserTwoFactor(user *model.User, code string) error {
+	if !user.TwoFactorEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	now := time.Now()
+	locked, err := isTwoFactorLocked(user.Id, now.Unix())
+	if err != nil {
+		return err
+	}
+	if locked {
+		return ErrTwoFactorLocked
+	}
+	err = verifyTwoFactorCode(user, strings.TrimSpace(code), now)
+	if err == nil || errors.Is(err, ErrTwoFactorCodeInvalid) {
+		recordTwoFactorResult(user.Id, err == nil, now.Unix())
+	}
+	return err
+}
+
+func verifyTwoFactorCode(user *model.User, code string, now time.Time) error {
+	if code == "" {
+		return ErrTwoFactorCodeInvalid
+	}
+	if counter, ok := common.ValidateTOTPCode(user.TwoFactorSecret, code, now); ok {
+		if counter <= user.TwoFactorCounter {
+			return ErrTwoFactorCodeInvalid
+		}
+		used, err := model.UseTwoFactorCounter(user.Id, counter)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrTwoFactorCodeInvalid
+		}
+		user.TwoFactorCounter = counter
+		return nil
+	}
+	return useRecoveryCode(user, code)
+}
+
+func useRecoveryCode(user *model.User, code string) error {
+	hash := HashRecoveryCode(code)
+	codes := user.GetTwoFactorRecoveryCodes()
+	remaining := make([]string, 0, len(codes))
+	found := false
+	for _, c := range codes {
+		if !found && subtle.ConstantTimeCompare([]byte(c), []byte(hash)) == 1 {
+			found = true
+			continue
+		}
+		remaining = append(remaining, c)
+	}
+	if !found {
+		return ErrTwoFactorCodeInvalid
+	}
+	updated, err := model.UpdateTwoFactorRecoveryCodes(user, remaining)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		// 恢复码被并发的请求修改过，可能已被使用
+		return ErrTwoFactorCodeInvalid
+	}
+	model.RecordLog(user.Id, model.LogTypeSystem, fmt.Sprintf("使用恢复码完成了两步验证，剩余 %d 个恢复码", len(remaining)))
+	return nil
+}
@@ -9,6 +9,11 @@ import (
 	"sync"
 )
 
+// UpdateListener 配置对象被修改后需要额外处理（如发布只读快照）时实现该接口
+type UpdateListener interface {
+	OnConfigUpdated()
+}
+
 // ConfigManager 统一管理所有配置
 type ConfigManager struct {
 	configs map[string]interface{}
@@ -56,7 +61,7 @@ func (cm *ConfigManager) LoadFromDB(options map[string]string) error {
 
 		// 如果找到配置项，则更新配置
 		if len(configMap) > 0 {
-			if err := updateConfigFromMap(config, configMap); err != nil {
+			if err := UpdateConfigFromMap(config, configMap); err != nil {
 				common.SysError("failed to update config " + name + ": " + err.Error())
 				continue
 			}
@@ -233,7 +238,13 @@ func ConfigToMap(config interface{}) (map[string]string, error) {
 
 // UpdateConfigFromMap 从map更新配置对象（导出函数）
 func UpdateConfigFromMap(config interface{}, configMap map[string]string) error {
-	return updateConfigFromMap(config, configMap)
+	if err := updateConfigFromMap(config, configMap); err != nil {
+		return err
+	}
+	if listener, ok := config.(UpdateListener); ok {
+		listener.OnConfigUpdated()
+	}
+	return nil
 }
 
 // ExportAllConfigs 导出所有已注册的配置为扁平结构
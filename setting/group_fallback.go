@@ -0,0 +1,87 @@
+package setting
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"tea-api/common"
+)
+
+const (
+	// GroupFallbackBillingOrigin 按用户请求的原始分组倍率计费
+	GroupFallbackBillingOrigin = "origin"
+	// GroupFallbackBillingFallback 按实际使用的回退分组倍率计费
+	GroupFallbackBillingFallback = "fallback"
+)
+
+// groupFallbackChains 分组回退链，例如 {"vip": ["default", "backup"]}
+// 表示 vip 分组无可用渠道时依次尝试 default、backup 分组
+var groupFallbackChains = map[string][]string{}
+var groupFallbackChainsMutex sync.RWMutex
+
+var GroupFallbackBillingMode = GroupFallbackBillingOrigin
+
+func GroupFallbackChains2JSONString() string {
+	groupFallbackChainsMutex.RLock()
+	defer groupFallbackChainsMutex.RUnlock()
+
+	jsonBytes, err := json.Marshal(groupFallbackChains)
+	if err != nil {
+		common.SysError("error marshalling group fallback chains: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupFallbackChainsByJSONString(jsonStr string) error {
+	chains := make(map[string][]string)
+	if err := json.Unmarshal([]byte(jsonStr), &chains); err != nil {
+		return err
+	}
+	groupFallbackChainsMutex.Lock()
+	defer groupFallbackChainsMutex.Unlock()
+	groupFallbackChains = chains
+	return nil
+}
+
+func CheckGroupFallbackChains(jsonStr string) error {
+	chains := make(map[string][]string)
+	if err := json.Unmarshal([]byte(jsonStr), &chains); err != nil {
+		return err
+	}
+	for group, fallbacks := range chains {
+		for _, fallback := range fallbacks {
+			if fallback == group {
+				return fmt.Errorf("分组 %s 不能回退到自身", group)
+			}
+			if !ContainsGroupRatio(fallback) {
+				return fmt.Errorf("回退分组 %s 不存在于分组倍率中", fallback)
+			}
+		}
+	}
+	return nil
+}
+
+// GetGroupFallbackChain 返回以 group 开头的完整回退链，已去重
+func GetGroupFallbackChain(group string) []string {
+	groupFallbackChainsMutex.RLock()
+	defer groupFallbackChainsMutex.RUnlock()
+
+	chain := []string{group}
+	seen := map[string]bool{group: true}
+	for _, fallback := range groupFallbackChains[group] {
+		if fallback == "" || seen[fallback] {
+			continue
+		}
+		seen[fallback] = true
+		chain = append(chain, fallback)
+	}
+	return chain
+}
+
+// GetFallbackBillingGroup 返回计费使用的分组，usingGroup 为实际选中渠道所在的分组
+func GetFallbackBillingGroup(group string, usingGroup string) string {
+	if usingGroup != "" && GroupFallbackBillingMode == GroupFallbackBillingFallback {
+		return usingGroup
+	}
+	return group
+}
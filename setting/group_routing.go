@@ -0,0 +1,68 @@
+package setting
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"tea-api/common"
+)
+
+const (
+	// GroupRoutingModeWeight 按优先级和静态权重随机选择渠道（默认）
+	GroupRoutingModeWeight = "weight"
+	// GroupRoutingModeLatency 在静态权重基础上按实时首字时延和错误率向更快的渠道倾斜
+	GroupRoutingModeLatency = "latency"
+)
+
+// groupRoutingModes 分组的渠道选择模式，例如 {"vip": "latency"}，未配置的分组使用 weight 模式
+var groupRoutingModes = map[string]string{}
+var groupRoutingModesMutex sync.RWMutex
+
+func GroupRoutingModes2JSONString() string {
+	groupRoutingModesMutex.RLock()
+	defer groupRoutingModesMutex.RUnlock()
+
+	jsonBytes, err := json.Marshal(groupRoutingModes)
+	if err != nil {
+		common.SysError("error marshalling group routing modes: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupRoutingModesByJSONString(jsonStr string) error {
+	modes := make(map[string]string)
+	if err := json.Unmarshal([]byte(jsonStr), &modes); err != nil {
+		return err
+	}
+	groupRoutingModesMutex.Lock()
+	defer groupRoutingModesMutex.Unlock()
+	groupRoutingModes = modes
+	return nil
+}
+
+func CheckGroupRoutingModes(jsonStr string) error {
+	modes := make(map[string]string)
+	if err := json.Unmarshal([]byte(jsonStr), &modes); err != nil {
+		return err
+	}
+	for group, mode := range modes {
+		if !ContainsGroupRatio(group) {
+			return fmt.Errorf("分组 %s 不存在于分组倍率中", group)
+		}
+		if mode != GroupRoutingModeWeight && mode != GroupRoutingModeLatency {
+			return fmt.Errorf("分组 %s 的渠道选择模式 %s 无效", group, mode)
+		}
+	}
+	return nil
+}
+
+// GetGroupRoutingMode 返回分组的渠道选择模式
+func GetGroupRoutingMode(group string) string {
+	groupRoutingModesMutex.RLock()
+	defer groupRoutingModesMutex.RUnlock()
+
+	if mode, ok := groupRoutingModes[group]; ok && mode != "" {
+		return mode
+	}
+	return GroupRoutingModeWeight
+}
@@ -0,0 +1,87 @@
+package setting
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"tea-api/common"
+)
+
+// ModelFallbackConfig 模型回退配置，上游全部失败时依次尝试替代模型。
+// Groups 中的配置优先于 Models，例如：
+//
+//	{"models": {"claude-sonnet-4": ["claude-3-7-sonnet"]}, "groups": {"vip": {"gpt-4o": ["gpt-4.1"]}}}
+type ModelFallbackConfig struct {
+	Models map[string][]string            `json:"models"`
+	Groups map[string]map[string][]string `json:"groups"`
+}
+
+var modelFallbackConfig = ModelFallbackConfig{
+	Models: map[string][]string{},
+	Groups: map[string]map[string][]string{},
+}
+var modelFallbackMutex sync.RWMutex
+
+func ModelFallbackChains2JSONString() string {
+	modelFallbackMutex.RLock()
+	defer modelFallbackMutex.RUnlock()
+
+	jsonBytes, err := json.Marshal(modelFallbackConfig)
+	if err != nil {
+		common.SysError("error marshalling model fallback chains: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelFallbackChainsByJSONString(jsonStr string) error {
+	config := ModelFallbackConfig{}
+	if err := json.Unmarshal([]byte(jsonStr), &config); err != nil {
+		return err
+	}
+	modelFallbackMutex.Lock()
+	defer modelFallbackMutex.Unlock()
+	modelFallbackConfig = config
+	return nil
+}
+
+func CheckModelFallbackChains(jsonStr string) error {
+	config := ModelFallbackConfig{}
+	if err := json.Unmarshal([]byte(jsonStr), &config); err != nil {
+		return err
+	}
+	check := func(chains map[string][]string) error {
+		for model, fallbacks := range chains {
+			for _, fallback := range fallbacks {
+				if fallback == model {
+					return fmt.Errorf("模型 %s 不能回退到自身", model)
+				}
+			}
+		}
+		return nil
+	}
+	if err := check(config.Models); err != nil {
+		return err
+	}
+	for group, chains := range config.Groups {
+		if !ContainsGroupRatio(group) {
+			return fmt.Errorf("分组 %s 不存在于分组倍率中", group)
+		}
+		if err := check(chains); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetModelFallbacks 返回模型在指定分组下的替代模型列表，分组未配置时使用全局配置
+func GetModelFallbacks(group string, model string) []string {
+	modelFallbackMutex.RLock()
+	defer modelFallbackMutex.RUnlock()
+
+	if chains, ok := modelFallbackConfig.Groups[group]; ok {
+		if fallbacks, ok := chains[model]; ok {
+			return append([]string(nil), fallbacks...)
+		}
+	}
+	return append([]string(nil), modelFallbackConfig.Models[model]...)
+}
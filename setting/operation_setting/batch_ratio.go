@@ -0,0 +1,62 @@
+package operation_setting
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"tea-api/common"
+)
+
+// DefaultBatchDiscountRatio 未单独配置的模型在批处理任务中的计费折扣
+const DefaultBatchDiscountRatio = 0.5
+
+var batchDiscountRatioMap = map[string]float64{}
+var batchDiscountRatioMapMutex sync.RWMutex
+
+// BatchDiscountRatio2JSONString converts the batch discount ratio map to a JSON string
+func BatchDiscountRatio2JSONString() string {
+	batchDiscountRatioMapMutex.RLock()
+	defer batchDiscountRatioMapMutex.RUnlock()
+	jsonBytes, err := json.Marshal(batchDiscountRatioMap)
+	if err != nil {
+		common.SysError("error marshalling batch discount ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+// UpdateBatchDiscountRatioByJSONString updates the batch discount ratio map from a JSON string
+func UpdateBatchDiscountRatioByJSONString(jsonStr string) error {
+	ratioMap := make(map[string]float64)
+	if err := json.Unmarshal([]byte(jsonStr), &ratioMap); err != nil {
+		return err
+	}
+	batchDiscountRatioMapMutex.Lock()
+	defer batchDiscountRatioMapMutex.Unlock()
+	batchDiscountRatioMap = ratioMap
+	return nil
+}
+
+// CheckBatchDiscountRatio 校验批处理折扣配置，折扣必须大于 0
+func CheckBatchDiscountRatio(jsonStr string) error {
+	ratioMap := make(map[string]float64)
+	if err := json.Unmarshal([]byte(jsonStr), &ratioMap); err != nil {
+		return err
+	}
+	for name, ratio := range ratioMap {
+		if ratio <= 0 {
+			return fmt.Errorf("模型 %s 的批处理折扣必须大于 0", name)
+		}
+	}
+	return nil
+}
+
+// GetBatchDiscountRatio returns the batch discount ratio for a model
+func GetBatchDiscountRatio(name string) float64 {
+	batchDiscountRatioMapMutex.RLock()
+	defer batchDiscountRatioMapMutex.RUnlock()
+	ratio, ok := batchDiscountRatioMap[name]
+	if !ok {
+		return DefaultBatchDiscountRatio
+	}
+	return ratio
+}
@@ -0,0 +1,34 @@
+package operation_setting
+
+import "tea-api/setting/config"
+
+// ChannelAutoTestSetting 渠道自动测试配置，渠道可在 setting 中单独设置测试间隔与响应时间阈值
+type ChannelAutoTestSetting struct {
+	Enabled bool `json:"enabled"`
+	// 默认测试间隔（分钟）
+	IntervalMinutes int `json:"interval_minutes"`
+	// 被自动禁用的渠道按连续失败次数指数退避，重测间隔最长不超过该值（分钟）
+	MaxBackoffMinutes int `json:"max_backoff_minutes"`
+	// 被自动禁用的渠道连续通过多少次测试后自动启用
+	EnablePassThreshold int `json:"enable_pass_threshold"`
+	// 测试记录保留天数，0 表示不清理
+	HistoryRetentionDays int `json:"history_retention_days"`
+}
+
+// 默认配置
+var channelAutoTestSetting = ChannelAutoTestSetting{
+	Enabled:              false,
+	IntervalMinutes:      30,
+	MaxBackoffMinutes:    720,
+	EnablePassThreshold:  2,
+	HistoryRetentionDays: 7,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_auto_test", &channelAutoTestSetting)
+}
+
+func GetChannelAutoTestSetting() *ChannelAutoTestSetting {
+	return &channelAutoTestSetting
+}
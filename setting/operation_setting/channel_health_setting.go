@@ -0,0 +1,49 @@
+package operation_setting
+
+import "tea-api/setting/config"
+
+// ChannelHealthSetting 渠道健康调度配置
+type ChannelHealthSetting struct {
+	Enabled bool `json:"enabled"`
+	// 连续失败多少次后熔断（渠道+模型维度）
+	FailureThreshold int `json:"failure_threshold"`
+	// 熔断后多少秒进入半开状态
+	OpenSeconds int `json:"open_seconds"`
+	// 半开状态下连续成功多少次后恢复
+	HalfOpenSuccessThreshold int `json:"half_open_success_threshold"`
+	// 成功率与延迟的指数移动平均系数
+	EwmaAlpha float64 `json:"ewma_alpha"`
+	// 延迟基准（毫秒），平均延迟低于基准时不降权
+	LatencyBaselineMs int `json:"latency_baseline_ms"`
+	// 权重最低折扣，避免慢渠道完全拿不到流量
+	MinWeightFactor float64 `json:"min_weight_factor"`
+	// 健康数据持久化到 channel_stats 的间隔（秒）
+	FlushIntervalSeconds int `json:"flush_interval_seconds"`
+	// 延迟优先模式下首字时延比例的指数，越大越偏向最快的渠道
+	LatencyRoutingExponent float64 `json:"latency_routing_exponent"`
+	// 延迟优先模式下首字时延样本数达到该值后才参与调权
+	LatencyRoutingMinSamples int `json:"latency_routing_min_samples"`
+}
+
+// 默认配置
+var channelHealthSetting = ChannelHealthSetting{
+	Enabled:                  true,
+	FailureThreshold:         5,
+	OpenSeconds:              60,
+	HalfOpenSuccessThreshold: 2,
+	EwmaAlpha:                0.2,
+	LatencyBaselineMs:        3000,
+	MinWeightFactor:          0.05,
+	FlushIntervalSeconds:     60,
+	LatencyRoutingExponent:   1,
+	LatencyRoutingMinSamples: 5,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_health", &channelHealthSetting)
+}
+
+func GetChannelHealthSetting() *ChannelHealthSetting {
+	return &channelHealthSetting
+}
@@ -0,0 +1,11 @@
+package operation_setting
+
+import (
+	"tea-api/common"
+	"tea-api/setting/config"
+)
+
+func init() {
+	// 注册到全局配置管理器，配置本身定义在 common 中以便中间件直接读取
+	config.GlobalConfig.Register("latency_optimization", common.GetLatencyOptConfigForUpdate())
+}
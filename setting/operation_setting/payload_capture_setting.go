@@ -0,0 +1,64 @@
+package operation_setting
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"tea-api/setting/config"
+)
+
+// PayloadCaptureSetting 请求/响应内容留存配置
+type PayloadCaptureSetting struct {
+	// 总开关，开启后仍需令牌或用户单独开启
+	Enabled bool `json:"enabled"`
+	// 请求体和响应体各自保存的最大大小（KB），超出部分截断
+	MaxBodyKB int `json:"max_body_kb"`
+	// 保留天数，0 表示不自动清理
+	RetentionDays int `json:"retention_days"`
+	// 是否脱敏常见格式的 API 密钥，例如 sk-xxx、Bearer xxx
+	RedactApiKeys bool `json:"redact_api_keys"`
+	// 是否脱敏邮箱地址
+	RedactEmails bool `json:"redact_emails"`
+	// 按 JSON 字段名整体脱敏，不区分大小写，例如 ["api_key", "user"]
+	RedactFields []string `json:"redact_fields"`
+	// 自定义脱敏正则，匹配到的内容被替换
+	RedactPatterns []string `json:"redact_patterns"`
+	// 是否允许普通用户查看自己的留存内容
+	UserViewEnabled bool `json:"user_view_enabled"`
+}
+
+// 默认配置
+var payloadCaptureSetting = PayloadCaptureSetting{
+	Enabled:         false,
+	MaxBodyKB:       64,
+	RetentionDays:   7,
+	RedactApiKeys:   true,
+	RedactEmails:    true,
+	RedactFields:    []string{},
+	RedactPatterns:  []string{},
+	UserViewEnabled: true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("payload_capture", &payloadCaptureSetting)
+}
+
+func GetPayloadCaptureSetting() *PayloadCaptureSetting {
+	return &payloadCaptureSetting
+}
+
+// CheckPayloadCaptureRedactPatterns 校验自定义脱敏正则，值为正则字符串数组的 JSON
+func CheckPayloadCaptureRedactPatterns(jsonStr string) error {
+	var patterns []string
+	if err := json.Unmarshal([]byte(jsonStr), &patterns); err != nil {
+		return err
+	}
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("脱敏正则 %s 无效: %v", pattern, err)
+		}
+	}
+	return nil
+}
@@ -1,8 +1,25 @@
 package setting
 
+const (
+	PaymentProviderEpay   = "epay"
+	PaymentProviderStripe = "stripe"
+)
+
+// PaymentProvider 在线充值使用的支付渠道，epay 或 stripe
+var PaymentProvider = PaymentProviderEpay
+
 var PayAddress = ""
 var CustomCallbackAddress = ""
 var EpayId = ""
 var EpayKey = ""
 var Price = 7.3
 var MinTopUp = 1
+
+// StripeApiAddress Stripe API 地址，测试时可指向本地的模拟服务
+var StripeApiAddress = "https://api.stripe.com"
+var StripeApiSecret = ""
+var StripeWebhookSecret = ""
+
+// StripeCurrency Stripe 结算币种，StripePrice 为每美金额度在该币种下的价格
+var StripeCurrency = "usd"
+var StripePrice = 1.0
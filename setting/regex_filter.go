@@ -1,8 +1,201 @@
 package setting
 
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"tea-api/common"
+)
+
 // Default regex rules for sensitive words.
 // Users may load these from configuration later.
 
 var DefaultRegexRules = map[string][]string{
 	"sensitive": {`badword`, `\d{6}password`},
 }
+
+const (
+	// RegexFilterActionBlock 命中后拒绝请求
+	RegexFilterActionBlock = "block"
+	// RegexFilterActionMask 命中后将匹配内容替换为 Replacement
+	RegexFilterActionMask = "mask"
+	// RegexFilterActionLog 命中后只记录日志
+	RegexFilterActionLog = "log"
+
+	// RegexFilterExemptAll 豁免配置中表示豁免全部规则组
+	RegexFilterExemptAll = "*"
+
+	regexFilterDefaultReplacement = "***"
+)
+
+// RegexFilterRule 单条正则规则
+type RegexFilterRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Action      string `json:"action"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// RegexFilterRuleGroup 正则规则组，例如：
+//
+//	{"pii": {"enabled": true, "rules": [{"name": "phone", "pattern": "1[3-9]\\d{9}", "action": "mask"}]}}
+type RegexFilterRuleGroup struct {
+	Enabled bool              `json:"enabled"`
+	Rules   []RegexFilterRule `json:"rules"`
+}
+
+// RegexFilterExemptions 正则过滤豁免，值为豁免的规则组名，"*" 表示全部豁免。
+// Tokens 的键为令牌 ID，例如：
+//
+//	{"groups": {"vip": ["pii"]}, "tokens": {"12": ["*"]}}
+type RegexFilterExemptions struct {
+	Groups map[string][]string `json:"groups"`
+	Tokens map[string][]string `json:"tokens"`
+}
+
+var RegexFilterEnabled = false
+
+var regexFilterRuleGroups = defaultRegexFilterRuleGroups()
+var regexFilterExemptions = RegexFilterExemptions{
+	Groups: map[string][]string{},
+	Tokens: map[string][]string{},
+}
+var regexFilterMutex sync.RWMutex
+
+// regexFilterVersion 规则组每次更新后递增，用于通知使用方重新编译规则
+var regexFilterVersion atomic.Int64
+
+func defaultRegexFilterRuleGroups() map[string]RegexFilterRuleGroup {
+	groups := make(map[string]RegexFilterRuleGroup, len(DefaultRegexRules))
+	for name, patterns := range DefaultRegexRules {
+		group := RegexFilterRuleGroup{Enabled: true}
+		for i, pattern := range patterns {
+			group.Rules = append(group.Rules, RegexFilterRule{
+				Name:    name + "-" + strconv.Itoa(i+1),
+				Pattern: pattern,
+				Action:  RegexFilterActionBlock,
+			})
+		}
+		groups[name] = group
+	}
+	return groups
+}
+
+func RegexFilterRules2JSONString() string {
+	regexFilterMutex.RLock()
+	defer regexFilterMutex.RUnlock()
+
+	jsonBytes, err := json.Marshal(regexFilterRuleGroups)
+	if err != nil {
+		common.SysError("error marshalling regex filter rules: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateRegexFilterRulesByJSONString(jsonStr string) error {
+	groups := make(map[string]RegexFilterRuleGroup)
+	if err := json.Unmarshal([]byte(jsonStr), &groups); err != nil {
+		return err
+	}
+	regexFilterMutex.Lock()
+	defer regexFilterMutex.Unlock()
+	regexFilterRuleGroups = groups
+	regexFilterVersion.Add(1)
+	return nil
+}
+
+func CheckRegexFilterRules(jsonStr string) error {
+	groups := make(map[string]RegexFilterRuleGroup)
+	if err := json.Unmarshal([]byte(jsonStr), &groups); err != nil {
+		return err
+	}
+	for groupName, group := range groups {
+		if groupName == RegexFilterExemptAll {
+			return fmt.Errorf("规则组名不能为 %s", RegexFilterExemptAll)
+		}
+		for _, rule := range group.Rules {
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("规则组 %s 的规则 %s 正则表达式无效: %s", groupName, rule.Name, err.Error())
+			}
+			switch rule.Action {
+			case RegexFilterActionBlock, RegexFilterActionMask, RegexFilterActionLog:
+			default:
+				return fmt.Errorf("规则组 %s 的规则 %s 动作无效: %s", groupName, rule.Name, rule.Action)
+			}
+		}
+	}
+	return nil
+}
+
+// GetRegexFilterRuleGroups 返回当前规则组及其版本号
+func GetRegexFilterRuleGroups() (map[string]RegexFilterRuleGroup, int64) {
+	regexFilterMutex.RLock()
+	defer regexFilterMutex.RUnlock()
+	return regexFilterRuleGroups, regexFilterVersion.Load()
+}
+
+// GetRegexFilterRuleVersion 返回规则组版本号
+func GetRegexFilterRuleVersion() int64 {
+	return regexFilterVersion.Load()
+}
+
+// GetReplacement 返回 mask 规则的替换文本
+func (r *RegexFilterRule) GetReplacement() string {
+	if r.Replacement == "" {
+		return regexFilterDefaultReplacement
+	}
+	return r.Replacement
+}
+
+func RegexFilterExemptions2JSONString() string {
+	regexFilterMutex.RLock()
+	defer regexFilterMutex.RUnlock()
+
+	jsonBytes, err := json.Marshal(regexFilterExemptions)
+	if err != nil {
+		common.SysError("error marshalling regex filter exemptions: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateRegexFilterExemptionsByJSONString(jsonStr string) error {
+	exemptions := RegexFilterExemptions{}
+	if err := json.Unmarshal([]byte(jsonStr), &exemptions); err != nil {
+		return err
+	}
+	regexFilterMutex.Lock()
+	defer regexFilterMutex.Unlock()
+	regexFilterExemptions = exemptions
+	return nil
+}
+
+func CheckRegexFilterExemptions(jsonStr string) error {
+	exemptions := RegexFilterExemptions{}
+	if err := json.Unmarshal([]byte(jsonStr), &exemptions); err != nil {
+		return err
+	}
+	for tokenId := range exemptions.Tokens {
+		if _, err := strconv.Atoi(tokenId); err != nil {
+			return fmt.Errorf("令牌 ID %s 无效", tokenId)
+		}
+	}
+	return nil
+}
+
+// GetRegexFilterExemptGroups 返回分组和令牌豁免的规则组集合，包含 "*" 时表示全部豁免
+func GetRegexFilterExemptGroups(group string, tokenId int) map[string]bool {
+	regexFilterMutex.RLock()
+	defer regexFilterMutex.RUnlock()
+
+	exempt := make(map[string]bool)
+	for _, name := range regexFilterExemptions.Groups[group] {
+		exempt[name] = true
+	}
+	for _, name := range regexFilterExemptions.Tokens[strconv.Itoa(tokenId)] {
+		exempt[name] = true
+	}
+	return exempt
+}
@@ -0,0 +1,86 @@
+package setting
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"tea-api/common"
+)
+
+// ResponseCacheEnabled 响应缓存总开关，开启后仍需令牌或分组单独启用
+var ResponseCacheEnabled = false
+
+// ResponseCacheTTLSeconds 缓存条目的有效期
+var ResponseCacheTTLSeconds = 3600
+
+// ResponseCacheHitRatio 命中缓存时的计费倍率，0 表示命中不计费
+var ResponseCacheHitRatio = 0.1
+
+// responseCacheGroups 启用响应缓存的分组，分组内所有令牌的请求均参与缓存
+var responseCacheGroups = map[string]bool{}
+var responseCacheGroupsMutex sync.RWMutex
+
+func ResponseCacheGroups2JSONString() string {
+	responseCacheGroupsMutex.RLock()
+	defer responseCacheGroupsMutex.RUnlock()
+
+	groups := make([]string, 0, len(responseCacheGroups))
+	for group := range responseCacheGroups {
+		groups = append(groups, group)
+	}
+	jsonBytes, err := json.Marshal(groups)
+	if err != nil {
+		common.SysError("error marshalling response cache groups: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateResponseCacheGroupsByJSONString(jsonStr string) error {
+	var groups []string
+	if err := json.Unmarshal([]byte(jsonStr), &groups); err != nil {
+		return err
+	}
+	responseCacheGroupsMutex.Lock()
+	defer responseCacheGroupsMutex.Unlock()
+	responseCacheGroups = make(map[string]bool, len(groups))
+	for _, group := range groups {
+		responseCacheGroups[group] = true
+	}
+	return nil
+}
+
+func CheckResponseCacheGroups(jsonStr string) error {
+	var groups []string
+	if err := json.Unmarshal([]byte(jsonStr), &groups); err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if !ContainsGroupRatio(group) {
+			return fmt.Errorf("分组 %s 不存在于分组倍率中", group)
+		}
+	}
+	return nil
+}
+
+func IsResponseCacheGroup(group string) bool {
+	responseCacheGroupsMutex.RLock()
+	defer responseCacheGroupsMutex.RUnlock()
+	return responseCacheGroups[group]
+}
+
+func CheckResponseCacheHitRatio(value string) error {
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil || ratio < 0 {
+		return fmt.Errorf("缓存命中计费倍率必须为非负数")
+	}
+	return nil
+}
+
+func CheckResponseCacheTTLSeconds(value string) error {
+	ttl, err := strconv.Atoi(value)
+	if err != nil || ttl <= 0 {
+		return fmt.Errorf("缓存有效期必须为正整数")
+	}
+	return nil
+}
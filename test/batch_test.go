@@ -0,0 +1,105 @@
+package test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"tea-api/constant"
+	"tea-api/service"
+	"tea-api/setting/operation_setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseBatchInput 测试批处理输入文件的逐行校验
+func TestParseBatchInput(t *testing.T) {
+	valid := `{"custom_id": "a", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "gpt-4o", "messages": []}}
+
+{"custom_id": "b", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "gpt-4o", "messages": []}}
+`
+	lines, batchErrors := service.ParseBatchInput([]byte(valid), "/v1/chat/completions")
+	assert.Empty(t, batchErrors)
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, "a", lines[0].CustomId)
+		assert.Equal(t, "b", lines[1].CustomId)
+	}
+
+	invalid := strings.Join([]string{
+		`not json`,
+		`{"custom_id": "a", "method": "POST", "url": "/v1/chat/completions", "body": {}}`,
+		`{"custom_id": "a", "method": "POST", "url": "/v1/chat/completions", "body": {}}`,
+		`{"custom_id": "c", "method": "GET", "url": "/v1/chat/completions", "body": {}}`,
+		`{"custom_id": "d", "method": "POST", "url": "/v1/embeddings", "body": {}}`,
+		`{"custom_id": "e", "method": "POST", "url": "/v1/chat/completions", "body": {"stream": true}}`,
+		`{"custom_id": "f", "method": "POST", "url": "/v1/chat/completions", "body": "text"}`,
+	}, "\n")
+	_, batchErrors = service.ParseBatchInput([]byte(invalid), "/v1/chat/completions")
+	codes := make(map[int]string)
+	for _, batchError := range batchErrors {
+		if assert.NotNil(t, batchError.Line) {
+			codes[*batchError.Line] = batchError.Code
+		}
+	}
+	assert.Equal(t, map[int]string{
+		1: "invalid_json_line",
+		3: "duplicate_custom_id",
+		4: "invalid_method",
+		5: "mismatched_endpoint",
+		6: "invalid_request",
+		7: "invalid_request",
+	}, codes)
+
+	_, batchErrors = service.ParseBatchInput([]byte("\n\n"), "/v1/chat/completions")
+	if assert.Len(t, batchErrors, 1) {
+		assert.Equal(t, "empty_file", batchErrors[0].Code)
+	}
+}
+
+// TestBatchDiscountRatio 测试按模型配置的批处理折扣，未配置的模型使用默认折扣
+func TestBatchDiscountRatio(t *testing.T) {
+	origin := operation_setting.BatchDiscountRatio2JSONString()
+	defer func() {
+		_ = operation_setting.UpdateBatchDiscountRatioByJSONString(origin)
+	}()
+
+	assert.Error(t, operation_setting.CheckBatchDiscountRatio(`{"gpt-4o": 0}`))
+	assert.Error(t, operation_setting.CheckBatchDiscountRatio(`not json`))
+	assert.NoError(t, operation_setting.CheckBatchDiscountRatio(`{"gpt-4o": 0.3}`))
+
+	assert.NoError(t, operation_setting.UpdateBatchDiscountRatioByJSONString(`{"gpt-4o": 0.3}`))
+	assert.Equal(t, 0.3, operation_setting.GetBatchDiscountRatio("gpt-4o"))
+	assert.Equal(t, operation_setting.DefaultBatchDiscountRatio, operation_setting.GetBatchDiscountRatio("gpt-4o-mini"))
+}
+
+// TestLocalFileStorage 测试本地磁盘文件存储的写入、读取与删除
+func TestLocalFileStorage(t *testing.T) {
+	originType, originPath := constant.FileStorageType, constant.FileStoragePath
+	defer func() {
+		constant.FileStorageType, constant.FileStoragePath = originType, originPath
+	}()
+	constant.FileStorageType = constant.FileStorageTypeLocal
+	constant.FileStoragePath = t.TempDir()
+
+	storage, err := service.GetFileStorage()
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx := context.Background()
+	content := `{"custom_id": "a"}`
+	assert.NoError(t, storage.Save(ctx, "1/file-test", strings.NewReader(content), int64(len(content))))
+
+	reader, err := storage.Open(ctx, "1/file-test")
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(reader)
+		_ = reader.Close()
+		assert.Equal(t, content, string(data))
+	}
+
+	assert.NoError(t, storage.Delete(ctx, "1/file-test"))
+	_, err = storage.Open(ctx, "1/file-test")
+	assert.Error(t, err)
+	// 重复删除不报错
+	assert.NoError(t, storage.Delete(ctx, "1/file-test"))
+}
@@ -0,0 +1,56 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"tea-api/common"
+	"tea-api/service"
+	"tea-api/setting/operation_setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestChannelAutoTestBackoff 测试被自动禁用的渠道按连续失败次数指数退避，且不超过最大间隔
+func TestChannelAutoTestBackoff(t *testing.T) {
+	setting := operation_setting.GetChannelAutoTestSetting()
+	origin := *setting
+	defer func() { *setting = origin }()
+	setting.MaxBackoffMinutes = 60
+
+	interval := 10 * time.Minute
+	// 启用中的渠道始终按固定间隔测试
+	assert.Equal(t, interval, service.ChannelAutoTestDelay(interval, common.ChannelStatusEnabled, 5))
+
+	disabled := common.ChannelStatusAutoDisabled
+	assert.Equal(t, interval, service.ChannelAutoTestDelay(interval, disabled, 1))
+	assert.Equal(t, 20*time.Minute, service.ChannelAutoTestDelay(interval, disabled, 2))
+	assert.Equal(t, 40*time.Minute, service.ChannelAutoTestDelay(interval, disabled, 3))
+	assert.Equal(t, 60*time.Minute, service.ChannelAutoTestDelay(interval, disabled, 4))
+	assert.Equal(t, 60*time.Minute, service.ChannelAutoTestDelay(interval, disabled, 100))
+
+	// 最大间隔小于渠道自身的间隔时按渠道间隔测试
+	assert.Equal(t, 2*time.Hour, service.ChannelAutoTestDelay(2*time.Hour, disabled, 3))
+}
+
+// TestChannelAutoTestEnableThreshold 测试被自动禁用的渠道需要连续通过多次测试才会重新启用
+func TestChannelAutoTestEnableThreshold(t *testing.T) {
+	setting := operation_setting.GetChannelAutoTestSetting()
+	origin := *setting
+	originEnable := common.AutomaticEnableChannelEnabled
+	defer func() {
+		*setting = origin
+		common.AutomaticEnableChannelEnabled = originEnable
+	}()
+	setting.EnablePassThreshold = 3
+	common.AutomaticEnableChannelEnabled = true
+
+	disabled := common.ChannelStatusAutoDisabled
+	assert.False(t, service.ShouldAutoEnableChannel(nil, nil, disabled, 2))
+	assert.True(t, service.ShouldAutoEnableChannel(nil, nil, disabled, 3))
+	// 手动禁用的渠道不会被自动启用
+	assert.False(t, service.ShouldAutoEnableChannel(nil, nil, common.ChannelStatusManuallyDisabled, 3))
+
+	common.AutomaticEnableChannelEnabled = false
+	assert.False(t, service.ShouldAutoEnableChannel(nil, nil, disabled, 3))
+}
@@ -0,0 +1,56 @@
+package test
+
+import (
+	"testing"
+
+	"tea-api/common"
+	"tea-api/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestChannelMultiKeyPolling 测试轮询模式下跳过已禁用的密钥
+func TestChannelMultiKeyPolling(t *testing.T) {
+	channel := &model.Channel{
+		Id:  90001,
+		Key: "sk-a\nsk-b\n\nsk-c\n",
+		ChannelInfo: model.ChannelInfo{
+			IsMultiKey:         true,
+			MultiKeyMode:       model.MultiKeyModePolling,
+			MultiKeyStatusList: map[int]int{1: common.ChannelStatusAutoDisabled},
+		},
+	}
+	assert.Equal(t, []string{"sk-a", "sk-b", "sk-c"}, channel.GetKeys())
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		key, _, err := channel.GetNextEnabledKey()
+		assert.NoError(t, err)
+		got = append(got, key)
+	}
+	assert.Equal(t, []string{"sk-a", "sk-c", "sk-a", "sk-c"}, got)
+
+	channel.ChannelInfo.MultiKeyStatusList[0] = common.ChannelStatusManuallyDisabled
+	channel.ChannelInfo.MultiKeyStatusList[2] = common.ChannelStatusAutoDisabled
+	_, _, err := channel.GetNextEnabledKey()
+	assert.Error(t, err)
+}
+
+// TestChannelMultiKeyVertex 测试 Vertex 渠道使用 JSON 数组保存多个密钥
+func TestChannelMultiKeyVertex(t *testing.T) {
+	channel := &model.Channel{
+		Type: common.ChannelTypeVertexAi,
+		Key:  `[{"project_id":"a"},{"project_id":"b"}]`,
+		ChannelInfo: model.ChannelInfo{
+			IsMultiKey: true,
+		},
+	}
+	keys := channel.GetKeys()
+	assert.Len(t, keys, 2)
+	assert.JSONEq(t, `{"project_id":"b"}`, keys[1])
+
+	single, err := channel.WithSingleKey(1)
+	assert.NoError(t, err)
+	assert.False(t, single.ChannelInfo.IsMultiKey)
+	assert.Equal(t, keys[1], single.Key)
+}
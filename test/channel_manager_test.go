@@ -0,0 +1,129 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tea-api/constant"
+	"tea-api/dto"
+	"tea-api/service"
+	"tea-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestChannelManagerCircuitBreaker 测试连续失败后熔断、冷却结束后半开并在探测成功后恢复
+func TestChannelManagerCircuitBreaker(t *testing.T) {
+	setting := operation_setting.GetChannelHealthSetting()
+	origin := *setting
+	defer func() { *setting = origin }()
+	setting.Enabled = true
+	setting.FailureThreshold = 3
+	setting.OpenSeconds = 0
+	setting.HalfOpenSuccessThreshold = 2
+
+	cm := service.GetChannelManager()
+	channelId, modelName := 90101, "gpt-4o"
+	defer cm.Reset(channelId, "")
+
+	for i := 0; i < 3; i++ {
+		cm.Report(channelId, modelName, false, 0)
+	}
+	assert.Less(t, cm.WeightFactor(channelId, modelName), 0.1)
+
+	setting.OpenSeconds = 60
+	assert.False(t, cm.Allow(channelId, modelName))
+	// 其它模型不受影响
+	assert.True(t, cm.Allow(channelId, "gpt-4o-mini"))
+
+	setting.OpenSeconds = 0
+	assert.True(t, cm.Allow(channelId, modelName))
+	cm.Report(channelId, modelName, true, 100*time.Millisecond)
+	cm.Report(channelId, modelName, true, 100*time.Millisecond)
+	assert.Greater(t, cm.WeightFactor(channelId, modelName), setting.MinWeightFactor)
+}
+
+// TestChannelManagerIgnoreClientError 测试请求参数错误和本地错误不计入渠道失败
+func TestChannelManagerIgnoreClientError(t *testing.T) {
+	assert.False(t, service.IsChannelFailure(&dto.OpenAIErrorWithStatusCode{StatusCode: http.StatusBadRequest}))
+	assert.False(t, service.IsChannelFailure(&dto.OpenAIErrorWithStatusCode{StatusCode: http.StatusInternalServerError, LocalError: true}))
+	assert.True(t, service.IsChannelFailure(&dto.OpenAIErrorWithStatusCode{StatusCode: http.StatusTooManyRequests}))
+	assert.True(t, service.IsChannelFailure(&dto.OpenAIErrorWithStatusCode{StatusCode: http.StatusBadGateway}))
+}
+
+// TestChannelManagerHalfOpenSingleProbe 测试半开状态下同一时间只放行一个探测请求
+func TestChannelManagerHalfOpenSingleProbe(t *testing.T) {
+	setting := operation_setting.GetChannelHealthSetting()
+	origin := *setting
+	defer func() { *setting = origin }()
+	setting.Enabled = true
+	setting.FailureThreshold = 1
+	setting.OpenSeconds = 0
+	setting.HalfOpenSuccessThreshold = 2
+
+	cm := service.GetChannelManager()
+	channelId, modelName := 90102, "gpt-4o"
+	defer cm.Reset(channelId, "")
+
+	cm.Report(channelId, modelName, false, 0)
+	assert.True(t, cm.Allow(channelId, modelName))
+	assert.True(t, cm.AcquireProbe(channelId, modelName))
+	// 探测请求在途时不再放行
+	assert.False(t, cm.Allow(channelId, modelName))
+	assert.False(t, cm.AcquireProbe(channelId, modelName))
+
+	// 非渠道原因的失败释放探测名额
+	cm.ReportRelayResult(channelId, modelName, &dto.OpenAIErrorWithStatusCode{StatusCode: http.StatusBadRequest}, 0, 0)
+	assert.True(t, cm.AcquireProbe(channelId, modelName))
+
+	cm.Report(channelId, modelName, true, 100*time.Millisecond)
+	assert.True(t, cm.Allow(channelId, modelName))
+	assert.True(t, cm.AcquireProbe(channelId, modelName))
+}
+
+func findChannelHealth(cm *service.ChannelManager, channelId int, modelName string) *service.ChannelHealthSnapshot {
+	for _, snapshot := range cm.Snapshot() {
+		if snapshot.ChannelId == channelId && snapshot.Model == modelName {
+			return &snapshot
+		}
+	}
+	return nil
+}
+
+// TestChannelManagerIgnoreResponseCacheHit 测试命中响应缓存时不改变熔断状态和成功率、延迟统计，只释放探测名额
+func TestChannelManagerIgnoreResponseCacheHit(t *testing.T) {
+	setting := operation_setting.GetChannelHealthSetting()
+	origin := *setting
+	defer func() { *setting = origin }()
+	setting.Enabled = true
+	setting.FailureThreshold = 1
+	setting.OpenSeconds = 0
+	setting.HalfOpenSuccessThreshold = 1
+
+	cm := service.GetChannelManager()
+	channelId, modelName := 90103, "gpt-4o"
+	defer cm.Reset(channelId, "")
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set(constant.ContextKeyResponseCacheHit, true)
+
+	cm.Report(channelId, modelName, true, 2*time.Second)
+	cm.Report(channelId, modelName, false, 0)
+	assert.True(t, cm.Allow(channelId, modelName))
+	assert.True(t, cm.AcquireProbe(channelId, modelName))
+	before := findChannelHealth(cm, channelId, modelName)
+	assert.NotNil(t, before)
+	assert.Equal(t, service.CircuitStateHalfOpen, before.State)
+
+	service.ReportRelayAttempt(c, channelId, modelName, nil, time.Now().Add(-10*time.Millisecond))
+	after := findChannelHealth(cm, channelId, modelName)
+	assert.Equal(t, service.CircuitStateHalfOpen, after.State)
+	assert.Equal(t, before.SuccessRate, after.SuccessRate)
+	assert.Equal(t, before.AvgLatency, after.AvgLatency)
+	assert.Equal(t, before.AvgFirstTokenLatency, after.AvgFirstTokenLatency)
+	// 探测名额已释放
+	assert.True(t, cm.AcquireProbe(channelId, modelName))
+}
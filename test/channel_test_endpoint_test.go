@@ -0,0 +1,47 @@
+package test
+
+import (
+	"testing"
+
+	"tea-api/common"
+	"tea-api/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestChannelTestEndpoint 测试按渠道类型和测试模型选择渠道测试请求的接口
+func TestChannelTestEndpoint(t *testing.T) {
+	openai := common.ChannelTypeOpenAI
+	cases := []struct {
+		channelType int
+		model       string
+		expected    string
+	}{
+		{openai, "gpt-4o-mini", service.ChannelTestEndpointChat},
+		{openai, "text-embedding-3-small", service.ChannelTestEndpointEmbeddings},
+		{common.ChannelTypeMokaAI, "m3e-base", service.ChannelTestEndpointEmbeddings},
+		{openai, "dall-e-3", service.ChannelTestEndpointImage},
+		{openai, "gpt-image-1", service.ChannelTestEndpointImage},
+		{openai, "tts-1", service.ChannelTestEndpointSpeech},
+		{openai, "gpt-4o-mini-tts", service.ChannelTestEndpointSpeech},
+		{openai, "whisper-1", service.ChannelTestEndpointTranscription},
+		{openai, "gpt-4o-transcribe", service.ChannelTestEndpointTranscription},
+		{common.ChannelTypeJina, "jina-reranker-v2-base-multilingual", service.ChannelTestEndpointRerank},
+		{openai, "codex-mini-latest", service.ChannelTestEndpointResponses},
+		{common.ChannelTypeAzure, "o1-pro", service.ChannelTestEndpointResponses},
+		// 非 OpenAI、Azure 渠道不支持 Responses API，仍按对话测试
+		{common.ChannelTypeOpenRouter, "o1-pro", service.ChannelTestEndpointChat},
+		// 任务类渠道只查询任务状态
+		{common.ChannelTypeMidjourneyPlus, "mj_imagine", service.ChannelTestEndpointMidjourney},
+		{common.ChannelTypeSunoAPI, "suno_music", service.ChannelTestEndpointSuno},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.expected, service.GetChannelTestEndpoint(tc.channelType, tc.model, ""), tc.model)
+	}
+
+	// 渠道设置指定的接口优先于推断，无效的配置被忽略
+	assert.Equal(t, service.ChannelTestEndpointImage, service.GetChannelTestEndpoint(openai, "my-painter", service.ChannelTestEndpointImage))
+	assert.Equal(t, service.ChannelTestEndpointChat, service.GetChannelTestEndpoint(openai, "gpt-4o", "unknown"))
+	// 任务类渠道不能指定其他接口
+	assert.Equal(t, service.ChannelTestEndpointSuno, service.GetChannelTestEndpoint(common.ChannelTypeSunoAPI, "suno_music", service.ChannelTestEndpointChat))
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tea-api/dto"
+	relaycommon "tea-api/relay/common"
+	"tea-api/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// claudeFixture 录制的 Claude Messages 与 OpenAI Chat Completions 转换样例
+type claudeFixture struct {
+	ClaudeRequest  json.RawMessage   `json:"claude_request"`
+	OpenAIRequest  json.RawMessage   `json:"openai_request"`
+	OpenAIResponse json.RawMessage   `json:"openai_response"`
+	ClaudeResponse json.RawMessage   `json:"claude_response"`
+	OpenAIStream   []json.RawMessage `json:"openai_stream"`
+	ClaudeStream   []json.RawMessage `json:"claude_stream"`
+}
+
+func newClaudeConvertRelayInfo() *relaycommon.RelayInfo {
+	return &relaycommon.RelayInfo{
+		PromptTokens: 7,
+		ClaudeConvertInfo: &relaycommon.ClaudeConvertInfo{
+			LastMessagesType: relaycommon.LastMessageTypeNone,
+		},
+	}
+}
+
+func marshalJSON(t *testing.T, v any) string {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(data)
+}
+
+// TestClaudeConformance 按 testdata/claude 下的样例校验请求、非流式响应与流式响应的转换结果
+func TestClaudeConformance(t *testing.T) {
+	files, err := filepath.Glob("testdata/claude/*.json")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			raw, err := os.ReadFile(file)
+			require.NoError(t, err)
+			var fixture claudeFixture
+			require.NoError(t, json.Unmarshal(raw, &fixture))
+
+			// 请求：Claude -> OpenAI
+			var claudeRequest dto.ClaudeRequest
+			require.NoError(t, json.Unmarshal(fixture.ClaudeRequest, &claudeRequest))
+			openAIRequest, err := service.ClaudeToOpenAIRequest(claudeRequest, newClaudeConvertRelayInfo())
+			require.NoError(t, err)
+			assert.JSONEq(t, string(fixture.OpenAIRequest), marshalJSON(t, openAIRequest))
+
+			// 非流式响应：OpenAI -> Claude
+			var openAIResponse dto.OpenAITextResponse
+			require.NoError(t, json.Unmarshal(fixture.OpenAIResponse, &openAIResponse))
+			claudeResponse := service.ResponseOpenAI2Claude(&openAIResponse, newClaudeConvertRelayInfo())
+			assert.JSONEq(t, string(fixture.ClaudeResponse), marshalJSON(t, claudeResponse))
+
+			// 流式响应：逐块转换，结束时补发 message_delta 与 message_stop
+			if len(fixture.OpenAIStream) == 0 {
+				return
+			}
+			info := newClaudeConvertRelayInfo()
+			var events []*dto.ClaudeResponse
+			for _, data := range fixture.OpenAIStream {
+				var chunk dto.ChatCompletionsStreamResponse
+				require.NoError(t, json.Unmarshal(data, &chunk))
+				if chunk.Usage != nil {
+					info.ClaudeConvertInfo.Usage = chunk.Usage
+				}
+				events = append(events, service.StreamResponseOpenAI2Claude(&chunk, info)...)
+			}
+			info.ClaudeConvertInfo.Done = true
+			events = append(events, service.StreamResponseOpenAI2Claude(&dto.ChatCompletionsStreamResponse{}, info)...)
+
+			require.Len(t, events, len(fixture.ClaudeStream))
+			for i, event := range events {
+				assert.JSONEq(t, string(fixture.ClaudeStream[i]), marshalJSON(t, event), "event %d", i)
+			}
+		})
+	}
+}
+
+// TestClaudeToolChoice 测试 tool_choice 的转换
+func TestClaudeToolChoice(t *testing.T) {
+	tools := []any{map[string]any{"name": "f", "input_schema": map[string]any{"type": "object"}}}
+	cases := []struct {
+		toolChoice any
+		expected   any
+	}{
+		{map[string]any{"type": "auto"}, "auto"},
+		{map[string]any{"type": "any"}, "required"},
+		{map[string]any{"type": "none"}, "none"},
+		{map[string]any{"type": "tool", "name": "f"}, map[string]any{"type": "function", "function": map[string]any{"name": "f"}}},
+		{nil, nil},
+	}
+	for _, tc := range cases {
+		request := dto.ClaudeRequest{
+			Model:      "gpt-4o",
+			Tools:      tools,
+			ToolChoice: tc.toolChoice,
+			Messages:   []dto.ClaudeMessage{{Role: "user", Content: "hi"}},
+		}
+		openAIRequest, err := service.ClaudeToOpenAIRequest(request, newClaudeConvertRelayInfo())
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, openAIRequest.ToolChoice)
+		assert.Nil(t, openAIRequest.ParallelTooCalls)
+	}
+}
@@ -0,0 +1,50 @@
+package test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"tea-api/common"
+	"tea-api/model"
+
+	"github.com/stretchr/testify/require"
+)
+
+// setupTestDB 使用临时的 SQLite 数据库初始化 model.DB 和 model.LOG_DB 并完成迁移，测试结束后恢复
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	originDB, originLogDB := model.DB, model.LOG_DB
+	originPath, originMaster, originSQLite := common.SQLitePath, common.IsMasterNode, common.UsingSQLite
+	originRedis := common.RedisEnabled
+	// 未初始化 Redis 客户端时 RedisEnabled 默认为 true，测试中只使用数据库
+	common.RedisEnabled = false
+	t.Setenv("SQL_DSN", "")
+	t.Setenv("LOG_SQL_DSN", "")
+	common.SQLitePath = filepath.Join(t.TempDir(), "tea-api.db") + "?_busy_timeout=5000"
+	common.IsMasterNode = true
+	require.NoError(t, model.InitDB())
+	require.NoError(t, model.InitLogDB())
+	t.Cleanup(func() {
+		if sqlDB, err := model.DB.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+		model.DB, model.LOG_DB = originDB, originLogDB
+		common.SQLitePath, common.IsMasterNode, common.UsingSQLite = originPath, originMaster, originSQLite
+		common.RedisEnabled = originRedis
+	})
+}
+
+// createTestUser 创建指定额度和分组的用户
+func createTestUser(t *testing.T, name string, quota int, group string) *model.User {
+	t.Helper()
+	user := &model.User{
+		Username: name,
+		Password: "password",
+		Quota:    quota,
+		Group:    group,
+		AffCode:  fmt.Sprintf("aff-%s", name),
+	}
+	require.NoError(t, model.DB.Create(user).Error)
+	return user
+}
@@ -0,0 +1,183 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tea-api/common"
+	"tea-api/dto"
+	"tea-api/relay"
+	"tea-api/relay/channel/gemini"
+	relayconstant "tea-api/relay/constant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGeminiNativePath 测试 Gemini 原生接口路径的解析
+func TestGeminiNativePath(t *testing.T) {
+	model, action := relayconstant.ParseGeminiModelAction("/v1beta/models/gemini-2.0-flash:streamGenerateContent")
+	assert.Equal(t, "gemini-2.0-flash", model)
+	assert.Equal(t, relayconstant.GeminiActionStreamGenerateContent, action)
+
+	// 模型名中可以包含冒号，按最后一个冒号分割
+	model, action = relayconstant.ParseGeminiModelAction("/v1beta/models/tuned:v1:generateContent")
+	assert.Equal(t, "tuned:v1", model)
+	assert.Equal(t, relayconstant.GeminiActionGenerateContent, action)
+
+	assert.Equal(t, relayconstant.RelayModeGeminiGenerateContent, relayconstant.Path2RelayMode("/v1beta/models/gemini-pro:generateContent"))
+	assert.Equal(t, relayconstant.RelayModeGeminiGenerateContent, relayconstant.Path2RelayMode("/v1beta/models/gemini-pro:streamGenerateContent"))
+	assert.Equal(t, relayconstant.RelayModeGeminiCountTokens, relayconstant.Path2RelayMode("/v1beta/models/gemini-pro:countTokens"))
+	assert.Equal(t, relayconstant.RelayModeGeminiEmbedContent, relayconstant.Path2RelayMode("/v1beta/models/text-embedding-004:embedContent"))
+	assert.True(t, relayconstant.IsGeminiRelayMode(relayconstant.RelayModeGeminiCountTokens))
+	assert.False(t, relayconstant.IsGeminiRelayMode(relayconstant.RelayModeChatCompletions))
+}
+
+// TestGeminiRequest2OpenAI 测试 Gemini 请求转换为 OpenAI 请求
+func TestGeminiRequest2OpenAI(t *testing.T) {
+	body := `{
+		"systemInstruction": {"parts": [{"text": "be brief"}]},
+		"contents": [
+			{"role": "user", "parts": [{"text": "weather?"}, {"inlineData": {"mimeType": "image/png", "data": "aGVsbG8="}}]},
+			{"role": "model", "parts": [{"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}}]},
+			{"role": "user", "parts": [{"functionResponse": {"name": "get_weather", "response": {"temp": 20}}}]}
+		],
+		"generationConfig": {"temperature": 0.5, "maxOutputTokens": 128, "stopSequences": ["END"], "responseMimeType": "application/json"},
+		"tools": [{"functionDeclarations": [{"name": "get_weather", "parameters": {"type": "OBJECT", "properties": {"city": {"type": "STRING"}}}}]}, {"googleSearch": {}}],
+		"toolConfig": {"functionCallingConfig": {"mode": "ANY"}}
+	}`
+	var geminiRequest gemini.GeminiChatRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &geminiRequest))
+
+	request, err := gemini.GeminiRequest2OpenAI(&geminiRequest)
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, *request.Temperature)
+	assert.Equal(t, uint(128), request.MaxTokens)
+	assert.Equal(t, []string{"END"}, request.Stop)
+	assert.Equal(t, "json_object", request.ResponseFormat.Type)
+	assert.Equal(t, "required", request.ToolChoice)
+
+	// googleSearch 被忽略，参数中的类型名转换为小写
+	require.Len(t, request.Tools, 1)
+	parameters := request.Tools[0].Function.Parameters.(map[string]any)
+	assert.Equal(t, "object", parameters["type"])
+	assert.Equal(t, "string", parameters["properties"].(map[string]any)["city"].(map[string]any)["type"])
+
+	require.Len(t, request.Messages, 4)
+	assert.Equal(t, "system", request.Messages[0].Role)
+	assert.Equal(t, "be brief", request.Messages[0].StringContent())
+
+	assert.Equal(t, "user", request.Messages[1].Role)
+	contents := request.Messages[1].ParseContent()
+	require.Len(t, contents, 2)
+	assert.Equal(t, dto.ContentTypeImageURL, contents[1].Type)
+	assert.Equal(t, "data:image/png;base64,aGVsbG8=", contents[1].GetImageMedia().Url)
+
+	// 函数调用与函数结果通过生成的 id 对应
+	assert.Equal(t, "assistant", request.Messages[2].Role)
+	toolCalls := request.Messages[2].ParseToolCalls()
+	require.Len(t, toolCalls, 1)
+	assert.Equal(t, "get_weather", toolCalls[0].Function.Name)
+	assert.JSONEq(t, `{"city":"Paris"}`, toolCalls[0].Function.Arguments)
+	assert.Equal(t, "tool", request.Messages[3].Role)
+	assert.Equal(t, toolCalls[0].ID, request.Messages[3].ToolCallId)
+	assert.JSONEq(t, `{"temp":20}`, request.Messages[3].StringContent())
+}
+
+// TestResponseOpenAI2Gemini 测试 OpenAI 响应转换为 Gemini 响应
+func TestResponseOpenAI2Gemini(t *testing.T) {
+	body := `{
+		"model": "gpt-4o",
+		"choices": [{"index": 0, "finish_reason": "tool_calls", "message": {"role": "assistant", "content": "checking",
+			"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]}}],
+		"usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}
+	}`
+	var response dto.OpenAITextResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &response))
+
+	geminiResponse := gemini.ResponseOpenAI2Gemini(&response)
+	require.Len(t, geminiResponse.Candidates, 1)
+	candidate := geminiResponse.Candidates[0]
+	assert.Equal(t, "STOP", *candidate.FinishReason)
+	assert.Equal(t, "model", candidate.Content.Role)
+	require.Len(t, candidate.Content.Parts, 2)
+	assert.Equal(t, "checking", candidate.Content.Parts[0].Text)
+	assert.Equal(t, "get_weather", candidate.Content.Parts[1].FunctionCall.FunctionName)
+	assert.Equal(t, map[string]any{"city": "Paris"}, candidate.Content.Parts[1].FunctionCall.Arguments)
+	assert.Equal(t, 10, geminiResponse.UsageMetadata.PromptTokenCount)
+	assert.Equal(t, 5, geminiResponse.UsageMetadata.CandidatesTokenCount)
+	assert.Equal(t, 15, geminiResponse.UsageMetadata.TotalTokenCount)
+}
+
+// TestOpenAIStreamConverter 测试 OpenAI 流式响应转换，函数调用参数累积后在最后一块输出
+func TestOpenAIStreamConverter(t *testing.T) {
+	chunks := []string{
+		`{"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hel"}}]}`,
+		`{"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+		`{"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"ci"}}]}}]}`,
+		`{"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"ty\":\"Paris\"}"}}]}}]}`,
+		`{"model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`,
+	}
+	converter := gemini.NewOpenAIStreamConverter("gpt-4o")
+	var texts []string
+	for _, chunk := range chunks {
+		var streamResponse dto.ChatCompletionsStreamResponse
+		require.NoError(t, json.Unmarshal([]byte(chunk), &streamResponse))
+		if response := converter.Convert(&streamResponse); response != nil {
+			texts = append(texts, response.Candidates[0].Content.Parts[0].Text)
+		}
+	}
+	assert.Equal(t, []string{"Hel", "lo"}, texts)
+
+	final := converter.Finish(&dto.Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7})
+	require.Len(t, final.Candidates, 1)
+	assert.Equal(t, "MAX_TOKENS", *final.Candidates[0].FinishReason)
+	require.Len(t, final.Candidates[0].Content.Parts, 1)
+	assert.Equal(t, map[string]any{"city": "Paris"}, final.Candidates[0].Content.Parts[0].FunctionCall.Arguments)
+	assert.Equal(t, 7, final.UsageMetadata.TotalTokenCount)
+}
+
+// TestGeminiNativeParamOverride 测试透传给 Gemini 渠道的原生请求同样应用参数覆盖规则
+func TestGeminiNativeParamOverride(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var upstreamBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		upstreamBody = string(data)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"totalTokens":3}`))
+	}))
+	defer upstream.Close()
+
+	body := `{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`
+	countTokens := func(paramOverride map[string]any) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1beta/models/gemini-2.0-flash:countTokens", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("channel_type", common.ChannelTypeGemini)
+		c.Set("base_url", upstream.URL)
+		c.Set("original_model", "gemini-2.0-flash")
+		c.Set("param_override", paramOverride)
+		require.Nil(t, relay.GeminiHelper(c))
+		return recorder
+	}
+
+	paramOverride := make(map[string]any)
+	require.NoError(t, json.Unmarshal([]byte(`{"operations":[
+		{"mode":"set","path":"contents.0.parts.0.text","value":"overridden","conditions":[{"path":"$model","mode":"prefix","value":"gemini-2.0"}]},
+		{"mode":"delete","path":"contents.0.role"}
+	]}`), &paramOverride))
+	recorder := countTokens(paramOverride)
+	assert.JSONEq(t, `{"contents":[{"parts":[{"text":"overridden"}]}]}`, upstreamBody)
+	assert.Contains(t, recorder.Body.String(), `"totalTokens":3`)
+
+	// 渠道未设置覆盖规则时原样透传
+	countTokens(nil)
+	assert.Equal(t, body, upstreamBody)
+}
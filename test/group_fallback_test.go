@@ -0,0 +1,33 @@
+package test
+
+import (
+	"testing"
+
+	"tea-api/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGroupFallbackChain 测试分组回退链的解析与计费分组
+func TestGroupFallbackChain(t *testing.T) {
+	origin := setting.GroupFallbackChains2JSONString()
+	originMode := setting.GroupFallbackBillingMode
+	defer func() {
+		_ = setting.UpdateGroupFallbackChainsByJSONString(origin)
+		setting.GroupFallbackBillingMode = originMode
+	}()
+
+	assert.Error(t, setting.CheckGroupFallbackChains(`{"vip":["vip"]}`))
+	assert.Error(t, setting.CheckGroupFallbackChains(`{"vip":["not-exist-group"]}`))
+	assert.NoError(t, setting.CheckGroupFallbackChains(`{"vip":["default"]}`))
+
+	assert.NoError(t, setting.UpdateGroupFallbackChainsByJSONString(`{"vip":["default","default","svip"]}`))
+	assert.Equal(t, []string{"vip", "default", "svip"}, setting.GetGroupFallbackChain("vip"))
+	assert.Equal(t, []string{"default"}, setting.GetGroupFallbackChain("default"))
+
+	setting.GroupFallbackBillingMode = setting.GroupFallbackBillingOrigin
+	assert.Equal(t, "vip", setting.GetFallbackBillingGroup("vip", "default"))
+	setting.GroupFallbackBillingMode = setting.GroupFallbackBillingFallback
+	assert.Equal(t, "default", setting.GetFallbackBillingGroup("vip", "default"))
+	assert.Equal(t, "vip", setting.GetFallbackBillingGroup("vip", ""))
+}
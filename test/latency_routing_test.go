@@ -0,0 +1,63 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"tea-api/service"
+	"tea-api/setting"
+	"tea-api/setting/operation_setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGroupRoutingModes 测试分组渠道选择模式的校验与默认值
+func TestGroupRoutingModes(t *testing.T) {
+	origin := setting.GroupRoutingModes2JSONString()
+	defer func() { _ = setting.UpdateGroupRoutingModesByJSONString(origin) }()
+
+	assert.Error(t, setting.CheckGroupRoutingModes(`{"default":"fastest"}`))
+	assert.Error(t, setting.CheckGroupRoutingModes(`{"not-exist-group":"latency"}`))
+	assert.NoError(t, setting.CheckGroupRoutingModes(`{"default":"latency","vip":"weight"}`))
+
+	assert.NoError(t, setting.UpdateGroupRoutingModesByJSONString(`{"default":"latency"}`))
+	assert.Equal(t, setting.GroupRoutingModeLatency, setting.GetGroupRoutingMode("default"))
+	assert.Equal(t, setting.GroupRoutingModeWeight, setting.GetGroupRoutingMode("vip"))
+}
+
+// TestChannelManagerLatencyWeightFactor 测试延迟优先模式按首字时延相对最快渠道降权，并叠加错误率
+func TestChannelManagerLatencyWeightFactor(t *testing.T) {
+	healthSetting := operation_setting.GetChannelHealthSetting()
+	origin := *healthSetting
+	defer func() { *healthSetting = origin }()
+	healthSetting.EwmaAlpha = 0.5
+	healthSetting.LatencyRoutingExponent = 1
+	healthSetting.LatencyRoutingMinSamples = 3
+	healthSetting.MinWeightFactor = 0.05
+
+	cm := service.GetChannelManager()
+	fast, slow, fresh, modelName := 90201, 90202, 90203, "gpt-4o"
+	for _, channelId := range []int{fast, slow, fresh} {
+		defer cm.Reset(channelId, "")
+	}
+
+	for i := 0; i < 3; i++ {
+		cm.ReportRelayResult(fast, modelName, nil, 0, 200*time.Millisecond)
+		cm.ReportRelayResult(slow, modelName, nil, 0, 800*time.Millisecond)
+	}
+	cm.ReportRelayResult(fresh, modelName, nil, 0, 100*time.Millisecond)
+
+	assert.Equal(t, 200.0, cm.FirstTokenLatency(fast, modelName))
+	assert.Equal(t, 800.0, cm.FirstTokenLatency(slow, modelName))
+	// 样本不足时不参与调权
+	assert.Equal(t, 0.0, cm.FirstTokenLatency(fresh, modelName))
+
+	fastest := cm.FirstTokenLatency(fast, modelName)
+	assert.Equal(t, 1.0, cm.LatencyWeightFactor(fast, modelName, fastest))
+	assert.InDelta(t, 0.25, cm.LatencyWeightFactor(slow, modelName, fastest), 0.001)
+	assert.Equal(t, 1.0, cm.LatencyWeightFactor(fresh, modelName, fastest))
+
+	// 失败会拉低成功率，同样降低权重
+	cm.Report(fast, modelName, false, 0)
+	assert.InDelta(t, 0.25, cm.LatencyWeightFactor(fast, modelName, fastest), 0.001)
+}
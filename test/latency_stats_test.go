@@ -0,0 +1,84 @@
+package test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"tea-api/common"
+	"tea-api/service"
+	"tea-api/setting/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLatencyStatsPercentiles 测试按全局、渠道、模型三个维度计算分位数，未经过的阶段不计入
+func TestLatencyStatsPercentiles(t *testing.T) {
+	collector := service.GetLatencyStatsCollector()
+	collector.Reset()
+	defer collector.Reset()
+
+	for i := 1; i <= 100; i++ {
+		metrics := &common.LatencyMetrics{
+			AuthLatency: time.Duration(i) * time.Millisecond,
+			ConnLatency: time.Duration(i*10) * time.Millisecond,
+		}
+		// 只有一半请求是流式，带有首字时延
+		if i%2 == 0 {
+			metrics.FirstTokenLatency = time.Duration(i*100) * time.Millisecond
+		}
+		channelId := 91001
+		if i > 80 {
+			channelId = 91002
+		}
+		collector.Record(channelId, "latency-model", metrics)
+	}
+
+	global, channels, models := collector.Snapshot()
+	assert.Equal(t, int64(100), global.Count)
+	assert.Equal(t, service.LatencyPercentiles{P50: 50, P90: 90, P99: 99}, global.Auth)
+	assert.Equal(t, service.LatencyPercentiles{P50: 500, P90: 900, P99: 990}, global.Connect)
+	assert.Equal(t, service.LatencyPercentiles{P50: 5000, P90: 9000, P99: 10000}, global.FirstToken)
+
+	require.Len(t, channels, 2)
+	assert.Equal(t, 91001, channels[0].ChannelId)
+	assert.Equal(t, int64(80), channels[0].Count)
+	assert.Equal(t, int64(40), channels[0].Auth.P50)
+	assert.Equal(t, int64(90), channels[1].Auth.P50, "第二个渠道只包含 81~100 的样本")
+
+	require.Len(t, models, 1)
+	assert.Equal(t, "latency-model", models[0].Model)
+	assert.Equal(t, global.Auth, models[0].Auth)
+}
+
+// TestLatencyMonitorUpstreamConnect 测试连接延迟从开始请求上游计算到收到响应头
+func TestLatencyMonitorUpstreamConnect(t *testing.T) {
+	requestId := "latency-test-request"
+	common.StartLatencyTracking(requestId)
+	common.RecordAuthComplete(requestId)
+	time.Sleep(30 * time.Millisecond)
+	common.RecordUpstreamStart(requestId)
+	time.Sleep(10 * time.Millisecond)
+	common.RecordUpstreamConnect(requestId)
+
+	metrics := common.RecordRequestComplete(requestId)
+	require.NotNil(t, metrics)
+	assert.GreaterOrEqual(t, metrics.ConnLatency, 10*time.Millisecond)
+	assert.Less(t, metrics.ConnLatency, 30*time.Millisecond, "请求准备阶段不计入连接延迟")
+	assert.Nil(t, common.RecordRequestComplete(requestId), "完成后清理单次请求的指标")
+}
+
+// TestLatencyOptConfigSnapshot 测试修改选项后发布新的配置快照，已取得的快照不受影响
+func TestLatencyOptConfigSnapshot(t *testing.T) {
+	registered := common.GetLatencyOptConfigForUpdate()
+	before := common.GetLatencyOptConfig()
+	origin := registered.EnableTokenCache
+	defer func() {
+		require.NoError(t, config.UpdateConfigFromMap(registered, map[string]string{"enable_token_cache": strconv.FormatBool(origin)}))
+	}()
+
+	require.NoError(t, config.UpdateConfigFromMap(registered, map[string]string{"enable_token_cache": strconv.FormatBool(!origin)}))
+	assert.Equal(t, !origin, common.GetLatencyOptConfig().EnableTokenCache)
+	assert.Equal(t, origin, before.EnableTokenCache)
+}
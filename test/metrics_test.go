@@ -0,0 +1,67 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrapeMetrics(t *testing.T, authorization string) (int, string) {
+	engine := gin.New()
+	engine.GET("/metrics", middleware.MetricsAuth(), gin.WrapH(common.MetricsHandler()))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	engine.ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+// TestMetricsEndpoint 测试中继指标按渠道、模型、分组标签输出
+func TestMetricsEndpoint(t *testing.T) {
+	common.RecordRelayAttemptMetrics(901, 1, "metrics-model", "default", "", 1500*time.Millisecond)
+	common.RecordRelayAttemptMetrics(901, 1, "metrics-model", "default", "rate_limit_exceeded", 200*time.Millisecond)
+	common.RecordFirstTokenMetrics(901, 1, "metrics-model", "default", 300*time.Millisecond)
+	common.RecordConsumeMetrics(901, 1, "metrics-model", "default", 120, 30, 150)
+
+	constant.MetricsToken = "secret"
+	defer func() { constant.MetricsToken = "" }()
+
+	status, body := scrapeMetrics(t, "Bearer secret")
+	assert.Equal(t, http.StatusOK, status)
+	labels := `channel_id="901",channel_type="1",group="default",model="metrics-model"`
+	assert.Contains(t, body, `tea_relay_requests_total{`+labels+`} 2`)
+	assert.Contains(t, body, `tea_relay_errors_total{channel_id="901",channel_type="1",error_code="rate_limit_exceeded",group="default",model="metrics-model"} 1`)
+	assert.Contains(t, body, `tea_relay_request_duration_seconds_bucket{`+labels+`,le="2"} 2`)
+	assert.Contains(t, body, `tea_relay_first_token_seconds_count{`+labels+`} 1`)
+	assert.Contains(t, body, `tea_relay_prompt_tokens_total{`+labels+`} 120`)
+	assert.Contains(t, body, `tea_relay_completion_tokens_total{`+labels+`} 30`)
+	assert.Contains(t, body, `tea_relay_quota_consumed_total{`+labels+`} 150`)
+	assert.Contains(t, body, "tea_active_streams ")
+	assert.Contains(t, body, "tea_ip_blacklist_size ")
+}
+
+// TestMetricsAuth 测试抓取时需要携带正确的 Bearer token，未设置 METRICS_TOKEN 时拒绝抓取
+func TestMetricsAuth(t *testing.T) {
+	status, _ := scrapeMetrics(t, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	constant.MetricsToken = "secret"
+	defer func() { constant.MetricsToken = "" }()
+
+	status, _ = scrapeMetrics(t, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = scrapeMetrics(t, "Bearer wrong")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = scrapeMetrics(t, "Bearer secret")
+	assert.Equal(t, http.StatusOK, status)
+}
@@ -0,0 +1,37 @@
+package test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"tea-api/service"
+	"tea-api/setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestModelFallbackChain 测试替代模型的优先级以及令牌模型限制
+func TestModelFallbackChain(t *testing.T) {
+	origin := setting.ModelFallbackChains2JSONString()
+	defer func() { _ = setting.UpdateModelFallbackChainsByJSONString(origin) }()
+
+	assert.Error(t, setting.CheckModelFallbackChains(`{"models":{"gpt-4o":["gpt-4o"]}}`))
+	assert.NoError(t, setting.UpdateModelFallbackChainsByJSONString(
+		`{"models":{"claude-sonnet-4":["claude-3-7-sonnet","claude-sonnet-4","claude-3-5-sonnet"]},"groups":{"vip":{"claude-sonnet-4":["claude-opus-4"]}}}`))
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	assert.Equal(t, []string{"claude-3-7-sonnet", "claude-3-5-sonnet"}, service.GetModelFallbackChain(c, "default", "claude-sonnet-4"))
+	assert.Equal(t, []string{"claude-opus-4"}, service.GetModelFallbackChain(c, "vip", "claude-sonnet-4"))
+	assert.Empty(t, service.GetModelFallbackChain(c, "default", "gpt-4o"))
+
+	// 令牌限制了可用模型
+	c.Set("token_model_limit_enabled", true)
+	c.Set("token_model_limit", map[string]bool{"claude-sonnet-4": true, "claude-3-5-sonnet": true})
+	assert.Equal(t, []string{"claude-3-5-sonnet"}, service.GetModelFallbackChain(c, "default", "claude-sonnet-4"))
+
+	// 令牌自身的配置优先
+	c.Set("token_model_fallbacks", map[string][]string{"claude-sonnet-4": {"claude-3-5-sonnet"}})
+	c.Set("token_model_limit_enabled", false)
+	assert.Equal(t, []string{"claude-3-5-sonnet"}, service.GetModelFallbackChain(c, "vip", "claude-sonnet-4"))
+}
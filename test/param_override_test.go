@@ -0,0 +1,139 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	relaycommon "tea-api/relay/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newParamOverrideInfo(t *testing.T, rules string) *relaycommon.RelayInfo {
+	paramOverride := make(map[string]any)
+	require.NoError(t, json.Unmarshal([]byte(rules), &paramOverride))
+	return &relaycommon.RelayInfo{
+		ParamOverride:     paramOverride,
+		OriginModelName:   "claude-sonnet",
+		UpstreamModelName: "claude-3-7-sonnet-20250219",
+	}
+}
+
+func applyParamOverride(t *testing.T, info *relaycommon.RelayInfo, body string) map[string]any {
+	data, err := info.ApplyParamOverride([]byte(body))
+	require.NoError(t, err)
+	result := make(map[string]any)
+	require.NoError(t, json.Unmarshal(data, &result))
+	return result
+}
+
+// TestParamOverrideLegacy 测试旧版平铺配置仍按顶层字段整体替换
+func TestParamOverrideLegacy(t *testing.T) {
+	info := newParamOverrideInfo(t, `{"temperature":0.1,"a.b":1}`)
+	result := applyParamOverride(t, info, `{"model":"m","temperature":1}`)
+	assert.Equal(t, 0.1, result["temperature"])
+	assert.Equal(t, 1.0, result["a.b"])
+}
+
+// TestParamOverrideOperations 测试按路径设置、删除、追加和移动字段
+func TestParamOverrideOperations(t *testing.T) {
+	info := newParamOverrideInfo(t, `{"operations":[
+		{"mode":"set","path":"thinking.budget_tokens","value":1024},
+		{"mode":"delete","path":"stream_options"},
+		{"mode":"delete","path":"messages.0"},
+		{"mode":"append","path":"stop","value":["###"]},
+		{"mode":"append","path":"messages.-1.content","value":"!"},
+		{"mode":"move","from":"max_tokens","path":"max_completion_tokens"}
+	]}`)
+	result := applyParamOverride(t, info, `{
+		"model":"m","max_tokens":100,"stop":["\n"],"stream_options":{"include_usage":true},
+		"messages":[{"role":"system","content":"sys"},{"role":"user","content":"hi"}]
+	}`)
+	assert.Equal(t, map[string]any{"budget_tokens": 1024.0}, result["thinking"])
+	assert.NotContains(t, result, "stream_options")
+	assert.NotContains(t, result, "max_tokens")
+	assert.Equal(t, 100.0, result["max_completion_tokens"])
+	assert.Equal(t, []any{"\n", "###"}, result["stop"])
+	assert.Equal(t, []any{map[string]any{"role": "user", "content": "hi!"}}, result["messages"])
+
+	// 路径中间是非对象的值时报错
+	info = newParamOverrideInfo(t, `{"operations":[{"mode":"set","path":"model.name","value":"x"}]}`)
+	_, err := info.ApplyParamOverride([]byte(`{"model":"m"}`))
+	assert.Error(t, err)
+}
+
+// TestParamOverrideConditions 测试按模型名和请求字段决定规则是否生效
+func TestParamOverrideConditions(t *testing.T) {
+	info := newParamOverrideInfo(t, `{"operations":[
+		{"mode":"set","path":"a","value":1,"conditions":[{"path":"$model","mode":"prefix","value":"claude-3-7"}]},
+		{"mode":"set","path":"b","value":1,"conditions":[{"path":"$original_model","mode":"full","value":"gpt-4o"}]},
+		{"mode":"set","path":"c","value":1,"conditions":[{"path":"max_tokens","mode":"gt","value":1000},{"path":"stream","mode":"full","value":true}]},
+		{"mode":"set","path":"d","value":1,"logic":"OR","conditions":[{"path":"max_tokens","mode":"gt","value":1000},{"path":"stream","mode":"full","value":true}]},
+		{"mode":"set","path":"e","value":1,"conditions":[{"path":"tools","mode":"exists","invert":true}]},
+		{"mode":"set","path":"f","value":1,"conditions":[{"path":"messages.0.role","mode":"regex","value":"^(system|developer)$"}]}
+	]}`)
+	result := applyParamOverride(t, info, `{"max_tokens":2000,"stream":false,"messages":[{"role":"system"}]}`)
+	assert.Contains(t, result, "a")
+	assert.NotContains(t, result, "b")
+	assert.NotContains(t, result, "c")
+	assert.Contains(t, result, "d")
+	assert.Contains(t, result, "e")
+	assert.Contains(t, result, "f")
+}
+
+// TestParamOverrideHeaders 测试上游请求头的设置与删除，请求体未经过覆盖时只按模型条件生效
+func TestParamOverrideHeaders(t *testing.T) {
+	rules := `{"operations":[
+		{"mode":"set_header","path":"anthropic-beta","value":"output-128k-2025-02-19","conditions":[{"path":"$model","mode":"contains","value":"3-7"}]},
+		{"mode":"set_header","path":"X-Stream","value":"1","conditions":[{"path":"stream","mode":"full","value":true}]},
+		{"mode":"delete_header","path":"X-Remove"}
+	]}`
+	info := newParamOverrideInfo(t, rules)
+	_, err := info.ApplyParamOverride([]byte(`{"stream":true}`))
+	require.NoError(t, err)
+	header := http.Header{}
+	header.Set("X-Remove", "1")
+	info.ApplyHeaderOverride(header)
+	assert.Equal(t, "output-128k-2025-02-19", header.Get("anthropic-beta"))
+	assert.Equal(t, "1", header.Get("X-Stream"))
+	assert.Empty(t, header.Get("X-Remove"))
+
+	info = newParamOverrideInfo(t, rules)
+	header = http.Header{}
+	info.ApplyHeaderOverride(header)
+	assert.Equal(t, "output-128k-2025-02-19", header.Get("anthropic-beta"))
+	assert.Empty(t, header.Get("X-Stream"))
+}
+
+// TestRealtimeSessionOverride 测试 Realtime 会话中覆盖规则作用于 session.update 的 session 对象
+func TestRealtimeSessionOverride(t *testing.T) {
+	info := newParamOverrideInfo(t, `{"operations":[
+		{"mode":"set","path":"temperature","value":0.6},
+		{"mode":"delete","path":"tools","conditions":[{"path":"$model","mode":"prefix","value":"claude"}]}
+	]}`)
+	data, err := info.ApplyRealtimeSessionOverride([]byte(`{"event_id":"e1","type":"session.update","session":{"temperature":1,"tools":[]}}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"event_id":"e1","type":"session.update","session":{"temperature":0.6}}`, string(data))
+
+	// 其他事件原样转发
+	message := `{"type":"input_audio_buffer.append","audio":"AAAA"}`
+	data, err = info.ApplyRealtimeSessionOverride([]byte(message))
+	require.NoError(t, err)
+	assert.Equal(t, message, string(data))
+}
+
+// TestCheckParamOverride 测试保存渠道时对覆盖规则的校验
+func TestCheckParamOverride(t *testing.T) {
+	assert.NoError(t, relaycommon.CheckParamOverride(""))
+	assert.NoError(t, relaycommon.CheckParamOverride(`{"temperature":0.5}`))
+	assert.NoError(t, relaycommon.CheckParamOverride(`{"operations":[{"mode":"delete","path":"top_p"}]}`))
+	assert.Error(t, relaycommon.CheckParamOverride(`[1]`))
+	assert.Error(t, relaycommon.CheckParamOverride(`{"operations":[{"mode":"rename","path":"a"}]}`))
+	assert.Error(t, relaycommon.CheckParamOverride(`{"operations":[{"mode":"set","path":"a"}]}`))
+	assert.Error(t, relaycommon.CheckParamOverride(`{"operations":[{"mode":"move","path":"a"}]}`))
+	assert.Error(t, relaycommon.CheckParamOverride(`{"operations":[{"mode":"set_header","path":"X-A","value":1}]}`))
+	assert.Error(t, relaycommon.CheckParamOverride(`{"operations":[{"mode":"delete","path":"a","conditions":[{"path":"b","mode":"regex","value":"("}]}]}`))
+	assert.Error(t, relaycommon.CheckParamOverride(`{"operations":[{"mode":"delete","path":"a","conditions":[{"path":"b","mode":"gt","value":"x"}]}]}`))
+}
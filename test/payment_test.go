@@ -0,0 +1,174 @@
+package test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"tea-api/model"
+	"tea-api/service"
+	"tea-api/setting"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signStripePayload(secret string, timestamp int64, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d.%s", timestamp, body)))
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// useStripeStub 将 Stripe 配置指向本地模拟服务，测试结束后恢复
+func useStripeStub(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	original := []string{setting.PaymentProvider, setting.StripeApiAddress, setting.StripeApiSecret, setting.StripeWebhookSecret, setting.StripeCurrency}
+	setting.PaymentProvider = setting.PaymentProviderStripe
+	setting.StripeApiAddress = server.URL
+	setting.StripeApiSecret = "sk_test_123"
+	setting.StripeWebhookSecret = "whsec_test"
+	setting.StripeCurrency = "usd"
+	t.Cleanup(func() {
+		server.Close()
+		setting.PaymentProvider, setting.StripeApiAddress, setting.StripeApiSecret, setting.StripeWebhookSecret, setting.StripeCurrency =
+			original[0], original[1], original[2], original[3], original[4]
+	})
+}
+
+// TestVerifyStripeSignature 测试 Stripe 回调签名的校验
+func TestVerifyStripeSignature(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	now := time.Unix(1700000000, 0)
+	header := signStripePayload("whsec_test", now.Unix(), string(body))
+	assert.NoError(t, service.VerifyStripeSignature(body, header, "whsec_test", now))
+	// 轮换密钥期间可能带有多个签名
+	assert.NoError(t, service.VerifyStripeSignature(body, "t=1700000000,v1=00ff,"+strings.TrimPrefix(header, "t=1700000000,"), "whsec_test", now))
+	assert.Error(t, service.VerifyStripeSignature(body, header, "whsec_other", now))
+	assert.Error(t, service.VerifyStripeSignature([]byte(`{"id":"evt_2"}`), header, "whsec_test", now))
+	assert.Error(t, service.VerifyStripeSignature(body, header, "whsec_test", now.Add(10*time.Minute)), "过期的签名")
+	assert.Error(t, service.VerifyStripeSignature(body, "", "whsec_test", now))
+}
+
+// TestStripeUnitAmount 测试支付金额转换为最小货币单位
+func TestStripeUnitAmount(t *testing.T) {
+	assert.Equal(t, int64(1999), service.StripeUnitAmount(19.99, "usd"))
+	assert.Equal(t, int64(730), service.StripeUnitAmount(7.3, "USD"))
+	assert.Equal(t, int64(500), service.StripeUnitAmount(500, "jpy"))
+}
+
+// TestStripeCheckout 测试通过本地模拟的 Stripe 服务创建 Checkout、查询订单和退款
+func TestStripeCheckout(t *testing.T) {
+	var refundForm url.Values
+	useStripeStub(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer sk_test_123", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/checkout/sessions":
+			assert.Equal(t, "USR1NOabc", r.Header.Get("Idempotency-Key"))
+			assert.Equal(t, "USR1NOabc", form.Get("client_reference_id"))
+			assert.Equal(t, "1250", form.Get("line_items[0][price_data][unit_amount]"))
+			assert.Equal(t, "usd", form.Get("line_items[0][price_data][currency]"))
+			_, _ = w.Write([]byte(`{"id":"cs_test_1","url":"https://checkout.stripe.test/cs_test_1"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/checkout/sessions/cs_test_1":
+			_, _ = w.Write([]byte(`{"id":"cs_test_1","payment_status":"paid","payment_intent":"pi_1","client_reference_id":"USR1NOabc"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/refunds":
+			refundForm = form
+			_, _ = w.Write([]byte(`{"id":"re_1","status":"succeeded"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"message":"No such resource"}}`))
+		}
+	})
+
+	provider, err := service.GetPaymentProvider()
+	require.NoError(t, err)
+	assert.Equal(t, setting.PaymentProviderStripe, provider.Name())
+
+	ctx := context.Background()
+	checkout, err := provider.CreateCheckout(ctx, &service.PaymentOrder{
+		TradeNo:   "USR1NOabc",
+		Name:      "TUC10",
+		Money:     12.5,
+		ReturnUrl: "http://localhost/log",
+		CancelUrl: "http://localhost/topup",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://checkout.stripe.test/cs_test_1", checkout.URL)
+	assert.Equal(t, "cs_test_1", checkout.ProviderOrderId)
+	assert.Empty(t, checkout.Params)
+
+	topUp := &model.TopUp{TradeNo: "USR1NOabc", ProviderOrderId: "cs_test_1"}
+	status, err := provider.QueryOrder(ctx, topUp)
+	require.NoError(t, err)
+	assert.True(t, status.Paid)
+
+	require.NoError(t, provider.Refund(ctx, topUp))
+	assert.Equal(t, "pi_1", refundForm.Get("payment_intent"))
+
+	_, err = provider.QueryOrder(ctx, &model.TopUp{TradeNo: "x", ProviderOrderId: "cs_missing"})
+	assert.ErrorContains(t, err, "No such resource")
+}
+
+// TestStripeWebhook 测试 Stripe 回调的验签与事件解析
+func TestStripeWebhook(t *testing.T) {
+	useStripeStub(t, func(w http.ResponseWriter, r *http.Request) {})
+	provider, err := service.GetPaymentProvider()
+	require.NoError(t, err)
+
+	newRequest := func(body string, signature string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/user/stripe/webhook", strings.NewReader(body))
+		r.Header.Set("Stripe-Signature", signature)
+		return r
+	}
+	now := time.Now().Unix()
+
+	body := `{"id":"evt_1","type":"checkout.session.completed","data":{"object":{"id":"cs_test_1","client_reference_id":"USR1NOabc","payment_status":"paid"}}}`
+	event, err := provider.VerifyWebhook(newRequest(body, signStripePayload("whsec_test", now, body)), []byte(body))
+	require.NoError(t, err)
+	assert.Equal(t, &service.PaymentEvent{TradeNo: "USR1NOabc", ProviderOrderId: "cs_test_1", Paid: true}, event)
+
+	// 异步支付方式在 Checkout 完成时尚未到账
+	body = `{"id":"evt_2","type":"checkout.session.completed","data":{"object":{"id":"cs_test_2","metadata":{"trade_no":"USR1NOdef"},"payment_status":"unpaid"}}}`
+	event, err = provider.VerifyWebhook(newRequest(body, signStripePayload("whsec_test", now, body)), []byte(body))
+	require.NoError(t, err)
+	assert.Equal(t, "USR1NOdef", event.TradeNo)
+	assert.False(t, event.Paid)
+
+	// 无关的事件只需确认收到
+	body = `{"id":"evt_3","type":"customer.created","data":{"object":{"id":"cus_1"}}}`
+	event, err = provider.VerifyWebhook(newRequest(body, signStripePayload("whsec_test", now, body)), []byte(body))
+	require.NoError(t, err)
+	assert.False(t, event.Paid)
+
+	_, err = provider.VerifyWebhook(newRequest(body, signStripePayload("whsec_wrong", now, body)), []byte(body))
+	assert.Error(t, err)
+}
+
+// TestCompleteTopUpErrors 测试订单不存在时返回 ErrTopUpNotFound，数据库错误原样返回以便支付回调重试
+func TestCompleteTopUpErrors(t *testing.T) {
+	setupTestDB(t)
+	_, _, err := model.CompleteTopUp("missing", setting.PaymentProviderStripe, "")
+	assert.ErrorIs(t, err, model.ErrTopUpNotFound)
+	_, _, err = model.RefundTopUp("missing")
+	assert.ErrorIs(t, err, model.ErrTopUpNotFound)
+
+	sqlDB, err := model.DB.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+	_, _, err = model.CompleteTopUp("missing", setting.PaymentProviderStripe, "")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, model.ErrTopUpNotFound)
+	_, _, err = model.RefundTopUp("missing")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, model.ErrTopUpNotFound)
+}
@@ -0,0 +1,61 @@
+package test
+
+import (
+	"testing"
+
+	"tea-api/service"
+	"tea-api/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRegexFilterScope 测试正则过滤的拦截、脱敏、仅记录以及豁免
+func TestRegexFilterScope(t *testing.T) {
+	originEnabled := setting.RegexFilterEnabled
+	originRules := setting.RegexFilterRules2JSONString()
+	originExemptions := setting.RegexFilterExemptions2JSONString()
+	defer func() {
+		setting.RegexFilterEnabled = originEnabled
+		_ = setting.UpdateRegexFilterRulesByJSONString(originRules)
+		_ = setting.UpdateRegexFilterExemptionsByJSONString(originExemptions)
+	}()
+
+	rules := `{
+		"pii": {"enabled": true, "rules": [{"name": "phone", "pattern": "1[3-9]\\d{9}", "action": "mask"}]},
+		"secret": {"enabled": true, "rules": [{"name": "key", "pattern": "sk-[a-z0-9]{8}", "action": "block"}]},
+		"audit": {"enabled": true, "rules": [{"name": "word", "pattern": "password", "action": "log"}]}
+	}`
+	assert.Error(t, setting.CheckRegexFilterRules(`{"pii": {"rules": [{"name": "bad", "pattern": "(", "action": "mask"}]}}`))
+	assert.Error(t, setting.CheckRegexFilterRules(`{"pii": {"rules": [{"name": "bad", "pattern": "a", "action": "drop"}]}}`))
+	assert.NoError(t, setting.CheckRegexFilterRules(rules))
+	assert.NoError(t, setting.UpdateRegexFilterRulesByJSONString(rules))
+	assert.NoError(t, setting.UpdateRegexFilterExemptionsByJSONString(`{"groups": {"vip": ["secret"]}, "tokens": {"7": ["*"]}}`))
+
+	// 未启用时不过滤
+	setting.RegexFilterEnabled = false
+	assert.Nil(t, service.NewRegexFilterScope("default", 1))
+	setting.RegexFilterEnabled = true
+
+	scope := service.NewRegexFilterScope("default", 1)
+	assert.NotNil(t, scope)
+	assert.Equal(t, "call ***", scope.ApplyText("call 13812345678"))
+	assert.True(t, scope.Masked())
+	assert.Nil(t, scope.Blocked())
+	assert.Equal(t, "my password", scope.ApplyText("my password"))
+	scope.ApplyText("key sk-abcd1234")
+	if assert.NotNil(t, scope.Blocked()) {
+		assert.Equal(t, "secret/key", scope.Blocked().String())
+	}
+	assert.Equal(t, []string{"pii/phone", "audit/word", "secret/key"}, scope.MatchedRules())
+
+	// 结构化内容只过滤 text 和 content 字段
+	scope = service.NewRegexFilterScope("default", 1)
+	raw := scope.ApplyRawJSON([]byte(`[{"role":"user","content":[{"type":"input_text","text":"13812345678"}]}]`))
+	assert.JSONEq(t, `[{"role":"user","content":[{"type":"input_text","text":"***"}]}]`, string(raw))
+
+	// 分组豁免部分规则组，令牌豁免全部规则组
+	scope = service.NewRegexFilterScope("vip", 1)
+	scope.ApplyText("key sk-abcd1234")
+	assert.Nil(t, scope.Blocked())
+	assert.Nil(t, service.NewRegexFilterScope("default", 7))
+}
@@ -0,0 +1,133 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tea-api/common"
+	"tea-api/constant"
+	"tea-api/dto"
+	relaycommon "tea-api/relay/common"
+	relayconstant "tea-api/relay/constant"
+	"tea-api/service"
+	"tea-api/setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newResponseCacheContext(body string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	c.Set(common.KeyRequestBody, []byte(body))
+	return c, w
+}
+
+// TestResponseCacheKey 测试缓存键忽略字段顺序、空白与流式参数，并区分上游模型与请求内容
+func TestResponseCacheKey(t *testing.T) {
+	info := &relaycommon.RelayInfo{RelayMode: relayconstant.RelayModeChatCompletions, UpstreamModelName: "gpt-4o"}
+	key := func(body string) string {
+		c, _ := newResponseCacheContext(body)
+		k, err := service.ResponseCacheKey(c, info)
+		require.NoError(t, err)
+		return k
+	}
+
+	base := key(`{"model":"gpt","temperature":0,"messages":[{"role":"user","content":"hi"}]}`)
+	assert.Equal(t, base, key(`{ "messages": [{"content":"hi","role":"user"}], "temperature": 0, "model": "gpt",
+		"stream": true, "stream_options": {"include_usage": true} }`))
+	assert.NotEqual(t, base, key(`{"model":"gpt","temperature":0,"messages":[{"role":"user","content":"hello"}]}`))
+
+	// 客户端模型名不同但映射到相同上游模型时共用缓存
+	assert.Equal(t, base, key(`{"model":"alias","temperature":0,"messages":[{"role":"user","content":"hi"}]}`))
+	info.UpstreamModelName = "gpt-4o-mini"
+	assert.NotEqual(t, base, key(`{"model":"gpt","temperature":0,"messages":[{"role":"user","content":"hi"}]}`))
+}
+
+// TestShouldUseResponseCache 测试只有启用缓存的令牌或分组的确定性请求参与缓存
+func TestShouldUseResponseCache(t *testing.T) {
+	setting.ResponseCacheEnabled = true
+	defer func() { setting.ResponseCacheEnabled = false }()
+	require.NoError(t, setting.UpdateResponseCacheGroupsByJSONString(`["ci"]`))
+	defer setting.UpdateResponseCacheGroupsByJSONString(`[]`)
+
+	zero, one := 0.0, 1.0
+	chat := &relaycommon.RelayInfo{RelayMode: relayconstant.RelayModeChatCompletions, Group: "default"}
+	c, _ := newResponseCacheContext(`{}`)
+	assert.False(t, service.ShouldUseResponseCache(c, chat, &dto.GeneralOpenAIRequest{Temperature: &zero}), "令牌与分组均未启用")
+
+	c.Set(constant.ContextKeyTokenResponseCache, true)
+	assert.True(t, service.ShouldUseResponseCache(c, chat, &dto.GeneralOpenAIRequest{Temperature: &zero}))
+	assert.False(t, service.ShouldUseResponseCache(c, chat, &dto.GeneralOpenAIRequest{Temperature: &one}))
+	assert.False(t, service.ShouldUseResponseCache(c, chat, &dto.GeneralOpenAIRequest{}), "未显式设置 temperature")
+	assert.False(t, service.ShouldUseResponseCache(c, chat, &dto.GeneralOpenAIRequest{Temperature: &zero, N: 2}))
+
+	c, _ = newResponseCacheContext(`{}`)
+	embedding := &relaycommon.RelayInfo{RelayMode: relayconstant.RelayModeEmbeddings, Group: "ci"}
+	assert.True(t, service.ShouldUseResponseCache(c, embedding, nil))
+
+	setting.ResponseCacheEnabled = false
+	assert.False(t, service.ShouldUseResponseCache(c, embedding, nil))
+}
+
+// TestResponseCacheStreamRoundTrip 测试流式响应聚合后写入缓存，再分别以非流式与流式重放
+func TestResponseCacheStreamRoundTrip(t *testing.T) {
+	redisEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	defer func() { common.RedisEnabled = redisEnabled }()
+
+	stream := strings.Join([]string{
+		`data: {"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello, "}}]}`,
+		`data: {"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"this is a cached answer."}}]}`,
+		`data: {"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"f","arguments":"{\"a\":"}}]}}]}`,
+		`data: {"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"1}"}}]}}]}`,
+		`data: {"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`data: [DONE]`,
+	}, "\n\n") + "\n\n"
+	usage := &dto.Usage{PromptTokens: 5, CompletionTokens: 9, TotalTokens: 14}
+
+	entry, err := service.BuildChatResponseCacheEntry([]byte(stream), true, usage)
+	require.NoError(t, err)
+	require.NoError(t, service.SetResponseCache("response_cache:test", entry))
+	cached, ok := service.GetResponseCache("response_cache:test")
+	require.True(t, ok)
+	assert.Equal(t, *usage, cached.Usage)
+
+	// 非流式重放
+	c, w := newResponseCacheContext(`{}`)
+	require.NoError(t, service.WriteChatResponseCache(c, &relaycommon.RelayInfo{}, cached))
+	var response dto.OpenAITextResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Choices, 1)
+	assert.Equal(t, "Hello, this is a cached answer.", response.Choices[0].Message.StringContent())
+	assert.Equal(t, "tool_calls", response.Choices[0].FinishReason)
+	toolCalls := response.Choices[0].Message.ParseToolCalls()
+	require.Len(t, toolCalls, 1)
+	assert.Equal(t, `{"a":1}`, toolCalls[0].Function.Arguments)
+	assert.Equal(t, 14, response.Usage.TotalTokens)
+
+	// 流式重放，重新分块后内容与原始响应一致
+	c, w = newResponseCacheContext(`{}`)
+	require.NoError(t, service.WriteChatResponseCache(c, &relaycommon.RelayInfo{IsStream: true, ShouldIncludeUsage: true}, cached))
+	replayed := w.Body.String()
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(replayed), "data: [DONE]"))
+	assert.Greater(t, strings.Count(replayed, "data: "), 5, "正文应被拆分为多个块")
+	again, err := service.BuildChatResponseCacheEntry(bytes.TrimSpace(w.Body.Bytes()), true, usage)
+	require.NoError(t, err)
+	var replayedResponse dto.OpenAITextResponse
+	require.NoError(t, json.Unmarshal(again.Body, &replayedResponse))
+	assert.Equal(t, "Hello, this is a cached answer.", replayedResponse.Choices[0].Message.StringContent())
+	assert.Len(t, replayedResponse.Choices[0].Message.ParseToolCalls(), 1)
+	assert.Contains(t, replayed, `"usage":{"prompt_tokens":5`)
+
+	// 被截断的响应不缓存
+	truncated := strings.Replace(stream, `"finish_reason":"tool_calls"`, `"finish_reason":"length"`, 1)
+	_, err = service.BuildChatResponseCacheEntry([]byte(truncated), true, usage)
+	assert.Error(t, err)
+}
@@ -0,0 +1,201 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"tea-api/dto"
+	"tea-api/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestResponsesRequestToOpenAIRequest 测试 Responses 请求转换为 Chat Completions 请求
+func TestResponsesRequestToOpenAIRequest(t *testing.T) {
+	body := `{
+		"model": "deepseek-chat",
+		"instructions": "be brief",
+		"max_output_tokens": 256,
+		"temperature": 0.3,
+		"reasoning": {"effort": "low"},
+		"text": {"format": {"type": "json_schema", "name": "answer", "schema": {"type": "object"}, "strict": true}},
+		"tools": [{"type": "function", "name": "get_weather", "description": "weather", "parameters": {"type": "object", "properties": {"city": {"type": "string"}}}}],
+		"tool_choice": {"type": "function", "name": "get_weather"},
+		"input": [
+			{"role": "developer", "content": "use celsius"},
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "weather?"}, {"type": "input_image", "image_url": "https://example.com/a.png", "detail": "low"}]},
+			{"type": "reasoning", "id": "rs_1", "summary": [{"type": "summary_text", "text": "need tool"}]},
+			{"type": "function_call", "call_id": "call_1", "name": "get_weather", "arguments": "{\"city\":\"Paris\"}"},
+			{"type": "function_call", "call_id": "call_2", "name": "get_weather", "arguments": "{\"city\":\"Rome\"}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "20C"},
+			{"type": "function_call_output", "call_id": "call_2", "output": [{"type": "input_text", "text": "25C"}]},
+			{"role": "assistant", "content": [{"type": "output_text", "text": "Paris 20C, Rome 25C"}]},
+			{"role": "user", "content": "thanks"}
+		]
+	}`
+	var request dto.OpenAIResponsesRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &request))
+
+	history := []dto.Message{{Role: "user", Content: json.RawMessage(`"earlier"`)}}
+	openAIRequest, err := service.ResponsesRequestToOpenAIRequest(&request, history)
+	require.NoError(t, err)
+	assert.Equal(t, uint(256), openAIRequest.MaxTokens)
+	assert.Equal(t, 0.3, *openAIRequest.Temperature)
+	assert.Equal(t, "low", openAIRequest.ReasoningEffort)
+	assert.Equal(t, "json_schema", openAIRequest.ResponseFormat.Type)
+	assert.Equal(t, "answer", openAIRequest.ResponseFormat.JsonSchema.Name)
+	require.Len(t, openAIRequest.Tools, 1)
+	assert.Equal(t, "get_weather", openAIRequest.Tools[0].Function.Name)
+	assert.Equal(t, map[string]any{"type": "function", "function": map[string]any{"name": "get_weather"}}, openAIRequest.ToolChoice)
+
+	messages := openAIRequest.Messages
+	require.Len(t, messages, 9)
+	// instructions 在最前，历史消息在本次 input 之前
+	assert.Equal(t, "system", messages[0].Role)
+	assert.Equal(t, "be brief", messages[0].StringContent())
+	assert.Equal(t, "earlier", messages[1].StringContent())
+	assert.Equal(t, "system", messages[2].Role)
+	assert.Equal(t, "use celsius", messages[2].StringContent())
+
+	contents := messages[3].ParseContent()
+	require.Len(t, contents, 2)
+	assert.Equal(t, dto.ContentTypeImageURL, contents[1].Type)
+	assert.Equal(t, "https://example.com/a.png", contents[1].GetImageMedia().Url)
+
+	// 连续的函数调用合并为一条 assistant 消息，推理内容作为 reasoning_content
+	assert.Equal(t, "assistant", messages[4].Role)
+	assert.Equal(t, "need tool", messages[4].ReasoningContent)
+	toolCalls := messages[4].ParseToolCalls()
+	require.Len(t, toolCalls, 2)
+	assert.Equal(t, "call_2", toolCalls[1].ID)
+	assert.Equal(t, "tool", messages[5].Role)
+	assert.Equal(t, "call_1", messages[5].ToolCallId)
+	assert.Equal(t, "20C", messages[5].StringContent())
+	assert.Equal(t, "25C", messages[6].StringContent())
+	assert.Equal(t, "assistant", messages[7].Role)
+	assert.Equal(t, "Paris 20C, Rome 25C", messages[7].StringContent())
+	assert.Equal(t, "thanks", messages[8].StringContent())
+
+	// 内置工具无法由其他渠道提供
+	request.Tools = append(request.Tools, dto.ResponsesToolsCall{Type: dto.BuildInToolWebSearchPreview})
+	_, err = service.ResponsesRequestToOpenAIRequest(&request, nil)
+	assert.Error(t, err)
+}
+
+// TestResponsesRequestTemperatureZero 测试显式设置的 temperature 为 0 时原样转发，未设置时不转发
+func TestResponsesRequestTemperatureZero(t *testing.T) {
+	var request dto.OpenAIResponsesRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"model": "deepseek-chat", "temperature": 0, "input": "hi"}`), &request))
+	openAIRequest, err := service.ResponsesRequestToOpenAIRequest(&request, nil)
+	require.NoError(t, err)
+	require.NotNil(t, openAIRequest.Temperature)
+	assert.Equal(t, 0.0, *openAIRequest.Temperature)
+	data, err := json.Marshal(openAIRequest)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"temperature":0`)
+
+	request = dto.OpenAIResponsesRequest{}
+	require.NoError(t, json.Unmarshal([]byte(`{"model": "deepseek-chat", "input": "hi"}`), &request))
+	openAIRequest, err = service.ResponsesRequestToOpenAIRequest(&request, nil)
+	require.NoError(t, err)
+	assert.Nil(t, openAIRequest.Temperature)
+}
+
+// TestResponseOpenAI2Responses 测试 Chat Completions 响应转换为 Responses 响应
+func TestResponseOpenAI2Responses(t *testing.T) {
+	body := `{
+		"id": "chatcmpl-1", "model": "deepseek-reasoner",
+		"choices": [{"index": 0, "finish_reason": "tool_calls", "message": {"role": "assistant", "reasoning_content": "think", "content": "checking",
+			"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]}}],
+		"usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15, "prompt_tokens_details": {"cached_tokens": 4}, "completion_tokens_details": {"reasoning_tokens": 2}}
+	}`
+	var openAIResponse dto.OpenAITextResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &openAIResponse))
+	request := &dto.OpenAIResponsesRequest{Model: "deepseek-reasoner", Instructions: json.RawMessage(`"be brief"`)}
+
+	response := service.ResponseOpenAI2Responses(&openAIResponse, request, "resp_1")
+	assert.Equal(t, "resp_1", response.ID)
+	assert.Equal(t, "response", response.Object)
+	assert.Equal(t, "completed", response.Status)
+	assert.Equal(t, "be brief", response.Instructions)
+	require.Len(t, response.Output, 3)
+	assert.Equal(t, dto.ResponsesItemTypeReasoning, response.Output[0].Type)
+	assert.Equal(t, "think", response.Output[0].Summary[0].Text)
+	assert.Equal(t, dto.ResponsesItemTypeMessage, response.Output[1].Type)
+	assert.Equal(t, "checking", response.Output[1].Content[0].Text)
+	assert.Equal(t, dto.ResponsesItemTypeFunctionCall, response.Output[2].Type)
+	assert.Equal(t, "call_1", response.Output[2].CallId)
+	assert.Equal(t, `{"city":"Paris"}`, response.Output[2].Arguments)
+
+	assert.Equal(t, 10, response.Usage.InputTokens)
+	assert.Equal(t, 5, response.Usage.OutputTokens)
+	assert.Equal(t, 15, response.Usage.TotalTokens)
+	assert.Equal(t, 4, response.Usage.InputTokensDetails.CachedTokens)
+	assert.Equal(t, 2, response.Usage.OutputTokensDetails.ReasoningTokens)
+
+	// 输出项可以作为下一轮的输入
+	output, err := json.Marshal(response.Output)
+	require.NoError(t, err)
+	messages, err := service.ResponsesInputToMessages(output)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "think", messages[0].ReasoningContent)
+	assert.Equal(t, "checking", messages[0].StringContent())
+	assert.Len(t, messages[0].ParseToolCalls(), 1)
+}
+
+// TestResponsesStreamConverter 测试流式块转换为 Responses 流式事件
+func TestResponsesStreamConverter(t *testing.T) {
+	chunks := []string{
+		`{"model":"deepseek-chat","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`{"model":"deepseek-chat","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+		`{"model":"deepseek-chat","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"f","arguments":"{\"a\":"}}]}}]}`,
+		`{"model":"deepseek-chat","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"1}"}}]}}]}`,
+		`{"model":"deepseek-chat","choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`,
+	}
+	converter := service.NewResponsesStreamConverter(&dto.OpenAIResponsesRequest{Model: "deepseek-chat"}, "resp_1")
+	var events []dto.ResponsesStreamResponse
+	for _, chunk := range chunks {
+		var streamResponse dto.ChatCompletionsStreamResponse
+		require.NoError(t, json.Unmarshal([]byte(chunk), &streamResponse))
+		events = append(events, converter.Convert(&streamResponse)...)
+	}
+	events = append(events, converter.Finish(&dto.Usage{PromptTokens: 3, CompletionTokens: 4})...)
+
+	var types []string
+	for i, event := range events {
+		assert.Equal(t, i, event.SequenceNumber)
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{
+		"response.created",
+		"response.in_progress",
+		"response.output_item.added",
+		"response.content_part.added",
+		"response.output_text.delta",
+		"response.output_text.delta",
+		"response.output_text.done",
+		"response.content_part.done",
+		"response.output_item.done",
+		"response.output_item.added",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.done",
+		"response.output_item.done",
+		"response.incomplete",
+	}, types)
+	assert.Equal(t, "Hello", events[6].Text)
+	assert.Equal(t, 1, *events[10].OutputIndex)
+	assert.Equal(t, `{"a":1}`, events[12].Arguments)
+
+	final := events[len(events)-1].Response
+	assert.Equal(t, "incomplete", final.Status)
+	assert.Equal(t, "max_output_tokens", final.IncompleteDetails.Reason)
+	require.Len(t, final.Output, 2)
+	assert.Equal(t, "Hello", final.Output[0].Content[0].Text)
+	assert.Equal(t, "call_1", final.Output[1].CallId)
+	assert.Equal(t, 7, final.Usage.TotalTokens)
+	// 创建事件中的响应不受后续输出影响
+	assert.Empty(t, events[0].Response.Output)
+}
@@ -0,0 +1,80 @@
+package test
+
+import (
+	"testing"
+
+	"tea-api/service"
+	"tea-api/setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupCompletionSensitive(t *testing.T, stopOnHit bool) {
+	originEnabled := setting.CheckSensitiveEnabled
+	originCompletion := setting.CheckSensitiveOnCompletionEnabled
+	originStop := setting.StopOnSensitiveEnabled
+	originWords := setting.SensitiveWordsToString()
+	t.Cleanup(func() {
+		setting.CheckSensitiveEnabled = originEnabled
+		setting.CheckSensitiveOnCompletionEnabled = originCompletion
+		setting.StopOnSensitiveEnabled = originStop
+		setting.SensitiveWordsFromString(originWords)
+	})
+	setting.CheckSensitiveEnabled = true
+	setting.CheckSensitiveOnCompletionEnabled = true
+	setting.StopOnSensitiveEnabled = stopOnHit
+	setting.SensitiveWordsFromString("badword\n敏感词")
+}
+
+// TestSensitiveStreamFilterMask 测试跨分块的敏感词被完整替换
+func TestSensitiveStreamFilterMask(t *testing.T) {
+	setupCompletionSensitive(t, false)
+
+	filter := service.NewSensitiveStreamFilter()
+	if !assert.NotNil(t, filter) {
+		return
+	}
+	var output string
+	for _, chunk := range []string{"this is Bad", "Word and ", "一个敏", "感词。"} {
+		text, stop := filter.Push(chunk)
+		assert.False(t, stop)
+		output += text
+	}
+	text, stop := filter.Flush()
+	assert.False(t, stop)
+	output += text
+
+	assert.Equal(t, "this is **###** and 一个**###**。", output)
+	assert.Equal(t, output, filter.DeliveredText())
+	assert.ElementsMatch(t, []string{"badword", "敏感词"}, filter.Words())
+}
+
+// TestSensitiveStreamFilterStop 测试命中敏感词后只下发敏感词之前的内容并终止
+func TestSensitiveStreamFilterStop(t *testing.T) {
+	setupCompletionSensitive(t, true)
+
+	filter := service.NewSensitiveStreamFilter()
+	if !assert.NotNil(t, filter) {
+		return
+	}
+	text, stop := filter.Push("hello bad")
+	assert.False(t, stop)
+	assert.Equal(t, "hel", text)
+
+	text, stop = filter.Push("word world")
+	assert.True(t, stop)
+	assert.Equal(t, "lo ", text)
+	assert.True(t, filter.Stopped())
+	assert.Equal(t, "hello ", filter.DeliveredText())
+
+	text, stop = filter.Push("more")
+	assert.True(t, stop)
+	assert.Empty(t, text)
+}
+
+// TestSensitiveStreamFilterDisabled 测试未开启输出检测时不创建过滤器
+func TestSensitiveStreamFilterDisabled(t *testing.T) {
+	setupCompletionSensitive(t, false)
+	setting.CheckSensitiveOnCompletionEnabled = false
+	assert.Nil(t, service.NewSensitiveStreamFilter())
+}
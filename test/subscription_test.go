@@ -0,0 +1,250 @@
+package test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tea-api/common"
+	"tea-api/model"
+	relaycommon "tea-api/relay/common"
+	"tea-api/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSubscriptionPeriodTime 测试订阅周期的推算，按月的周期始终从开通时间推算，不会因月末而漂移
+func TestSubscriptionPeriodTime(t *testing.T) {
+	start := time.Date(2025, 1, 15, 8, 0, 0, 0, time.Local).Unix()
+	assert.Equal(t, time.Date(2025, 1, 16, 8, 0, 0, 0, time.Local).Unix(), model.SubscriptionPeriodTime(start, model.SubscriptionPeriodDay, 1))
+	assert.Equal(t, time.Date(2025, 1, 29, 8, 0, 0, 0, time.Local).Unix(), model.SubscriptionPeriodTime(start, model.SubscriptionPeriodWeek, 2))
+	assert.Equal(t, time.Date(2025, 4, 15, 8, 0, 0, 0, time.Local).Unix(), model.SubscriptionPeriodTime(start, model.SubscriptionPeriodMonth, 3))
+
+	monthEnd := time.Date(2025, 1, 31, 0, 0, 0, 0, time.Local).Unix()
+	third := model.SubscriptionPeriodTime(monthEnd, model.SubscriptionPeriodMonth, 3)
+	assert.Equal(t, time.Date(2025, 5, 1, 0, 0, 0, 0, time.Local).Unix(), third)
+	assert.Less(t, model.SubscriptionPeriodTime(monthEnd, model.SubscriptionPeriodMonth, 2), third)
+}
+
+// TestSubscriptionPlanAllows 测试套餐的模型白名单和分组限制
+func TestSubscriptionPlanAllows(t *testing.T) {
+	plan := &model.SubscriptionPlan{}
+	assert.True(t, plan.AllowsModel("gpt-4o"))
+	assert.True(t, plan.AllowsGroup("default"))
+
+	plan.Models = "gpt-4o, gpt-4o-mini,"
+	plan.AllowedGroups = "vip"
+	assert.True(t, plan.AllowsModel("gpt-4o-mini"))
+	assert.False(t, plan.AllowsModel("gpt-4"))
+	assert.True(t, plan.AllowsGroup("vip"))
+	assert.False(t, plan.AllowsGroup("default"))
+}
+
+// createTestSubscription 创建套餐并为用户开通
+func createTestSubscription(t *testing.T, userId int, plan *model.SubscriptionPlan) *model.Subscription {
+	t.Helper()
+	plan.Status = model.SubscriptionPlanStatusEnabled
+	require.NoError(t, plan.Insert())
+	subscription, renewed, err := model.GrantSubscription(userId, plan.Id)
+	require.NoError(t, err)
+	require.False(t, renewed)
+	return subscription
+}
+
+func getTestSubscription(t *testing.T, id int) *model.Subscription {
+	t.Helper()
+	subscription, err := model.GetSubscriptionById(id)
+	require.NoError(t, err)
+	return subscription
+}
+
+func getTestUserQuota(t *testing.T, userId int) int {
+	t.Helper()
+	quota, err := model.GetUserQuota(userId, true)
+	require.NoError(t, err)
+	return quota
+}
+
+// TestSubscriptionConsumeAndRefund 测试请求优先扣除订阅额度、不足部分扣除余额，退回时先退余额再退订阅额度
+func TestSubscriptionConsumeAndRefund(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "sub_consume", 1000, "default")
+	subscription := createTestSubscription(t, user.Id, &model.SubscriptionPlan{Name: "basic", Period: model.SubscriptionPeriodMonth, Duration: 1, Quota: 100})
+
+	relayInfo := &relaycommon.RelayInfo{UserId: user.Id, OriginModelName: "gpt-4o", Group: "default", IsPlayground: true}
+	available, err := service.GetUserAvailableQuota(relayInfo)
+	require.NoError(t, err)
+	assert.Equal(t, 1100, available)
+
+	// 预扣 150：订阅扣 100，余额扣 50
+	require.NoError(t, service.PreConsumeUserQuota(relayInfo, 150))
+	assert.Equal(t, 0, getTestSubscription(t, subscription.Id).Quota)
+	assert.Equal(t, 950, getTestUserQuota(t, user.Id))
+	assert.Equal(t, 100, relayInfo.SubscriptionConsumed)
+	assert.Equal(t, 50, relayInfo.BalanceConsumed)
+
+	// 实际消耗 70，退回 80：先退余额 50，再退订阅 30
+	require.NoError(t, service.PostConsumeQuota(relayInfo, -80, 150, false))
+	assert.Equal(t, 30, getTestSubscription(t, subscription.Id).Quota)
+	assert.Equal(t, 1000, getTestUserQuota(t, user.Id))
+	assert.Equal(t, 70, relayInfo.SubscriptionConsumed)
+	assert.Equal(t, 0, relayInfo.BalanceConsumed)
+
+	// 补扣 50：订阅扣 30，余额扣 20
+	require.NoError(t, service.PostConsumeQuota(relayInfo, 50, 150, false))
+	assert.Equal(t, 0, getTestSubscription(t, subscription.Id).Quota)
+	assert.Equal(t, 980, getTestUserQuota(t, user.Id))
+}
+
+// TestRefundTaskQuota 测试失败的异步任务先退回订阅额度，其余退回余额
+func TestRefundTaskQuota(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "sub_task", 0, "default")
+	subscription := createTestSubscription(t, user.Id, &model.SubscriptionPlan{Name: "task", Period: model.SubscriptionPeriodMonth, Duration: 1, Quota: 100})
+	consumed, err := model.ConsumeSubscriptionQuota(subscription.Id, 60)
+	require.NoError(t, err)
+	require.True(t, consumed)
+
+	require.NoError(t, service.RefundTaskQuota(user.Id, 100, subscription.Id, 60))
+	assert.Equal(t, 100, getTestSubscription(t, subscription.Id).Quota)
+	assert.Equal(t, 40, getTestUserQuota(t, user.Id))
+
+	// 没有订阅扣费记录的任务全部退回余额
+	require.NoError(t, service.RefundTaskQuota(user.Id, 30, 0, 0))
+	assert.Equal(t, 70, getTestUserQuota(t, user.Id))
+}
+
+// TestConsumeSubscriptionQuotaConcurrent 测试并发扣除订阅额度时不会超扣
+func TestConsumeSubscriptionQuotaConcurrent(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "sub_concurrent", 0, "default")
+	subscription := createTestSubscription(t, user.Id, &model.SubscriptionPlan{Name: "concurrent", Period: model.SubscriptionPeriodMonth, Duration: 1, Quota: 1000})
+
+	var wg sync.WaitGroup
+	var succeeded atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consumed, err := model.ConsumeSubscriptionQuota(subscription.Id, 30)
+			assert.NoError(t, err)
+			if consumed {
+				succeeded.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(33), succeeded.Load())
+	current := getTestSubscription(t, subscription.Id)
+	assert.Equal(t, 10, current.Quota)
+	assert.Equal(t, 990, current.UsedQuota)
+}
+
+// TestResetSubscriptionPeriodRollover 测试进入新周期时按结转策略发放额度，同一周期只重置一次
+func TestResetSubscriptionPeriodRollover(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "sub_rollover", 0, "default")
+	plan := &model.SubscriptionPlan{Name: "rollover", Period: model.SubscriptionPeriodDay, Duration: 3, Quota: 100,
+		RolloverPolicy: model.SubscriptionRolloverCarryover, RolloverLimit: 50}
+	subscription := createTestSubscription(t, user.Id, plan)
+	_, err := model.ConsumeSubscriptionQuota(subscription.Id, 20)
+	require.NoError(t, err)
+
+	// 剩余 80，结转上限 50
+	now := model.SubscriptionPeriodTime(subscription.StartTime, plan.Period, 1)
+	reset, err := model.ResetSubscriptionPeriod(subscription, plan, now)
+	require.NoError(t, err)
+	assert.True(t, reset)
+	current := getTestSubscription(t, subscription.Id)
+	assert.Equal(t, 150, current.Quota)
+	assert.Equal(t, 0, current.UsedQuota)
+	assert.Equal(t, 1, current.CurrentPeriod)
+	assert.Equal(t, model.SubscriptionPeriodTime(subscription.StartTime, plan.Period, 2), current.NextResetTime)
+
+	// 使用旧的周期重复重置不会再次发放
+	reset, err = model.ResetSubscriptionPeriod(subscription, plan, now)
+	require.NoError(t, err)
+	assert.False(t, reset)
+	assert.Equal(t, 150, getTestSubscription(t, subscription.Id).Quota)
+
+	// 不结转时未用完的额度作废
+	plan.RolloverPolicy = model.SubscriptionRolloverNone
+	reset, err = model.ResetSubscriptionPeriod(current, plan, model.SubscriptionPeriodTime(subscription.StartTime, plan.Period, 2))
+	require.NoError(t, err)
+	assert.True(t, reset)
+	assert.Equal(t, 100, getTestSubscription(t, subscription.Id).Quota)
+}
+
+// TestEndSubscriptionRestoreGroup 测试订阅结束时恢复开通前的分组，期间被管理员调整过的分组保持不变
+func TestEndSubscriptionRestoreGroup(t *testing.T) {
+	setupTestDB(t)
+	plan := &model.SubscriptionPlan{Name: "vip", Period: model.SubscriptionPeriodMonth, Duration: 1, Quota: 100, Group: "vip"}
+	user := createTestUser(t, "sub_group", 0, "default")
+	subscription := createTestSubscription(t, user.Id, plan)
+	group, err := model.GetUserGroup(user.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, "vip", group)
+
+	ended, endedOk, err := model.EndSubscription(subscription.Id, model.SubscriptionStatusCancelled)
+	require.NoError(t, err)
+	assert.True(t, endedOk)
+	assert.Equal(t, 0, ended.Quota)
+	group, err = model.GetUserGroup(user.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, "default", group)
+
+	// 重复结束不会再次处理
+	_, endedOk, err = model.EndSubscription(subscription.Id, model.SubscriptionStatusExpired)
+	require.NoError(t, err)
+	assert.False(t, endedOk)
+	assert.Equal(t, model.SubscriptionStatusCancelled, getTestSubscription(t, subscription.Id).Status)
+
+	other := createTestUser(t, "sub_manual", 0, "default")
+	subscription, _, err = model.GrantSubscription(other.Id, plan.Id)
+	require.NoError(t, err)
+	require.NoError(t, model.DB.Model(&model.User{}).Where("id = ?", other.Id).Update("group", "svip").Error)
+	_, endedOk, err = model.EndSubscription(subscription.Id, model.SubscriptionStatusCancelled)
+	require.NoError(t, err)
+	assert.True(t, endedOk)
+	group, err = model.GetUserGroup(other.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, "svip", group)
+}
+
+// TestProcessDueSubscriptions 测试定时任务结束到期的订阅并为未到期的订阅发放新周期的额度
+func TestProcessDueSubscriptions(t *testing.T) {
+	setupTestDB(t)
+	plan := &model.SubscriptionPlan{Name: "daily", Period: model.SubscriptionPeriodDay, Duration: 2, Quota: 100, Group: "vip"}
+	expiring := createTestUser(t, "sub_expire", 0, "default")
+	expiringSub := createTestSubscription(t, expiring.Id, plan)
+	renewing := createTestUser(t, "sub_renew", 0, "default")
+	renewingSub, _, err := model.GrantSubscription(renewing.Id, plan.Id)
+	require.NoError(t, err)
+	_, err = model.ConsumeSubscriptionQuota(renewingSub.Id, 100)
+	require.NoError(t, err)
+
+	now := common.GetTimestamp()
+	require.NoError(t, model.DB.Model(&model.Subscription{}).Where("id = ?", expiringSub.Id).Update("end_time", now-1).Error)
+	require.NoError(t, model.DB.Model(&model.Subscription{}).Where("id = ?", renewingSub.Id).Updates(map[string]interface{}{
+		"start_time":      model.SubscriptionPeriodTime(now, plan.Period, -1),
+		"next_reset_time": now,
+		"end_time":        model.SubscriptionPeriodTime(now, plan.Period, 1),
+	}).Error)
+
+	service.ProcessDueSubscriptions(now)
+
+	current := getTestSubscription(t, expiringSub.Id)
+	assert.Equal(t, model.SubscriptionStatusExpired, current.Status)
+	assert.Equal(t, 0, current.Quota)
+	group, err := model.GetUserGroup(expiring.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, "default", group)
+
+	current = getTestSubscription(t, renewingSub.Id)
+	assert.Equal(t, model.SubscriptionStatusActive, current.Status)
+	assert.Equal(t, 1, current.CurrentPeriod)
+	assert.Equal(t, 100, current.Quota)
+	assert.Greater(t, current.NextResetTime, now)
+}
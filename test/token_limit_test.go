@@ -0,0 +1,110 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tea-api/model"
+	"tea-api/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTokenUsageCounters 测试未启用 Redis 时令牌用量的内存计数
+func TestTokenUsageCounters(t *testing.T) {
+	tokenId := 900001
+	model.RecordTokenUsage(tokenId, 100, 30)
+	model.RecordTokenUsage(tokenId, 50, 20)
+	assert.Equal(t, int64(1), model.IncrTokenMinuteRequests(tokenId))
+	assert.Equal(t, int64(2), model.IncrTokenMinuteRequests(tokenId))
+
+	usage := model.GetTokenUsage(tokenId)
+	assert.Equal(t, int64(150), usage.Daily.Quota)
+	assert.Equal(t, int64(150), usage.Weekly.Quota)
+	assert.Equal(t, int64(150), usage.Monthly.Quota)
+	assert.Equal(t, int64(150), usage.Minute.Quota)
+	assert.Equal(t, int64(50), usage.Minute.Tokens)
+	assert.Equal(t, int64(2), usage.Minute.Requests)
+	// token 数与请求数只统计到分钟窗口
+	assert.Zero(t, usage.Daily.Tokens)
+	assert.Zero(t, usage.Daily.Requests)
+	assert.True(t, usage.Minute.ResetAt <= usage.Daily.ResetAt)
+
+	// 其他令牌的计数互不影响
+	assert.Zero(t, model.GetTokenUsage(tokenId+1).Daily.Quota)
+}
+
+// TestCheckTokenQuotaWindows 测试按时间窗口的额度上限检查
+func TestCheckTokenQuotaWindows(t *testing.T) {
+	usage := &model.TokenUsage{
+		Daily:   model.TokenUsageWindow{Quota: 80},
+		Weekly:  model.TokenUsageWindow{Quota: 300},
+		Monthly: model.TokenUsageWindow{Quota: 900},
+	}
+	token := &model.Token{DailyQuotaLimit: 100}
+	assert.NoError(t, service.CheckTokenQuotaWindows(token, usage, 20))
+	assert.Error(t, service.CheckTokenQuotaWindows(token, usage, 21))
+
+	token = &model.Token{WeeklyQuotaLimit: 300}
+	assert.Error(t, service.CheckTokenQuotaWindows(token, usage, 0), "已用尽的窗口应直接拒绝")
+
+	token = &model.Token{MonthlyQuotaLimit: 1000}
+	assert.NoError(t, service.CheckTokenQuotaWindows(token, usage, 100))
+	assert.Error(t, service.CheckTokenQuotaWindows(token, usage, 101))
+
+	// 未设置上限时不限制
+	assert.NoError(t, service.CheckTokenQuotaWindows(&model.Token{}, usage, 1<<30))
+}
+
+// TestCheckTokenLimits 测试 RPM 限制与剩余额度响应头
+func TestCheckTokenLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	token := &model.Token{Id: 900010, RpmLimit: 2, DailyQuotaLimit: 1000}
+	model.RecordTokenUsage(token.Id, 400, 0)
+
+	newContext := func() (*gin.Context, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		return c, w
+	}
+
+	for i := 0; i < 2; i++ {
+		c, w := newContext()
+		status, err := service.CheckTokenLimits(c, token)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit-Requests"))
+		assert.Equal(t, "1000", w.Header().Get("X-Token-Quota-Limit-Daily"))
+		assert.Equal(t, "600", w.Header().Get("X-Token-Quota-Remaining-Daily"))
+	}
+	c, w := newContext()
+	status, err := service.CheckTokenLimits(c, token)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining-Requests"))
+
+	// 每日额度用尽后拒绝请求
+	token = &model.Token{Id: 900011, DailyQuotaLimit: 100}
+	model.RecordTokenUsage(token.Id, 100, 0)
+	c, _ = newContext()
+	status, err = service.CheckTokenLimits(c, token)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+}
+
+// TestCheckTokenPreConsumeQuota 预扣费会超出时间窗口额度上限时拒绝，即使令牌剩余额度充足
+func TestCheckTokenPreConsumeQuota(t *testing.T) {
+	token := &model.Token{Id: 900020, RemainQuota: 10000, DailyQuotaLimit: 1000}
+	model.RecordTokenUsage(token.Id, 900, 0)
+	assert.NoError(t, service.CheckTokenPreConsumeQuota(token, false, 100))
+	assert.Error(t, service.CheckTokenPreConsumeQuota(token, false, 101))
+	// 无限额度令牌同样受时间窗口上限限制
+	assert.Error(t, service.CheckTokenPreConsumeQuota(token, true, 200))
+
+	token = &model.Token{Id: 900021, RemainQuota: 50}
+	assert.Error(t, service.CheckTokenPreConsumeQuota(token, false, 51))
+	assert.NoError(t, service.CheckTokenPreConsumeQuota(token, true, 51))
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tea-api/common"
+	"tea-api/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func setupTestTracing(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	common.TracingEnabled = true
+	t.Cleanup(func() {
+		common.TracingEnabled = false
+		_ = provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+// TestTracingPropagation 测试沿用客户端 traceparent、阶段 span 的父子关系以及向上游传递 traceparent
+func TestTracingPropagation(t *testing.T) {
+	recorder := setupTestTracing(t)
+
+	var upstreamHeader string
+	var traceId string
+	engine := gin.New()
+	engine.Use(middleware.Tracing())
+	engine.POST("/v1/chat/completions", func(c *gin.Context) {
+		traceId = c.GetString(common.TraceIdKey)
+		_, endAuth := common.StartGinSpan(c, "middleware.TokenAuth")
+		endAuth()
+
+		_, endAttempt := common.StartGinSpan(c, "relay.attempt")
+		upstream := http.Header{}
+		common.InjectTraceHeaders(c.Request.Context(), upstream)
+		upstreamHeader = upstream.Get("traceparent")
+		endAttempt()
+		c.Status(http.StatusOK)
+	})
+
+	const clientTraceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set("traceparent", "00-"+clientTraceId+"-00f067aa0ba902b7-01")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, clientTraceId, traceId)
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range spans {
+		assert.Equal(t, clientTraceId, span.SpanContext().TraceID().String())
+		byName[span.Name()] = span
+	}
+	root := byName["POST /v1/chat/completions"]
+	require.NotNil(t, root)
+	assert.Equal(t, "00f067aa0ba902b7", root.Parent().SpanID().String())
+	// 阶段 span 结束后恢复父上下文，后续阶段与之并列而不是嵌套
+	assert.Equal(t, root.SpanContext().SpanID(), byName["middleware.TokenAuth"].Parent().SpanID())
+	attempt := byName["relay.attempt"]
+	assert.Equal(t, root.SpanContext().SpanID(), attempt.Parent().SpanID())
+	assert.Equal(t, "00-"+clientTraceId+"-"+attempt.SpanContext().SpanID().String()+"-01", upstreamHeader)
+}
+
+// TestTracingDisabled 测试未启用追踪时不生成 trace id 也不向上游写入 traceparent
+func TestTracingDisabled(t *testing.T) {
+	var traceId string
+	var upstream http.Header
+	engine := gin.New()
+	engine.Use(middleware.Tracing())
+	engine.GET("/ping", func(c *gin.Context) {
+		traceId = c.GetString(common.TraceIdKey)
+		_, end := common.StartGinSpan(c, "stage")
+		upstream = http.Header{}
+		common.InjectTraceHeaders(c.Request.Context(), upstream)
+		end()
+	})
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+	assert.Empty(t, traceId)
+	assert.Empty(t, upstream.Get("traceparent"))
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"tea-api/common"
+	"tea-api/model"
+	"tea-api/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfc6238Secret RFC 6238 附录 B 中 SHA1 测试用的密钥 "12345678901234567890" 的 base32 编码
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestGenerateTOTPCode 使用 RFC 6238 的测试向量校验验证码的计算（取后 6 位）
+func TestGenerateTOTPCode(t *testing.T) {
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range cases {
+		code, err := common.GenerateTOTPCode(rfc6238Secret, common.TOTPCounter(time.Unix(unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, code, "time %d", unix)
+	}
+}
+
+// TestValidateTOTPCode 测试前后一个时间步的容差，以及返回的时间步
+func TestValidateTOTPCode(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	counter := common.TOTPCounter(now)
+	for _, offset := range []int64{-1, 0, 1} {
+		code, _ := common.GenerateTOTPCode(rfc6238Secret, counter+offset)
+		matched, ok := common.ValidateTOTPCode(rfc6238Secret, code, now)
+		assert.True(t, ok)
+		assert.Equal(t, counter+offset, matched)
+	}
+	code, _ := common.GenerateTOTPCode(rfc6238Secret, counter+2)
+	_, ok := common.ValidateTOTPCode(rfc6238Secret, code, now)
+	assert.False(t, ok)
+	_, ok = common.ValidateTOTPCode(rfc6238Secret, "12345", now)
+	assert.False(t, ok)
+}
+
+// TestGenerateTOTPSecret 生成的密钥可以直接用于计算验证码
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := common.GenerateTOTPSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+	_, err = common.GenerateTOTPCode(secret, 1)
+	assert.NoError(t, err)
+}
+
+// TestTOTPProvisioningURI 测试验证器应用使用的 otpauth 地址
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := common.TOTPProvisioningURI("Tea API", "root", rfc6238Secret)
+	parsed, err := url.Parse(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth", parsed.Scheme)
+	assert.Equal(t, "totp", parsed.Host)
+	assert.Equal(t, "/Tea API:root", parsed.Path)
+	assert.Equal(t, rfc6238Secret, parsed.Query().Get("secret"))
+	assert.Equal(t, "Tea API", parsed.Query().Get("issuer"))
+}
+
+// TestTwoFactorRecoveryCodes 恢复码的摘要忽略大小写、空格和连字符，且每个恢复码不重复
+func TestTwoFactorRecoveryCodes(t *testing.T) {
+	codes, hashes, err := service.GenerateTwoFactorRecoveryCodes()
+	assert.NoError(t, err)
+	assert.Len(t, codes, service.TwoFactorRecoveryCodeCount)
+	assert.Len(t, hashes, service.TwoFactorRecoveryCodeCount)
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		assert.Len(t, code, 11)
+		assert.Equal(t, hashes[i], service.HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", " "))))
+		assert.False(t, seen[hashes[i]])
+		seen[hashes[i]] = true
+	}
+}
+
+// TestIsTwoFactorRequired 测试按角色强制两步验证，设置为 0 时不强制
+func TestIsTwoFactorRequired(t *testing.T) {
+	origin := common.TwoFactorRequiredRole
+	defer func() { common.TwoFactorRequiredRole = origin }()
+
+	common.TwoFactorRequiredRole = common.RoleAdminUser
+	assert.False(t, service.IsTwoFactorRequired(common.RoleCommonUser))
+	assert.True(t, service.IsTwoFactorRequired(common.RoleAdminUser))
+	assert.True(t, service.IsTwoFactorRequired(common.RoleRootUser))
+
+	common.TwoFactorRequiredRole = 0
+	assert.False(t, service.IsTwoFactorRequired(common.RoleRootUser))
+}
+
+// TestTwoFactorLockout 测试未启用 Redis 时在进程内计数，连续验证失败达到上限后锁定
+func TestTwoFactorLockout(t *testing.T) {
+	originRedis := common.RedisEnabled
+	common.RedisEnabled = false
+	defer func() { common.RedisEnabled = originRedis }()
+
+	user := &model.User{Id: 987654, TwoFactorEnabled: true, TwoFactorSecret: rfc6238Secret}
+	for i := 0; i < service.TwoFactorMaxFailures; i++ {
+		assert.ErrorIs(t, service.VerifyUserTwoFactor(user, "000000-x"), service.ErrTwoFactorCodeInvalid)
+	}
+	assert.ErrorIs(t, service.VerifyUserTwoFactor(user, "000000-x"), service.ErrTwoFactorLocked)
+}
@@ -40,6 +40,7 @@ const LoginForm = () => {
     username: '',
     password: '',
     wechat_verification_code: '',
+    two_factor_code: '',
   });
   const [searchParams, setSearchParams] = useSearchParams();
   const [submitted, setSubmitted] = useState(false);
@@ -51,6 +52,9 @@ const LoginForm = () => {
   let navigate = useNavigate();
   const [status, setStatus] = useState({});
   const [showWeChatLoginModal, setShowWeChatLoginModal] = useState(false);
+  const [showTwoFactorModal, setShowTwoFactorModal] = useState(
+    searchParams.get('two_factor') !== null,
+  );
   const { t } = useTranslation();
 
   const logo = getLogo();
@@ -89,6 +93,9 @@ const LoginForm = () => {
     );
     const { success, message, data } = res.data;
     if (success) {
+      if (requireTwoFactor(data)) {
+        return;
+      }
       userDispatch({ type: 'login', payload: data });
       localStorage.setItem('user', JSON.stringify(data));
       setUserData(data);
@@ -105,6 +112,34 @@ const LoginForm = () => {
     setInputs((inputs) => ({ ...inputs, [name]: value }));
   }
 
+  // 启用了两步验证的账户需要再输入验证码才能完成登录
+  function requireTwoFactor(data) {
+    if (data && data.require_two_factor) {
+      setShowWeChatLoginModal(false);
+      setShowTwoFactorModal(true);
+      return true;
+    }
+    return false;
+  }
+
+  const onSubmitTwoFactorCode = async () => {
+    const res = await API.post('/api/user/login/2fa', {
+      code: inputs.two_factor_code,
+    });
+    const { success, message, data } = res.data;
+    if (success) {
+      userDispatch({ type: 'login', payload: data });
+      localStorage.setItem('user', JSON.stringify(data));
+      setUserData(data);
+      updateAPI();
+      setShowTwoFactorModal(false);
+      showSuccess('登录成功！');
+      navigate('/token');
+    } else {
+      showError(message);
+    }
+  };
+
   async function handleSubmit(e) {
     if (turnstileEnabled && turnstileToken === '') {
       showInfo('请稍后几秒重试，Turnstile 正在检查用户环境！');
@@ -121,6 +156,9 @@ const LoginForm = () => {
       );
       const { success, message, data } = res.data;
       if (success) {
+        if (requireTwoFactor(data)) {
+          return;
+        }
         userDispatch({ type: 'login', payload: data });
         setUserData(data);
         updateAPI();
@@ -162,6 +200,9 @@ const LoginForm = () => {
     const res = await API.get(`/api/oauth/telegram/login`, { params });
     const { success, message, data } = res.data;
     if (success) {
+      if (requireTwoFactor(data)) {
+        return;
+      }
       userDispatch({ type: 'login', payload: data });
       localStorage.setItem('user', JSON.stringify(data));
       showSuccess('登录成功！');
@@ -355,6 +396,31 @@ const LoginForm = () => {
                     />
                   </Form>
                 </Modal>
+                <Modal
+                  title={t('两步验证')}
+                  visible={showTwoFactorModal}
+                  maskClosable={false}
+                  onOk={onSubmitTwoFactorCode}
+                  onCancel={() => setShowTwoFactorModal(false)}
+                  okText={t('登录')}
+                  size={'small'}
+                  centered={true}
+                >
+                  <Text>
+                    {t('请输入验证器应用中的 6 位验证码，或使用一个恢复码')}
+                  </Text>
+                  <Form size='large'>
+                    <Form.Input
+                      field={'two_factor_code'}
+                      placeholder={t('验证码或恢复码')}
+                      label={t('验证码')}
+                      value={inputs.two_factor_code}
+                      onChange={(value) =>
+                        handleChange('two_factor_code', value)
+                      }
+                    />
+                  </Form>
+                </Modal>
               </Card>
               {turnstileEnabled ? (
                 <div
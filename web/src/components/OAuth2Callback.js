@@ -23,6 +23,9 @@ const OAuth2Callback = (props) => {
       if (message === 'bind') {
         showSuccess('绑定成功！');
         navigate('/setting');
+      } else if (data && data.require_two_factor) {
+        // 启用了两步验证，回到登录页输入验证码
+        navigate('/login?two_factor=1');
       } else {
         userDispatch({ type: 'login', payload: data });
         localStorage.setItem('user', JSON.stringify(data));
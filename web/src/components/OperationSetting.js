@@ -11,6 +11,7 @@ import ModelSettingsVisualEditor from '../pages/Setting/Operation/ModelSettingsV
 import GroupRatioSettings from '../pages/Setting/Operation/GroupRatioSettings.js';
 import ModelRatioSettings from '../pages/Setting/Operation/ModelRatioSettings.js';
 import SettingsChannelStats from '../pages/Setting/Operation/SettingsChannelStats.js';
+import SettingsResponseCache from '../pages/Setting/Operation/SettingsResponseCache.js';
 
 import { API, showError, showSuccess } from '../helpers';
 import SettingsChats from '../pages/Setting/Operation/SettingsChats.js';
@@ -29,6 +30,7 @@ const OperationSetting = () => {
     ModelRatio: '',
     CacheRatio: '',
     CompletionRatio: '',
+    BatchDiscountRatio: '',
     ModelPrice: '',
     GroupRatio: '',
     UserUsableGroups: '',
@@ -44,8 +46,8 @@ const OperationSetting = () => {
     DisplayTokenStatEnabled: false,
     CheckSensitiveEnabled: false,
     CheckSensitiveOnPromptEnabled: false,
-    CheckSensitiveOnCompletionEnabled: '',
-    StopOnSensitiveEnabled: '',
+    CheckSensitiveOnCompletionEnabled: false,
+    StopOnSensitiveEnabled: false,
     SensitiveWords: '',
     MjNotifyEnabled: false,
     MjAccountFilterEnabled: false,
@@ -66,6 +68,10 @@ const OperationSetting = () => {
     ContinuousCheckinReward: 1000, // 添加连续签到奖励
     MaxContinuousRewardDays: 7, // 添加连续签到最大天数
     AutomaticDisableKeywords: '',
+    ResponseCacheEnabled: false,
+    ResponseCacheTTLSeconds: 3600,
+    ResponseCacheHitRatio: 0.1,
+    ResponseCacheGroups: '[]',
   });
 
   let [loading, setLoading] = useState(false);
@@ -89,7 +95,8 @@ const OperationSetting = () => {
             item.key === 'UserUsableGroups' ||
             item.key === 'CompletionRatio' ||
             item.key === 'ModelPrice' ||
-            item.key === 'CacheRatio'
+            item.key === 'CacheRatio' ||
+            item.key === 'BatchDiscountRatio'
           ) {
             try {
               item.value = JSON.stringify(JSON.parse(item.value), null, 2);
@@ -183,6 +190,10 @@ const OperationSetting = () => {
         <Card style={{ marginTop: '10px' }}>
           <SettingsCreditLimit options={inputs} refresh={onRefresh} />
         </Card>
+        {/* 响应缓存设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsResponseCache options={inputs} refresh={onRefresh} />
+        </Card>
         {/* 聊天设置 */}
         <Card style={{ marginTop: '10px' }}>
           <SettingsChats options={inputs} refresh={onRefresh} />
@@ -45,6 +45,7 @@ import {
   stringToColor,
 } from '../helpers/render';
 import TelegramLoginButton from 'react-telegram-login';
+import TwoFactorSetting from './TwoFactorSetting';
 import { useTranslation } from 'react-i18next';
 
 const PersonalSetting = () => {
@@ -829,6 +830,7 @@ const PersonalSetting = () => {
                 </Modal>
               </div>
             </Card>
+            <TwoFactorSetting />
             <Card style={{ marginTop: 10 }}>
               <Tabs type='line' defaultActiveKey='notification'>
                 <TabPane tab={t('通知设置')} itemKey='notification'>
@@ -53,12 +53,19 @@ const SystemSetting = () => {
     TopupGroupRatio: '',
     PayAddress: '',
     CustomCallbackAddress: '',
+    PaymentProvider: 'epay',
+    StripeApiAddress: '',
+    StripeApiSecret: '',
+    StripeWebhookSecret: '',
+    StripeCurrency: 'usd',
+    StripePrice: 1,
     Footer: '',
     WeChatAuthEnabled: '',
     WeChatServerAddress: '',
     WeChatServerToken: '',
     WeChatAccountQRCodeImageURL: '',
     TurnstileCheckEnabled: '',
+    TwoFactorRequiredRole: '10',
     TurnstileSiteKey: '',
     TurnstileSecretKey: '',
     RegisterEnabled: '',
@@ -117,6 +124,7 @@ const SystemSetting = () => {
             break;
           case 'Price':
           case 'MinTopUp':
+          case 'StripePrice':
             item.value = parseFloat(item.value);
             break;
           default:
@@ -256,6 +264,31 @@ const SystemSetting = () => {
     if (originInputs['TopupGroupRatio'] !== inputs.TopupGroupRatio) {
       options.push({ key: 'TopupGroupRatio', value: inputs.TopupGroupRatio });
     }
+    options.push({ key: 'PaymentProvider', value: inputs.PaymentProvider });
+    if (inputs.StripeApiAddress !== '') {
+      options.push({
+        key: 'StripeApiAddress',
+        value: removeTrailingSlash(inputs.StripeApiAddress),
+      });
+    }
+    if (inputs.StripeApiSecret !== undefined && inputs.StripeApiSecret !== '') {
+      options.push({ key: 'StripeApiSecret', value: inputs.StripeApiSecret });
+    }
+    if (
+      inputs.StripeWebhookSecret !== undefined &&
+      inputs.StripeWebhookSecret !== ''
+    ) {
+      options.push({
+        key: 'StripeWebhookSecret',
+        value: inputs.StripeWebhookSecret,
+      });
+    }
+    if (inputs.StripeCurrency !== '') {
+      options.push({ key: 'StripeCurrency', value: inputs.StripeCurrency });
+    }
+    if (inputs.StripePrice !== '') {
+      options.push({ key: 'StripePrice', value: inputs.StripePrice.toString() });
+    }
 
     await updateOptions(options);
   };
@@ -597,8 +630,22 @@ const SystemSetting = () => {
               <Card>
                 <Form.Section text='支付设置'>
                   <Text>
-                    （当前仅支持易支付接口，默认使用上方服务器地址作为回调地址！）
+                    （支持易支付和 Stripe，默认使用上方服务器地址作为回调地址，Stripe 的 Webhook 地址为 回调地址/api/user/stripe/webhook）
                   </Text>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                  >
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Select
+                        field='PaymentProvider'
+                        label='支付渠道'
+                        optionList={[
+                          { label: '易支付', value: 'epay' },
+                          { label: 'Stripe', value: 'stripe' },
+                        ]}
+                      />
+                    </Col>
+                  </Row>
                   <Row
                     gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
                   >
@@ -652,6 +699,54 @@ const SystemSetting = () => {
                       />
                     </Col>
                   </Row>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                    style={{ marginTop: 16 }}
+                  >
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field='StripeApiSecret'
+                        label='Stripe API 密钥'
+                        placeholder='敏感信息不会发送到前端显示'
+                        type='password'
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field='StripeWebhookSecret'
+                        label='Stripe Webhook 签名密钥'
+                        placeholder='敏感信息不会发送到前端显示'
+                        type='password'
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field='StripeApiAddress'
+                        label='Stripe API 地址'
+                        placeholder='默认 https://api.stripe.com'
+                      />
+                    </Col>
+                  </Row>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                    style={{ marginTop: 16 }}
+                  >
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field='StripeCurrency'
+                        label='Stripe 结算币种'
+                        placeholder='例如：usd'
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.InputNumber
+                        field='StripePrice'
+                        precision={2}
+                        label='Stripe 充值价格（结算币种/美金）'
+                        placeholder='例如：1，就是 1 美元/美金'
+                      />
+                    </Col>
+                  </Row>
                   <Form.TextArea
                     field='TopupGroupRatio'
                     label='充值分组倍率'
@@ -762,6 +857,28 @@ const SystemSetting = () => {
                       </Form.Checkbox>
                     </Col>
                   </Row>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                  >
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Select
+                        field='TwoFactorRequiredRole'
+                        label='强制启用两步验证'
+                        extraText='所选角色及更高权限的用户必须启用两步验证后才能使用控制台'
+                        optionList={[
+                          { label: '不强制', value: '0' },
+                          { label: '所有用户', value: '1' },
+                          { label: '管理员及以上', value: '10' },
+                          { label: '仅超级管理员', value: '100' },
+                        ]}
+                        onChange={(value) =>
+                          updateOptions([
+                            { key: 'TwoFactorRequiredRole', value },
+                          ])
+                        }
+                      />
+                    </Col>
+                  </Row>
                 </Form.Section>
               </Card>
 
@@ -0,0 +1,209 @@
+import React, { useEffect, useState } from 'react';
+import { API, copy, showError, showSuccess } from '../helpers';
+import {
+  Banner,
+  Button,
+  Card,
+  Input,
+  Modal,
+  Space,
+  Tag,
+  Typography,
+} from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+
+const TwoFactorSetting = () => {
+  const { t } = useTranslation();
+  const [status, setStatus] = useState({
+    enabled: false,
+    required: false,
+    recovery_codes_remaining: 0,
+  });
+  const [setupData, setSetupData] = useState(null);
+  const [code, setCode] = useState('');
+  const [recoveryCodes, setRecoveryCodes] = useState([]);
+  // 需要输入验证码确认的操作：disable 或 recovery_codes
+  const [confirmAction, setConfirmAction] = useState('');
+
+  const loadStatus = async () => {
+    const res = await API.get('/api/user/2fa/status');
+    const { success, message, data } = res.data;
+    if (success) {
+      setStatus(data);
+    } else {
+      showError(message);
+    }
+  };
+
+  useEffect(() => {
+    loadStatus().then();
+  }, []);
+
+  const startSetup = async () => {
+    const res = await API.post('/api/user/2fa/setup');
+    const { success, message, data } = res.data;
+    if (success) {
+      setCode('');
+      setSetupData(data);
+    } else {
+      showError(message);
+    }
+  };
+
+  const enable = async () => {
+    const res = await API.post('/api/user/2fa/enable', { code });
+    const { success, message, data } = res.data;
+    if (success) {
+      showSuccess(t('两步验证已启用'));
+      setSetupData(null);
+      setRecoveryCodes(data.recovery_codes);
+      await loadStatus();
+    } else {
+      showError(message);
+    }
+  };
+
+  const submitConfirm = async () => {
+    const res = await API.post(`/api/user/2fa/${confirmAction}`, { code });
+    const { success, message, data } = res.data;
+    if (success) {
+      if (confirmAction === 'disable') {
+        showSuccess(t('两步验证已关闭'));
+      } else {
+        setRecoveryCodes(data.recovery_codes);
+      }
+      setConfirmAction('');
+      await loadStatus();
+    } else {
+      showError(message);
+    }
+  };
+
+  const openConfirm = (action) => {
+    setCode('');
+    setConfirmAction(action);
+  };
+
+  const copyText = async (text) => {
+    if (await copy(text)) {
+      showSuccess(t('已复制到剪贴板！'));
+    }
+  };
+
+  return (
+    <Card style={{ marginTop: 10 }}>
+      <Typography.Title heading={6}>{t('两步验证')}</Typography.Title>
+      {status.required && !status.enabled && (
+        <Banner
+          type='warning'
+          description={t('当前账户必须启用两步验证后才能使用其他功能')}
+          closeIcon={null}
+          style={{ marginTop: 10 }}
+        />
+      )}
+      <div style={{ marginTop: 10 }}>
+        <Space>
+          {status.enabled ? (
+            <Tag color='green'>{t('已启用')}</Tag>
+          ) : (
+            <Tag color='grey'>{t('未启用')}</Tag>
+          )}
+          {status.enabled && (
+            <Typography.Text type='tertiary'>
+              {t('剩余恢复码')}: {status.recovery_codes_remaining}
+            </Typography.Text>
+          )}
+        </Space>
+      </div>
+      <div style={{ marginTop: 10 }}>
+        {status.enabled ? (
+          <Space>
+            <Button onClick={() => openConfirm('recovery_codes')}>
+              {t('重新生成恢复码')}
+            </Button>
+            {!status.required && (
+              <Button type='danger' onClick={() => openConfirm('disable')}>
+                {t('关闭两步验证')}
+              </Button>
+            )}
+          </Space>
+        ) : (
+          <Button type='primary' onClick={startSetup}>
+            {t('启用两步验证')}
+          </Button>
+        )}
+      </div>
+      <Modal
+        title={t('启用两步验证')}
+        visible={setupData !== null}
+        onCancel={() => setSetupData(null)}
+        onOk={enable}
+        okText={t('启用')}
+        centered={true}
+      >
+        <Typography.Text>
+          {t(
+            '请在验证器应用（如 Google Authenticator、1Password）中添加以下密钥，然后输入应用生成的 6 位验证码',
+          )}
+        </Typography.Text>
+        <Input
+          readOnly
+          value={setupData?.secret}
+          onClick={() => copyText(setupData?.secret)}
+          style={{ marginTop: 10 }}
+        />
+        <Input
+          readOnly
+          value={setupData?.uri}
+          onClick={() => copyText(setupData?.uri)}
+          style={{ marginTop: 10 }}
+        />
+        <Input
+          placeholder={t('验证码')}
+          value={code}
+          onChange={setCode}
+          style={{ marginTop: 10 }}
+        />
+      </Modal>
+      <Modal
+        title={
+          confirmAction === 'disable'
+            ? t('关闭两步验证')
+            : t('重新生成恢复码')
+        }
+        visible={confirmAction !== ''}
+        onCancel={() => setConfirmAction('')}
+        onOk={submitConfirm}
+        centered={true}
+      >
+        <Input
+          placeholder={t('验证码或恢复码')}
+          value={code}
+          onChange={setCode}
+        />
+      </Modal>
+      <Modal
+        title={t('恢复码')}
+        visible={recoveryCodes.length > 0}
+        onCancel={() => setRecoveryCodes([])}
+        onOk={() => setRecoveryCodes([])}
+        hasCancel={false}
+        centered={true}
+      >
+        <Banner
+          type='warning'
+          description={t(
+            '恢复码只显示一次，每个恢复码只能使用一次，请妥善保存。丢失验证器时可以使用恢复码登录',
+          )}
+          closeIcon={null}
+        />
+        <pre style={{ marginTop: 10 }}>{recoveryCodes.join('\n')}</pre>
+        <Button onClick={() => copyText(recoveryCodes.join('\n'))}>
+          {t('复制')}
+        </Button>
+      </Modal>
+    </Card>
+  );
+};
+
+export default TwoFactorSetting;
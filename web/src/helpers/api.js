@@ -1,5 +1,30 @@
 import { getUserIdFromLocalStorage, showError } from './utils';
 import axios from 'axios';
+import i18next from 'i18next';
+import { Input, Modal } from '@douyinfe/semi-ui';
+
+// 弹窗输入两步验证码，取消时返回空字符串
+function promptTwoFactorCode(message) {
+  return new Promise((resolve) => {
+    let code = '';
+    Modal.confirm({
+      title: i18next.t('两步验证'),
+      content: (
+        <>
+          <div style={{ marginBottom: 8 }}>{message}</div>
+          <Input
+            autoFocus
+            placeholder={i18next.t('验证码或恢复码')}
+            onChange={(value) => (code = value)}
+          />
+        </>
+      ),
+      centered: true,
+      onOk: () => resolve(code),
+      onCancel: () => resolve(''),
+    });
+  });
+}
 
 function createAPIInstance() {
   const instance = axios.create({
@@ -18,7 +43,33 @@ function createAPIInstance() {
   });
 
   instance.interceptors.response.use(
-    (response) => response,
+    async (response) => {
+      const data = response.data;
+      if (
+        !data ||
+        !data.two_factor_required ||
+        response.config.twoFactorRetried
+      ) {
+        return response;
+      }
+      if (!data.two_factor_enabled) {
+        // 当前角色必须启用两步验证，跳转到个人设置启用
+        if (window.location.pathname !== '/setting') {
+          window.location.href = '/setting';
+        }
+        return response;
+      }
+      // 敏感操作需要两步验证，验证通过后重试原请求
+      const code = await promptTwoFactorCode(data.message);
+      if (!code) {
+        return response;
+      }
+      const res = await instance.post('/api/user/2fa/verify', { code });
+      if (!res.data.success) {
+        return res;
+      }
+      return instance.request({ ...response.config, twoFactorRetried: true });
+    },
     (error) => {
       showError(error);
     },
@@ -31,4 +82,4 @@ export let API = createAPIInstance();
 
 export function updateAPI() {
   API = createAPIInstance();
-}
\ No newline at end of file
+}
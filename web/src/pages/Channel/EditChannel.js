@@ -162,6 +162,28 @@ const EditChannel = (props) => {
     //setAutoBan
   };
 
+  // 查看完整密钥需要通过两步验证，由 API 拦截器提示输入验证码
+  const viewChannelKey = async () => {
+    const res = await API.get(`/api/channel/${channelId}/key`);
+    if (res === undefined) {
+      return;
+    }
+    const { success, message, data } = res.data;
+    if (success) {
+      Modal.info({
+        title: t('渠道密钥'),
+        content: (
+          <Typography.Paragraph copyable style={{ wordBreak: 'break-all' }}>
+            {data.key}
+          </Typography.Paragraph>
+        ),
+        centered: true,
+      });
+    } else {
+      showError(message);
+    }
+  };
+
   const loadChannel = async () => {
     setLoading(true);
     let res = await API.get(`/api/channel/${channelId}`);
@@ -618,6 +640,11 @@ const EditChannel = (props) => {
             )}
           <div style={{ marginTop: 10 }}>
             <Typography.Text strong>{t('密钥')}：</Typography.Text>
+            {isEdit && (
+              <Button size='small' theme='borderless' onClick={viewChannelKey}>
+                {t('查看密钥')}
+              </Button>
+            )}
           </div>
           {batch ? (
             <TextArea
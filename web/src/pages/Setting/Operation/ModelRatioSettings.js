@@ -25,6 +25,7 @@ export default function ModelRatioSettings(props) {
     ModelRatio: '',
     CacheRatio: '',
     CompletionRatio: '',
+    BatchDiscountRatio: '',
   });
   const refForm = useRef();
   const [inputsRow, setInputsRow] = useState(inputs);
@@ -226,6 +227,31 @@ export default function ModelRatioSettings(props) {
               />
             </Col>
           </Row>
+          <Row gutter={16}>
+            <Col xs={24} sm={16}>
+              <Form.TextArea
+                label={t('批处理折扣倍率')}
+                extraText={t('Batch API 中的请求按此倍率计费，未配置的模型默认为 0.5')}
+                placeholder={t('为一个 JSON 文本，键为模型名称，值为倍率')}
+                field={'BatchDiscountRatio'}
+                autosize={{ minRows: 6, maxRows: 12 }}
+                trigger='blur'
+                stopValidateWithError
+                rules={[
+                  {
+                    validator: (rule, value) => verifyJSON(value),
+                    message: '不是合法的 JSON 字符串',
+                  },
+                ]}
+                onChange={(value) =>
+                  setInputs((prevInputs) => ({
+                    ...(prevInputs || {}),
+                    BatchDiscountRatio: value,
+                  }))
+                }
+              />
+            </Col>
+          </Row>
         </Form.Section>
       </Form>
       <Space>
@@ -0,0 +1,161 @@
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Row, Spin } from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+} from '../../../helpers';
+
+export default function SettingsResponseCache(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    ResponseCacheEnabled: false,
+    ResponseCacheTTLSeconds: '',
+    ResponseCacheHitRatio: '',
+    ResponseCacheGroups: '',
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+
+  function onSubmit() {
+    const updateArray = compareObjects(inputs, inputsRow);
+    if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+    const requestQueue = updateArray.map((item) => {
+      let value = '';
+      if (typeof inputs[item.key] === 'boolean') {
+        value = String(inputs[item.key]);
+      } else {
+        value = inputs[item.key];
+      }
+      return API.put('/api/option/', {
+        key: item.key,
+        value,
+      });
+    });
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined))
+            return showError(t('部分保存失败，请重试'));
+        }
+        showSuccess(t('保存成功'));
+        props.refresh();
+      })
+      .catch(() => {
+        showError(t('保存失败，请重试'));
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  useEffect(() => {
+    // 确保 props.options 存在且为对象
+    if (!props.options || typeof props.options !== 'object') {
+      console.warn('props.options is invalid:', props.options);
+      return;
+    }
+
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (Object.keys(inputs).includes(key)) {
+        currentInputs[key] = props.options[key];
+      }
+    }
+
+    // 确保 currentInputs 不为空，合并默认值
+    setInputs(prevInputs => ({ ...prevInputs, ...currentInputs }));
+    setInputsRow(structuredClone({ ...inputs, ...currentInputs }));
+    if (refForm.current) refForm.current.setValues({ ...inputs, ...currentInputs });
+  }, [props.options]);
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={t('响应缓存设置')}>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'ResponseCacheEnabled'}
+                  label={t('启用响应缓存')}
+                  extraText={t('仅对启用缓存的令牌或分组生效')}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={(value) =>
+                    setInputs((prevInputs) => ({
+                      ...(prevInputs || {}),
+                      ResponseCacheEnabled: value,
+                    }))
+                  }
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  label={t('缓存有效期')}
+                  field={'ResponseCacheTTLSeconds'}
+                  step={60}
+                  min={1}
+                  suffix={t('秒')}
+                  onChange={(value) =>
+                    setInputs((prevInputs) => ({
+                      ...(prevInputs || {}),
+                      ResponseCacheTTLSeconds: String(value),
+                    }))
+                  }
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  label={t('缓存命中计费倍率')}
+                  field={'ResponseCacheHitRatio'}
+                  step={0.1}
+                  min={0}
+                  extraText={t('0 表示命中缓存不计费')}
+                  onChange={(value) =>
+                    setInputs((prevInputs) => ({
+                      ...(prevInputs || {}),
+                      ResponseCacheHitRatio: String(value),
+                    }))
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={24} md={16} lg={16} xl={16}>
+                <Form.TextArea
+                  label={t('启用响应缓存的分组')}
+                  field={'ResponseCacheGroups'}
+                  extraText={t('JSON 数组，例如 ["ci"]，分组内所有令牌均使用缓存')}
+                  autosize={{ minRows: 2, maxRows: 6 }}
+                  onChange={(value) =>
+                    setInputs((prevInputs) => ({
+                      ...(prevInputs || {}),
+                      ResponseCacheGroups: value,
+                    }))
+                  }
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Button size='default' onClick={onSubmit}>
+                {t('保存响应缓存设置')}
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
@@ -15,6 +15,8 @@ export default function SettingsSensitiveWords(props) {
   const [inputs, setInputs] = useState({
     CheckSensitiveEnabled: false,
     CheckSensitiveOnPromptEnabled: false,
+    CheckSensitiveOnCompletionEnabled: false,
+    StopOnSensitiveEnabled: false,
     SensitiveWords: '',
   });
   const refForm = useRef();
@@ -114,6 +116,37 @@ export default function SettingsSensitiveWords(props) {
                   }
                 />
               </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'CheckSensitiveOnCompletionEnabled'}
+                  label={t('启用流式输出检查')}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={(value) =>
+                    setInputs((prevInputs) => ({
+                      ...(prevInputs || {}),
+                      CheckSensitiveOnCompletionEnabled: value,
+                    }))
+                  }
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'StopOnSensitiveEnabled'}
+                  label={t('输出命中屏蔽词时终止生成')}
+                  extraText={t('关闭时将屏蔽词替换为 **###**')}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={(value) =>
+                    setInputs((prevInputs) => ({
+                      ...(prevInputs || {}),
+                      StopOnSensitiveEnabled: value,
+                    }))
+                  }
+                />
+              </Col>
             </Row>
             <Row>
               <Col xs={24} sm={12} md={8} lg={8} xl={8}>
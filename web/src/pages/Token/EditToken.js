@@ -38,6 +38,13 @@ const EditToken = (props) => {
     model_limits: [],
     allow_ips: '',
     group: '',
+    daily_quota_limit: 0,
+    weekly_quota_limit: 0,
+    monthly_quota_limit: 0,
+    rpm_limit: 0,
+    tpm_limit: 0,
+    response_cache_enabled: false,
+    payload_capture_enabled: false,
   };
   const [inputs, setInputs] = useState(originInputs);
   const {
@@ -49,6 +56,13 @@ const EditToken = (props) => {
     model_limits,
     allow_ips,
     group,
+    daily_quota_limit,
+    weekly_quota_limit,
+    monthly_quota_limit,
+    rpm_limit,
+    tpm_limit,
+    response_cache_enabled,
+    payload_capture_enabled,
   } = inputs;
   // const [visible, setVisible] = useState(false);
   const [models, setModels] = useState([]);
@@ -169,12 +183,26 @@ const EditToken = (props) => {
     return result;
   };
 
+  // 额度与速率限制为空时按 0（不限制）处理
+  const parseLimits = (localInputs) => {
+    [
+      'daily_quota_limit',
+      'weekly_quota_limit',
+      'monthly_quota_limit',
+      'rpm_limit',
+      'tpm_limit',
+    ].forEach((key) => {
+      localInputs[key] = parseInt(localInputs[key]) || 0;
+    });
+  };
+
   const submit = async () => {
     setLoading(true);
     if (isEdit) {
       // 编辑令牌的逻辑保持不变
       let localInputs = { ...inputs };
       localInputs.remain_quota = parseInt(localInputs.remain_quota);
+      parseLimits(localInputs);
       if (localInputs.expired_time !== -1) {
         let time = Date.parse(localInputs.expired_time);
         if (isNaN(time)) {
@@ -207,6 +235,7 @@ const EditToken = (props) => {
           localInputs.name = `${inputs.name}-${generateRandomSuffix()}`;
         }
         localInputs.remain_quota = parseInt(localInputs.remain_quota);
+        parseLimits(localInputs);
 
         if (localInputs.expired_time !== -1) {
           let time = Date.parse(localInputs.expired_time);
@@ -398,6 +427,79 @@ const EditToken = (props) => {
             </Button>
           </div>
           <Divider />
+          <div style={{ marginTop: 10 }}>
+            <Typography.Text>
+              {t('时间窗口额度上限，0 表示不限制')}
+            </Typography.Text>
+          </div>
+          <Space style={{ marginTop: 8 }} wrap>
+            <Input
+              prefix={t('每日')}
+              type='number'
+              value={daily_quota_limit}
+              onChange={(value) => handleInputChange('daily_quota_limit', value)}
+            />
+            <Input
+              prefix={t('每周')}
+              type='number'
+              value={weekly_quota_limit}
+              onChange={(value) => handleInputChange('weekly_quota_limit', value)}
+            />
+            <Input
+              prefix={t('每月')}
+              type='number'
+              value={monthly_quota_limit}
+              onChange={(value) =>
+                handleInputChange('monthly_quota_limit', value)
+              }
+            />
+          </Space>
+          <div style={{ marginTop: 10 }}>
+            <Typography.Text>
+              {t('速率限制，0 表示不限制')}
+            </Typography.Text>
+          </div>
+          <Space style={{ marginTop: 8 }} wrap>
+            <Input
+              prefix='RPM'
+              type='number'
+              value={rpm_limit}
+              onChange={(value) => handleInputChange('rpm_limit', value)}
+            />
+            <Input
+              prefix='TPM'
+              type='number'
+              value={tpm_limit}
+              onChange={(value) => handleInputChange('tpm_limit', value)}
+            />
+          </Space>
+          <div style={{ marginTop: 10, display: 'flex' }}>
+            <Space>
+              <Checkbox
+                name='response_cache_enabled'
+                checked={response_cache_enabled}
+                onChange={(e) =>
+                  handleInputChange('response_cache_enabled', e.target.checked)
+                }
+              >
+                {t('启用响应缓存（temperature=0 的对话与嵌入请求）')}
+              </Checkbox>
+            </Space>
+          </div>
+          <div style={{ marginTop: 10, display: 'flex' }}>
+            <Space>
+              <Checkbox
+                name='payload_capture_enabled'
+                checked={payload_capture_enabled}
+                onChange={(e) =>
+                  handleInputChange('payload_capture_enabled', e.target.checked)
+                }
+              >
+                {t('留存请求与响应内容（需管理员开启内容留存，内容会按规则脱敏）')}
+              </Checkbox>
+            </Space>
+          </div>
+          <Divider />
           <div style={{ marginTop: 10 }}>
             <Typography.Text>
               {t('IP白名单（请勿过度信任此功能）')}
@@ -37,6 +37,8 @@ const TopUp = () => {
   const [isSubmitting, setIsSubmitting] = useState(false);
   const [open, setOpen] = useState(false);
   const [payWay, setPayWay] = useState('');
+  const [paymentProvider, setPaymentProvider] = useState('epay');
+  const [stripeCurrency, setStripeCurrency] = useState('usd');
 
   const topUp = async () => {
     if (redemptionCode === '') {
@@ -113,6 +115,11 @@ const TopUp = () => {
         if (message === 'success') {
           let params = data;
           let url = res.data.url;
+          // Stripe Checkout 没有表单参数，直接跳转
+          if (!params || Object.keys(params).length === 0) {
+            window.location.href = url;
+            return;
+          }
           let form = document.createElement('form');
           form.action = url;
           form.method = 'POST';
@@ -170,12 +177,21 @@ const TopUp = () => {
       if (status.enable_online_topup) {
         setEnableOnlineTopUp(status.enable_online_topup);
       }
+      if (status.payment_provider) {
+        setPaymentProvider(status.payment_provider);
+      }
+      if (status.stripe_currency) {
+        setStripeCurrency(status.stripe_currency);
+      }
     }
     getUserQuota().then();
   }, []);
 
   const renderAmount = () => {
     // console.log(amount);
+    if (paymentProvider === 'stripe') {
+      return amount + ' ' + stripeCurrency.toUpperCase();
+    }
     return amount + ' ' + t('元');
   };
 
@@ -298,29 +314,41 @@ const TopUp = () => {
                       await getAmount(value);
                     }}
                   />
-                  <Space>
-                    <Button
-                      type={'primary'}
-                      theme={'solid'}
-                      onClick={async () => {
-                        preTopUp('zfb');
-                      }}
-                    >
-                      {t('支付宝')}
-                    </Button>
+                  {paymentProvider === 'stripe' ? (
                     <Button
-                      style={{
-                        backgroundColor: 'rgba(var(--semi-green-5), 1)',
-                      }}
                       type={'primary'}
                       theme={'solid'}
                       onClick={async () => {
-                        preTopUp('wx');
+                        preTopUp('stripe');
                       }}
                     >
-                      {t('微信')}
+                      {t('在线支付')}
                     </Button>
-                  </Space>
+                  ) : (
+                    <Space>
+                      <Button
+                        type={'primary'}
+                        theme={'solid'}
+                        onClick={async () => {
+                          preTopUp('zfb');
+                        }}
+                      >
+                        {t('支付宝')}
+                      </Button>
+                      <Button
+                        style={{
+                          backgroundColor: 'rgba(var(--semi-green-5), 1)',
+                        }}
+                        type={'primary'}
+                        theme={'solid'}
+                        onClick={async () => {
+                          preTopUp('wx');
+                        }}
+                      >
+                        {t('微信')}
+                      </Button>
+                    </Space>
+                  )}
                 </Form>
               </div>
               {/*<div style={{ display: 'flex', justifyContent: 'right' }}>*/}